@@ -9,6 +9,8 @@ class CyberJianghu {
         this.currentMode = 'demo'; // 'demo' or 'live'
         this.currentStoryId = 'demo_story'; // Store the current story ID
         this.storyCreated = false; // Prevent duplicate story creation
+        this.tokenTotal = 0; // GLM tokens seen on this page, when the server total isn't sent
+        this.storyLanguage = new URLSearchParams(window.location.search).get('lang') || 'zh'; // ?lang=en for an English story
 
         this.init();
     }
@@ -94,11 +96,14 @@ class CyberJianghu {
                 headers: {
                     'Content-Type': 'application/json',
                 },
-                body: JSON.stringify({
+                // Other languages take the server's defaults for that language
+                body: JSON.stringify(this.storyLanguage === 'zh' ? {
                     genre: '武侠',
                     tone: '赛博',
                     style: '说书风',
                     protagonist: '玩家'
+                } : {
+                    language: this.storyLanguage
                 })
             });
 
@@ -129,6 +134,7 @@ class CyberJianghu {
             const text = data.story.text || data.story.content;
             this.updateStory(text);
             this.updateOptions(data.story.options || []);
+            this.updateTokenUsage(data.story.usage, data.story.state && data.story.state.token_usage);
 
             // Request and play audio for the story text
             this.playStoryAudio(text);
@@ -190,6 +196,16 @@ class CyberJianghu {
             case 'danmaku':
                 this.handleDanmaku(data);
                 break;
+            case 'gift':
+            case 'superchat':
+                this.handleGift(data);
+                break;
+            case 'enter':
+                this.handleEnter(data);
+                break;
+            case 'commands':
+                this.log(data.text, 'info');
+                break;
             case 'story':
                 this.handleStory(data);
                 break;
@@ -217,9 +233,28 @@ class CyberJianghu {
         }
     }
 
+    handleGift(data) {
+        const gift = data.data || {};
+        const username = gift.Username || '观众';
+        let content;
+        if (data.type === 'superchat') {
+            content = `<span class="danmaku-superchat">【醒目留言】${gift.Content}</span>`;
+        } else {
+            content = `<span class="danmaku-gift">赠送 ${gift.GiftName} x${gift.GiftCount || 1}</span>`;
+        }
+        this.displayDanmaku(username, content, data.type);
+    }
+
+    handleEnter(data) {
+        const viewer = data.data || {};
+        const content = `<span class="danmaku-enter">进入直播间</span>`;
+        this.displayDanmaku(viewer.Username || '观众', content, data.type);
+    }
+
     handleStory(data) {
         this.updateStory(data.text || data.content);
         this.updateOptions(data.options);
+        this.updateTokenUsage(data.usage);
         this.log('故事已更新', 'success');
     }
 
@@ -258,6 +293,21 @@ class CyberJianghu {
         }
     }
 
+    // Show the GLM tokens spent on the latest segment and in total; without a server
+    // total, the tokens seen since the page loaded are summed instead
+    updateTokenUsage(usage, total) {
+        const display = document.getElementById('token-usage');
+        if (!display || !usage) return;
+
+        if (total) {
+            this.tokenTotal = total.total_tokens || 0;
+        } else {
+            this.tokenTotal += usage.total_tokens || 0;
+        }
+        display.textContent = `本回合 ${usage.total_tokens || 0} tokens · 累计 ${this.tokenTotal}`;
+        display.style.display = '';
+    }
+
     updateStory(text) {
         const display = document.getElementById('story-display');
 
@@ -424,7 +474,8 @@ class CyberJianghu {
                 },
                 body: JSON.stringify({
                     text: textToSpeak,
-                    voice_id: 'narrator'
+                    voice_id: 'narrator',
+                    language: this.storyLanguage
                 })
             });
 
@@ -467,7 +518,7 @@ class CyberJianghu {
             return;
         }
 
-        this.log(`正在连接 ${platform} 直播间 ${roomId}...`, 'info');
+        this.log(`正在连接 ${platform || '自动识别'} 直播间 ${roomId}...`, 'info');
 
         try {
             const response = await fetch('/api/v1/live/connect', {
@@ -483,7 +534,13 @@ class CyberJianghu {
             });
 
             if (!response.ok) {
-                throw new Error(`HTTP ${response.status}`);
+                const failure = await response.json().catch(() => ({}));
+                const hints = {
+                    cookie_expired: 'Cookie 已失效，请重新获取 Cookie',
+                    room_offline: '直播间未开播',
+                    room_not_found: '直播间不存在，请检查房间号',
+                };
+                throw new Error(hints[failure.error_code] || failure.message || failure.error || `HTTP ${response.status}`);
             }
 
             const data = await response.json();
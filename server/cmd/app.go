@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"Cyber-Jianghu/server/internal/engine"
+	"Cyber-Jianghu/server/internal/rag"
+	"Cyber-Jianghu/server/internal/storage"
+	"Cyber-Jianghu/server/internal/web"
+)
+
+// App holds the running components that must be stopped together
+type App struct {
+	server       *http.Server
+	storyEngine  *engine.StoryEngine
+	services     *web.Services
+	mysqlStore   *storage.MySQLStore
+	redisStore   *storage.RedisStore
+	qdrantClient *rag.QdrantClient // Nil when Qdrant isn't used
+	logger       *slog.Logger
+
+	stopBackground context.CancelFunc // Stops background loops such as the danmaku cleaner and Qdrant reconnector
+}
+
+// Shutdown stops the app in dependency order: it stops taking requests, disconnects
+// from the live room, lets in-flight story and image generations finish until ctx ends,
+// saves active stories and finally stops background loops and closes the stores
+func (a *App) Shutdown(ctx context.Context) {
+	if err := a.server.Shutdown(ctx); err != nil {
+		a.logger.Warn("http server shutdown incomplete", "error", err)
+	}
+
+	if a.services != nil && a.services.LiveService != nil {
+		if err := a.services.LiveService.Disconnect(); err != nil {
+			a.logger.Warn("failed to disconnect live service", "error", err)
+		}
+	}
+
+	if a.storyEngine != nil {
+		report := a.storyEngine.Shutdown(ctx)
+		if len(report.Dropped) > 0 {
+			a.logger.Warn("stories not saved on shutdown", "story_ids", report.Dropped)
+		}
+	}
+
+	if a.services != nil && a.services.StoryHandlers != nil {
+		if err := a.services.StoryHandlers.Shutdown(ctx); err != nil {
+			a.logger.Warn("image generations abandoned", "error", err)
+		}
+	}
+
+	// Background loops use the stores, so they stop before the stores close
+	if a.stopBackground != nil {
+		a.stopBackground()
+	}
+	if a.qdrantClient != nil {
+		a.qdrantClient.Close()
+	}
+
+	if a.redisStore != nil {
+		if err := a.redisStore.Close(); err != nil {
+			a.logger.Warn("failed to close redis", "error", err)
+		}
+	}
+	if a.mysqlStore != nil {
+		if err := a.mysqlStore.Close(); err != nil {
+			a.logger.Warn("failed to close mysql", "error", err)
+		}
+	}
+}
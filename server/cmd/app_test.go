@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+func TestShutdownStopsQdrantReconnector(t *testing.T) {
+	var probes atomic.Int32
+	qdrant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		io.WriteString(w, "healthz check passed")
+	}))
+	defer qdrant.Close()
+
+	host, portText, _ := net.SplitHostPort(qdrant.Listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	client := rag.NewQdrantClient(host, port, "")
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	stopped := make(chan struct{})
+	go func() {
+		client.StartReconnector(backgroundCtx, 10*time.Millisecond)
+		close(stopped)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for probes.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("reconnector never probed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	app := &App{
+		server:         &http.Server{},
+		qdrantClient:   client,
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stopBackground: stopBackground,
+	}
+	app.Shutdown(context.Background())
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Qdrant reconnector still running after Shutdown")
+	}
+	if client.Connected() {
+		t.Error("Qdrant client still marked connected after Shutdown")
+	}
+}
+
+func TestSelectVectorBackendFallsBackToMemory(t *testing.T) {
+	vectors := selectVectorBackend(nil, 64)
+	if _, ok := vectors.(*rag.InMemoryVectorStore); !ok {
+		t.Fatalf("backend without Qdrant = %T, want *rag.InMemoryVectorStore", vectors)
+	}
+	// The engine can be built on it and stores memories
+	if err := vectors.InsertPoints(context.Background(), "story_memories", []*rag.Point{{ID: "m1", Vector: make([]float64, 64)}}); err != nil {
+		t.Errorf("InsertPoints on the fallback store: %v", err)
+	}
+}
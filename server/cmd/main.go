@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,6 +16,7 @@ import (
 	"Cyber-Jianghu/server/internal/engine"
 	"Cyber-Jianghu/server/internal/generators"
 	"Cyber-Jianghu/server/internal/infra"
+	"Cyber-Jianghu/server/internal/logging"
 	"Cyber-Jianghu/server/internal/rag"
 	"Cyber-Jianghu/server/internal/storage"
 	"Cyber-Jianghu/server/internal/web"
@@ -27,14 +29,32 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Structured logging; plain log calls are routed through it as well
+	logger, logCloser, err := logging.Init(cfg.Logging)
+	if err != nil {
+		log.Printf("Warning: Invalid logging config, using defaults: %v", err)
+		logger = slog.Default()
+	} else {
+		defer logCloser.Close()
+	}
+
+	// Background loops run until App.Shutdown cancels this context
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
 	// Initialize storage connections
 	mysqlStore, err := storage.NewMySQLStore(cfg.Database.MySQL)
 	if err != nil {
 		log.Printf("Warning: Failed to connect to MySQL: %v", err)
 		mysqlStore = nil
 	} else {
-		defer mysqlStore.Close()
 		log.Println("MySQL connected successfully")
+
+		// Periodically purge archived danmaku past the retention window
+		if cfg.Live.Archive.Enabled && cfg.Live.Archive.RetentionDays > 0 {
+			retention := time.Duration(cfg.Live.Archive.RetentionDays) * 24 * time.Hour
+			go mysqlStore.StartDanmakuCleaner(backgroundCtx, retention, time.Hour)
+		}
 	}
 
 	redisStore, err := storage.NewRedisStore(cfg.Database.Redis)
@@ -42,7 +62,6 @@ func main() {
 		log.Printf("Warning: Failed to connect to Redis: %v", err)
 		redisStore = nil
 	} else {
-		defer redisStore.Close()
 		log.Println("Redis connected successfully")
 	}
 
@@ -56,9 +75,12 @@ func main() {
 		log.Println("Warning: No ZhipuAI API key provided. Some features may not work.")
 	}
 
+	// Replay mode runs the engine offline from recorded GLM replies
+	replay := cfg.AI.Replay.Fixture != ""
+
 	// Initialize Qdrant client
 	var qdrantClient *rag.QdrantClient
-	if apiKey != "" {
+	if apiKey != "" && !replay {
 		qdrantHost := cfg.Database.Qdrant.Host
 		if qdrantHost == "" {
 			qdrantHost = "localhost"
@@ -67,31 +89,79 @@ func main() {
 		if qdrantPort == 0 {
 			qdrantPort = 6333
 		}
-		var err error
-		qdrantClient, err = rag.NewQdrantClient(qdrantHost, qdrantPort, cfg.Database.Qdrant.APIKey)
-		if err != nil {
-			log.Printf("Warning: Failed to connect to Qdrant: %v", err)
-		} else {
+		qdrantClient = rag.NewQdrantClient(qdrantHost, qdrantPort, cfg.Database.Qdrant.APIKey,
+			rag.WithConnectRetry(cfg.Database.Qdrant.ConnectRetry), rag.WithLogger(logger))
+		if qdrantClient.Connected() {
 			log.Println("Qdrant connected successfully")
-			// Initialize collections
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			if err := qdrantClient.InitializeCollections(ctx); err != nil {
-				log.Printf("Warning: Failed to initialize Qdrant collections: %v", err)
-			}
-			cancel()
+		} else {
+			log.Println("Warning: Qdrant not reachable yet, will keep reconnecting")
+		}
+		// Also brings up a client that started disconnected
+		go qdrantClient.StartReconnector(backgroundCtx, cfg.Database.Qdrant.ReconnectInterval)
+		// Initialize collections
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := qdrantClient.InitializeCollections(ctx, cfg.Database.Qdrant.VectorSize, cfg.Database.Qdrant.Distance, cfg.Database.Qdrant.Distances); err != nil {
+			log.Printf("Warning: Failed to initialize Qdrant collections: %v", err)
 		}
+		cancel()
 	}
 
 	// Create cache directories
 	baseDir := "./data"
 	audioCacheDir := filepath.Join(baseDir, "audio_cache")
 	_ = os.MkdirAll(audioCacheDir, 0755)
+	embeddingCacheDir := filepath.Join(baseDir, "embedding_cache")
 
 	// Initialize StoryEngine
-	var storyEngine *engine.StoryEngine
-	if qdrantClient != nil {
-		storyEngine = engine.NewStoryEngine(apiKey, qdrantClient, audioCacheDir)
-		log.Println("StoryEngine initialized successfully")
+	if qdrantClient == nil && !replay {
+		log.Println("Warning: Qdrant unavailable, using the in-memory vector store; story memories will not survive a restart")
+	}
+	vectors := selectVectorBackend(qdrantClient, cfg.Database.Qdrant.VectorSize)
+	storyEngine := engine.NewStoryEngine(apiKey, vectors, audioCacheDir, embeddingCacheDir, cfg.AI.GLM5)
+	storyEngine.SetLogger(logger)
+	storyEngine.SetEmbeddingModel(cfg.AI.Embedding.Model)
+	log.Println("StoryEngine initialized successfully")
+
+	if replay {
+		chatClient, err := engine.LoadReplayChatClient(cfg.AI.Replay.Fixture)
+		if err != nil {
+			log.Fatalf("Failed to load replay fixture: %v", err)
+		}
+		storyEngine.SetChatClient(chatClient)
+		storyEngine.SetEmbedder(rag.NewHashEmbedder(cfg.Database.Qdrant.VectorSize))
+		storyEngine.SetTTSProvider(generators.NewNoopTTSProvider())
+		log.Printf("Replay mode: GLM replies from %s, stub images and audio", cfg.AI.Replay.Fixture)
+	}
+
+	if mysqlStore != nil {
+		storyEngine.SetMySQLStore(mysqlStore)
+	}
+	if cfg.AI.GLM5.MaxInputTokens != 0 {
+		storyEngine.SetMaxInputTokens(cfg.AI.GLM5.MaxInputTokens)
+	}
+	storyEngine.SetStructuredOutput(cfg.AI.GLM5.StructuredOutput)
+	storyEngine.SetAudioMemoryBudget(config.Megabytes(cfg.Cache.AudioMemoryMB))
+	storyEngine.SetAudioCacheMaxSize(config.Megabytes(cfg.Cache.AudioMaxSizeMB))
+	storyEngine.SetContentFilter(engine.NewContentFilter(cfg.AI.ContentFilter.BannedTerms, cfg.AI.ContentFilter.Mode))
+	for language, terms := range cfg.AI.ContentFilter.Languages {
+		storyEngine.SetLanguageContentFilter(language, engine.NewContentFilter(terms, cfg.AI.ContentFilter.Mode))
+	}
+	if cfg.Memory.SummaryInterval != 0 {
+		storyEngine.SetSummaryInterval(cfg.Memory.SummaryInterval)
+	}
+	storyEngine.SetMemoryWriteBuffer(cfg.Memory.WriteBatchSize, cfg.Memory.WriteFlushInterval)
+	if cfg.AI.Prompts.Dir != "" {
+		if err := storyEngine.LoadTemplateDir(context.Background(), cfg.AI.Prompts.Dir, cfg.AI.Prompts.ReloadInterval); err != nil {
+			log.Printf("Warning: Failed to load prompt templates: %v", err)
+		}
+	}
+	if cfg.AI.Translation.Enabled {
+		storyEngine.EnableTranslation(cfg.AI.Translation.Model)
+		log.Println("Danmaku translation enabled")
+	}
+	if cfg.AI.ImageTranslation.Enabled {
+		storyEngine.EnableImagePromptTranslation(cfg.AI.ImageTranslation.Model)
+		log.Println("Image prompt translation enabled")
 	}
 
 	// Initialize AIGC components
@@ -105,19 +175,40 @@ func main() {
 	_ = os.MkdirAll(loraDir, 0755)
 	loraRegistry := generators.NewLoRARegistry(loraDir)
 	_ = loraRegistry.LoadModels(context.Background())
+	go loraRegistry.StartVerifier(backgroundCtx, 5*time.Minute)
+
+	voiceDir := filepath.Join("./data", "voices")
+	_ = os.MkdirAll(voiceDir, 0755)
+	voiceRegistry := generators.NewVoiceRegistry(voiceDir)
+	if err := voiceRegistry.LoadVoices(context.Background()); err != nil {
+		log.Printf("Failed to load voices: %v", err)
+	} else {
+		stats := voiceRegistry.GetStats()
+		log.Printf("Loaded %d voices (%d with reference audio)", stats.TotalCount, stats.ReferenceCount)
+	}
+
+	storyEngine.SetLoRARegistry(loraRegistry)
+	storyEngine.SetVoiceRegistry(voiceRegistry)
 
 	// Initialize ComfyUI Manager
 	var comfyuiManager *infra.ComfyUIManager
 	comfyuiCfg := &infra.ComfyUIManagerConfig{
 		Host:     "127.0.0.1",
 		Port:     8188,
-		ModelsDir: "D:\\ComfyUI",
 		UseGPU:   true,
+		LogDir:   filepath.Join("./data", "logs"),
+		CondaEnvPath: cfg.AI.ComfyUI.CondaEnvPath,
+		PythonPath:   cfg.AI.ComfyUI.PythonPath,
+		RootDir:      cfg.AI.ComfyUI.RootDir,
 	}
 	comfyuiManager = infra.NewComfyUIManager(comfyuiCfg)
 
 	// Create router with story engine integration
-	r := web.NewRouter(cfg, storyEngine, redisStore, comfyuiManager)
+	r, services := web.NewRouter(cfg, storyEngine, redisStore, mysqlStore, comfyuiManager, loraRegistry, voiceRegistry, logger)
+	services.Health.Register("qdrant", nil)
+	if qdrantClient != nil {
+		services.Health.Register("qdrant", qdrantClient.HealthCheck)
+	}
 
 	// Create HTTP server
 	server := &http.Server{
@@ -146,9 +237,26 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+	app := &App{
+		server:         server,
+		storyEngine:    storyEngine,
+		services:       services,
+		mysqlStore:     mysqlStore,
+		redisStore:     redisStore,
+		qdrantClient:   qdrantClient,
+		logger:         logger,
+		stopBackground: stopBackground,
 	}
+	app.Shutdown(ctx)
 
 	log.Println("Server stopped")
 }
+
+// selectVectorBackend returns the Qdrant client when there is one, otherwise an in-memory
+// store so the story engine still runs without Qdrant
+func selectVectorBackend(qdrantClient *rag.QdrantClient, vectorSize int) rag.VectorBackend {
+	if qdrantClient != nil {
+		return qdrantClient
+	}
+	return rag.NewInMemoryVectorStore(vectorSize)
+}
@@ -1,16 +1,21 @@
 package adapters
 
 import (
+	"Cyber-Jianghu/server/internal/backpressure"
 	"Cyber-Jianghu/server/internal/interfaces"
+	"bytes"
+	"compress/zlib"
 	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/gorilla/websocket"
 	"go.uber.org/atomic"
 )
@@ -19,31 +24,46 @@ import (
 type BilibiliAdapter struct {
 	conn          *websocket.Conn
 	danmakuChan   chan interfaces.Danmaku
+	ingest        *backpressure.Gate // Sheds and counts danmaku when danmakuChan backs up
 	roomID        string
 	cookie        string
 	connected     atomic.Bool
+	reconnecting  atomic.Bool
+	attempts      atomic.Int32
 	mu            sync.Mutex
 	cancel        context.CancelFunc
-	heartbeatDone chan struct{}
+	closeOnce     sync.Once
 	parser        *DanmakuParser
 
+	maxReconnectAttempts int
+
 	// Phase 7: Deduplication and filtering
-	recentDanmaku map[string]int64 // Map content -> timestamp
-	dedupWindow   int64           // Time window for deduplication (seconds)
-	filterKeywords []string         // Keywords to filter
-	lastDedupTime int64           // Last dedup cleanup time
-	dedupMu       sync.RWMutex    // Mutex for deduplication
+	deduper       *DanmakuDeduper
+
+	logger *slog.Logger
 }
 
 // Bilibili message protocol constants
 const (
 	protocolVersion    = 1
+	protoverZlib       = 2 // Body is a zlib-compressed sequence of packets
+	protoverBrotli     = 3 // Body is a brotli-compressed sequence of packets
 	operationHeartbeat = 2
 	operationMessage   = 5
 	operationAuth      = 7
 	headerLength       = 16
 )
 
+// DefaultDanmakuBuffer is the capacity of an adapter's danmaku channel
+const DefaultDanmakuBuffer = 1000
+
+// Reconnect backoff settings
+const (
+	defaultMaxReconnectAttempts = 10
+	reconnectBaseDelay          = 1 * time.Second
+	reconnectMaxDelay           = 60 * time.Second
+)
+
 // bilibiliMessage represents the Bilibili WebSocket message format
 type bilibiliMessage struct {
 	PacketLength uint32
@@ -69,10 +89,29 @@ type bilibiliAuthResponse struct {
 // NewBilibiliAdapter creates a new Bilibili live adapter
 func NewBilibiliAdapter() *BilibiliAdapter {
 	return &BilibiliAdapter{
-		danmakuChan:   make(chan interfaces.Danmaku, 1000),
-		recentDanmaku: make(map[string]int64, 5000),
-		dedupWindow:   60, // 60 seconds dedup window
-		filterKeywords: []string{}, // Can be configured
+		danmakuChan:   make(chan interfaces.Danmaku, DefaultDanmakuBuffer),
+		ingest:        backpressure.NewGate("adapter_ingest", 1, nil),
+		deduper:       NewDanmakuDeduper(),
+		maxReconnectAttempts: defaultMaxReconnectAttempts,
+		logger:        slog.Default().With("component", "bilibili"),
+	}
+}
+
+// SetLogger sets the structured logger; call it before Connect
+func (b *BilibiliAdapter) SetLogger(logger *slog.Logger) {
+	b.logger = logger.With("component", "bilibili")
+}
+
+// SetBackpressure sets the danmaku channel capacity (0 keeps the default) and the gate
+// that counts and sheds danmaku when it backs up; call it before Connect
+func (b *BilibiliAdapter) SetBackpressure(capacity int, gate *backpressure.Gate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if capacity > 0 {
+		b.danmakuChan = make(chan interfaces.Danmaku, capacity)
+	}
+	if gate != nil {
+		b.ingest = gate
 	}
 }
 
@@ -83,6 +122,13 @@ func (b *BilibiliAdapter) SetParser(parser *DanmakuParser) {
 	b.parser = parser
 }
 
+// SetMaxReconnectAttempts sets how many times a dropped connection is re-dialed before giving up
+func (b *BilibiliAdapter) SetMaxReconnectAttempts(attempts int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxReconnectAttempts = attempts
+}
+
 // Connect establishes connection to Bilibili live platform
 func (b *BilibiliAdapter) Connect(ctx context.Context, opts *interfaces.ConnectOptions) error {
 	b.mu.Lock()
@@ -90,14 +136,29 @@ func (b *BilibiliAdapter) Connect(ctx context.Context, opts *interfaces.ConnectO
 
 	b.roomID = opts.RoomID
 	b.cookie = opts.Cookie
-	b.heartbeatDone = make(chan struct{})
 
 	ctx, b.cancel = context.WithCancel(ctx)
 
+	conn, err := b.dial(ctx)
+	if err != nil {
+		b.cancel()
+		return err
+	}
+	b.conn = conn
+	b.connected.Store(true)
+
+	// The supervisor owns the connection from here on and re-dials when it drops
+	go b.supervise(ctx, conn)
+
+	return nil
+}
+
+// dial fetches room info, opens the WebSocket and authenticates
+func (b *BilibiliAdapter) dial(ctx context.Context) (*websocket.Conn, error) {
 	// Get live room info
 	host, port, token, err := b.getRoomInfo(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get room info: %w", err)
+		return nil, fmt.Errorf("failed to get room info: %w", err)
 	}
 
 	// Connect to WebSocket
@@ -109,25 +170,115 @@ func (b *BilibiliAdapter) Connect(ctx context.Context, opts *interfaces.ConnectO
 		"Referer":     {fmt.Sprintf("https://live.bilibili.com/%s", b.roomID)},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to connect to WebSocket: %w", err)
+		return nil, fmt.Errorf("failed to connect to WebSocket: %w", err)
 	}
-	b.conn = conn
 
 	// Send auth packet
-	if err := b.sendAuth(token); err != nil {
+	if err := b.sendAuth(conn, token); err != nil {
 		conn.Close()
-		return fmt.Errorf("failed to send auth: %w", err)
+		return nil, fmt.Errorf("failed to send auth: %w", err)
 	}
 
-	b.connected.Store(true)
+	return conn, nil
+}
 
-	// Start reading messages
-	go b.readMessages(ctx)
+// supervise runs a connection until it drops, then re-dials with capped exponential backoff.
+// danmakuChan stays open across reconnects and is closed only when the supervisor exits,
+// so no send can race with the close.
+func (b *BilibiliAdapter) supervise(ctx context.Context, conn *websocket.Conn) {
+	defer b.closeDanmaku()
 
-	// Start heartbeat
-	go b.heartbeat(ctx)
+	for {
+		b.run(ctx, conn)
+		b.connected.Store(false)
 
-	return nil
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.logger.Warn("connection lost, reconnecting", "room_id", b.roomID)
+		var err error
+		conn, err = b.reconnect(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				b.logger.Error("giving up on room", "room_id", b.roomID, "error", err)
+			}
+			return
+		}
+
+		b.mu.Lock()
+		b.conn = conn
+		b.mu.Unlock()
+		b.connected.Store(true)
+		b.logger.Info("reconnected", "room_id", b.roomID)
+	}
+}
+
+// run reads from one connection until it fails or ctx is cancelled.
+// Its heartbeat goroutine has exited by the time run returns.
+func (b *BilibiliAdapter) run(ctx context.Context, conn *websocket.Conn) {
+	connCtx, cancel := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+
+	go func() {
+		defer close(heartbeatDone)
+		b.heartbeat(connCtx, conn)
+	}()
+
+	// Unblock ReadMessage when the adapter is disconnected
+	go func() {
+		<-connCtx.Done()
+		conn.Close()
+	}()
+
+	b.readMessages(connCtx, conn)
+	cancel()
+	<-heartbeatDone
+}
+
+// reconnect re-dials until it succeeds, ctx is cancelled or the attempts run out
+func (b *BilibiliAdapter) reconnect(ctx context.Context) (*websocket.Conn, error) {
+	b.mu.Lock()
+	maxAttempts := b.maxReconnectAttempts
+	b.mu.Unlock()
+
+	b.reconnecting.Store(true)
+	defer func() {
+		b.reconnecting.Store(false)
+		b.attempts.Store(0)
+	}()
+
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		b.attempts.Store(int32(attempt))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(reconnectDelay(attempt)):
+		}
+
+		conn, err := b.dial(ctx)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		b.logger.Warn("reconnect attempt failed", "room_id", b.roomID, "attempt", attempt, "max_attempts", maxAttempts, "error", err)
+	}
+
+	return nil, fmt.Errorf("reconnect failed after %d attempts: %w", maxAttempts, lastErr)
+}
+
+// reconnectDelay returns the backoff before the given 1-based attempt
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectBaseDelay
+	for i := 1; i < attempt && delay < reconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+	return delay
 }
 
 // getRoomInfo retrieves live room connection info
@@ -161,21 +312,21 @@ func (b *BilibiliAdapter) getRoomInfo(ctx context.Context) (host string, port in
 }
 
 // sendAuth sends authentication packet
-func (b *BilibiliAdapter) sendAuth(token string) error {
+func (b *BilibiliAdapter) sendAuth(conn *websocket.Conn, token string) error {
 	authJSON := map[string]interface{}{
 		"uid":         0,
 		"roomid":      b.roomID,
-		"protover":    3,
+		"protover":    protoverBrotli,
 		"platform":    "web",
 		"type":        2,
 		"key":         token,
 	}
 	body, _ := json.Marshal(authJSON)
-	return b.sendMessage(operationAuth, body)
+	return b.sendMessage(conn, operationAuth, body)
 }
 
 // sendMessage sends a message with Bilibili protocol
-func (b *BilibiliAdapter) sendMessage(op uint32, body []byte) error {
+func (b *BilibiliAdapter) sendMessage(conn *websocket.Conn, op uint32, body []byte) error {
 	totalLen := headerLength + len(body)
 
 	msg := bilibiliMessage{
@@ -206,22 +357,20 @@ func (b *BilibiliAdapter) sendMessage(op uint32, body []byte) error {
 	buf[15] = byte(msg.SequenceID)
 	copy(buf[headerLength:], msg.Body)
 
-	return b.conn.WriteMessage(websocket.BinaryMessage, buf)
+	return conn.WriteMessage(websocket.BinaryMessage, buf)
 }
 
-// readMessages reads messages from WebSocket
-func (b *BilibiliAdapter) readMessages(ctx context.Context) {
-	defer b.close()
-
+// readMessages reads messages from WebSocket until the connection fails
+func (b *BilibiliAdapter) readMessages(ctx context.Context, conn *websocket.Conn) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			_, data, err := b.conn.ReadMessage()
+			_, data, err := conn.ReadMessage()
 			if err != nil {
-				if err != io.EOF && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					// Log error
+				if ctx.Err() == nil && err != io.EOF && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					b.logger.Warn("read error", "room_id", b.roomID, "error", err)
 				}
 				return
 			}
@@ -231,7 +380,7 @@ func (b *BilibiliAdapter) readMessages(ctx context.Context) {
 	}
 }
 
-// handleMessage processes incoming messages
+// handleMessage processes incoming messages, unpacking compressed packet sequences
 func (b *BilibiliAdapter) handleMessage(data []byte) {
 	offset := 0
 	for offset < len(data) {
@@ -240,22 +389,55 @@ func (b *BilibiliAdapter) handleMessage(data []byte) {
 		}
 
 		packetLen := binary.BigEndian.Uint32(data[offset : offset+4])
-		_ = binary.BigEndian.Uint16(data[offset+4 : offset+6]) // headerLen - unused
+		headerLen := binary.BigEndian.Uint16(data[offset+4 : offset+6])
+		protover := binary.BigEndian.Uint16(data[offset+6 : offset+8])
 		operation := binary.BigEndian.Uint32(data[offset+8 : offset+12])
 
-		if packetLen < headerLength {
+		if packetLen < headerLength || offset+int(packetLen) > len(data) || int(headerLen) > int(packetLen) {
 			break
 		}
 
 		if operation == operationMessage {
-			body := data[offset+headerLength : offset+int(packetLen)]
-			b.parseDanmaku(body)
+			body := data[offset+int(headerLen) : offset+int(packetLen)]
+			switch protover {
+			case protoverZlib:
+				inner, err := inflateZlib(body)
+				if err != nil {
+					b.logger.Warn("failed to inflate zlib packet", "room_id", b.roomID, "error", err)
+					break
+				}
+				b.handleMessage(inner)
+			case protoverBrotli:
+				inner, err := decodeBrotli(body)
+				if err != nil {
+					b.logger.Warn("failed to decode brotli packet", "room_id", b.roomID, "error", err)
+					break
+				}
+				b.handleMessage(inner)
+			default:
+				b.parseDanmaku(body)
+			}
 		}
 
 		offset += int(packetLen)
 	}
 }
 
+// inflateZlib decompresses a zlib-compressed packet body
+func inflateZlib(body []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// decodeBrotli decompresses a brotli-compressed packet body
+func decodeBrotli(body []byte) ([]byte, error) {
+	return io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+}
+
 // parseDanmaku parses danmaku from message body
 func (b *BilibiliAdapter) parseDanmaku(body []byte) {
 	// Bilibili uses a custom JSON format for danmaku
@@ -269,8 +451,15 @@ func (b *BilibiliAdapter) parseDanmaku(body []byte) {
 			var msg struct {
 				Cmd string `json:"cmd"`
 				Info []interface{} `json:"info"`
+				Data json.RawMessage `json:"data"`
 			}
-			if err := json.Unmarshal(body, &msg); err == nil && msg.Cmd == "DANMU_MSG" {
+			if err := json.Unmarshal(body, &msg); err == nil && msg.Cmd == "SEND_GIFT" {
+				b.parseGift(msg.Data)
+			} else if err == nil && msg.Cmd == "SUPER_CHAT_MESSAGE" {
+				b.parseSuperChat(msg.Data)
+			} else if err == nil && msg.Cmd == "INTERACT_WORD" {
+				b.parseInteract(msg.Data)
+			} else if err == nil && msg.Cmd == "DANMU_MSG" {
 				if len(msg.Info) > 0 {
 					// info is a mixed array, need to parse carefully
 					// info[0] typically contains danmaku text
@@ -297,7 +486,7 @@ func (b *BilibiliAdapter) parseDanmaku(body []byte) {
 						}
 					}
 
-					if danmakuText != "" && b.shouldSendDanmaku(danmakuText) {
+					if danmakuText != "" && b.deduper.Allow(danmakuText) {
 						danmaku := interfaces.Danmaku{
 							Username:  username,
 							UserID:    uid,
@@ -306,16 +495,10 @@ func (b *BilibiliAdapter) parseDanmaku(body []byte) {
 							IsVip:     false,
 							IsAdmin:   false,
 							GiftValue: 0,
+							Kind:      interfaces.DanmakuChat,
 						}
 
-						// Record danmaku for deduplication
-						b.recordDanmaku(danmakuText)
-
-						select {
-						case b.danmakuChan <- danmaku:
-						default:
-							// Channel full, drop message
-						}
+						b.emit(danmaku)
 					}
 				}
 			}
@@ -323,57 +506,119 @@ func (b *BilibiliAdapter) parseDanmaku(body []byte) {
 	}
 }
 
-// shouldSendDanmaku checks if danmaku should be sent (deduplication + filtering)
-func (b *BilibiliAdapter) shouldSendDanmaku(text string) bool {
-	b.dedupMu.Lock()
-	defer b.dedupMu.Unlock()
-
-	// Clean up old entries periodically
-	now := time.Now().Unix()
-	if now-b.lastDedupTime > 300 { // Every 5 minutes
-		b.cleanupOldDanmaku(now)
-		b.lastDedupTime = now
+// parseGift parses a SEND_GIFT message into a content-less danmaku carrying the gift.
+// Gifts bypass the deduper, since repeated gifts are all meaningful.
+func (b *BilibiliAdapter) parseGift(data []byte) {
+	var gift struct {
+		UID       int64  `json:"uid"`
+		Uname     string `json:"uname"`
+		GiftName  string `json:"giftName"`
+		Num       int    `json:"num"`
+		CoinType  string `json:"coin_type"`
+		TotalCoin int    `json:"total_coin"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &gift); err != nil {
+		return
 	}
 
-	// Check for duplicates
-	if lastSeen, exists := b.recentDanmaku[text]; exists {
-		if now-lastSeen < b.dedupWindow {
-			return false // Duplicate within window
-		}
+	// Silver (free) gifts are still shown but carry no weight
+	giftValue := 0
+	if gift.CoinType == "gold" {
+		giftValue = gift.TotalCoin
 	}
 
-	// Check for filtered keywords
-	for _, keyword := range b.filterKeywords {
-		if contains(text, keyword) {
-			return false
-		}
+	timestamp := gift.Timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
 	}
 
-	return true
+	b.emit(interfaces.Danmaku{
+		Username:  gift.Uname,
+		UserID:    fmt.Sprintf("%d", gift.UID),
+		Timestamp: timestamp,
+		GiftValue: giftValue,
+		GiftName:  gift.GiftName,
+		GiftCount: gift.Num,
+		Kind:      interfaces.DanmakuGift,
+	})
 }
 
-// recordDanmaku records a danmaku for deduplication
-func (b *BilibiliAdapter) recordDanmaku(text string) {
-	b.dedupMu.Lock()
-	defer b.dedupMu.Unlock()
+// parseSuperChat parses a SUPER_CHAT_MESSAGE (醒目留言) into a highlighted danmaku
+func (b *BilibiliAdapter) parseSuperChat(data []byte) {
+	var sc struct {
+		UID      int64  `json:"uid"`
+		Message  string `json:"message"`
+		Price    int    `json:"price"` // RMB
+		Time     int64  `json:"start_time"`
+		UserInfo struct {
+			Uname string `json:"uname"`
+		} `json:"user_info"`
+	}
+	if err := json.Unmarshal(data, &sc); err != nil || sc.Message == "" {
+		return
+	}
+
+	timestamp := sc.Time
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
+	}
 
-	b.recentDanmaku[text] = time.Now().Unix()
+	b.emit(interfaces.Danmaku{
+		Username:  sc.UserInfo.Uname,
+		UserID:    fmt.Sprintf("%d", sc.UID),
+		Content:   sc.Message,
+		Timestamp: timestamp,
+		IsVip:     true,
+		GiftValue: sc.Price * 1000, // 1 RMB = 1000 金瓜子
+		GiftCount: 1,
+		Kind:      interfaces.DanmakuSuperChat,
+	})
 }
 
-// cleanupOldDanmaku removes old danmaku entries
-func (b *BilibiliAdapter) cleanupOldDanmaku(now int64) {
-	for text, timestamp := range b.recentDanmaku {
-		if now-timestamp > b.dedupWindow {
-			delete(b.recentDanmaku, text)
-		}
+// bilibiliInteractEnter is the INTERACT_WORD msg_type for a viewer entering the room
+const bilibiliInteractEnter = 1
+
+// parseInteract parses an INTERACT_WORD message, emitting room entries only.
+// Follows and shares arrive on the same command and are ignored.
+func (b *BilibiliAdapter) parseInteract(data []byte) {
+	var interact struct {
+		UID       int64  `json:"uid"`
+		Uname     string `json:"uname"`
+		MsgType   int    `json:"msg_type"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &interact); err != nil || interact.MsgType != bilibiliInteractEnter {
+		return
 	}
+
+	timestamp := interact.Timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
+	}
+
+	b.emit(interfaces.Danmaku{
+		Username:  interact.Uname,
+		UserID:    fmt.Sprintf("%d", interact.UID),
+		Timestamp: timestamp,
+		Kind:      interfaces.DanmakuEnter,
+	})
+}
+
+// emit sends a danmaku downstream without blocking the read loop; under overload the
+// ingest gate sheds chat before gifts
+func (b *BilibiliAdapter) emit(danmaku interfaces.Danmaku) {
+	backpressure.Send(b.ingest, b.danmakuChan, danmaku, danmaku.IsPaid())
 }
 
 // SetFilterKeywords sets keywords to filter
 func (b *BilibiliAdapter) SetFilterKeywords(keywords []string) {
-	b.dedupMu.Lock()
-	defer b.dedupMu.Unlock()
-	b.filterKeywords = keywords
+	b.deduper.SetFilterKeywords(keywords)
+}
+
+// SetDedupWindow sets the deduplication window
+func (b *BilibiliAdapter) SetDedupWindow(window time.Duration) {
+	b.deduper.SetWindow(window)
 }
 
 // contains checks if a string contains a substring (case-insensitive)
@@ -392,7 +637,7 @@ func findSubstring(s, substr string) int {
 }
 
 // heartbeat sends periodic heartbeat messages
-func (b *BilibiliAdapter) heartbeat(ctx context.Context) {
+func (b *BilibiliAdapter) heartbeat(ctx context.Context, conn *websocket.Conn) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
@@ -401,7 +646,7 @@ func (b *BilibiliAdapter) heartbeat(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if err := b.sendMessage(operationHeartbeat, nil); err != nil {
+			if err := b.sendMessage(conn, operationHeartbeat, nil); err != nil {
 				return
 			}
 		}
@@ -410,7 +655,7 @@ func (b *BilibiliAdapter) heartbeat(ctx context.Context) {
 
 // SubscribeDanmaku returns a channel for receiving danmaku messages
 func (b *BilibiliAdapter) SubscribeDanmaku(ctx context.Context) (<-chan interfaces.Danmaku, error) {
-	if !b.connected.Load() {
+	if !b.connected.Load() && !b.reconnecting.Load() {
 		return nil, fmt.Errorf("not connected")
 	}
 	return b.danmakuChan, nil
@@ -425,39 +670,39 @@ func (b *BilibiliAdapter) SendChat(ctx context.Context, msg string) error {
 
 // HealthCheck checks if the connection is still alive
 func (b *BilibiliAdapter) HealthCheck(ctx context.Context) error {
+	if b.reconnecting.Load() {
+		return fmt.Errorf("reconnecting (attempt %d)", b.attempts.Load())
+	}
 	if !b.connected.Load() {
 		return fmt.Errorf("not connected")
 	}
 	return nil
 }
 
-// Disconnect closes the connection
+// Disconnect closes the connection and stops any reconnect in progress
 func (b *BilibiliAdapter) Disconnect() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if !b.connected.Load() {
+	if b.cancel == nil {
 		return nil
 	}
 
-	if b.cancel != nil {
-		b.cancel()
-	}
+	b.cancel()
+	b.cancel = nil
 
 	if b.conn != nil {
 		b.conn.Close()
 	}
 
 	b.connected.Store(false)
-	close(b.danmakuChan)
 
 	return nil
 }
 
-// close internal cleanup
-func (b *BilibiliAdapter) close() {
-	b.connected.Store(false)
-	if b.heartbeatDone != nil {
-		close(b.heartbeatDone)
-	}
+// closeDanmaku closes the danmaku channel exactly once
+func (b *BilibiliAdapter) closeDanmaku() {
+	b.closeOnce.Do(func() {
+		close(b.danmakuChan)
+	})
 }
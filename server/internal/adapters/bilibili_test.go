@@ -0,0 +1,144 @@
+package adapters
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
+)
+
+// bilibiliPacket frames a body with the 16-byte Bilibili packet header
+func bilibiliPacket(protover uint16, operation uint32, body []byte) []byte {
+	packet := make([]byte, headerLength+len(body))
+	binary.BigEndian.PutUint32(packet[0:4], uint32(len(packet)))
+	binary.BigEndian.PutUint16(packet[4:6], headerLength)
+	binary.BigEndian.PutUint16(packet[6:8], protover)
+	binary.BigEndian.PutUint32(packet[8:12], operation)
+	binary.BigEndian.PutUint32(packet[12:16], 1)
+	copy(packet[headerLength:], body)
+	return packet
+}
+
+// danmuPackets returns plain JSON DANMU_MSG packets, back to back as Bilibili batches them
+func danmuPackets(texts ...string) []byte {
+	var buf bytes.Buffer
+	for i, text := range texts {
+		body := fmt.Sprintf(`{"cmd":"DANMU_MSG","info":[[0,%q],"",[%d,"侠客%d"]]}`, text, 1000+i, i)
+		buf.Write(bilibiliPacket(0, operationMessage, []byte(body)))
+	}
+	return buf.Bytes()
+}
+
+func brotliFrame(t *testing.T, inner []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	if _, err := w.Write(inner); err != nil {
+		t.Fatalf("brotli write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("brotli close: %v", err)
+	}
+	return bilibiliPacket(protoverBrotli, operationMessage, buf.Bytes())
+}
+
+func zlibFrame(t *testing.T, inner []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(inner); err != nil {
+		t.Fatalf("zlib write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("zlib close: %v", err)
+	}
+	return bilibiliPacket(protoverZlib, operationMessage, buf.Bytes())
+}
+
+func TestBilibiliHandleCompressedFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame func(t *testing.T, inner []byte) []byte
+	}{
+		{"brotli", brotliFrame},
+		{"zlib", zlibFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBilibiliAdapter()
+			b.handleMessage(tt.frame(t, danmuPackets("上山", "下山")))
+
+			for i, want := range []string{"上山", "下山"} {
+				select {
+				case danmaku := <-b.danmakuChan:
+					if danmaku.Content != want || danmaku.Username != fmt.Sprintf("侠客%d", i) {
+						t.Errorf("danmaku %d = %q from %q, want %q", i, danmaku.Content, danmaku.Username, want)
+					}
+				default:
+					t.Fatalf("danmaku %d (%q) not emitted", i, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBilibiliHandleCorruptBrotliFrame(t *testing.T) {
+	b := NewBilibiliAdapter()
+	b.handleMessage(bilibiliPacket(protoverBrotli, operationMessage, []byte("not brotli")))
+	select {
+	case danmaku := <-b.danmakuChan:
+		t.Fatalf("corrupt frame emitted %+v", danmaku)
+	default:
+	}
+}
+
+func TestBilibiliAuthRequestsBrotli(t *testing.T) {
+	auth := make(chan map[string]interface{}, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, data, err := conn.ReadMessage()
+		if err != nil || len(data) < headerLength {
+			return
+		}
+		var body map[string]interface{}
+		if json.Unmarshal(data[headerLength:], &body) == nil {
+			auth <- body
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	b := NewBilibiliAdapter()
+	b.roomID = "5050"
+	if err := b.sendAuth(conn, "token"); err != nil {
+		t.Fatalf("sendAuth: %v", err)
+	}
+
+	select {
+	case body := <-auth:
+		if body["protover"] != float64(protoverBrotli) {
+			t.Fatalf("auth protover = %v, want %d", body["protover"], protoverBrotli)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("auth packet not received")
+	}
+}
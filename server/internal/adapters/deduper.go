@@ -0,0 +1,86 @@
+package adapters
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupWindow   = 60 * time.Second
+	defaultDedupCleanup  = 5 * time.Minute
+	defaultDedupCapacity = 5000
+)
+
+// DanmakuDeduper drops repeated danmaku within a time window and filters by keyword.
+// It is shared by all platform adapters.
+type DanmakuDeduper struct {
+	recent         map[string]time.Time // Map content -> last seen
+	window         time.Duration        // Time window for deduplication
+	filterKeywords []string             // Keywords to filter
+	lastCleanup    time.Time            // Last dedup cleanup time
+	mu             sync.Mutex
+}
+
+// NewDanmakuDeduper creates a deduper with the default 60 second window
+func NewDanmakuDeduper() *DanmakuDeduper {
+	return &DanmakuDeduper{
+		recent:         make(map[string]time.Time, defaultDedupCapacity),
+		window:         defaultDedupWindow,
+		filterKeywords: []string{},
+		lastCleanup:    time.Now(),
+	}
+}
+
+// Allow reports whether a danmaku should be forwarded and records it if so
+func (d *DanmakuDeduper) Allow(text string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Clean up old entries periodically
+	now := time.Now()
+	if now.Sub(d.lastCleanup) > defaultDedupCleanup || len(d.recent) > defaultDedupCapacity {
+		d.cleanup(now)
+		d.lastCleanup = now
+	}
+
+	// Check for duplicates
+	if lastSeen, exists := d.recent[text]; exists && now.Sub(lastSeen) < d.window {
+		return false
+	}
+
+	// Check for filtered keywords
+	for _, keyword := range d.filterKeywords {
+		if keyword != "" && contains(text, keyword) {
+			return false
+		}
+	}
+
+	d.recent[text] = now
+	return true
+}
+
+// SetFilterKeywords sets keywords to filter
+func (d *DanmakuDeduper) SetFilterKeywords(keywords []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.filterKeywords = keywords
+}
+
+// SetWindow sets the deduplication window; non-positive values are ignored
+func (d *DanmakuDeduper) SetWindow(window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.window = window
+}
+
+// cleanup removes entries older than the window
+func (d *DanmakuDeduper) cleanup(now time.Time) {
+	for text, seen := range d.recent {
+		if now.Sub(seen) > d.window {
+			delete(d.recent, text)
+		}
+	}
+}
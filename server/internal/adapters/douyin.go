@@ -1,41 +1,384 @@
 package adapters
 
 import (
+	"Cyber-Jianghu/server/internal/backpressure"
 	"Cyber-Jianghu/server/internal/interfaces"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"go.uber.org/atomic"
 )
 
+// Douyin webcast endpoints
+const (
+	douyinLiveURL     = "https://live.douyin.com/"
+	douyinWebcastURL  = "wss://webcast5-ws-web-hl.douyin.com/webcast/im/push/v2/"
+	douyinUserAgent   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	douyinHeartbeat   = 10 * time.Second
+	douyinChatMethod  = "WebcastChatMessage"
+	douyinHTTPTimeout = 10 * time.Second // Room page, ttwid and signer requests
+)
+
+// ErrNoDouyinSigner is returned by Connect when no signer is set; Douyin rejects unsigned push URLs
+var ErrNoDouyinSigner = errors.New("no douyin signer configured")
+
+var douyinRoomIDRegex = regexp.MustCompile(`roomId\\":\\"(\d+)\\"`)
+
+// DouyinSignatureFunc computes the websocket signature for a room.
+// Douyin signs the push URL in browser JavaScript, so the value must come from an external signer.
+type DouyinSignatureFunc func(roomID string, userUniqueID string) (string, error)
+
 // DouyinAdapter implements LiveAdapter for Douyin (TikTok China) platform
 type DouyinAdapter struct {
+	conn        *websocket.Conn
 	danmakuChan chan interfaces.Danmaku
-	roomID      string
+	ingest      *backpressure.Gate // Sheds and counts danmaku when danmakuChan backs up
+	roomID      string             // Web room ID from the live.douyin.com URL
+	realRoomID  string             // Internal room ID used by the webcast service
 	cookie      string
 	connected   atomic.Bool
+	mu          sync.Mutex
+	writeMu     sync.Mutex
 	cancel      context.CancelFunc
+	closeOnce   sync.Once
+	signer      DouyinSignatureFunc
+	deduper     *DanmakuDeduper
+	httpClient  *http.Client
 }
 
 // NewDouyinAdapter creates a new Douyin live adapter
 func NewDouyinAdapter() *DouyinAdapter {
 	return &DouyinAdapter{
-		danmakuChan: make(chan interfaces.Danmaku, 1000),
+		danmakuChan: make(chan interfaces.Danmaku, DefaultDanmakuBuffer),
+		ingest:      backpressure.NewGate("adapter_ingest", 1, nil),
+		deduper:     NewDanmakuDeduper(),
+		httpClient:  &http.Client{Timeout: douyinHTTPTimeout},
+	}
+}
+
+// SetBackpressure sets the danmaku channel capacity (0 keeps the default) and the gate
+// that counts and sheds danmaku when it backs up; call it before Connect
+func (d *DouyinAdapter) SetBackpressure(capacity int, gate *backpressure.Gate) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if capacity > 0 {
+		d.danmakuChan = make(chan interfaces.Danmaku, capacity)
+	}
+	if gate != nil {
+		d.ingest = gate
 	}
 }
 
+// SetFilterKeywords sets keywords to filter
+func (d *DouyinAdapter) SetFilterKeywords(keywords []string) {
+	d.deduper.SetFilterKeywords(keywords)
+}
+
+// SetDedupWindow sets the deduplication window
+func (d *DouyinAdapter) SetDedupWindow(window time.Duration) {
+	d.deduper.SetWindow(window)
+}
+
+// SetSignatureFunc sets the signer used to sign the websocket URL
+func (d *DouyinAdapter) SetSignatureFunc(signer DouyinSignatureFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.signer = signer
+}
+
 // Connect establishes connection to Douyin live platform
-// Note: Douyin's protocol is more complex and requires reverse engineering
-// This is a skeleton implementation
 func (d *DouyinAdapter) Connect(ctx context.Context, opts *interfaces.ConnectOptions) error {
-	// TODO: Implement Douyin connection
-	// Douyin uses wss protocol with custom binary format
-	// Requires extracting ttwid cookie and room info
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.signer == nil {
+		return ErrNoDouyinSigner
+	}
 
 	d.roomID = opts.RoomID
 	d.cookie = opts.Cookie
 
-	return fmt.Errorf("not implemented: Douyin adapter requires additional protocol research")
+	ctx, d.cancel = context.WithCancel(ctx)
+
+	conn, err := d.dial(ctx)
+	if err != nil {
+		d.cancel()
+		d.cancel = nil
+		return err
+	}
+	d.conn = conn
+
+	d.connected.Store(true)
+
+	// The run goroutine owns the connection and closes danmakuChan once reading stops
+	go d.run(ctx, conn)
+
+	return nil
+}
+
+// dial resolves the room, signs the push URL and opens the WebSocket
+func (d *DouyinAdapter) dial(ctx context.Context) (*websocket.Conn, error) {
+	// Douyin requires a ttwid cookie for both the room page and the websocket
+	if !strings.Contains(d.cookie, "ttwid=") {
+		ttwid, err := d.fetchTTWID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ttwid cookie: %w", err)
+		}
+		d.cookie = strings.TrimPrefix(d.cookie+"; ttwid="+ttwid, "; ")
+	}
+
+	// Resolve the internal room ID
+	realRoomID, err := d.getRoomInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room info: %w", err)
+	}
+	d.realRoomID = realRoomID
+
+	wsURL, err := d.buildWebsocketURL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build websocket URL: %w", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, http.Header{
+		"User-Agent": {douyinUserAgent},
+		"Cookie":     {d.cookie},
+		"Origin":     {"https://live.douyin.com"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to WebSocket: %w", err)
+	}
+	return conn, nil
+}
+
+// run reads from the connection until it fails or ctx is cancelled, then closes
+// danmakuChan. Nothing sends on the channel after run returns, so the close can't race.
+func (d *DouyinAdapter) run(ctx context.Context, conn *websocket.Conn) {
+	defer d.closeDanmaku()
+
+	connCtx, cancel := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+
+	go func() {
+		defer close(heartbeatDone)
+		d.heartbeat(connCtx)
+	}()
+
+	// Unblock ReadMessage when the adapter is disconnected
+	go func() {
+		<-connCtx.Done()
+		conn.Close()
+	}()
+
+	d.readMessages(connCtx, conn)
+	cancel()
+	<-heartbeatDone
+}
+
+// fetchTTWID requests the live homepage to obtain a guest ttwid cookie
+func (d *DouyinAdapter) fetchTTWID(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", douyinLiveURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", douyinUserAgent)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "ttwid" {
+			return cookie.Value, nil
+		}
+	}
+	return "", fmt.Errorf("ttwid cookie not returned")
+}
+
+// getRoomInfo scrapes the internal room ID from the live room page
+func (d *DouyinAdapter) getRoomInfo(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", douyinLiveURL+d.roomID, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", douyinUserAgent)
+	req.Header.Set("Cookie", d.cookie)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	match := douyinRoomIDRegex.FindSubmatch(body)
+	if match == nil {
+		return "", fmt.Errorf("room ID not found for %s", d.roomID)
+	}
+	return string(match[1]), nil
+}
+
+// buildWebsocketURL builds the signed webcast push URL
+func (d *DouyinAdapter) buildWebsocketURL() (string, error) {
+	userUniqueID := fmt.Sprintf("7%018d", rand.Int63n(1e18))
+
+	params := url.Values{}
+	params.Set("app_name", "douyin_web")
+	params.Set("version_code", "180800")
+	params.Set("webcast_sdk_version", "1.0.14-beta.0")
+	params.Set("compress", "gzip")
+	params.Set("device_platform", "web")
+	params.Set("cookie_enabled", "true")
+	params.Set("browser_language", "zh-CN")
+	params.Set("browser_platform", "Win32")
+	params.Set("browser_name", "Mozilla")
+	params.Set("browser_online", "true")
+	params.Set("tz_name", "Asia/Shanghai")
+	params.Set("host", "https://live.douyin.com")
+	params.Set("aid", "6383")
+	params.Set("live_id", "1")
+	params.Set("did_rule", "3")
+	params.Set("endpoint", "live_pc")
+	params.Set("support_wrds", "1")
+	params.Set("user_unique_id", userUniqueID)
+	params.Set("im_path", "/webcast/im/fetch/")
+	params.Set("identity", "audience")
+	params.Set("need_persist_msg_count", "15")
+	params.Set("room_id", d.realRoomID)
+	params.Set("heartbeatDuration", "0")
+
+	signature, err := d.signer(d.realRoomID, userUniqueID)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign URL: %w", err)
+	}
+	params.Set("signature", signature)
+
+	return douyinWebcastURL + "?" + params.Encode(), nil
+}
+
+// readMessages reads messages from WebSocket
+func (d *DouyinAdapter) readMessages(ctx context.Context, conn *websocket.Conn) {
+	defer d.connected.Store(false)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			d.handleMessage(data)
+		}
+	}
+}
+
+// handleMessage processes a protobuf PushFrame
+func (d *DouyinAdapter) handleMessage(data []byte) {
+	frame, err := parsePushFrame(data)
+	if err != nil {
+		return
+	}
+
+	payload := frame.Payload
+	if frame.PayloadEncoding == "gzip" {
+		reader, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return
+		}
+		payload, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return
+		}
+	}
+
+	resp, err := parseResponse(payload)
+	if err != nil {
+		return
+	}
+
+	// Acknowledge so the server keeps pushing
+	if resp.NeedAck {
+		ack := &douyinPushFrame{
+			LogID:       frame.LogID,
+			PayloadType: "ack",
+			Payload:     []byte(resp.InternalExt),
+		}
+		_ = d.writeFrame(ack)
+	}
+
+	for _, msg := range resp.Messages {
+		if msg.Method == douyinChatMethod {
+			d.parseDanmaku(msg.Payload)
+		}
+	}
+}
+
+// parseDanmaku parses a WebcastChatMessage and emits it
+func (d *DouyinAdapter) parseDanmaku(payload []byte) {
+	chat, err := parseChatMessage(payload)
+	if err != nil || chat.Content == "" {
+		return
+	}
+
+	if !d.deduper.Allow(chat.Content) {
+		return
+	}
+
+	danmaku := interfaces.Danmaku{
+		Username:  chat.Nickname,
+		UserID:    chat.UserID,
+		Content:   chat.Content,
+		Timestamp: time.Now().Unix(),
+		Kind:      interfaces.DanmakuChat,
+	}
+
+	backpressure.Send(d.ingest, d.danmakuChan, danmaku, danmaku.IsPaid())
+}
+
+// writeFrame sends a PushFrame over the websocket
+func (d *DouyinAdapter) writeFrame(frame *douyinPushFrame) error {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	return d.conn.WriteMessage(websocket.BinaryMessage, frame.encode())
+}
+
+// heartbeat sends periodic heartbeat frames
+func (d *DouyinAdapter) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(douyinHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.writeFrame(&douyinPushFrame{PayloadType: "hb"}); err != nil {
+				return
+			}
+		}
+	}
 }
 
 // SubscribeDanmaku returns a channel for receiving danmaku messages
@@ -48,8 +391,8 @@ func (d *DouyinAdapter) SubscribeDanmaku(ctx context.Context) (<-chan interfaces
 
 // SendChat sends a chat message to the live room
 func (d *DouyinAdapter) SendChat(ctx context.Context, msg string) error {
-	// TODO: Implement Douyin send chat
-	return fmt.Errorf("not implemented")
+	// Sending requires a logged-in account and signed API calls
+	return fmt.Errorf("not implemented: requires authenticated API")
 }
 
 // HealthCheck checks if the connection is still alive
@@ -60,12 +403,66 @@ func (d *DouyinAdapter) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
-// Disconnect closes the connection
+// Disconnect closes the connection; danmakuChan is closed once the reader has exited
 func (d *DouyinAdapter) Disconnect() error {
-	if d.cancel != nil {
-		d.cancel()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel == nil {
+		return nil
+	}
+
+	d.cancel()
+	d.cancel = nil
+
+	if d.conn != nil {
+		d.conn.Close()
 	}
+
 	d.connected.Store(false)
-	close(d.danmakuChan)
 	return nil
 }
+
+// closeDanmaku closes the danmaku channel exactly once
+func (d *DouyinAdapter) closeDanmaku() {
+	d.closeOnce.Do(func() {
+		close(d.danmakuChan)
+	})
+}
+
+// NewHTTPDouyinSigner returns a signer backed by an external signing service. It POSTs
+// {"room_id", "user_unique_id"} to endpoint and expects {"signature"} back.
+func NewHTTPDouyinSigner(endpoint string, timeout time.Duration) DouyinSignatureFunc {
+	if timeout <= 0 {
+		timeout = douyinHTTPTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+
+	return func(roomID string, userUniqueID string) (string, error) {
+		body, err := json.Marshal(map[string]string{"room_id": roomID, "user_unique_id": userUniqueID})
+		if err != nil {
+			return "", err
+		}
+
+		resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return "", fmt.Errorf("signer request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("signer returned status %d", resp.StatusCode)
+		}
+
+		var result struct {
+			Signature string `json:"signature"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", fmt.Errorf("failed to decode signer response: %w", err)
+		}
+		if result.Signature == "" {
+			return "", fmt.Errorf("signer returned an empty signature")
+		}
+		return result.Signature, nil
+	}
+}
@@ -0,0 +1,232 @@
+package adapters
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Minimal protobuf wire-format helpers for Douyin's webcast frames.
+// Only the fields needed to extract chat messages are decoded.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoField is a single decoded protobuf field
+type protoField struct {
+	Number int
+	Type   int
+	Varint uint64
+	Bytes  []byte
+}
+
+// decodeProto splits a protobuf message into its top-level fields
+func decodeProto(data []byte) ([]protoField, error) {
+	fields := make([]protoField, 0, 8)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid field key")
+		}
+		data = data[n:]
+
+		field := protoField{Number: int(key >> 3), Type: int(key & 7)}
+		switch field.Type {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint for field %d", field.Number)
+			}
+			field.Varint = v
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("truncated fixed64 for field %d", field.Number)
+			}
+			field.Varint = binary.LittleEndian.Uint64(data[:8])
+			data = data[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, fmt.Errorf("truncated bytes for field %d", field.Number)
+			}
+			field.Bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("truncated fixed32 for field %d", field.Number)
+			}
+			field.Varint = uint64(binary.LittleEndian.Uint32(data[:4]))
+			data = data[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", field.Type)
+		}
+
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// protoEncoder builds protobuf messages field by field
+type protoEncoder struct {
+	buf []byte
+}
+
+// varint appends a varint field
+func (e *protoEncoder) varint(number int, value uint64) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(number<<3|wireVarint))
+	e.buf = binary.AppendUvarint(e.buf, value)
+}
+
+// bytes appends a length-delimited field
+func (e *protoEncoder) bytes(number int, value []byte) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(number<<3|wireBytes))
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+// douyinPushFrame is the outer frame of every websocket message
+type douyinPushFrame struct {
+	LogID           uint64
+	PayloadEncoding string
+	PayloadType     string
+	Payload         []byte
+}
+
+// douyinResponse is the gzip-compressed payload of a push frame
+type douyinResponse struct {
+	Messages    []douyinMessage
+	InternalExt string
+	NeedAck     bool
+}
+
+// douyinMessage is a single webcast message inside a response
+type douyinMessage struct {
+	Method  string
+	Payload []byte
+}
+
+// douyinChatMessage holds the fields of WebcastChatMessage we use
+type douyinChatMessage struct {
+	UserID   string
+	Nickname string
+	Content  string
+}
+
+// parsePushFrame decodes a PushFrame
+func parsePushFrame(data []byte) (*douyinPushFrame, error) {
+	fields, err := decodeProto(data)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := &douyinPushFrame{}
+	for _, f := range fields {
+		switch f.Number {
+		case 2:
+			frame.LogID = f.Varint
+		case 6:
+			frame.PayloadEncoding = string(f.Bytes)
+		case 7:
+			frame.PayloadType = string(f.Bytes)
+		case 8:
+			frame.Payload = f.Bytes
+		}
+	}
+	return frame, nil
+}
+
+// encode serializes the frame for acks and heartbeats
+func (f *douyinPushFrame) encode() []byte {
+	enc := &protoEncoder{}
+	if f.LogID != 0 {
+		enc.varint(2, f.LogID)
+	}
+	if f.PayloadEncoding != "" {
+		enc.bytes(6, []byte(f.PayloadEncoding))
+	}
+	if f.PayloadType != "" {
+		enc.bytes(7, []byte(f.PayloadType))
+	}
+	if len(f.Payload) > 0 {
+		enc.bytes(8, f.Payload)
+	}
+	return enc.buf
+}
+
+// parseResponse decodes a Response
+func parseResponse(data []byte) (*douyinResponse, error) {
+	fields, err := decodeProto(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &douyinResponse{}
+	for _, f := range fields {
+		switch f.Number {
+		case 1:
+			msg, err := parseMessage(f.Bytes)
+			if err != nil {
+				continue
+			}
+			resp.Messages = append(resp.Messages, *msg)
+		case 5:
+			resp.InternalExt = string(f.Bytes)
+		case 9:
+			resp.NeedAck = f.Varint != 0
+		}
+	}
+	return resp, nil
+}
+
+// parseMessage decodes a Message envelope
+func parseMessage(data []byte) (*douyinMessage, error) {
+	fields, err := decodeProto(data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &douyinMessage{}
+	for _, f := range fields {
+		switch f.Number {
+		case 1:
+			msg.Method = string(f.Bytes)
+		case 2:
+			msg.Payload = f.Bytes
+		}
+	}
+	return msg, nil
+}
+
+// parseChatMessage decodes a WebcastChatMessage
+func parseChatMessage(data []byte) (*douyinChatMessage, error) {
+	fields, err := decodeProto(data)
+	if err != nil {
+		return nil, err
+	}
+
+	chat := &douyinChatMessage{}
+	for _, f := range fields {
+		switch f.Number {
+		case 2: // User
+			userFields, err := decodeProto(f.Bytes)
+			if err != nil {
+				continue
+			}
+			for _, uf := range userFields {
+				switch uf.Number {
+				case 1:
+					chat.UserID = fmt.Sprintf("%d", uf.Varint)
+				case 3:
+					chat.Nickname = string(uf.Bytes)
+				}
+			}
+		case 3:
+			chat.Content = string(f.Bytes)
+		}
+	}
+	return chat, nil
+}
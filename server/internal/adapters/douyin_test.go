@@ -0,0 +1,137 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Cyber-Jianghu/server/internal/interfaces"
+
+	"github.com/gorilla/websocket"
+)
+
+// douyinChatFrame builds an uncompressed push frame carrying one chat message
+func douyinChatFrame(nickname, content string) []byte {
+	user := &protoEncoder{}
+	user.varint(1, 42)
+	user.bytes(3, []byte(nickname))
+
+	chat := &protoEncoder{}
+	chat.bytes(2, user.buf)
+	chat.bytes(3, []byte(content))
+
+	msg := &protoEncoder{}
+	msg.bytes(1, []byte(douyinChatMethod))
+	msg.bytes(2, chat.buf)
+
+	resp := &protoEncoder{}
+	resp.bytes(1, msg.buf)
+
+	frame := &douyinPushFrame{PayloadType: "msg", Payload: resp.buf}
+	return frame.encode()
+}
+
+func TestDouyinConnectRequiresSigner(t *testing.T) {
+	d := NewDouyinAdapter()
+	err := d.Connect(context.Background(), &interfaces.ConnectOptions{RoomID: "123"})
+	if !errors.Is(err, ErrNoDouyinSigner) {
+		t.Fatalf("Connect without signer = %v, want ErrNoDouyinSigner", err)
+	}
+	// Nothing was started, so disconnecting is a no-op
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+}
+
+func TestDouyinDisconnectWhileReceiving(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Flood distinct chat messages until the client goes away
+		for i := 0; ; i++ {
+			if err := conn.WriteMessage(websocket.BinaryMessage, douyinChatFrame("侠客", fmt.Sprintf("消息%d", i))); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	d := NewDouyinAdapter()
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.conn = conn
+	d.connected.Store(true)
+	go d.run(ctx, conn)
+
+	select {
+	case danmaku := <-d.danmakuChan:
+		if danmaku.Username != "侠客" || !strings.HasPrefix(danmaku.Content, "消息") {
+			t.Fatalf("unexpected danmaku %+v", danmaku)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no danmaku received")
+	}
+
+	// Disconnecting mid-stream, twice, must neither panic nor leave the channel open
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	if err := d.Disconnect(); err != nil {
+		t.Fatalf("second Disconnect: %v", err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-d.danmakuChan:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("danmaku channel not closed after Disconnect")
+		}
+	}
+}
+
+func TestHTTPDouyinSigner(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req["room_id"] != "7300" || req["user_unique_id"] != "7001" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"signature": "sig-abc"})
+	}))
+	defer server.Close()
+
+	signature, err := NewHTTPDouyinSigner(server.URL, time.Second)("7300", "7001")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if signature != "sig-abc" {
+		t.Fatalf("signature = %q, want sig-abc", signature)
+	}
+
+	if _, err := NewHTTPDouyinSigner(server.URL, time.Second)("other", "7001"); err == nil {
+		t.Fatal("expected an error for a rejected signing request")
+	}
+}
@@ -3,8 +3,11 @@ package adapters
 import (
 	"Cyber-Jianghu/server/internal/interfaces"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 )
 
 // CommandType represents the type of command parsed from danmaku
@@ -13,13 +16,31 @@ type CommandType string
 const (
 	CommandAction CommandType = "action"
 	CommandVote  CommandType = "vote"
+	CommandHelp  CommandType = "help"
 	CommandNone  CommandType = "none"
 )
 
+// Canonical verbs handled by the parser itself rather than the action batcher
+const (
+	VerbVote = "vote"
+	VerbHelp = "help"
+)
+
+// defaultCommandAliases maps keywords viewers type without a slash to canonical verbs.
+// Action keywords are registered by whoever owns the action commands.
+var defaultCommandAliases = map[string]string{
+	"投票":       VerbVote,
+	"帮助":       VerbHelp,
+	"指令":       VerbHelp,
+	"命令":       VerbHelp,
+	"commands": VerbHelp,
+}
+
 // ParsedCommand represents a parsed command from danmaku
 type ParsedCommand struct {
 	Type    CommandType
-	Action  string
+	Action  string // Canonical verb, for action commands
+	Args    string // Text after the verb, e.g. the target of an action
 	Params  map[string]string
 	VoteID  string
 	RawText string
@@ -29,14 +50,56 @@ type ParsedCommand struct {
 type DanmakuParser struct {
 	actionPattern *regexp.Regexp
 	votePattern  *regexp.Regexp
+	bareVotePattern *regexp.Regexp // A message that is only an option number, e.g. "2" or "#2"
+	numberPattern   *regexp.Regexp
+
+	mu      sync.RWMutex
+	aliases map[string]string // Lower-cased keyword -> canonical verb
 }
 
 // NewDanmakuParser creates a new danmaku parser
 func NewDanmakuParser() *DanmakuParser {
-	return &DanmakuParser{
+	p := &DanmakuParser{
 		actionPattern: regexp.MustCompile(`^/(\w+)(?:\s+(.+))?$`),
-		votePattern:  regexp.MustCompile(`^/vote\s+(\d+)$`),
+		votePattern:  regexp.MustCompile(`(?i)^/vote([\s:#\d].*)?$`),
+		bareVotePattern: regexp.MustCompile(`^[#第]?(\d{1,2})号?$`),
+		numberPattern:   regexp.MustCompile(`\d+`),
+		aliases:      make(map[string]string, len(defaultCommandAliases)),
+	}
+	p.AddAliases(defaultCommandAliases)
+	return p
+}
+
+// AddAliases registers keywords (e.g. "攻击") for canonical verbs (e.g. "attack").
+// Keywords match with or without a leading slash; later registrations win.
+func (p *DanmakuParser) AddAliases(aliases map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for alias, verb := range aliases {
+		alias = strings.ToLower(normalizeWidth(strings.TrimSpace(alias)))
+		verb = strings.ToLower(strings.TrimSpace(verb))
+		if alias == "" || verb == "" {
+			continue
+		}
+		p.aliases[alias] = verb
+	}
+}
+
+// Aliases returns the registered keywords for each canonical verb, sorted
+func (p *DanmakuParser) Aliases() map[string][]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	byVerb := make(map[string][]string)
+	for alias, verb := range p.aliases {
+		if alias != verb {
+			byVerb[verb] = append(byVerb[verb], alias)
+		}
+	}
+	for _, aliases := range byVerb {
+		sort.Strings(aliases)
 	}
+	return byVerb
 }
 
 // Parse parses a danmaku message and extracts commands
@@ -44,31 +107,117 @@ func (p *DanmakuParser) Parse(danmaku interfaces.Danmaku) *ParsedCommand {
 	trimmed := strings.TrimSpace(danmaku.Content)
 	result := &ParsedCommand{
 		RawText: trimmed,
+		Type:    CommandNone,
 	}
 
-	// Check for vote command
-	if match := p.votePattern.FindStringSubmatch(trimmed); match != nil {
-		result.Type = CommandVote
-		result.VoteID = match[1]
+	// Full-width digits, letters and slashes from Chinese input methods parse like ASCII
+	text := normalizeWidth(trimmed)
+
+	// Check for vote command; "/vote" without a number is not a command
+	if match := p.votePattern.FindStringSubmatch(text); match != nil {
+		p.fill(result, VerbVote, match[1])
+		return result
+	}
+	if match := p.bareVotePattern.FindStringSubmatch(text); match != nil {
+		p.fill(result, VerbVote, match[1])
 		return result
 	}
 
 	// Check for action command
-	if match := p.actionPattern.FindStringSubmatch(trimmed); match != nil {
-		result.Type = CommandAction
-		result.Action = match[1]
-
-		// Parse parameters
-		if len(match) > 2 && match[2] != "" {
-			result.Params = parseParams(match[2])
+	if match := p.actionPattern.FindStringSubmatch(text); match != nil {
+		verb, args := p.canonical(match[1]), ""
+		if len(match) > 2 {
+			args = match[2]
 		}
+		p.fill(result, verb, args)
 		return result
 	}
 
-	result.Type = CommandNone
+	// Check for a keyword typed without the slash, e.g. "投票1" or "攻击 山贼"
+	if verb, args, ok := p.matchAlias(strings.TrimPrefix(text, "/")); ok {
+		p.fill(result, verb, args)
+	}
 	return result
 }
 
+// fill sets the command type and arguments for a canonical verb
+func (p *DanmakuParser) fill(result *ParsedCommand, verb, args string) {
+	args = strings.TrimSpace(args)
+	switch verb {
+	case VerbVote:
+		// The first number is the option, so "投票：2号" and "/vote 第2个" both count
+		if id, ok := p.firstNumber(args); ok {
+			result.Type = CommandVote
+			result.VoteID = id
+		}
+	case VerbHelp:
+		// "命令 大家冲" is chat, not a request for help
+		if args == "" {
+			result.Type = CommandHelp
+		}
+	default:
+		result.Type = CommandAction
+		result.Action = verb
+		result.Args = args
+		if args != "" {
+			result.Params = parseParams(args)
+		}
+	}
+}
+
+// canonical resolves a slash verb through the aliases, ignoring case
+func (p *DanmakuParser) canonical(verb string) string {
+	verb = strings.ToLower(verb)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if canonical, ok := p.aliases[verb]; ok {
+		return canonical
+	}
+	return verb
+}
+
+// firstNumber returns the first integer in s without leading zeros
+func (p *DanmakuParser) firstNumber(s string) (string, bool) {
+	n, err := strconv.Atoi(p.numberPattern.FindString(s))
+	if err != nil {
+		return "", false
+	}
+	return strconv.Itoa(n), true
+}
+
+// matchAlias finds the longest keyword that starts text and is followed by nothing or
+// whitespace, so ordinary chat starting with a keyword isn't a command. Vote keywords
+// may be followed by anything; the vote only counts if it contains a number.
+func (p *DanmakuParser) matchAlias(text string) (verb, args string, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	best := ""
+	for alias, candidate := range p.aliases {
+		if len(alias) <= len(best) || len(text) < len(alias) || !strings.EqualFold(text[:len(alias)], alias) {
+			continue
+		}
+		rest := text[len(alias):]
+		if rest == "" || unicode.IsSpace(rune(rest[0])) || candidate == VerbVote {
+			best, verb, args = alias, candidate, rest
+		}
+	}
+	return verb, args, best != ""
+}
+
+// normalizeWidth folds full-width ASCII variants and the ideographic space to ASCII
+func normalizeWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '　':
+			return ' '
+		case r >= '！' && r <= '～':
+			return r - 0xfee0
+		}
+		return r
+	}, s)
+}
+
 // parseParams parses command parameters from string
 func parseParams(params string) map[string]string {
 	result := make(map[string]string)
@@ -91,10 +240,10 @@ func parseParams(params string) map[string]string {
 
 // IsActionCommand checks if text is an action command
 func (p *DanmakuParser) IsActionCommand(text string) bool {
-	return p.actionPattern.MatchString(strings.TrimSpace(text))
+	return p.Parse(interfaces.Danmaku{Content: text}).Type == CommandAction
 }
 
 // IsVoteCommand checks if text is a vote command
 func (p *DanmakuParser) IsVoteCommand(text string) bool {
-	return p.votePattern.MatchString(strings.TrimSpace(text))
+	return p.Parse(interfaces.Danmaku{Content: text}).Type == CommandVote
 }
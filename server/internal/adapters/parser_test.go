@@ -0,0 +1,64 @@
+package adapters
+
+import (
+	"testing"
+
+	"Cyber-Jianghu/server/internal/interfaces"
+)
+
+func TestDanmakuParserVotes(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantType CommandType
+		wantVote string
+	}{
+		{"１", CommandVote, "1"},
+		{"＃２", CommandVote, "2"},
+		{"第3号", CommandVote, "3"},
+		{"投票：2号", CommandVote, "2"},
+		{"投票2", CommandVote, "2"},
+		{"/vote 3", CommandVote, "3"},
+		{"／ＶＯＴＥ　３", CommandVote, "3"},
+		{"/vote:02", CommandVote, "2"},
+		{"/vote", CommandNone, ""},
+		{"投票吧大家", CommandNone, ""},
+		{"123", CommandNone, ""},
+		{"今天天气不错", CommandNone, ""},
+	}
+	p := NewDanmakuParser()
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := p.Parse(interfaces.Danmaku{Content: tt.text})
+			if got.Type != tt.wantType || got.VoteID != tt.wantVote {
+				t.Errorf("Parse(%q) = %s vote %q, want %s vote %q", tt.text, got.Type, got.VoteID, tt.wantType, tt.wantVote)
+			}
+		})
+	}
+}
+
+func TestDanmakuParserActions(t *testing.T) {
+	p := NewDanmakuParser()
+	p.AddAliases(map[string]string{"攻击": "attack"})
+
+	tests := []struct {
+		text       string
+		wantType   CommandType
+		wantAction string
+		wantArgs   string
+	}{
+		{"/attack 山贼", CommandAction, "attack", "山贼"},
+		{"/攻击 山贼", CommandAction, "attack", "山贼"},
+		{"攻击 山贼", CommandAction, "attack", "山贼"},
+		{"攻击山贼的人是谁", CommandNone, "", ""},
+		{"帮助", CommandHelp, "", ""},
+		{"命令 大家冲", CommandNone, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := p.Parse(interfaces.Danmaku{Content: tt.text})
+			if got.Type != tt.wantType || got.Action != tt.wantAction || got.Args != tt.wantArgs {
+				t.Errorf("Parse(%q) = %s %q %q, want %s %q %q", tt.text, got.Type, got.Action, got.Args, tt.wantType, tt.wantAction, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"Cyber-Jianghu/server/internal/interfaces"
+)
+
+// Definite preflight failures; anything else from a preflight check means it couldn't tell
+var (
+	ErrCookieExpired = errors.New("cookie is invalid or expired")
+	ErrRoomOffline   = errors.New("room is not live")
+	ErrRoomNotFound  = errors.New("room does not exist")
+)
+
+const (
+	bilibiliNavURL      = "https://api.bilibili.com/x/web-interface/nav"
+	bilibiliRoomInfoURL = "https://api.live.bilibili.com/room/v1/Room/get_info?room_id=%s"
+
+	bilibiliCodeNotLoggedIn = -101
+	bilibiliRoomLive        = 1 // live_status: 0 offline, 1 live, 2 replaying recordings
+)
+
+// PreflightCheck confirms the cookie is logged in and the room exists and is live, so
+// Connect doesn't fail deep in the handshake. An empty cookie skips the login check,
+// since anonymous connections are allowed.
+func (b *BilibiliAdapter) PreflightCheck(ctx context.Context, opts *interfaces.ConnectOptions) error {
+	if opts.Cookie != "" {
+		var nav struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    struct {
+				IsLogin bool `json:"isLogin"`
+			} `json:"data"`
+		}
+		if err := bilibiliGet(ctx, bilibiliNavURL, opts, &nav); err != nil {
+			return fmt.Errorf("failed to check cookie: %w", err)
+		}
+		if nav.Code == bilibiliCodeNotLoggedIn || (nav.Code == 0 && !nav.Data.IsLogin) {
+			return ErrCookieExpired
+		}
+	}
+
+	var room struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			LiveStatus int `json:"live_status"`
+		} `json:"data"`
+	}
+	if err := bilibiliGet(ctx, fmt.Sprintf(bilibiliRoomInfoURL, opts.RoomID), opts, &room); err != nil {
+		return fmt.Errorf("failed to check room: %w", err)
+	}
+	switch {
+	case room.Code != 0:
+		// The API answers unknown rooms with a non-zero code rather than a 404
+		return fmt.Errorf("%w: room %s: %s", ErrRoomNotFound, opts.RoomID, room.Message)
+	case room.Data.LiveStatus != bilibiliRoomLive:
+		return fmt.Errorf("%w: room %s", ErrRoomOffline, opts.RoomID)
+	}
+	return nil
+}
+
+// bilibiliGet fetches a Bilibili API URL with the connection's cookie and decodes the JSON body
+func bilibiliGet(ctx context.Context, apiURL string, opts *interfaces.ConnectOptions, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("Referer", fmt.Sprintf("https://live.bilibili.com/%s", opts.RoomID))
+	if opts.Cookie != "" {
+		req.Header.Set("Cookie", opts.Cookie)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,153 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrUnrecognizedRoomURL is returned for links that aren't a Bilibili or Douyin live room
+var ErrUnrecognizedRoomURL = errors.New("unrecognized live room URL")
+
+const shortLinkTimeout = 5 * time.Second
+
+var (
+	// roomURLPattern finds the link inside pasted share text such as "【某某的直播间】 https://b23.tv/xxxx"
+	roomURLPattern = regexp.MustCompile(`(?i)(?:https?://)?[a-z0-9.-]+\.(?:com|tv)(?:/[\w\-./?=&%#~:+]*)?`)
+	digitsPattern  = regexp.MustCompile(`^\d+$`)
+)
+
+// shortLinkHosts redirect to the full live room URL
+var shortLinkHosts = map[string]bool{
+	"b23.tv":       true,
+	"v.douyin.com": true,
+}
+
+// ResolveRoomURL returns the platform and room ID for a pasted live room link, following
+// b23.tv and v.douyin.com short links first
+func ResolveRoomURL(ctx context.Context, raw string) (platform, roomID string, err error) {
+	u, err := parseRoomLink(raw)
+	if err != nil {
+		return "", "", err
+	}
+
+	if shortLinkHosts[u.Hostname()] {
+		u, err = followShortLink(ctx, u)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return roomFromURL(u)
+}
+
+// parseRoomLink extracts and parses the first link in raw, which may lack a scheme
+func parseRoomLink(raw string) (*url.URL, error) {
+	link := roomURLPattern.FindString(strings.TrimSpace(raw))
+	if link == "" {
+		return nil, fmt.Errorf("%w: no link found in %q", ErrUnrecognizedRoomURL, raw)
+	}
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnrecognizedRoomURL, err)
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+// roomFromURL maps a full live room URL to its platform and room ID
+func roomFromURL(u *url.URL) (platform, roomID string, err error) {
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	host := u.Hostname()
+
+	switch {
+	case host == "live.bilibili.com":
+		// live.bilibili.com/123, /h5/123 (mobile) and /blanc/123 (no page chrome)
+		if roomID := roomSegment(segments, "h5", "blanc"); roomID != "" {
+			return "bilibili", roomID, nil
+		}
+	case host == "live.douyin.com":
+		// live.douyin.com/123 and /h5/123
+		if roomID := roomSegment(segments, "h5"); roomID != "" {
+			return "douyin", roomID, nil
+		}
+	case host == "www.douyin.com" || host == "douyin.com":
+		// www.douyin.com/root/live/123 and /follow/live/123
+		for i := 0; i+1 < len(segments); i++ {
+			if segments[i] == "live" && digitsPattern.MatchString(segments[i+1]) {
+				return "douyin", segments[i+1], nil
+			}
+		}
+	case strings.HasSuffix(host, ".amemv.com"):
+		// Mobile share pages carry the internal room ID, which the web danmaku API doesn't accept
+		return "", "", fmt.Errorf("%w: %s is a Douyin mobile share page; open it in a browser and paste the live.douyin.com address", ErrUnrecognizedRoomURL, host)
+	case shortLinkHosts[host]:
+		return "", "", fmt.Errorf("%w: short link %s must be resolved first", ErrUnrecognizedRoomURL, u)
+	default:
+		return "", "", fmt.Errorf("%w: unsupported host %q, expected live.bilibili.com or live.douyin.com", ErrUnrecognizedRoomURL, host)
+	}
+	return "", "", fmt.Errorf("%w: no room ID in %s", ErrUnrecognizedRoomURL, u)
+}
+
+// roomSegment returns the numeric first path segment, skipping one optional prefix
+func roomSegment(segments []string, prefixes ...string) string {
+	if len(segments) > 1 {
+		for _, prefix := range prefixes {
+			if segments[0] == prefix {
+				segments = segments[1:]
+				break
+			}
+		}
+	}
+	if len(segments) > 0 && digitsPattern.MatchString(segments[0]) {
+		return segments[0]
+	}
+	return ""
+}
+
+// followShortLink returns the URL a short link redirects to
+func followShortLink(ctx context.Context, u *url.URL) (*url.URL, error) {
+	ctx, cancel := context.WithTimeout(ctx, shortLinkTimeout)
+	defer cancel()
+
+	var target *url.URL
+	client := &http.Client{
+		// Stop at the first redirect off the short link host; the room page itself isn't needed
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !shortLinkHosts[req.URL.Hostname()] {
+				target = req.URL
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create short link request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve short link %s: %w", u, err)
+	}
+	resp.Body.Close()
+
+	if target == nil {
+		return nil, fmt.Errorf("%w: short link %s did not redirect to a live room", ErrUnrecognizedRoomURL, u)
+	}
+	target.Host = strings.ToLower(target.Host)
+	return target, nil
+}
@@ -0,0 +1,106 @@
+// Package backpressure counts and sheds messages at the bounded channels of the live
+// danmaku pipeline, so operators can see where messages are lost under load.
+package backpressure
+
+import (
+	"log/slog"
+
+	"go.uber.org/atomic"
+)
+
+// Channel fill ratios at which a gate starts and stops sampling
+const (
+	highWater = 0.8
+	lowWater  = 0.5
+)
+
+// Stats is a snapshot of one stage's counters
+type Stats struct {
+	Accepted   uint64 `json:"accepted"`
+	Sampled    uint64 `json:"sampled"` // Shed by 1-in-N sampling while overloaded
+	Dropped    uint64 `json:"dropped"` // Lost because the channel was full
+	Overloaded bool   `json:"overloaded"`
+}
+
+// Gate guards one pipeline stage. Once its channel passes 80% full it keeps only one in
+// every sampleEvery ordinary messages, until the channel drains below 50%, so a sustained
+// flood thins evenly instead of losing whatever arrives while the channel is full.
+// Priority messages skip sampling and are only lost when the channel is full.
+type Gate struct {
+	stage       string
+	sampleEvery uint64
+	logger      *slog.Logger
+
+	overloaded atomic.Bool
+	seq        atomic.Uint64
+	accepted   atomic.Uint64
+	sampled    atomic.Uint64
+	dropped    atomic.Uint64
+}
+
+// NewGate creates a gate for the named stage, logging overload through logger (nil uses
+// the default); sampleEvery of 0 or 1 disables sampling
+func NewGate(stage string, sampleEvery int, logger *slog.Logger) *Gate {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if sampleEvery < 1 {
+		sampleEvery = 1
+	}
+	return &Gate{
+		stage:       stage,
+		sampleEvery: uint64(sampleEvery),
+		logger:      logger.With("stage", stage),
+	}
+}
+
+// Send offers v to ch without blocking and reports whether it was queued
+func Send[T any](g *Gate, ch chan<- T, v T, priority bool) bool {
+	if !g.admit(len(ch), cap(ch), priority) {
+		return false
+	}
+	select {
+	case ch <- v:
+		g.accepted.Inc()
+		return true
+	default:
+		g.dropped.Inc()
+		return false
+	}
+}
+
+// admit applies sampling given the channel's current fill
+func (g *Gate) admit(length, capacity int, priority bool) bool {
+	if g.sampleEvery <= 1 || capacity == 0 {
+		return true
+	}
+
+	fill := float64(length) / float64(capacity)
+	switch {
+	case fill >= highWater && g.overloaded.CompareAndSwap(false, true):
+		g.logger.Warn("channel overloaded, sampling messages", "sample_every", g.sampleEvery, "fill", fill)
+	case fill < lowWater && g.overloaded.CompareAndSwap(true, false):
+		g.logger.Info("channel recovered", "sampled", g.sampled.Load(), "dropped", g.dropped.Load())
+	}
+
+	if priority || !g.overloaded.Load() || g.seq.Inc()%g.sampleEvery == 0 {
+		return true
+	}
+	g.sampled.Inc()
+	return false
+}
+
+// Stage returns the stage name the gate was created with
+func (g *Gate) Stage() string {
+	return g.stage
+}
+
+// Stats returns the gate's counters
+func (g *Gate) Stats() Stats {
+	return Stats{
+		Accepted:   g.accepted.Load(),
+		Sampled:    g.sampled.Load(),
+		Dropped:    g.dropped.Load(),
+		Overloaded: g.overloaded.Load(),
+	}
+}
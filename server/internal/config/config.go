@@ -16,6 +16,7 @@ type Config struct {
 	Live     LiveConfig     `yaml:"live"`
 	Queue    QueueConfig    `yaml:"queue"`
 	Logging  LoggingConfig  `yaml:"logging"`
+	Cache    CacheConfig    `yaml:"cache"`
 }
 
 type ServerConfig struct {
@@ -23,6 +24,26 @@ type ServerConfig struct {
 	Port         int           `yaml:"port"`
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IdempotencyTTL is how long a response is replayed for retries carrying the same
+	// Idempotency-Key header
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl"`
+	// Debug enables the /api/v1/debug endpoints, which expose story internals; keep it
+	// off in production
+	Debug bool `yaml:"debug"`
+	// RateLimit caps how often /story/continue and /story/select run per story and per user
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// AllowedOrigins lists the origins (scheme://host[:port]) allowed to call the API and
+	// open the danmaku websocket from another site. "*" allows any origin without
+	// credentials, for development only. The server's own pages are always allowed.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// RateLimitConfig sets sliding-window limits on player actions; a limit of 0 disables it
+type RateLimitConfig struct {
+	Window           time.Duration `yaml:"window"`
+	PerStory         int           `yaml:"per_story"`         // Actions on one story per window
+	PerUser          int           `yaml:"per_user"`          // Actions by one user on one story per window
+	GifterMultiplier float64       `yaml:"gifter_multiplier"` // Limit multiplier for viewers over the gift threshold
 }
 
 type DatabaseConfig struct {
@@ -56,13 +77,26 @@ type QdrantConfig struct {
 	APIKey     string `yaml:"api_key"`
 	Collection string `yaml:"collection"`
 	VectorSize int    `yaml:"vector_size"`
+	// Distance is the metric collections are searched with: Cosine, Euclid or Dot.
+	// Distances overrides it per collection name.
+	Distance  string            `yaml:"distance"`
+	Distances map[string]string `yaml:"distances"`
+	// ConnectRetry is how long startup waits for Qdrant before starting disconnected; 0 tries once
+	ConnectRetry time.Duration `yaml:"connect_retry"`
+	// ReconnectInterval is how often Qdrant is probed to detect restarts; 0 disables probing
+	ReconnectInterval time.Duration `yaml:"reconnect_interval"`
 }
 
 type AIConfig struct {
-	GLM5      GLM5Config      `yaml:"glm5"`
-	Embedding EmbeddingConfig `yaml:"embedding"`
-	ComfyUI   ComfyUIConfig   `yaml:"comfyui"`
-	SoVITS    SoVITSConfig    `yaml:"sovits"`
+	GLM5             GLM5Config          `yaml:"glm5"`
+	Embedding        EmbeddingConfig     `yaml:"embedding"`
+	ComfyUI          ComfyUIConfig       `yaml:"comfyui"`
+	SoVITS           SoVITSConfig        `yaml:"sovits"`
+	Translation      TranslationConfig   `yaml:"translation"`
+	ImageTranslation TranslationConfig   `yaml:"image_translation"` // Chinese image prompts to English tags for SDXL
+	Prompts          PromptsConfig       `yaml:"prompts"`
+	ContentFilter    ContentFilterConfig `yaml:"content_filter"`
+	Replay           ReplayConfig        `yaml:"replay"`
 }
 
 type GLM5Config struct {
@@ -71,6 +105,16 @@ type GLM5Config struct {
 	Model       string  `yaml:"model"`
 	MaxTokens   int     `yaml:"max_tokens"`
 	Temperature float64 `yaml:"temperature"`
+	// MaxInputTokens is the estimated prompt size story generation trims context to fit;
+	// 0 uses the engine default and a negative value disables trimming
+	MaxInputTokens int `yaml:"max_input_tokens"`
+	// Client-side request limits; requests block rather than fail when saturated. 0 is unlimited.
+	RateLimit     float64 `yaml:"rate_limit"`     // Requests per second
+	Burst         int     `yaml:"burst"`          // Requests allowed at once after idling
+	MaxConcurrent int     `yaml:"max_concurrent"` // Requests in flight at once
+	// StructuredOutput asks for story segments as JSON instead of scraping prose;
+	// replies that aren't valid JSON fall back to the prose parser
+	StructuredOutput bool `yaml:"structured_output"`
 }
 
 type EmbeddingConfig struct {
@@ -80,9 +124,14 @@ type EmbeddingConfig struct {
 }
 
 type ComfyUIConfig struct {
-	BaseURL      string        `yaml:"base_url"`
-	WorkflowFile string        `yaml:"workflow_file"`
-	Timeout      time.Duration `yaml:"timeout"`
+	BaseURL        string        `yaml:"base_url"`
+	WorkflowFile   string        `yaml:"workflow_file"`
+	Timeout        time.Duration `yaml:"timeout"`
+	NegativePrompt string        `yaml:"negative_prompt"` // Default negative prompt merged into every request
+	// Local install launched by the ComfyUI manager; empty paths use per-OS defaults
+	CondaEnvPath string `yaml:"conda_env_path"`
+	PythonPath   string `yaml:"python_path"`
+	RootDir      string `yaml:"root_dir"`
 }
 
 type SoVITSConfig struct {
@@ -91,27 +140,115 @@ type SoVITSConfig struct {
 	Timeout   time.Duration `yaml:"timeout"`
 }
 
+// TranslationConfig controls translation of non-Chinese danmaku for the story engine
+type TranslationConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Model   string `yaml:"model"`
+}
+
+// PromptsConfig points at prompt template overrides that can be edited without a rebuild
+type PromptsConfig struct {
+	Dir            string        `yaml:"dir"`             // *.json templates overriding built-ins by name; empty disables
+	ReloadInterval time.Duration `yaml:"reload_interval"` // How often Dir is checked for changes; 0 loads once
+}
+
+// ReplayConfig runs the story engine offline for reproducible testing: GLM replies come
+// from a recorded fixture, memories use hash embeddings in memory, and images and
+// narration are fixed stubs
+type ReplayConfig struct {
+	Fixture string `yaml:"fixture"` // JSON map of engine.PromptHash to reply; empty disables replay
+}
+
+// ContentFilterConfig lists terms that break the wuxia setting and how generated text
+// containing them is handled
+type ContentFilterConfig struct {
+	BannedTerms []string            `yaml:"banned_terms"` // For Chinese stories; empty disables the filter
+	Mode        string              `yaml:"mode"`         // regenerate (retry once, then mask) or mask
+	Languages   map[string][]string `yaml:"languages"`    // Banned terms for stories in other languages, e.g. en
+}
+
+// CacheConfig sizes the image and audio caches: the in-memory tier in front of each and
+// the disk budget behind it
+type CacheConfig struct {
+	ImageMemoryMB  int `yaml:"image_memory_mb"`   // Negative disables the memory tier
+	AudioMemoryMB  int `yaml:"audio_memory_mb"`   // Negative disables the memory tier
+	ImageMaxSizeMB int `yaml:"image_max_size_mb"` // Disk budget for cached images; 0 is unlimited
+	AudioMaxSizeMB int `yaml:"audio_max_size_mb"` // Disk budget for cached audio; 0 is unlimited
+}
+
 type MemoryConfig struct {
 	RetentionDays         int `yaml:"retention_days"`
 	MaxMemoriesPerSession int `yaml:"max_memories_per_session"`
 	SearchLimit           int `yaml:"search_limit"`
+	// SummaryInterval is how many turns pass between condensing recent events into the
+	// story summary; 0 uses the engine default and a negative value disables it
+	SummaryInterval int `yaml:"summary_interval"`
+	// WriteFlushInterval batches memory writes to the vector store, flushing at this
+	// interval or once WriteBatchSize memories are waiting; 0 writes them immediately
+	WriteFlushInterval time.Duration `yaml:"write_flush_interval"`
+	WriteBatchSize     int           `yaml:"write_batch_size"`
 }
 
 type LiveConfig struct {
-	Bilibili BilibiliConfig `yaml:"bilibili"`
-	Douyin   DouyinConfig   `yaml:"douyin"`
+	Bilibili BilibiliConfig       `yaml:"bilibili"`
+	Douyin   DouyinConfig         `yaml:"douyin"`
+	Archive  DanmakuArchiveConfig `yaml:"archive"`
+	// ReplayCount is how many recent danmaku new websocket clients receive on connect
+	ReplayCount int `yaml:"replay_count"`
+	// VoteWindow is how long /vote commands are collected before the winning option is applied
+	VoteWindow time.Duration `yaml:"vote_window"`
+	// ActionWindow batches danmaku action commands into one story generation per window
+	ActionWindow time.Duration `yaml:"action_window"`
+	// ActionCommands maps command verbs (e.g. "attack") to story action prefixes (e.g. "攻击")
+	ActionCommands map[string]string `yaml:"action_commands"`
+	// CommandAliases maps extra keywords viewers may type (e.g. "冲") to command verbs (e.g. "attack").
+	// Each action command's prefix is already a keyword for it.
+	CommandAliases map[string]string `yaml:"command_aliases"`
+	// Gift controls how gift value amplifies a viewer's votes and actions
+	Gift GiftInfluenceConfig `yaml:"gift"`
+	// Backpressure sizes the danmaku channels and how they shed load when they back up
+	Backpressure BackpressureConfig `yaml:"backpressure"`
+}
+
+// BackpressureConfig controls the danmaku pipeline's channel sizes and overload sampling
+type BackpressureConfig struct {
+	AdapterBuffer int `yaml:"adapter_buffer"` // Danmaku queued between the platform adapter and the service
+	HubBuffer     int `yaml:"hub_buffer"`     // Messages queued for the websocket hub
+	// SampleEvery keeps one in N chat danmaku while a channel is over 80% full; 1 disables sampling.
+	// Gifts and superchats are never sampled.
+	SampleEvery int `yaml:"sample_every"`
+	// SlowClientDrops disconnects a websocket client that misses this many messages in a row
+	// on a full send buffer; negative never disconnects
+	SlowClientDrops int `yaml:"slow_client_drops"`
+}
+
+// GiftInfluenceConfig controls gift-weighted audience influence
+type GiftInfluenceConfig struct {
+	Threshold int     `yaml:"threshold"`  // Gift value at which influence starts
+	Curve     string  `yaml:"curve"`      // "linear", "log" or "step"
+	MaxWeight float64 `yaml:"max_weight"` // Upper bound on a single viewer's vote weight
+}
+
+// DanmakuArchiveConfig controls long-term danmaku persistence to MySQL
+type DanmakuArchiveConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	RetentionDays int  `yaml:"retention_days"`
 }
 
 type BilibiliConfig struct {
 	RoomID            string        `yaml:"room_id"`
 	Cookie            string        `yaml:"cookie"`
 	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	DedupWindow       time.Duration `yaml:"dedup_window"`
 }
 
 type DouyinConfig struct {
 	RoomID            string        `yaml:"room_id"`
 	Cookie            string        `yaml:"cookie"`
 	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	DedupWindow       time.Duration `yaml:"dedup_window"`
+	SignerURL         string        `yaml:"signer_url"`     // Signing service for the webcast URL; Douyin can't connect without one
+	SignerTimeout     time.Duration `yaml:"signer_timeout"` // 0 uses the adapter's 10s default
 }
 
 type QueueConfig struct {
@@ -125,7 +262,7 @@ type LoggingConfig struct {
 	Output string `yaml:"output"`
 }
 
-// Load reads configuration from a YAML file
+// Load reads configuration from a YAML file, applies environment overrides and validates it
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -146,5 +283,9 @@ func Load(path string) (*Config, error) {
 		cfg.Database.Qdrant.APIKey = apiKey
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Defaults applied by Validate to settings left unset
+const (
+	DefaultServerTimeout     = 30 * time.Second
+	DefaultIdempotencyTTL    = 10 * time.Minute
+	DefaultRateLimitWindow   = time.Minute
+	DefaultMySQLMaxOpenConns = 100
+	DefaultMySQLMaxIdleConns = 10
+	DefaultMySQLConnLifetime = time.Hour
+	DefaultRedisPoolSize     = 50
+	DefaultQdrantHost        = "localhost"
+	DefaultQdrantPort        = 6333
+	DefaultQdrantVectorSize  = 2048
+	DefaultQdrantDistance    = "Cosine"
+	DefaultComfyUITimeout    = 60 * time.Second
+	DefaultSoVITSTimeout     = 30 * time.Second
+	DefaultHeartbeatInterval = 30 * time.Second
+	DefaultDanmakuBuffer     = 1000
+	DefaultDanmakuSampling   = 4
+	DefaultSlowClientDrops   = 50
+	DefaultQueueMaxWorkers   = 5
+	DefaultQueueMaxQueueSize = 1000
+	DefaultImageMemoryMB     = 64
+	DefaultAudioMemoryMB     = 32
+)
+
+// Validate fills documented defaults for unset timeouts, pool sizes and the Qdrant
+// endpoint, then checks required fields. Every problem found is reported in one error.
+func (c *Config) Validate() error {
+	c.applyDefaults()
+
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validPort(c.Server.Port), "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive, got %v", c.Server.ReadTimeout)
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive, got %v", c.Server.WriteTimeout)
+	check(c.Server.IdempotencyTTL > 0, "server.idempotency_ttl must be positive, got %v", c.Server.IdempotencyTTL)
+	check(c.Server.RateLimit.Window > 0, "server.rate_limit.window must be positive, got %v", c.Server.RateLimit.Window)
+	check(c.Server.RateLimit.PerStory >= 0, "server.rate_limit.per_story must not be negative, got %d", c.Server.RateLimit.PerStory)
+	for _, origin := range c.Server.AllowedOrigins {
+		check(validOrigin(origin), "server.allowed_origins entries must be \"*\" or scheme://host[:port], got %q", origin)
+	}
+	check(c.Server.RateLimit.PerUser >= 0, "server.rate_limit.per_user must not be negative, got %d", c.Server.RateLimit.PerUser)
+
+	// Replay mode answers from a recorded fixture and never calls a provider
+	check(c.AI.Replay.Fixture != "" || c.AI.GLM5.APIKey != "" || c.AI.Embedding.APIKey != "",
+		"an AI provider key is required: set ai.glm5.api_key, ai.embedding.api_key or ZHIPUAI_API_KEY")
+
+	mysql := c.Database.MySQL
+	check(mysql.Port == 0 || validPort(mysql.Port), "database.mysql.port must be between 1 and 65535, got %d", mysql.Port)
+	check(mysql.MaxOpenConns > 0, "database.mysql.max_open_conns must be positive, got %d", mysql.MaxOpenConns)
+	check(mysql.MaxIdleConns >= 0 && mysql.MaxIdleConns <= mysql.MaxOpenConns,
+		"database.mysql.max_idle_conns must be between 0 and max_open_conns (%d), got %d", mysql.MaxOpenConns, mysql.MaxIdleConns)
+	check(mysql.ConnMaxLifetime > 0, "database.mysql.conn_max_lifetime must be positive, got %v", mysql.ConnMaxLifetime)
+
+	redis := c.Database.Redis
+	check(redis.Port == 0 || validPort(redis.Port), "database.redis.port must be between 1 and 65535, got %d", redis.Port)
+	check(redis.PoolSize > 0, "database.redis.pool_size must be positive, got %d", redis.PoolSize)
+
+	qdrant := c.Database.Qdrant
+	check(validPort(qdrant.Port), "database.qdrant.port must be between 1 and 65535, got %d", qdrant.Port)
+	check(qdrant.VectorSize > 0, "database.qdrant.vector_size must be positive, got %d", qdrant.VectorSize)
+	check(validDistance(qdrant.Distance), "database.qdrant.distance must be Cosine, Euclid or Dot, got %q", qdrant.Distance)
+	for name, distance := range qdrant.Distances {
+		check(validDistance(distance), "database.qdrant.distances.%s must be Cosine, Euclid or Dot, got %q", name, distance)
+	}
+
+	check(qdrant.ConnectRetry >= 0, "database.qdrant.connect_retry must not be negative, got %v", qdrant.ConnectRetry)
+	check(qdrant.ReconnectInterval >= 0, "database.qdrant.reconnect_interval must not be negative, got %v", qdrant.ReconnectInterval)
+
+	check(c.Memory.WriteFlushInterval >= 0, "memory.write_flush_interval must not be negative, got %v", c.Memory.WriteFlushInterval)
+	check(c.Memory.WriteBatchSize >= 0, "memory.write_batch_size must not be negative, got %d", c.Memory.WriteBatchSize)
+
+	check(c.AI.GLM5.Temperature >= 0 && c.AI.GLM5.Temperature <= 1,
+		"ai.glm5.temperature must be between 0 and 1, got %v", c.AI.GLM5.Temperature)
+	check(c.AI.GLM5.MaxTokens >= 0, "ai.glm5.max_tokens must not be negative, got %d", c.AI.GLM5.MaxTokens)
+	check(c.AI.GLM5.RateLimit >= 0, "ai.glm5.rate_limit must not be negative, got %v", c.AI.GLM5.RateLimit)
+	check(c.AI.GLM5.Burst >= 0, "ai.glm5.burst must not be negative, got %d", c.AI.GLM5.Burst)
+	check(c.AI.GLM5.MaxConcurrent >= 0, "ai.glm5.max_concurrent must not be negative, got %d", c.AI.GLM5.MaxConcurrent)
+	check(c.AI.ComfyUI.Timeout > 0, "ai.comfyui.timeout must be positive, got %v", c.AI.ComfyUI.Timeout)
+	check(c.AI.SoVITS.Timeout > 0, "ai.sovits.timeout must be positive, got %v", c.AI.SoVITS.Timeout)
+	switch c.AI.ContentFilter.Mode {
+	case "", "regenerate", "mask":
+	default:
+		errs = append(errs, fmt.Errorf("ai.content_filter.mode must be regenerate or mask, got %q", c.AI.ContentFilter.Mode))
+	}
+	for language := range c.AI.ContentFilter.Languages {
+		// Chinese terms live in banned_terms; a zh entry here would silently replace them
+		check(language != "" && !strings.EqualFold(language, "zh"),
+			"ai.content_filter.languages must name a language other than zh, got %q", language)
+	}
+
+	check(c.Live.Douyin.SignerTimeout >= 0, "live.douyin.signer_timeout must not be negative, got %v", c.Live.Douyin.SignerTimeout)
+	check(c.Live.ReplayCount >= 0, "live.replay_count must not be negative, got %d", c.Live.ReplayCount)
+	check(c.Live.VoteWindow >= 0, "live.vote_window must not be negative, got %v", c.Live.VoteWindow)
+	check(c.Live.ActionWindow >= 0, "live.action_window must not be negative, got %v", c.Live.ActionWindow)
+	switch c.Live.Gift.Curve {
+	case "", "linear", "log", "step":
+	default:
+		errs = append(errs, fmt.Errorf("live.gift.curve must be linear, log or step, got %q", c.Live.Gift.Curve))
+	}
+	check(c.Live.Backpressure.AdapterBuffer >= 0, "live.backpressure.adapter_buffer must not be negative, got %d", c.Live.Backpressure.AdapterBuffer)
+	check(c.Live.Backpressure.HubBuffer >= 0, "live.backpressure.hub_buffer must not be negative, got %d", c.Live.Backpressure.HubBuffer)
+	check(c.Live.Backpressure.SampleEvery >= 0, "live.backpressure.sample_every must not be negative, got %d", c.Live.Backpressure.SampleEvery)
+	for alias, verb := range c.Live.CommandAliases {
+		check(verb != "", "live.command_aliases.%s must name a command verb", alias)
+	}
+
+	check(c.Queue.MaxWorkers > 0, "queue.max_workers must be positive, got %d", c.Queue.MaxWorkers)
+	check(c.Cache.ImageMaxSizeMB >= 0, "cache.image_max_size_mb must not be negative, got %d", c.Cache.ImageMaxSizeMB)
+	check(c.Cache.AudioMaxSizeMB >= 0, "cache.audio_max_size_mb must not be negative, got %d", c.Cache.AudioMaxSizeMB)
+	check(c.Queue.MaxQueueSize > 0, "queue.max_queue_size must be positive, got %d", c.Queue.MaxQueueSize)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// applyDefaults fills zero-valued settings that have a documented default
+func (c *Config) applyDefaults() {
+	setDuration(&c.Server.ReadTimeout, DefaultServerTimeout)
+	setDuration(&c.Server.WriteTimeout, DefaultServerTimeout)
+	setDuration(&c.Server.IdempotencyTTL, DefaultIdempotencyTTL)
+	setDuration(&c.Server.RateLimit.Window, DefaultRateLimitWindow)
+
+	setInt(&c.Database.MySQL.MaxOpenConns, DefaultMySQLMaxOpenConns)
+	setInt(&c.Database.MySQL.MaxIdleConns, DefaultMySQLMaxIdleConns)
+	setDuration(&c.Database.MySQL.ConnMaxLifetime, DefaultMySQLConnLifetime)
+	setInt(&c.Database.Redis.PoolSize, DefaultRedisPoolSize)
+
+	if c.Database.Qdrant.Host == "" {
+		c.Database.Qdrant.Host = DefaultQdrantHost
+	}
+	setInt(&c.Database.Qdrant.Port, DefaultQdrantPort)
+	setInt(&c.Database.Qdrant.VectorSize, DefaultQdrantVectorSize)
+	if c.Database.Qdrant.Distance == "" {
+		c.Database.Qdrant.Distance = DefaultQdrantDistance
+	}
+
+	setDuration(&c.AI.ComfyUI.Timeout, DefaultComfyUITimeout)
+	setDuration(&c.AI.SoVITS.Timeout, DefaultSoVITSTimeout)
+
+	setDuration(&c.Live.Bilibili.HeartbeatInterval, DefaultHeartbeatInterval)
+	setDuration(&c.Live.Douyin.HeartbeatInterval, DefaultHeartbeatInterval)
+	setInt(&c.Live.Backpressure.AdapterBuffer, DefaultDanmakuBuffer)
+	setInt(&c.Live.Backpressure.HubBuffer, DefaultDanmakuBuffer)
+	setInt(&c.Live.Backpressure.SampleEvery, DefaultDanmakuSampling)
+	setInt(&c.Live.Backpressure.SlowClientDrops, DefaultSlowClientDrops)
+
+	setInt(&c.Queue.MaxWorkers, DefaultQueueMaxWorkers)
+	setInt(&c.Queue.MaxQueueSize, DefaultQueueMaxQueueSize)
+
+	setInt(&c.Cache.ImageMemoryMB, DefaultImageMemoryMB)
+	setInt(&c.Cache.AudioMemoryMB, DefaultAudioMemoryMB)
+}
+
+// Megabytes converts a megabyte setting to bytes, treating negative settings as 0
+func Megabytes(mb int) int64 {
+	if mb < 0 {
+		return 0
+	}
+	return int64(mb) << 20
+}
+
+// validOrigin reports whether origin is "*" or a bare http(s) origin with no path
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(strings.TrimSuffix(origin, "/"))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+// validDistance reports whether a vector distance metric is one Qdrant supports
+func validDistance(distance string) bool {
+	return distance == "Cosine" || distance == "Euclid" || distance == "Dot"
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func setInt(field *int, def int) {
+	if *field == 0 {
+		*field = def
+	}
+}
+
+func setDuration(field *time.Duration, def time.Duration) {
+	if *field == 0 {
+		*field = def
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// minimalConfig returns the smallest config Validate accepts
+func minimalConfig() *Config {
+	c := &Config{}
+	c.Server.Port = 8080
+	c.AI.GLM5.APIKey = "key"
+	return c
+}
+
+func TestValidateReplayNeedsNoKey(t *testing.T) {
+	c := minimalConfig()
+	c.AI.GLM5.APIKey = ""
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "AI provider key") {
+		t.Fatalf("Validate without a key = %v, want the provider key error", err)
+	}
+
+	c.AI.Replay.Fixture = "testdata/session.json"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate in replay mode: %v", err)
+	}
+}
+
+func TestValidateMinimalConfigAppliesDefaults(t *testing.T) {
+	c := minimalConfig()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if c.Server.ReadTimeout != DefaultServerTimeout || c.Database.MySQL.MaxOpenConns != DefaultMySQLMaxOpenConns {
+		t.Errorf("server timeout %v, mysql pool %d, want the defaults", c.Server.ReadTimeout, c.Database.MySQL.MaxOpenConns)
+	}
+	qdrant := c.Database.Qdrant
+	if qdrant.Host != DefaultQdrantHost || qdrant.Port != DefaultQdrantPort || qdrant.Distance != DefaultQdrantDistance {
+		t.Errorf("qdrant = %s:%d %s, want the default endpoint", qdrant.Host, qdrant.Port, qdrant.Distance)
+	}
+	if c.Queue.MaxWorkers != DefaultQueueMaxWorkers || c.Queue.MaxQueueSize != DefaultQueueMaxQueueSize {
+		t.Errorf("queue = %d workers, %d slots, want the defaults", c.Queue.MaxWorkers, c.Queue.MaxQueueSize)
+	}
+
+	// Explicit settings are kept
+	c = minimalConfig()
+	c.Database.Redis.PoolSize = 7
+	if err := c.Validate(); err != nil || c.Database.Redis.PoolSize != 7 {
+		t.Errorf("Validate = %v with pool size %d, want 7 kept", err, c.Database.Redis.PoolSize)
+	}
+}
+
+func TestValidateRejectsInvalidConfigs(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"no port", func(c *Config) { c.Server.Port = 0 }, "server.port"},
+		{"port out of range", func(c *Config) { c.Server.Port = 70000 }, "server.port"},
+		{"negative timeout", func(c *Config) { c.Server.ReadTimeout = -time.Second }, "server.read_timeout"},
+		{"origin with path", func(c *Config) { c.Server.AllowedOrigins = []string{"https://example.com/app"} }, "server.allowed_origins"},
+		{"idle above open conns", func(c *Config) {
+			c.Database.MySQL.MaxOpenConns = 5
+			c.Database.MySQL.MaxIdleConns = 10
+		}, "max_idle_conns"},
+		{"redis port", func(c *Config) { c.Database.Redis.Port = -1 }, "database.redis.port"},
+		{"unknown distance", func(c *Config) { c.Database.Qdrant.Distance = "Manhattan" }, "database.qdrant.distance"},
+		{"temperature", func(c *Config) { c.AI.GLM5.Temperature = 1.5 }, "ai.glm5.temperature"},
+		{"filter mode", func(c *Config) { c.AI.ContentFilter.Mode = "drop" }, "ai.content_filter.mode"},
+		{"zh filter language", func(c *Config) { c.AI.ContentFilter.Languages = map[string][]string{"ZH": {"x"}} }, "ai.content_filter.languages"},
+		{"gift curve", func(c *Config) { c.Live.Gift.Curve = "exp" }, "live.gift.curve"},
+		{"vote window", func(c *Config) { c.Live.VoteWindow = -time.Second }, "live.vote_window"},
+		{"empty alias", func(c *Config) { c.Live.CommandAliases = map[string]string{"打": ""} }, "live.command_aliases"},
+		{"queue workers", func(c *Config) { c.Queue.MaxWorkers = -1 }, "queue.max_workers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := minimalConfig()
+			tt.modify(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	c := minimalConfig()
+	c.Server.Port = 0
+	c.AI.GLM5.APIKey = ""
+	c.Live.Gift.Curve = "exp"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted three problems")
+	}
+	for _, want := range []string{"server.port", "AI provider key", "live.gift.curve"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"strings"
+
+	"Cyber-Jianghu/server/internal/generators"
+)
+
+const (
+	defaultAspectRatio    = "16:9"
+	defaultNegativePrompt = "text, watermark, signature, low quality, blurry"
+)
+
+// VisualSpec describes how to render the scene image for a story turn
+type VisualSpec struct {
+	Prompt      string                `json:"prompt"`
+	Negative    string                `json:"negative"`
+	LoRAs       []generators.LoraSpec `json:"loras,omitempty"`
+	Style       string                `json:"style"`
+	AspectRatio string                `json:"aspect_ratio"`
+	SceneKey    string                `json:"scene_key"` // Cache key shared by every visit to the scene
+}
+
+// AudioSpec describes how to narrate a story turn
+type AudioSpec struct {
+	Text     string  `json:"text"`
+	VoiceID  string  `json:"voice_id"`
+	Speed    float64 `json:"speed"`
+	Language string  `json:"language"` // TTS language, matching the story
+}
+
+// genreNegativePrompts keeps anachronistic elements out of genre-specific scenes
+var genreNegativePrompts = map[string]string{
+	"武侠":    "modern clothing, neon, cyberpunk, sci-fi, guns, cars, skyscrapers, electronics",
+	"wuxia": "modern clothing, neon, cyberpunk, sci-fi, guns, cars, skyscrapers, electronics",
+	"仙侠":    "modern clothing, neon, cyberpunk, guns, cars, skyscrapers, electronics",
+	"宫廷":    "modern clothing, neon, sci-fi, guns, cars, electronics",
+}
+
+// toneSpeeds adjusts narration pace to match the story tone
+var toneSpeeds = map[string]float64{
+	"史诗":           0.95,
+	"悬疑":           0.9,
+	"悲壮":           0.9,
+	"轻松":           1.1,
+	"幽默":           1.1,
+	"epic":         0.95,
+	"suspenseful":  0.9,
+	"tragic":       0.9,
+	"lighthearted": 1.1,
+	"humorous":     1.1,
+}
+
+// buildVisualSpec builds the image generation spec for a scene
+func buildVisualSpec(prompt string, state *StoryState) *VisualSpec {
+	negative := defaultNegativePrompt
+	if genreNegative, ok := genreNegativePrompts[state.Genre]; ok {
+		negative = generators.MergeNegativePrompts(genreNegative, negative)
+	}
+
+	style := state.Style
+	if state.Genre != "" {
+		style = strings.TrimSpace(state.Genre + " " + state.Style)
+	}
+
+	return &VisualSpec{
+		Prompt:      prompt,
+		Negative:    negative,
+		Style:       style,
+		AspectRatio: defaultAspectRatio,
+	}
+}
+
+// buildAudioSpec builds the narration spec for a story turn
+func buildAudioSpec(text string, options []StoryOption, voiceID string, tone string, language string) *AudioSpec {
+	speed := 1.0
+	if toneSpeed, ok := toneSpeeds[tone]; ok {
+		speed = toneSpeed
+	}
+
+	return &AudioSpec{
+		Text:     narrationText(text, options),
+		VoiceID:  voiceID,
+		Speed:    speed,
+		Language: language,
+	}
+}
+
+// narrationText strips the trailing option list so only the narrative is read aloud
+func narrationText(text string, options []StoryOption) string {
+	// Parsed option text drops the space models put after the marker ("A. 拔剑" is "A.拔剑"),
+	// so option lines are matched with spaces removed
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if isOptionLine(lines[i], options) {
+			return strings.TrimSpace(strings.Join(lines[:i], "\n"))
+		}
+	}
+
+	for _, opt := range options {
+		if opt.Text == "" {
+			continue
+		}
+		if idx := strings.Index(text, opt.Text); idx > 0 {
+			return strings.TrimSpace(text[:idx])
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// isOptionLine reports whether a line of generated text starts one of the options
+func isOptionLine(line string, options []StoryOption) bool {
+	compact := strings.ReplaceAll(strings.TrimSpace(line), " ", "")
+	for _, opt := range options {
+		if opt.Text != "" && strings.HasPrefix(compact, strings.ReplaceAll(opt.Text, " ", "")) {
+			return true
+		}
+	}
+	return false
+}
+
+// sceneCharacters lists the characters present in a scene for image prompts
+func sceneCharacters(state *StoryState) []string {
+	characters := make([]string, 0)
+	if state.Protagonist != "" {
+		characters = append(characters, state.Protagonist)
+	}
+	for _, name := range strings.FieldsFunc(state.NPCs, func(r rune) bool {
+		return r == ',' || r == '，' || r == '、' || r == '\n'
+	}) {
+		if name = strings.TrimSpace(name); name != "" {
+			characters = append(characters, name)
+		}
+	}
+	return characters
+}
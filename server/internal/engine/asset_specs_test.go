@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"Cyber-Jianghu/server/internal/generators"
+)
+
+func TestBuildVisualSpec(t *testing.T) {
+	spec := buildVisualSpec("a misty bamboo grove", &StoryState{Genre: "武侠", Style: "水墨"})
+	if spec.Prompt != "a misty bamboo grove" || spec.AspectRatio != defaultAspectRatio {
+		t.Errorf("prompt %q, aspect %q", spec.Prompt, spec.AspectRatio)
+	}
+	if spec.Style != "武侠 水墨" {
+		t.Errorf("style = %q, want genre and style joined", spec.Style)
+	}
+	if !strings.HasPrefix(spec.Negative, "modern clothing, neon") || !strings.HasSuffix(spec.Negative, "low quality, blurry") {
+		t.Errorf("negative = %q, want the genre terms followed by the defaults", spec.Negative)
+	}
+
+	// An unknown genre keeps only the default negatives; no genre leaves the style alone
+	plain := buildVisualSpec("a street", &StoryState{Style: "写实"})
+	if plain.Negative != defaultNegativePrompt || plain.Style != "写实" {
+		t.Errorf("plain spec negative %q, style %q", plain.Negative, plain.Style)
+	}
+}
+
+func TestBuildVisualSpecWithoutLoRAs(t *testing.T) {
+	spec := buildVisualSpec("a street", &StoryState{Genre: "wuxia"})
+	if spec.LoRAs != nil {
+		t.Fatalf("LoRAs = %+v, want none", spec.LoRAs)
+	}
+	data, _ := json.Marshal(spec)
+	if strings.Contains(string(data), "loras") {
+		t.Errorf("spec JSON %s carries an empty loras field", data)
+	}
+}
+
+func TestBuildAudioSpec(t *testing.T) {
+	options := []StoryOption{{ID: "A", Text: "A. 推门进客栈"}, {ID: "B", Text: "B. 转身离开"}}
+	text := "夜雨敲窗，李逍遥立在客栈门外。\nA. 推门进客栈\nB. 转身离开"
+
+	spec := buildAudioSpec(text, options, "narrator", "悬疑", "zh")
+	if spec.Text != "夜雨敲窗，李逍遥立在客栈门外。" {
+		t.Errorf("narration = %q, want the options stripped", spec.Text)
+	}
+	if spec.VoiceID != "narrator" || spec.Speed != 0.9 || spec.Language != "zh" {
+		t.Errorf("spec = %+v", spec)
+	}
+
+	// Parsed options lose the space after the marker and must still match their lines
+	parsed := []StoryOption{{ID: "A", Text: "A.推门进客栈", Description: "推门进客栈"}}
+	if got := buildAudioSpec(text, parsed, "", "", "zh"); got.Text != "夜雨敲窗，李逍遥立在客栈门外。" {
+		t.Errorf("narration with parsed options = %q, want the options stripped", got.Text)
+	}
+
+	if got := buildAudioSpec(text, nil, "", "epic", "en"); got.Speed != 0.95 || got.Text != text {
+		t.Errorf("English epic spec = %+v", got)
+	}
+	if got := buildAudioSpec("风起。", nil, "", "未知", "zh"); got.Speed != 1.0 {
+		t.Errorf("unknown tone speed = %v, want 1.0", got.Speed)
+	}
+}
+
+func TestBuildAudioSpecWithoutVoice(t *testing.T) {
+	spec := buildAudioSpec("风起。", nil, "", "", "zh")
+	if spec.VoiceID != "" {
+		t.Fatalf("voice = %q, want empty", spec.VoiceID)
+	}
+	// The field is still sent so clients can tell the server default applies
+	data, _ := json.Marshal(spec)
+	if !strings.Contains(string(data), `"voice_id":""`) {
+		t.Errorf("spec JSON %s has no voice_id", data)
+	}
+}
+
+func TestSceneChangeSpecsCarryCharacterLoRA(t *testing.T) {
+	scenes := map[string]string{
+		"## 玩家的行为\n" + openingAction: "【场景：悦来客栈】\n夜雨敲窗，李逍遥立在客栈门外。\nA. 推门进客栈\nB. 转身离开",
+		"## 玩家的行为\n转身离开":             "【场景：竹林】\n竹影摇曳，李逍遥独自前行。\nA. 拔剑\nB. 继续赶路",
+	}
+	ctx := context.Background()
+
+	for _, withLoRA := range []bool{false, true} {
+		e := newReplayTestEngine(t, &scriptedChatClient{replies: scenes})
+		if withLoRA {
+			registry := generators.NewLoRARegistry(t.TempDir())
+			err := registry.RegisterModel(&generators.LoRAModel{ID: "lxy", Type: "character", CharacterName: "李逍遥", Strength: 0.8, Enabled: true})
+			if err != nil {
+				t.Fatalf("RegisterModel: %v", err)
+			}
+			e.SetLoRARegistry(registry)
+		}
+		if _, err := e.CreateStory(ctx, "specs", map[string]interface{}{"protagonist": "李逍遥"}); err != nil {
+			t.Fatalf("CreateStory: %v", err)
+		}
+
+		resp, err := e.ApplyOption(ctx, "specs", "B", "转身离开")
+		if err != nil {
+			t.Fatalf("ApplyOption: %v", err)
+		}
+		if !resp.SceneChange || resp.VisualPrompt == nil {
+			t.Fatalf("moving to 竹林 gave no scene change or visual spec: %+v", resp)
+		}
+		if resp.VisualPrompt.SceneKey != SceneKey("specs", "竹林") {
+			t.Errorf("scene key = %q", resp.VisualPrompt.SceneKey)
+		}
+
+		loras := resp.VisualPrompt.LoRAs
+		switch {
+		case withLoRA && (len(loras) != 1 || loras[0].Name != "lxy.safetensors" || loras[0].Strength != 0.8):
+			t.Errorf("LoRAs = %+v, want lxy.safetensors at 0.8", loras)
+		case !withLoRA && len(loras) != 0:
+			t.Errorf("LoRAs = %+v without a registry, want none", loras)
+		}
+
+		if resp.AudioPrompt == nil || resp.AudioPrompt.Text != "竹影摇曳，李逍遥独自前行。" {
+			t.Errorf("audio spec = %+v, want the narration without options", resp.AudioPrompt)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package engine
+
+import "context"
+
+// ChatClient is the chat completion API the engine generates story text with.
+// GLM5Client is the production client; ReplayChatClient answers from recorded
+// responses so the engine can run without network access.
+type ChatClient interface {
+	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+	Stats() GLMStats
+}
+
+var _ ChatClient = (*GLM5Client)(nil)
+
+// SetChatClient replaces the client used for story generation, summaries, NPCs and
+// content filter retries. Call it before enabling translation, which captures the
+// client at that point.
+func (e *StoryEngine) SetChatClient(client ChatClient) {
+	e.glm5Client = client
+}
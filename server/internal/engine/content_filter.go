@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"Cyber-Jianghu/server/internal/prompts"
+)
+
+// Content filter modes
+const (
+	FilterModeRegenerate = "regenerate" // Retry once with a stricter instruction, then mask
+	FilterModeMask       = "mask"       // Mask banned terms in place
+)
+
+const filterMaskRune = "□"
+
+// ContentFilterResult reports what the banned-term filter did to a segment
+type ContentFilterResult struct {
+	Triggered   bool     `json:"triggered"`
+	Terms       []string `json:"terms"`       // Banned terms found in the first reply
+	Regenerated bool     `json:"regenerated"` // The segment was generated a second time
+	Masked      bool     `json:"masked"`      // Terms were masked in the returned text
+}
+
+// asciiWordRegex matches terms made of ASCII letters and digits, which only match whole words
+var asciiWordRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 '-]*$`)
+
+// ContentFilter finds banned terms in generated text, ignoring ASCII case
+type ContentFilter struct {
+	pattern *regexp.Regexp
+	mode    string
+}
+
+// NewContentFilter builds a filter for terms; it returns nil when there are no terms.
+// An unknown mode is treated as regenerate. ASCII terms match whole words only, so AI
+// does not match said.
+func NewContentFilter(terms []string, mode string) *ContentFilter {
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		if asciiWordRegex.MatchString(term) {
+			quoted = append(quoted, `\b`+regexp.QuoteMeta(term)+`\b`)
+		} else {
+			quoted = append(quoted, regexp.QuoteMeta(term))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+
+	// Longest first so overlapping terms mask completely
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+
+	if mode != FilterModeMask {
+		mode = FilterModeRegenerate
+	}
+	return &ContentFilter{
+		pattern: regexp.MustCompile("(?i)" + strings.Join(quoted, "|")),
+		mode:    mode,
+	}
+}
+
+// Find returns the distinct banned terms in texts, as written in the text
+func (f *ContentFilter) Find(texts ...string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, text := range texts {
+		for _, match := range f.pattern.FindAllString(text, -1) {
+			if !seen[match] {
+				seen[match] = true
+				terms = append(terms, match)
+			}
+		}
+	}
+	return terms
+}
+
+// Mask replaces each banned term with one mask character per rune
+func (f *ContentFilter) Mask(text string) string {
+	return f.pattern.ReplaceAllStringFunc(text, func(match string) string {
+		return strings.Repeat(filterMaskRune, utf8.RuneCountInString(match))
+	})
+}
+
+// SetContentFilter sets the banned-term filter applied to Chinese stories; nil disables it
+func (e *StoryEngine) SetContentFilter(filter *ContentFilter) {
+	e.SetLanguageContentFilter(prompts.DefaultLanguage, filter)
+}
+
+// SetLanguageContentFilter sets the banned-term filter applied to stories in a language;
+// nil disables it. Each language has its own list, since terms rarely carry over.
+func (e *StoryEngine) SetLanguageContentFilter(language string, filter *ContentFilter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.contentFilters == nil {
+		e.contentFilters = make(map[string]*ContentFilter)
+	}
+	e.contentFilters[prompts.NormalizeLanguage(language)] = filter
+}
+
+// filterSegment checks a parsed segment for banned terms. In regenerate mode it asks the
+// model once more with the offending terms called out, masking whatever still slips
+// through; a failed retry keeps the first reply, masked. A retry's tokens are added to usage.
+func (e *StoryEngine) filterSegment(ctx context.Context, storyID string, language string, req *ChatRequest, content string, segment segmentParts, structured bool, usage *Usage) (segmentParts, *ContentFilterResult) {
+	e.mu.RLock()
+	filter := e.contentFilters[language]
+	e.mu.RUnlock()
+
+	if filter == nil {
+		return segment, nil
+	}
+	terms := filter.Find(segmentTexts(segment)...)
+	if len(terms) == 0 {
+		return segment, nil
+	}
+
+	result := &ContentFilterResult{Triggered: true, Terms: terms}
+	e.loggerFor(ctx).Warn("banned terms in generated text", "story_id", storyID, "terms", terms, "mode", filter.mode)
+
+	if filter.mode == FilterModeRegenerate {
+		retry := *req
+		retry.Messages = append(append([]ChatMessage(nil), req.Messages...),
+			ChatMessage{Role: "assistant", Content: content},
+			ChatMessage{Role: "user", Content: defaultsFor(language).retryInstruction(terms)},
+		)
+
+		resp, err := e.glm5Client.Chat(ctx, &retry)
+		if err == nil {
+			usage.Add(resp.Usage)
+		}
+		if err == nil && len(resp.Choices) > 0 {
+			segment = e.parseSegment(ctx, storyID, resp.Choices[0].Message.Content, structured)
+			result.Regenerated = true
+		} else {
+			e.loggerFor(ctx).Warn("content filter regeneration failed, masking", "story_id", storyID, "error", err)
+		}
+		if len(filter.Find(segmentTexts(segment)...)) == 0 {
+			return segment, result
+		}
+	}
+
+	segment.text = filter.Mask(segment.text)
+	segment.scene = filter.Mask(segment.scene)
+	segment.visualPrompt = filter.Mask(segment.visualPrompt)
+	options := make([]StoryOption, len(segment.options))
+	for i, opt := range segment.options {
+		opt.Text = filter.Mask(opt.Text)
+		opt.Description = filter.Mask(opt.Description)
+		options[i] = opt
+	}
+	segment.options = options
+	result.Masked = true
+	return segment, result
+}
+
+// segmentTexts lists the player-visible text of a segment
+func segmentTexts(segment segmentParts) []string {
+	texts := []string{segment.text, segment.scene}
+	for _, opt := range segment.options {
+		texts = append(texts, opt.Text, opt.Description)
+	}
+	return texts
+}
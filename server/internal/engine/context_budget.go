@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"Cyber-Jianghu/server/internal/rag"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxInputTokens keeps story prompts well inside GLM's context window
+const defaultMaxInputTokens = 6000
+
+// truncationMarker prefixes previous text whose start was cut
+const truncationMarker = "……"
+
+// ContextTrim reports what was cut from a prompt to fit the input token budget
+type ContextTrim struct {
+	Budget                int      `json:"budget"`
+	EstimatedTokens       int      `json:"estimated_tokens"`            // After trimming
+	DroppedMemories       []string `json:"dropped_memories,omitempty"`  // Memory IDs
+	DroppedDecisions      []string `json:"dropped_decisions,omitempty"` // Decision memory IDs
+	PreviousTextTruncated bool     `json:"previous_text_truncated,omitempty"`
+}
+
+// estimateTokens approximates GLM token usage: roughly one token per CJK character and
+// one per four ASCII characters
+func estimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return other + (ascii+3)/4
+}
+
+// SetMaxInputTokens sets the estimated prompt size story generation trims to; 0 disables trimming
+func (e *StoryEngine) SetMaxInputTokens(tokens int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if tokens < 0 {
+		tokens = 0
+	}
+	e.maxInputTokens = tokens
+}
+
+// fitContextBudget drops the lowest-scoring memories, then the oldest decisions, then the
+// start of the previous text until the prompt fits. base is the estimate for the prompt
+// without any of them. Memories must arrive sorted by descending score.
+func fitContextBudget(base, budget int, memories []*rag.Memory, decisions []*rag.DecisionMemory, previousText string) ([]*rag.Memory, []*rag.DecisionMemory, string, *ContextTrim) {
+	// Most recent decisions first, so the oldest are dropped first
+	decisions = append([]*rag.DecisionMemory(nil), decisions...)
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Timestamp > decisions[j].Timestamp
+	})
+
+	memoryTexts := buildMemoryTexts(memories)
+	decisionTexts := buildDecisionTexts(decisions)
+
+	total := base + estimateTokens(previousText)
+	for _, text := range memoryTexts {
+		total += estimateTokens(text) + 1
+	}
+	for _, text := range decisionTexts {
+		total += estimateTokens(text) + 1
+	}
+
+	trim := &ContextTrim{Budget: budget}
+
+	for total > budget && len(memories) > 0 {
+		last := len(memories) - 1
+		total -= estimateTokens(memoryTexts[last]) + 1
+		trim.DroppedMemories = append(trim.DroppedMemories, memories[last].ID)
+		memories, memoryTexts = memories[:last], memoryTexts[:last]
+	}
+
+	for total > budget && len(decisions) > 0 {
+		last := len(decisions) - 1
+		total -= estimateTokens(decisionTexts[last]) + 1
+		trim.DroppedDecisions = append(trim.DroppedDecisions, decisions[last].ID)
+		decisions, decisionTexts = decisions[:last], decisionTexts[:last]
+	}
+
+	if total > budget && previousText != "" {
+		// Keep the end of the previous segment, which leads into this turn
+		over := total - budget + estimateTokens(truncationMarker)
+		runes := []rune(previousText)
+		cut := 0
+		for cut < len(runes) && over > 0 {
+			over -= estimateTokens(string(runes[cut]))
+			cut++
+		}
+		total -= estimateTokens(previousText)
+		previousText = truncationMarker + strings.TrimSpace(string(runes[cut:]))
+		total += estimateTokens(previousText)
+		trim.PreviousTextTruncated = true
+	}
+
+	trim.EstimatedTokens = total
+	return memories, decisions, previousText, trim
+}
@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
@@ -25,6 +30,8 @@ type GLM5Client struct {
 	baseURL    string
 	apiKey     string
 	httpClient *http.Client
+	limiter    *glmLimiter
+	usage      usageCounter // Tokens used by successful requests
 }
 
 // ChatMessage represents a chat message
@@ -40,6 +47,12 @@ type ChatRequest struct {
 	Temperature float64       `json:"temperature,omitempty"`
 	MaxTokens   int           `json:"max_tokens,omitempty"`
 	Stream      bool          `json:"stream,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// ResponseFormat constrains the reply format, e.g. {"type": "json_object"}
+type ResponseFormat struct {
+	Type string `json:"type"`
 }
 
 // ChatResponse represents a chat completion response
@@ -102,10 +115,16 @@ type EmbeddingUsage struct {
 	TotalTokens  int `json:"total_tokens"`
 }
 
-// NewGLM5Client creates a new GLM-5 API client
-func NewGLM5Client(apiKey string) *GLM5Client {
+// NewGLM5Client creates a new GLM-5 API client; an empty baseURL uses the Zhipu endpoint,
+// anything else should be an OpenAI-compatible API root
+func NewGLM5Client(apiKey string, baseURL string) *GLM5Client {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
 	config := openai.DefaultConfig(apiKey)
-	config.BaseURL = defaultBaseURL
+	config.BaseURL = baseURL
 
 	httpClient := &http.Client{
 		Timeout: defaultTimeout,
@@ -113,12 +132,27 @@ func NewGLM5Client(apiKey string) *GLM5Client {
 
 	return &GLM5Client{
 		client:     openai.NewClientWithConfig(config),
-		baseURL:    defaultBaseURL,
+		baseURL:    baseURL,
 		apiKey:     apiKey,
 		httpClient: httpClient,
+		limiter:    newGLMLimiter(0, 1, 0),
 	}
 }
 
+// SetLimits bounds chat requests to ratePerSecond (with burst) and maxConcurrent in flight.
+// Zero rate or concurrency leaves that dimension unlimited. Call before the client is shared.
+func (c *GLM5Client) SetLimits(ratePerSecond float64, burst int, maxConcurrent int) {
+	c.limiter = newGLMLimiter(ratePerSecond, burst, maxConcurrent)
+}
+
+// Stats returns in-flight and waiting request counts along with the configured limits,
+// and the tokens used so far
+func (c *GLM5Client) Stats() GLMStats {
+	stats := c.limiter.stats()
+	stats.Usage = c.usage.snapshot()
+	return stats
+}
+
 // Chat sends a chat completion request
 func (c *GLM5Client) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
 	var lastErr error
@@ -132,8 +166,14 @@ func (c *GLM5Client) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse,
 			}
 		}
 
+		// Every attempt, retries included, counts against the limits
+		if err := c.limiter.acquire(ctx); err != nil {
+			return nil, err
+		}
 		response, err := c.doChatRequest(ctx, req)
+		c.limiter.release()
 		if err == nil {
+			c.usage.add(response.Usage)
 			return response, nil
 		}
 
@@ -260,24 +300,15 @@ func isRetryableError(err error) bool {
 	if err == nil {
 		return false
 	}
-	errStr := err.Error()
-	return contains(errStr, "timeout") ||
-		contains(errStr, "connection refused") ||
-		contains(errStr, "rate limit")
-}
 
-// contains checks if a string contains a substring (case-insensitive)
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr ||
-		len(substr) == 0 ||
-		stringsContains(s, substr))
-}
-
-func stringsContains(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
+	var netErr net.Error
+	if (errors.As(err, &netErr) && netErr.Timeout()) || os.IsTimeout(err) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
 	}
-	return false
+
+	// API errors only carry the reason in their message
+	errStr := strings.ToLower(err.Error())
+	return strings.Contains(errStr, "timeout") ||
+		strings.Contains(errStr, "connection refused") ||
+		strings.Contains(errStr, "rate limit")
 }
@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// recordedRequest is a request seen by newGLMServer
+type recordedRequest struct {
+	path string
+	auth string
+}
+
+// newGLMServer answers chat and embedding calls like the Zhipu API and records each request
+func newGLMServer(t *testing.T) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []recordedRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, recordedRequest{path: r.URL.Path, auth: r.Header.Get("Authorization")})
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v4/chat/completions":
+			json.NewEncoder(w).Encode(ChatResponse{Choices: []Choice{{Message: ChatMessage{Role: "assistant", Content: "风起云涌"}}}})
+		case "/v4/embeddings":
+			json.NewEncoder(w).Encode(EmbeddingResponse{Data: []Embedding{{Embedding: []float64{0.6, 0.8}}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), seen...)
+	}
+}
+
+func TestGLM5ClientUsesConfiguredBaseURL(t *testing.T) {
+	server, requests := newGLMServer(t)
+	// The trailing slash must not double up in the request path
+	client := NewGLM5Client("test-key", server.URL+"/v4/")
+	ctx := context.Background()
+
+	resp, err := client.Chat(ctx, &ChatRequest{Model: "glm-4", Messages: []ChatMessage{{Role: "user", Content: "开场"}}})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "风起云涌" {
+		t.Errorf("chat response = %+v", resp)
+	}
+
+	emb, err := client.CreateEmbedding(ctx, []string{"华山"}, "embedding-3")
+	if err != nil {
+		t.Fatalf("CreateEmbedding: %v", err)
+	}
+	if len(emb.Data) != 1 || len(emb.Data[0].Embedding) != 2 {
+		t.Errorf("embedding response = %+v", emb)
+	}
+
+	got := requests()
+	want := []string{"/v4/chat/completions", "/v4/embeddings"}
+	if len(got) != len(want) {
+		t.Fatalf("server saw %+v, want requests to %v", got, want)
+	}
+	for i, req := range got {
+		if req.path != want[i] {
+			t.Errorf("request %d went to %q, want %q", i, req.path, want[i])
+		}
+		if req.auth != "Bearer test-key" {
+			t.Errorf("request %d Authorization = %q", i, req.auth)
+		}
+	}
+}
+
+func TestNewGLM5ClientDefaultBaseURL(t *testing.T) {
+	if got := NewGLM5Client("key", "").baseURL; got != defaultBaseURL {
+		t.Errorf("empty base URL gave %q, want %q", got, defaultBaseURL)
+	}
+}
+
+// timeoutError is a net.Error that times out without saying so in its message
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "deadline passed" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"net timeout", &url.Error{Op: "Post", URL: "https://example.invalid", Err: timeoutError{}}, true},
+		{"deadline exceeded", fmt.Errorf("failed to send request: %w", os.ErrDeadlineExceeded), true},
+		{"connection refused", fmt.Errorf("failed to send request: %w", refused), true},
+		{"rate limit message", errors.New("API error: Rate Limit reached (code: 1302)"), true},
+		{"timeout message", errors.New("HTTP 504: Gateway Timeout"), true},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, false},
+		{"bad request", errors.New("API error: invalid api key (code: 1001)"), false},
+		{"cancelled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryableError(tt.err); got != tt.want {
+			t.Errorf("%s: isRetryableError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
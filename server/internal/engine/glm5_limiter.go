@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// GLMStats reports GLM request pressure and token spend so operators can tune the limits
+// and watch API cost
+type GLMStats struct {
+	InFlight      int32            `json:"in_flight"`
+	Waiting       int32            `json:"waiting"`         // Requests blocked on the limiter
+	MaxConcurrent int              `json:"max_concurrent"`  // 0 means unbounded
+	RatePerSecond float64          `json:"rate_per_second"` // 0 means unlimited
+	Burst         int              `json:"burst"`
+	Usage         Usage            `json:"usage"`                 // Tokens used by every GLM call since start
+	StoryUsage    map[string]Usage `json:"story_usage,omitempty"` // Story generation tokens per active story
+}
+
+// glmLimiter bounds GLM requests by a token bucket and a concurrency semaphore.
+// Both block until capacity frees up or the context ends.
+type glmLimiter struct {
+	rate  float64 // Tokens per second; 0 disables the bucket
+	burst int
+	sem   chan struct{} // Nil when concurrency is unbounded
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	inFlight atomic.Int32
+	waiting  atomic.Int32
+}
+
+// newGLMLimiter creates a limiter; a burst below one is raised to one
+func newGLMLimiter(ratePerSecond float64, burst int, maxConcurrent int) *glmLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &glmLimiter{
+		rate:   math.Max(ratePerSecond, 0),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+	if maxConcurrent > 0 {
+		l.sem = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// acquire waits for a concurrency slot and then a rate token; release must be called
+// once the request finishes
+func (l *glmLimiter) acquire(ctx context.Context) error {
+	l.waiting.Inc()
+	defer l.waiting.Dec()
+
+	// Take the slot first so a token isn't spent while queued for one
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := l.waitToken(ctx); err != nil {
+		if l.sem != nil {
+			<-l.sem
+		}
+		return err
+	}
+
+	l.inFlight.Inc()
+	return nil
+}
+
+// release frees the slot taken by acquire
+func (l *glmLimiter) release() {
+	l.inFlight.Dec()
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// waitToken blocks until the bucket has a token
+func (l *glmLimiter) waitToken(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = math.Min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// stats returns the current counters and limits
+func (l *glmLimiter) stats() GLMStats {
+	return GLMStats{
+		InFlight:      l.inFlight.Load(),
+		Waiting:       l.waiting.Load(),
+		MaxConcurrent: cap(l.sem),
+		RatePerSecond: l.rate,
+		Burst:         l.burst,
+	}
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	imageTranslationCacheSize = 500
+	imageTranslationPrompt    = "你是 Stable Diffusion 提示词助手。请把下面的中文画面描述转换成英文 danbooru 风格标签，" +
+		"用英文逗号分隔，保留人物、服饰、动作、场景、光线和画风等要素，已是英文的标签原样保留。" +
+		"只输出标签，不要添加任何解释。"
+)
+
+// ImagePromptTranslator turns Chinese image prompts into English tags for SDXL checkpoints
+// trained on English captions
+type ImagePromptTranslator struct {
+	glm5Client ChatClient
+	model      string
+	cache      map[string]string
+	mu         sync.RWMutex
+}
+
+// NewImagePromptTranslator creates a new image prompt translator backed by GLM-5
+func NewImagePromptTranslator(glm5Client ChatClient, model string) *ImagePromptTranslator {
+	if model == "" {
+		model = defaultTranslationModel
+	}
+	return &ImagePromptTranslator{
+		glm5Client: glm5Client,
+		model:      model,
+		cache:      make(map[string]string),
+	}
+}
+
+// Translate converts prompt into English tags, using cached results when available
+func (t *ImagePromptTranslator) Translate(ctx context.Context, prompt string) (string, error) {
+	prompt = strings.TrimSpace(prompt)
+
+	t.mu.RLock()
+	cached, ok := t.cache[prompt]
+	t.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	req := &ChatRequest{
+		Messages: []ChatMessage{
+			{Role: "system", Content: imageTranslationPrompt},
+			{Role: "user", Content: prompt},
+		},
+		Model:       t.model,
+		Temperature: 0.2,
+		MaxTokens:   300,
+	}
+
+	resp, err := t.glm5Client.Chat(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to translate image prompt: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned from model")
+	}
+
+	translated := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if translated == "" {
+		return "", fmt.Errorf("empty translation")
+	}
+	if containsHan(translated) {
+		return "", fmt.Errorf("translation still contains Chinese: %q", truncateRunes(translated, 50))
+	}
+
+	t.mu.Lock()
+	// Simple bound: reset the cache once it grows too large
+	if len(t.cache) >= imageTranslationCacheSize {
+		t.cache = make(map[string]string)
+	}
+	t.cache[prompt] = translated
+	t.mu.Unlock()
+
+	return translated, nil
+}
+
+// containsHan reports whether text has any Chinese characters
+func containsHan(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnableImagePromptTranslation turns on translating Chinese image prompts into English tags
+// before they reach ComfyUI
+func (e *StoryEngine) EnableImagePromptTranslation(model string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.imageTranslator = NewImagePromptTranslator(e.glm5Client, model)
+}
+
+// translateImagePrompt returns prompt as English tags. The original prompt is returned when
+// translation is disabled, not needed or fails.
+func (e *StoryEngine) translateImagePrompt(ctx context.Context, prompt string) string {
+	e.mu.RLock()
+	translator := e.imageTranslator
+	e.mu.RUnlock()
+
+	if translator == nil || !containsHan(prompt) {
+		return prompt
+	}
+
+	translated, err := translator.Translate(ctx, prompt)
+	if err != nil {
+		e.loggerFor(ctx).Warn("failed to translate image prompt, using original", "error", err)
+		return prompt
+	}
+	return translated
+}
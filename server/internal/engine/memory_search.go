@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+// SearchMemories runs the same similarity search story generation uses for a player
+// action and returns the matches most relevant first; empty types searches every type
+func (e *StoryEngine) SearchMemories(ctx context.Context, storyID, query string, limit int, types []rag.MemoryType) ([]*rag.Memory, error) {
+	memories, err := e.memoryStore.SearchRelatedMemories(ctx, storyID, query, limit, 0, types)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search memories: %w", err)
+	}
+	return memories, nil
+}
+
+// SetMemoryWriteBuffer batches the memories stored after each turn, writing them every
+// interval or once batchSize are waiting. A non-positive interval keeps writes immediate.
+func (e *StoryEngine) SetMemoryWriteBuffer(batchSize int, interval time.Duration) {
+	e.memoryStore.EnableWriteBuffer(batchSize, interval)
+}
+
+// SetEmbedder replaces the embedder memories are vectorized with, e.g. a rag.HashEmbedder
+// for offline replay. Call it before the first story is created.
+func (e *StoryEngine) SetEmbedder(embedder rag.Embedder) {
+	e.memoryStore.SetEmbedder(embedder)
+}
+
+// SetEmbeddingModel sets the model the embedding service vectorizes memories with; an
+// empty model keeps the default
+func (e *StoryEngine) SetEmbeddingModel(model string) {
+	e.embedService.SetModel(model)
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrNoRecordedResponse is returned by ReplayChatClient for a prompt missing from its fixture
+var ErrNoRecordedResponse = errors.New("no recorded response for prompt")
+
+// PromptHash identifies a chat request in a replay fixture. It covers the model, the
+// messages and the response format, but not sampling parameters, so retuning temperature
+// or max tokens doesn't invalidate recorded responses.
+func PromptHash(req *ChatRequest) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "model=%s\n", req.Model)
+	if req.ResponseFormat != nil {
+		fmt.Fprintf(h, "format=%s\n", req.ResponseFormat.Type)
+	}
+	for _, msg := range req.Messages {
+		fmt.Fprintf(h, "%s:%d:%s\n", msg.Role, len(msg.Content), msg.Content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReplayChatClient answers chat requests from a fixture mapping PromptHash to the
+// recorded reply, so generation is deterministic and needs no network
+type ReplayChatClient struct {
+	responses map[string]string
+}
+
+// NewReplayChatClient creates a client answering from responses, keyed by PromptHash
+func NewReplayChatClient(responses map[string]string) *ReplayChatClient {
+	return &ReplayChatClient{responses: responses}
+}
+
+// LoadReplayChatClient reads a JSON fixture of PromptHash to reply, as written by
+// RecordingChatClient.Save
+func LoadReplayChatClient(path string) (*ReplayChatClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replay fixture: %w", err)
+	}
+	var responses map[string]string
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, fmt.Errorf("failed to parse replay fixture %s: %w", path, err)
+	}
+	return NewReplayChatClient(responses), nil
+}
+
+// Chat returns the recorded reply for req, or ErrNoRecordedResponse
+func (c *ReplayChatClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	hash := PromptHash(req)
+	content, ok := c.responses[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s (model %s, %d messages)", ErrNoRecordedResponse, hash, req.Model, len(req.Messages))
+	}
+	return &ChatResponse{
+		ID:      "replay-" + hash[:12],
+		Object:  "chat.completion",
+		Model:   req.Model,
+		Choices: []Choice{{Message: ChatMessage{Role: "assistant", Content: content}, FinishReason: "stop"}},
+	}, nil
+}
+
+// Stats reports no load; replayed requests aren't limited
+func (c *ReplayChatClient) Stats() GLMStats {
+	return GLMStats{}
+}
+
+// RecordingChatClient passes requests to another client and keeps each reply, so a live
+// session can be saved as a replay fixture
+type RecordingChatClient struct {
+	next ChatClient
+
+	mu        sync.Mutex
+	responses map[string]string
+}
+
+// NewRecordingChatClient creates a client that records the replies of next
+func NewRecordingChatClient(next ChatClient) *RecordingChatClient {
+	return &RecordingChatClient{next: next, responses: make(map[string]string)}
+}
+
+// Chat forwards req and records the first choice of a successful reply
+func (c *RecordingChatClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	resp, err := c.next.Chat(ctx, req)
+	if err != nil || len(resp.Choices) == 0 {
+		return resp, err
+	}
+	c.mu.Lock()
+	c.responses[PromptHash(req)] = resp.Choices[0].Message.Content
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// Stats returns the wrapped client's stats
+func (c *RecordingChatClient) Stats() GLMStats {
+	return c.next.Stats()
+}
+
+// Save writes the recorded replies to path as a fixture for LoadReplayChatClient
+func (c *RecordingChatClient) Save(path string) error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.responses, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal replay fixture: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write replay fixture: %w", err)
+	}
+	return nil
+}
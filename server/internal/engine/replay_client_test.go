@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"Cyber-Jianghu/server/internal/config"
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+// scriptedChatClient answers a request whose prompt contains one of its keys with that
+// key's reply, and fails any other request
+type scriptedChatClient struct {
+	replies map[string]string
+}
+
+func (c *scriptedChatClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	prompt := req.Messages[len(req.Messages)-1].Content
+	for key, reply := range c.replies {
+		if strings.Contains(prompt, key) {
+			return &ChatResponse{Choices: []Choice{{Message: ChatMessage{Role: "assistant", Content: reply}, FinishReason: "stop"}}}, nil
+		}
+	}
+	return nil, fmt.Errorf("unscripted prompt")
+}
+
+func (c *scriptedChatClient) Stats() GLMStats {
+	return GLMStats{}
+}
+
+// newReplayTestEngine builds an engine on in-memory vectors and hash embeddings
+func newReplayTestEngine(t *testing.T, client ChatClient) *StoryEngine {
+	t.Helper()
+	e := NewStoryEngine("", rag.NewInMemoryVectorStore(64), t.TempDir(), "", config.GLM5Config{})
+	e.SetEmbedder(rag.NewHashEmbedder(64))
+	e.SetChatClient(client)
+	return e
+}
+
+// playTwoTurns opens a story, which plays its opening turn, then applies one option
+func playTwoTurns(t *testing.T, e *StoryEngine) (*StoryState, *StoryResponse) {
+	t.Helper()
+	ctx := context.Background()
+	opening, err := e.CreateStory(ctx, "replay", map[string]interface{}{"protagonist": "李逍遥"})
+	if err != nil {
+		t.Fatalf("CreateStory: %v", err)
+	}
+	// CreateStory returns the live state, so keep the opening before the next turn moves it on
+	opening = opening.clone()
+	chosen, err := e.ApplyOption(ctx, "replay", "A", "推门进客栈")
+	if err != nil {
+		t.Fatalf("ApplyOption: %v", err)
+	}
+	return opening, chosen
+}
+
+func TestReplayChatClientDrivesEngine(t *testing.T) {
+	// Keyed on the action line so only story_continuation prompts are answered
+	recorder := NewRecordingChatClient(&scriptedChatClient{replies: map[string]string{
+		"## 玩家的行为\n" + openingAction: "【场景：悦来客栈】\n夜雨敲窗，李逍遥立在客栈门外。\nA. 推门进客栈\nB. 转身离开\nC. 在檐下避雨",
+		"## 玩家的行为\n推门进客栈":            "堂中灯火昏黄，掌柜抬眼打量来客。\nA. 要一壶酒\nB. 打听消息",
+	}})
+	playTwoTurns(t, newReplayTestEngine(t, recorder))
+
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+	if err := recorder.Save(fixture); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	replay, err := LoadReplayChatClient(fixture)
+	if err != nil {
+		t.Fatalf("LoadReplayChatClient: %v", err)
+	}
+
+	e := newReplayTestEngine(t, replay)
+	opening, chosen := playTwoTurns(t, e)
+
+	if opening.CurrentScene != "悦来客栈" {
+		t.Errorf("opening scene = %q, want 悦来客栈", opening.CurrentScene)
+	}
+	if len(opening.Options) != 3 || opening.Options[0].ID != "A" || opening.Options[0].Description != "推门进客栈" {
+		t.Errorf("opening options = %+v, want A. 推门进客栈 and two more", opening.Options)
+	}
+
+	if chosen.SceneChange {
+		t.Errorf("second turn changed scene to %q", chosen.NewScene)
+	}
+	if len(chosen.Options) != 2 || chosen.Options[1].ID != "B" || chosen.Options[1].Description != "打听消息" {
+		t.Errorf("second options = %+v, want A. 要一壶酒 and B. 打听消息", chosen.Options)
+	}
+
+	state, err := e.GetStoryState("replay")
+	if err != nil {
+		t.Fatalf("GetStoryState: %v", err)
+	}
+	if state.Turn != 2 {
+		t.Errorf("Turn = %d, want 2", state.Turn)
+	}
+	if state.CurrentScene != "悦来客栈" {
+		t.Errorf("CurrentScene = %q, want 悦来客栈", state.CurrentScene)
+	}
+	if !strings.Contains(state.PreviousText, "掌柜") || len(state.Options) != 2 {
+		t.Errorf("state not advanced to the second turn: %q, %d options", state.PreviousText, len(state.Options))
+	}
+
+	// An action the fixture never saw has no recorded reply
+	_, err = e.GenerateStorySegment(context.Background(), "replay", "拔剑四顾", rag.Memory{})
+	if !errors.Is(err, ErrNoRecordedResponse) {
+		t.Fatalf("unrecorded turn error = %v, want ErrNoRecordedResponse", err)
+	}
+	if state, _ := e.GetStoryState("replay"); state.Turn != 2 {
+		t.Errorf("a failed turn advanced Turn to %d", state.Turn)
+	}
+}
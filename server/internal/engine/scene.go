@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxSceneNameRunes bounds a scene name taken from the text when the model gave no marker
+const maxSceneNameRunes = 20
+
+// sceneMarkerRegex matches the 【场景：name】 line story_continuation asks for on a scene
+// change, or [Scene: name] in English stories
+var sceneMarkerRegex = regexp.MustCompile(`(?mi)^[ \t]*(?:【场景[:：]\s*([^】\n]+)】|\[scene:\s*([^\]\n]+)\])[ \t]*\n?`)
+
+// parseSceneMarker returns the scene named by a marker line, if any, and the text without it
+func parseSceneMarker(text string) (string, string) {
+	match := sceneMarkerRegex.FindStringSubmatchIndex(text)
+	if match == nil {
+		return "", text
+	}
+
+	name := match[2:4]
+	if name[0] < 0 {
+		name = match[4:6]
+	}
+	scene := strings.TrimSpace(text[name[0]:name[1]])
+	cleaned := strings.TrimSpace(text[:match[0]] + text[match[1]:])
+	return scene, cleaned
+}
+
+// detectSceneChange decides whether a segment moved to a new scene; a marker naming the
+// current scene is not a change. The opening turn always starts a scene, falling back to
+// the first line of text when there is no marker.
+func (e *StoryEngine) detectSceneChange(state *StoryState, marked, text string) (bool, string) {
+	if marked != "" && (marked != state.CurrentScene || state.Turn == 0) {
+		return true, marked
+	}
+	if state.Turn == 0 {
+		return true, truncateRunes(e.extractSceneDescription(text), maxSceneNameRunes)
+	}
+	return false, ""
+}
+
+// SceneKey identifies a story's scene for image caching, so revisiting it reuses the image
+func SceneKey(storyID, scene string) string {
+	return storyID + ":" + scene
+}
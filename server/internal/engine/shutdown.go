@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// shutdownSaveTimeout bounds saving stories after the shutdown deadline has passed
+const shutdownSaveTimeout = 5 * time.Second
+
+// ErrShuttingDown is returned for generations requested after Shutdown began
+var ErrShuttingDown = errors.New("story engine is shutting down")
+
+// ShutdownReport summarizes what Shutdown did with the active stories
+type ShutdownReport struct {
+	Saved   []string // Stories persisted with status "paused"
+	Dropped []string // Stories whose state could not be saved
+	Drained bool     // Every in-flight generation finished before the deadline
+}
+
+// beginGeneration registers a story generation, refusing it once Shutdown has begun
+func (e *StoryEngine) beginGeneration() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closing {
+		return ErrShuttingDown
+	}
+	e.inflight.Add(1)
+	return nil
+}
+
+// Shutdown refuses new generations, waits for in-flight ones until ctx ends and then saves
+// every active story to MySQL as paused. Saving still runs briefly after a missed
+// deadline so a slow generation doesn't cost the stories.
+func (e *StoryEngine) Shutdown(ctx context.Context) ShutdownReport {
+	e.mu.Lock()
+	e.closing = true
+	e.mu.Unlock()
+
+	var report ShutdownReport
+	done := make(chan struct{})
+	go func() {
+		e.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		report.Drained = true
+	case <-ctx.Done():
+		e.logger.Warn("shutdown deadline reached with story generations in flight")
+	}
+
+	saveCtx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		saveCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), shutdownSaveTimeout)
+		defer cancel()
+	}
+
+	if err := e.memoryStore.CloseWriteBuffer(saveCtx); err != nil {
+		e.logger.Error("failed to flush buffered memories", "error", err)
+	}
+
+	e.mu.RLock()
+	canSave := e.mysqlStore != nil
+	e.mu.RUnlock()
+	if !canSave {
+		report.Dropped = e.GetActiveStories()
+		e.logger.Warn("MySQL unavailable, active stories not saved", "dropped", len(report.Dropped))
+		return report
+	}
+
+	for _, storyID := range e.GetActiveStories() {
+		state, err := e.GetStoryState(storyID)
+		if err == nil {
+			err = e.saveStory(saveCtx, storyID, state, "paused")
+		}
+		if err != nil {
+			e.logger.Error("failed to save story on shutdown", "story_id", storyID, "error", err)
+			report.Dropped = append(report.Dropped, storyID)
+			continue
+		}
+		report.Saved = append(report.Saved, storyID)
+	}
+
+	e.logger.Info("story engine stopped", "saved", len(report.Saved), "dropped", len(report.Dropped), "drained", report.Drained)
+	return report
+}
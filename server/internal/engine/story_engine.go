@@ -2,17 +2,30 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"Cyber-Jianghu/server/internal/config"
 	"Cyber-Jianghu/server/internal/generators"
 	"Cyber-Jianghu/server/internal/interfaces"
+	"Cyber-Jianghu/server/internal/logging"
+	"Cyber-Jianghu/server/internal/models"
 	"Cyber-Jianghu/server/internal/prompts"
 	"Cyber-Jianghu/server/internal/rag"
+	"Cyber-Jianghu/server/internal/storage"
 )
 
+// ErrStoryNotFound is returned when a story ID has no active state
+var ErrStoryNotFound = errors.New("story not found")
+
 // StoryState represents the current state of the story
 type StoryState struct {
 	CurrentNode   string                 `json:"current_node"`
@@ -26,6 +39,25 @@ type StoryState struct {
 	Style          string                 `json:"style"`
 	Options        []StoryOption         `json:"options"`
 	Custom         map[string]interface{} `json:"custom"`
+	Turn           int                    `json:"turn"`                    // Segments generated so far
+	RecentEvents   []string               `json:"recent_events,omitempty"` // Events not yet condensed into Summary
+	Characters     []*interfaces.Character `json:"characters,omitempty"`   // Tracked NPCs; NPCs lists their names
+	StartedAt      int64                  `json:"started_at,omitempty"`    // Unix time the story was created
+	TokenUsage     Usage                  `json:"token_usage"`             // GLM tokens spent generating the story's segments
+	Language       string                 `json:"language"`                // Story language, e.g. zh or en; empty is Chinese
+}
+
+// clone returns a snapshot of the state that is safe to read without the engine lock
+func (s *StoryState) clone() *StoryState {
+	stateCopy := *s
+	stateCopy.Options = append([]StoryOption(nil), s.Options...)
+	stateCopy.RecentEvents = append([]string(nil), s.RecentEvents...)
+	stateCopy.Characters = append([]*interfaces.Character(nil), s.Characters...) // Entries are replaced, never mutated
+	stateCopy.Custom = make(map[string]interface{}, len(s.Custom))
+	for k, v := range s.Custom {
+		stateCopy.Custom[k] = v
+	}
+	return &stateCopy
 }
 
 // StoryOption represents a player choice option
@@ -41,29 +73,69 @@ type StoryOption struct {
 type StoryResponse struct {
 	Text           string                 `json:"text"`
 	Scene          string                 `json:"scene"`
+	SceneChange    bool                   `json:"scene_change"`        // The segment moved to a new scene
+	NewScene       string                 `json:"new_scene,omitempty"` // Name of that scene
 	Options        []StoryOption         `json:"options"`
 	NextNode      string                 `json:"next_node,omitempty"`
-	VisualPrompt   string                 `json:"visual_prompt,omitempty"`
-	AudioPrompt    string                 `json:"audio_prompt,omitempty"`
+	VisualPrompt   *VisualSpec            `json:"visual_prompt,omitempty"`
+	AudioPrompt    *AudioSpec             `json:"audio_prompt,omitempty"`
 	RelatedMemories []*rag.Memory `json:"related_memories,omitempty"`
+	ContextTrim    *ContextTrim           `json:"context_trim,omitempty"` // Set when the prompt was trimmed to fit
+	NPCDialogue    *NPCDialogue           `json:"npc_dialogue,omitempty"` // Set when the action addressed a tracked NPC
+	ContentFilter  *ContentFilterResult   `json:"content_filter,omitempty"` // Set when banned terms were found
+	Usage          *Usage                 `json:"usage,omitempty"`          // GLM tokens spent on this segment, retries included
 }
 
 // StoryEngine manages story generation and state
 type StoryEngine struct {
-	glm5Client    *GLM5Client
+	glm5Client    ChatClient
 	embedService  *rag.EmbeddingService
 	memoryStore   *rag.MemoryStore
 	promptEngine *prompts.TemplateEngine
-	audioClient   *generators.GPTSoVITSClient
+	audioClient   generators.TTSProvider
 	audioCache    *generators.AudioCache
 	voiceRegistry *generators.VoiceRegistry
+	translator    *DanmakuTranslator
+	imageTranslator *ImagePromptTranslator // Nil sends image prompts to ComfyUI as written
+	mysqlStore    *storage.MySQLStore
+	loraRegistry  *generators.LoRARegistry
+	summaryInterval int // Turns between summary condensations; 0 disables
+	maxInputTokens  int // Estimated prompt budget for story generation; 0 disables trimming
+	templateDir     string // Prompt template overrides; empty when none are configured
+	structuredOutput bool  // Ask GLM for JSON story segments instead of prose
+	contentFilters  map[string]*ContentFilter // Banned-term checks on generated segments, by story language
+	closing         bool           // Set by Shutdown; new generations are refused
+	inflight        sync.WaitGroup // Story generations in progress
 
 	state        map[string]*StoryState
+	history      map[string][]StorySegment // Narrative so far per story, oldest first
+	undo         map[string][]*turnSnapshot // States before recent turns, newest last
 	mu           sync.RWMutex
 
 	storyModel   string // GLM-5 model for story generation
 	imageModel   string // Model for image prompt generation
-	defaultVoiceID string
+
+	defaultParams  GenerationParams            // From config, for templates without an override
+	templateParams map[string]GenerationParams // Per-template overrides, e.g. cooler summaries
+
+	logger *slog.Logger
+}
+
+// Generation defaults used when config leaves them unset
+const (
+	defaultStoryModel  = "glm-4"
+	defaultTemperature = 0.7
+	defaultMaxTokens   = 1000
+
+	// Prompt values for the opening turn, which has no protagonist setting or player action yet
+	defaultProtagonist = "无名少侠"
+	openingAction      = "（故事开篇，尚无玩家行动，请铺陈开场）"
+)
+
+// GenerationParams controls sampling for a GLM-5 call; zero fields fall back to the engine defaults
+type GenerationParams struct {
+	Temperature float64
+	MaxTokens   int
 }
 
 // Story represents a complete story
@@ -72,25 +144,56 @@ type Story struct {
 	State   *StoryState `json:"state"`
 	Content string      `json:"content"`
 	Options []StoryOption `json:"options"`
+	Visual  *VisualSpec `json:"visual,omitempty"`
+	Audio   *AudioSpec  `json:"audio,omitempty"`
+	Usage   *Usage      `json:"usage,omitempty"` // GLM tokens spent on the latest segment
 }
 
-// NewStoryEngine creates a new story engine
+// NewStoryEngine creates a new story engine whose memories live in vectors: a QdrantClient
+// in production, or an rag.InMemoryVectorStore when no Qdrant server is available
 func NewStoryEngine(
 	apiKey string,
-	qdrantClient *rag.QdrantClient,
+	vectors rag.VectorBackend,
 	audioCacheDir string,
+	embeddingCacheDir string,
+	glm5Config config.GLM5Config,
 ) *StoryEngine {
-	glm5Client := NewGLM5Client(apiKey)
-	embedService := rag.NewEmbeddingService(apiKey)
-	memoryStore := rag.NewMemoryStore(qdrantClient, embedService)
+	glm5Client := NewGLM5Client(apiKey, glm5Config.BaseURL)
+	glm5Client.SetLimits(glm5Config.RateLimit, glm5Config.Burst, glm5Config.MaxConcurrent)
+	embedService := rag.NewEmbeddingService(apiKey, glm5Config.BaseURL)
+	if embeddingCacheDir != "" {
+		diskService, err := rag.NewEmbeddingServiceWithCacheDir(apiKey, glm5Config.BaseURL, embeddingCacheDir)
+		if err != nil {
+			log.Printf("[StoryEngine] Embedding disk cache unavailable, using memory only: %v", err)
+		} else {
+			embedService = diskService
+		}
+	}
+	memoryStore := rag.NewMemoryStore(vectors, embedService)
 	promptEngine := prompts.NewTemplateEngine()
 	audioClient := generators.NewGPTSoVITSClient()
 	audioCache := generators.NewAudioCache(audioCacheDir, 500, 24*time.Hour)
 	voiceRegistry := generators.NewVoiceRegistry("")
+	_ = voiceRegistry.LoadVoices(context.Background())
 
 	// Initialize default templates
 	_ = promptEngine.InitializeDefaultTemplates()
 
+	storyModel := glm5Config.Model
+	if storyModel == "" {
+		storyModel = defaultStoryModel
+	}
+	defaultParams := GenerationParams{
+		Temperature: glm5Config.Temperature,
+		MaxTokens:   glm5Config.MaxTokens,
+	}
+	if defaultParams.Temperature <= 0 {
+		defaultParams.Temperature = defaultTemperature
+	}
+	if defaultParams.MaxTokens <= 0 {
+		defaultParams.MaxTokens = defaultMaxTokens
+	}
+
 	return &StoryEngine{
 		glm5Client:    glm5Client,
 		embedService:  embedService,
@@ -100,9 +203,19 @@ func NewStoryEngine(
 		audioCache:    audioCache,
 		voiceRegistry: voiceRegistry,
 		state:        make(map[string]*StoryState),
-		storyModel:   "glm-4",
+		history:      make(map[string][]StorySegment),
+		undo:         make(map[string][]*turnSnapshot),
+		summaryInterval: defaultSummaryInterval,
+		maxInputTokens:  defaultMaxInputTokens,
+		storyModel:   storyModel,
 		imageModel:   "embedding-3",
-		defaultVoiceID: "narrator",
+		defaultParams: defaultParams,
+		templateParams: map[string]GenerationParams{
+			"decision_summary": {Temperature: 0.3, MaxTokens: 200},
+			"npc_extraction":   {Temperature: 0.2, MaxTokens: 400},
+			"npc_response":     {Temperature: 0.8, MaxTokens: 300},
+		},
+		logger:       slog.Default().With("component", "engine"),
 	}
 }
 
@@ -113,24 +226,34 @@ func (e *StoryEngine) CreateStory(ctx context.Context, storyID string, settings
 	genre, _ := settings["genre"].(string)
 	tone, _ := settings["tone"].(string)
 	style, _ := settings["style"].(string)
+	language, _ := settings["language"].(string)
+
+	language = prompts.NormalizeLanguage(language)
+	if !e.promptEngine.SupportsLanguage(language) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedLanguage, language)
+	}
 
 	// Default values
+	defaults := defaultsFor(language)
 	if genre == "" {
-		genre = "武侠"
+		genre = defaults.genre
 	}
 	if tone == "" {
-		tone = "史诗"
+		tone = defaults.tone
 	}
 	if style == "" {
-		style = "古典"
+		style = defaults.style
+	}
+	if protagonist == "" {
+		protagonist = defaults.protagonist
 	}
 
 	// Create initial state
 	state := &StoryState{
 		CurrentNode:  "start",
-		CurrentScene: "故事开始",
+		CurrentScene: defaults.openingScene,
 		PreviousText: "",
-		Summary:       fmt.Sprintf("%s主角 %s的故事开始了", genre, protagonist),
+		Summary:       fmt.Sprintf(defaults.summaryFormat, genre, protagonist),
 		Protagonist:   protagonist,
 		NPCs:          "",
 		Genre:          genre,
@@ -138,6 +261,8 @@ func (e *StoryEngine) CreateStory(ctx context.Context, storyID string, settings
 		Style:          style,
 		Options:        []StoryOption{},
 		Custom:         make(map[string]interface{}),
+		StartedAt:      time.Now().Unix(),
+		Language:       language,
 	}
 
 	// Store state
@@ -152,9 +277,10 @@ func (e *StoryEngine) CreateStory(ctx context.Context, storyID string, settings
 	}
 
 	// Update state with response
-	state.CurrentScene = response.Scene
+	e.mu.Lock()
 	state.PreviousText = response.Text
 	state.Options = response.Options
+	e.mu.Unlock()
 
 	// Store initial memory
 	initialMemory := &rag.Memory{
@@ -171,12 +297,139 @@ func (e *StoryEngine) CreateStory(ctx context.Context, storyID string, settings
 
 	// Use goroutine to avoid blocking
 	go func() {
-		_ = e.memoryStore.StoreMemory(context.Background(), initialMemory)
+		_ = e.memoryStore.StoreMemoriesBuffered(context.Background(), initialMemory)
 	}()
 
 	return state, nil
 }
 
+// GLMStats returns the GLM client's in-flight and waiting request counts, its token
+// usage, and the running token total of each active story
+func (e *StoryEngine) GLMStats() GLMStats {
+	stats := e.glm5Client.Stats()
+
+	e.mu.RLock()
+	stats.StoryUsage = make(map[string]Usage, len(e.state))
+	for storyID, state := range e.state {
+		stats.StoryUsage[storyID] = state.TokenUsage
+	}
+	e.mu.RUnlock()
+	return stats
+}
+
+// SetTemplateParams overrides sampling for calls rendered from a template; zero fields keep the defaults
+func (e *StoryEngine) SetTemplateParams(templateName string, params GenerationParams) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.templateParams[templateName] = params
+}
+
+// paramsFor returns the sampling for a template, falling back to the config defaults
+func (e *StoryEngine) paramsFor(templateName string) GenerationParams {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	params := e.templateParams[templateName]
+	if params.Temperature <= 0 {
+		params.Temperature = e.defaultParams.Temperature
+	}
+	if params.MaxTokens <= 0 {
+		params.MaxTokens = e.defaultParams.MaxTokens
+	}
+	return params
+}
+
+// SetMySQLStore sets the MySQL store used to persist finished stories
+func (e *StoryEngine) SetMySQLStore(mysqlStore *storage.MySQLStore) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mysqlStore = mysqlStore
+}
+
+// SetLogger sets the structured logger; call it before the engine starts serving stories
+func (e *StoryEngine) SetLogger(logger *slog.Logger) {
+	e.logger = logger.With("component", "engine")
+	e.promptEngine.SetLogger(logger)
+	e.memoryStore.SetLogger(logger)
+}
+
+// loggerFor returns the engine logger tagged with the request ID in ctx
+func (e *StoryEngine) loggerFor(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, e.logger)
+}
+
+// SetLoRARegistry sets the registry used to keep the protagonist visually consistent
+func (e *StoryEngine) SetLoRARegistry(loraRegistry *generators.LoRARegistry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loraRegistry = loraRegistry
+}
+
+// CharacterLoRA returns the protagonist's LoRA for a story, if one is registered and enabled
+func (e *StoryEngine) CharacterLoRA(storyID string) (*generators.LoraSpec, bool) {
+	state, err := e.GetStoryState(storyID)
+	if err != nil {
+		return nil, false
+	}
+	return e.protagonistLoRA(state.Protagonist)
+}
+
+// protagonistLoRA looks up the enabled character LoRA for a protagonist
+func (e *StoryEngine) protagonistLoRA(protagonist string) (*generators.LoraSpec, bool) {
+	e.mu.RLock()
+	loraRegistry := e.loraRegistry
+	e.mu.RUnlock()
+
+	if loraRegistry == nil || protagonist == "" {
+		return nil, false
+	}
+
+	model, err := loraRegistry.GetCharacterModel(protagonist)
+	if err != nil || !model.Enabled {
+		return nil, false
+	}
+
+	return &generators.LoraSpec{
+		Name:     filepath.Base(model.Path),
+		Strength: model.Strength,
+	}, true
+}
+
+// EnableTranslation turns on translation of non-Chinese danmaku before they reach the story pipeline
+func (e *StoryEngine) EnableTranslation(model string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.translator = NewDanmakuTranslator(e.glm5Client, model)
+}
+
+// NeedsTranslation reports whether text should be translated before feeding the story pipeline
+func (e *StoryEngine) NeedsTranslation(text string) bool {
+	e.mu.RLock()
+	translator := e.translator
+	e.mu.RUnlock()
+
+	return translator != nil && NeedsTranslation(text)
+}
+
+// TranslateForStory translates text to Chinese for the story pipeline.
+// The original text is returned when translation is disabled or fails.
+func (e *StoryEngine) TranslateForStory(ctx context.Context, text string) string {
+	e.mu.RLock()
+	translator := e.translator
+	e.mu.RUnlock()
+
+	if translator == nil || !NeedsTranslation(text) {
+		return text
+	}
+
+	translated, err := translator.Translate(ctx, text)
+	if err != nil {
+		e.loggerFor(ctx).Warn("failed to translate danmaku, using original", "error", err)
+		return text
+	}
+	return translated
+}
+
 // GetStoryState retrieves a story state
 func (e *StoryEngine) GetStoryState(storyID string) (*StoryState, error) {
 	e.mu.RLock()
@@ -184,10 +437,10 @@ func (e *StoryEngine) GetStoryState(storyID string) (*StoryState, error) {
 
 	state, ok := e.state[storyID]
 	if !ok {
-		return nil, fmt.Errorf("story not found: %s", storyID)
+		return nil, fmt.Errorf("%w: %s", ErrStoryNotFound, storyID)
 	}
 
-	return state, nil
+	return state.clone(), nil
 }
 
 // GenerateStorySegment generates a story segment based on player action
@@ -197,6 +450,11 @@ func (e *StoryEngine) GenerateStorySegment(
 	playerAction string,
 	inputMemory rag.Memory,
 ) (*StoryResponse, error) {
+	if err := e.beginGeneration(); err != nil {
+		return nil, err
+	}
+	defer e.inflight.Done()
+
 	// Get current state
 	state, err := e.GetStoryState(storyID)
 	if err != nil {
@@ -206,8 +464,10 @@ func (e *StoryEngine) GenerateStorySegment(
 	// Search for related memories
 	relatedMemories, err := e.memoryStore.SearchRelatedMemories(
 		ctx,
+		storyID,
 		playerAction,
 		10, // Limit to 10 memories
+		5,  // Keep the 5 most relevant
 		[]rag.MemoryType{rag.MemoryTypePlayerAction, rag.MemoryTypeDecision, rag.MemoryTypeNPC},
 	)
 	if err != nil {
@@ -221,6 +481,26 @@ func (e *StoryEngine) GenerateStorySegment(
 		relatedDecisions = []*rag.DecisionMemory{}
 	}
 
+	// An action addressed to a tracked NPC gets their reply first, so the story can follow it
+	var npcDialogue *NPCDialogue
+	if npc := targetNPC(state, playerAction); npc != nil {
+		npcDialogue, err = e.generateNPCDialogue(ctx, state, npc, playerAction)
+		if err != nil {
+			e.loggerFor(ctx).Warn("failed to generate NPC dialogue", "story_id", storyID, "npc", npc.Name, "error", err)
+		}
+	}
+
+	// Templates and fixed prompt text follow the story language
+	language := storyLanguage(state)
+	defaults := defaultsFor(language)
+	continuationTemplate := e.promptEngine.Resolve("story_continuation", language)
+
+	// The opening turn has no action; strict rendering needs one for the prompt
+	promptAction := playerAction
+	if promptAction == "" {
+		promptAction = defaults.openingAction
+	}
+
 	// Build story context
 	storyCtx := prompts.BuildStoryContext(
 		&interfaces.Story{
@@ -234,36 +514,77 @@ func (e *StoryEngine) GenerateStorySegment(
 			Style:          state.Style,
 		},
 		interfaces.Danmaku{
-			Content: playerAction,
+			Content: promptAction,
 		},
 		buildMemoryTexts(relatedMemories),
 		buildDecisionTexts(relatedDecisions),
 	)
+	if npcDialogue != nil {
+		storyCtx.Custom = map[string]string{"npc_dialogue": npcDialogue.Name + "：" + npcDialogue.Text}
+	}
 
-	// Render prompt
-	prompt, err := e.promptEngine.Render("story_continuation", storyCtx)
+	// Render prompt strictly so a missing value fails here rather than reaching the model
+	prompt, err := e.promptEngine.Render(continuationTemplate, storyCtx)
 	if err != nil {
-		log.Printf("Error rendering prompt: %v", err)
+		e.loggerFor(ctx).Error("failed to render prompt", "story_id", storyID, "error", err)
 		return nil, fmt.Errorf("failed to render prompt: %w", err)
 	}
 
-	log.Printf("Calling GLM-5 with prompt (first 200 chars): %s...", prompt[:min(200, len(prompt))])
+	// Trim memories, decisions and previous text if the prompt would overflow the budget
+	e.mu.RLock()
+	budget := e.maxInputTokens
+	e.mu.RUnlock()
+
+	var contextTrim *ContextTrim
+	if budget > 0 && estimateTokens(prompt) > budget {
+		baseCtx := *storyCtx
+		baseCtx.RelatedMemories, baseCtx.RelatedDecisions, baseCtx.PreviousText = "", "", ""
+		basePrompt, err := e.promptEngine.Render(continuationTemplate, &baseCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render prompt: %w", err)
+		}
+
+		var previousText string
+		relatedMemories, relatedDecisions, previousText, contextTrim = fitContextBudget(
+			estimateTokens(basePrompt), budget, relatedMemories, relatedDecisions, state.PreviousText)
+		storyCtx.RelatedMemories = strings.Join(buildMemoryTexts(relatedMemories), "\n")
+		storyCtx.RelatedDecisions = strings.Join(buildDecisionTexts(relatedDecisions), "\n")
+		storyCtx.PreviousText = previousText
+
+		prompt, err = e.promptEngine.Render(continuationTemplate, storyCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render prompt: %w", err)
+		}
+		e.loggerFor(ctx).Info("trimmed prompt to budget", "story_id", storyID,
+			"estimated_tokens", contextTrim.EstimatedTokens, "budget", budget,
+			"dropped_memories", len(contextTrim.DroppedMemories), "dropped_decisions", len(contextTrim.DroppedDecisions),
+			"previous_text_truncated", contextTrim.PreviousTextTruncated)
+	}
+
+	e.loggerFor(ctx).Debug("calling GLM-5", "story_id", storyID, "prompt", truncateRunes(prompt, 200))
 
 	// Call GLM-5
 	messages := []ChatMessage{
 		{Role: "user", Content: prompt},
 	}
 
+	params := e.paramsFor("story_continuation")
 	req := &ChatRequest{
 		Messages:    messages,
 		Model:       e.storyModel,
-		Temperature: 0.7,
-		MaxTokens:   1000,
+		Temperature: params.Temperature,
+		MaxTokens:   params.MaxTokens,
+	}
+
+	structured := e.structuredOutputEnabled()
+	if structured {
+		req.Messages = append([]ChatMessage{{Role: "system", Content: defaults.structured}}, messages...)
+		req.ResponseFormat = &ResponseFormat{Type: "json_object"}
 	}
 
 	resp, err := e.glm5Client.Chat(ctx, req)
 	if err != nil {
-		log.Printf("Error calling GLM-5 API: %v", err)
+		e.loggerFor(ctx).Error("GLM-5 call failed", "story_id", storyID, "error", err)
 		return nil, fmt.Errorf("failed to generate story: %w", err)
 	}
 
@@ -271,37 +592,57 @@ func (e *StoryEngine) GenerateStorySegment(
 		return nil, fmt.Errorf("no choices returned from model")
 	}
 
-	generatedText := resp.Choices[0].Message.Content
+	content := resp.Choices[0].Message.Content
+	usage := resp.Usage
 
 	// Log generated text for debugging
-	log.Printf("Generated text (first 500 chars): %s...", generatedText[:min(500, len(generatedText))])
+	e.loggerFor(ctx).Debug("generated text", "story_id", storyID, "text", truncateRunes(content, 500))
 
-	// Parse response to extract options
-	options := e.parseOptionsFromResponse(generatedText)
+	// Split the reply into narrative, scene and options
+	segment := e.parseSegment(ctx, storyID, content, structured)
+	segment, filterResult := e.filterSegment(ctx, storyID, language, req, content, segment, structured, &usage)
+	generatedText, options := segment.text, segment.options
+	sceneChange, newScene := e.detectSceneChange(state, segment.scene, generatedText)
 
 	// Log parsed options for debugging
-	log.Printf("Parsed %d options:", len(options))
-	for i, opt := range options {
-		log.Printf("  Option %d: ID=%s, Text=%s", i, opt.ID, opt.Text)
+	if e.loggerFor(ctx).Enabled(ctx, slog.LevelDebug) {
+		optionTexts := make([]string, len(options))
+		for i, opt := range options {
+			optionTexts[i] = opt.ID + ": " + opt.Text
+		}
+		e.loggerFor(ctx).Debug("parsed options", "story_id", storyID, "count", len(options), "options", optionTexts)
 	}
 
 	// Generate visual prompt
 	imageCtx := &prompts.ImagePromptContext{
 		SceneDescription: e.extractSceneDescription(generatedText),
 		Style:           state.Style,
+		Characters:      sceneCharacters(state),
 		Mood:            state.Tone,
 	}
-	visualPrompt, _ := e.promptEngine.RenderImagePrompt("image_generation", imageCtx)
-
-	// Update state
-	e.mu.Lock()
-	if currentState, ok := e.state[storyID]; ok {
-		currentState.PreviousText = generatedText
-		currentState.Options = options
+	// Only a new scene gets a new background image
+	var visualSpec *VisualSpec
+	if sceneChange {
+		visualPrompt := segment.visualPrompt
+		if visualPrompt == "" {
+			visualPrompt, _ = e.promptEngine.RenderImagePrompt(e.promptEngine.Resolve("image_generation", language), imageCtx)
+		}
+		visualSpec = buildVisualSpec(e.translateImagePrompt(ctx, visualPrompt), state)
+		visualSpec.SceneKey = SceneKey(storyID, newScene)
+		if lora, ok := e.protagonistLoRA(state.Protagonist); ok {
+			visualSpec.LoRAs = append(visualSpec.LoRAs, *lora)
+		}
 	}
-	e.mu.Unlock()
 
-	// Store player action memory
+	// Generate narration spec
+	voiceID := e.defaultVoiceID()
+	audioSpec := buildAudioSpec(generatedText, options, voiceID, state.Tone, language)
+
+	// The triggering decision and player action memories, stored in one batch below
+	var newMemories []*rag.Memory
+	if inputMemory.ID != "" && inputMemory.Type == rag.MemoryTypeDecision {
+		newMemories = append(newMemories, &inputMemory)
+	}
 	if playerAction != "" {
 		actionMemory := &rag.Memory{
 			ID:        rag.BuildMemoryID(rag.MemoryTypePlayerAction, storyID),
@@ -313,21 +654,68 @@ func (e *StoryEngine) GenerateStorySegment(
 				"current_node": state.CurrentNode,
 			},
 		}
-		_ = e.memoryStore.StoreMemory(ctx, actionMemory)
+		newMemories = append(newMemories, actionMemory)
 	}
 
+	// Store the decision and action memories in one batch before the turn becomes visible,
+	// so a Rollback of it always finds them to delete
+	if err := e.memoryStore.StoreMemoriesBuffered(ctx, newMemories...); err != nil {
+		e.loggerFor(ctx).Warn("failed to store memories", "story_id", storyID, "error", err)
+	}
+
+	// Update state
+	e.mu.Lock()
+	var condense *summaryJob
+	if currentState, ok := e.state[storyID]; ok {
+		e.pushUndoLocked(storyID, currentState, newMemories)
+		currentState.PreviousText = generatedText
+		currentState.Options = options
+		if sceneChange {
+			currentState.CurrentScene = newScene
+		}
+		condense = e.recordTurnLocked(storyID, currentState, playerAction, generatedText)
+		e.recordSegmentLocked(storyID, currentState, playerAction, generatedText, inputMemory)
+		currentState.TokenUsage.Add(usage)
+	}
+	e.mu.Unlock()
+
+	// Condense off the request path so a slow or failed summary never holds up the turn
+	if condense != nil {
+		go e.condenseSummary(logging.Detach(ctx, "summary"), condense)
+	}
+	go e.trackNPCs(logging.Detach(ctx, "npcs"), storyID, state, generatedText)
+
 	return &StoryResponse{
 		Text:            generatedText,
 		Scene:           e.extractSceneDescription(generatedText),
+		SceneChange:     sceneChange,
+		NewScene:        newScene,
 		Options:         options,
-		VisualPrompt:    visualPrompt,
+		VisualPrompt:    visualSpec,
+		AudioPrompt:     audioSpec,
 		RelatedMemories: relatedMemories,
+		ContextTrim:     contextTrim,
+		NPCDialogue:     npcDialogue,
+		ContentFilter:   filterResult,
+		Usage:           &usage,
 	}, nil
 }
 
+// DecisionSource identifies who made a decision, e.g. the viewer behind a danmaku
+type DecisionSource struct {
+	UserID   string
+	Username string
+	Action   string // Command that triggered the decision, e.g. "/vote"
+}
+
 // ApplyOption applies a player choice option
 func (e *StoryEngine) ApplyOption(ctx context.Context, storyID, optionID string, choiceText string) (*StoryResponse, error) {
-	// Store decision memory
+	return e.ApplyOptionFrom(ctx, storyID, optionID, choiceText, DecisionSource{})
+}
+
+// ApplyOptionFrom applies a player choice option and records who chose it in MySQL
+func (e *StoryEngine) ApplyOptionFrom(ctx context.Context, storyID, optionID string, choiceText string, source DecisionSource) (*StoryResponse, error) {
+	// Build decision memory; it is stored together with the action memory
 	decision := &rag.DecisionMemory{
 		Memory: rag.Memory{
 			ID:        rag.BuildMemoryID(rag.MemoryTypeDecision, storyID),
@@ -344,10 +732,66 @@ func (e *StoryEngine) ApplyOption(ctx context.Context, storyID, optionID string,
 		ChoiceText: choiceText,
 	}
 
-	_ = e.memoryStore.StoreDecision(ctx, decision)
-
 	// Generate next story segment
-	return e.GenerateStorySegment(ctx, storyID, choiceText, decision.Memory)
+	response, err := e.GenerateStorySegment(ctx, storyID, choiceText, decision.Memory)
+	if err != nil {
+		return nil, err
+	}
+
+	e.saveDecision(ctx, decision, source)
+	return response, nil
+}
+
+// saveDecision writes an applied decision to MySQL for the audit trail; a no-op without MySQL
+func (e *StoryEngine) saveDecision(ctx context.Context, decision *rag.DecisionMemory, source DecisionSource) {
+	e.mu.RLock()
+	mysqlStore := e.mysqlStore
+	e.mu.RUnlock()
+
+	if mysqlStore == nil {
+		return
+	}
+
+	action := source.Action
+	if action == "" {
+		action = "/select"
+	}
+
+	record := &models.StoryDecision{
+		ID:        decision.ID,
+		StoryID:   decision.StoryID,
+		UserID:    source.UserID,
+		Username:  source.Username,
+		Action:    action,
+		Content:   decision.ChoiceText,
+		Selected:  true,
+		Timestamp: decision.Timestamp,
+	}
+	if err := mysqlStore.SaveDecision(ctx, record); err != nil {
+		e.loggerFor(ctx).Warn("failed to save decision", "story_id", decision.StoryID, "user_id", source.UserID, "error", err)
+	}
+}
+
+// GetDecisionHistory returns a story's applied decisions oldest first; empty without MySQL
+func (e *StoryEngine) GetDecisionHistory(ctx context.Context, storyID string) ([]models.StoryDecision, error) {
+	e.mu.RLock()
+	mysqlStore := e.mysqlStore
+	e.mu.RUnlock()
+
+	if mysqlStore == nil {
+		return []models.StoryDecision{}, nil
+	}
+
+	decisions, err := mysqlStore.GetDecisions(ctx, storyID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load decisions: %w", err)
+	}
+
+	// GetDecisions returns newest first; a timeline reads the other way
+	for i, j := 0, len(decisions)-1; i < j; i, j = i+1, j-1 {
+		decisions[i], decisions[j] = decisions[j], decisions[i]
+	}
+	return decisions, nil
 }
 
 // GetActiveStories returns list of active story IDs
@@ -362,32 +806,65 @@ func (e *StoryEngine) GetActiveStories() []string {
 	return stories
 }
 
-// EndStory ends a story and optionally saves it
-func (e *StoryEngine) EndStory(ctx context.Context, storyID string, save bool) error {
+// EndStory ends a story, optionally saving its final state to MySQL, and returns that final state
+func (e *StoryEngine) EndStory(ctx context.Context, storyID string, save bool) (*StoryState, error) {
 	state, err := e.GetStoryState(storyID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Store final state as memory
-	finalMemory := &rag.Memory{
-		ID:        rag.BuildMemoryID(rag.MemoryTypeStoryState, storyID),
-		Type:      rag.MemoryTypeStoryState,
-		Content:   fmt.Sprintf("故事结束。最后状态: %s", state.CurrentScene),
-		Timestamp: time.Now().Unix(),
-		StoryID:   storyID,
-		Metadata:  map[string]interface{}{
-			"final": true,
-		},
+	// Flush final state before removing it so a failed save leaves the story intact
+	if save {
+		if err := e.saveStory(ctx, storyID, state, "ended"); err != nil {
+			return nil, fmt.Errorf("failed to save story: %w", err)
+		}
 	}
-	_ = e.memoryStore.StoreMemory(ctx, finalMemory)
 
-	// Remove from active states
+	// Remove from active states; a concurrent EndStory may have won the race
 	e.mu.Lock()
+	if _, ok := e.state[storyID]; !ok {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrStoryNotFound, storyID)
+	}
 	delete(e.state, storyID)
+	delete(e.history, storyID)
+	delete(e.undo, storyID)
 	e.mu.Unlock()
 
-	return nil
+	// Free the story's vectors; the final state lives on in MySQL when saved
+	deleted, err := e.memoryStore.DeleteMemoriesByStory(ctx, storyID)
+	if err != nil {
+		e.loggerFor(ctx).Warn("failed to delete memories", "story_id", storyID, "error", err)
+	} else {
+		e.loggerFor(ctx).Info("deleted memories for ended story", "story_id", storyID, "count", deleted)
+	}
+
+	return state, nil
+}
+
+// saveStory persists a story state to MySQL with the given status
+func (e *StoryEngine) saveStory(ctx context.Context, storyID string, state *StoryState, status string) error {
+	e.mu.RLock()
+	mysqlStore := e.mysqlStore
+	e.mu.RUnlock()
+
+	if mysqlStore == nil {
+		return fmt.Errorf("MySQL store not available")
+	}
+
+	contextJSON, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal story state: %w", err)
+	}
+
+	return mysqlStore.SaveStory(ctx, &models.Story{
+		ID:           storyID,
+		Title:        fmt.Sprintf("%s·%s", state.Genre, state.Protagonist),
+		SessionID:    storyID,
+		Status:       status,
+		CurrentScene: state.CurrentScene,
+		JSONContext:  string(contextJSON),
+	})
 }
 
 // parseOptionsFromResponse extracts options from generated text
@@ -402,6 +879,7 @@ func (e *StoryEngine) parseOptionsFromResponse(text string) []StoryOption {
 		{prefixes: []string{"A.", "B.", "C.", "D.", "E."}, letterID: true},
 		{prefixes: []string{"1.", "2.", "3.", "4.", "5."}, letterID: false},
 		{prefixes: []string{"一、", "二、", "三、", "四、", "五、"}, letterID: false},
+		{prefixes: []string{"①", "②", "③", "④", "⑤"}, letterID: false},
 		{prefixes: []string{"【", "】"}, letterID: false}, // 【选项】
 	}
 
@@ -410,7 +888,7 @@ func (e *StoryEngine) parseOptionsFromResponse(text string) []StoryOption {
 		foundOptions := 0
 		for i, prefix := range pattern.prefixes {
 			// Check if prefix exists in text
-			if !containsSubstring(text, prefix) {
+			if !strings.Contains(text, prefix) {
 				break
 			}
 
@@ -458,23 +936,20 @@ func (e *StoryEngine) parseOptionsFromResponse(text string) []StoryOption {
 func (e *StoryEngine) extractSceneDescription(text string) string {
 	// Simplified - just take first sentence or paragraph
 	// In production, this would use NLP
-	lines := splitLines(text, "\n")
-	if len(lines) > 0 {
-		// Return first substantial line
-		for _, line := range lines {
-			if len(line) > 10 {
-				return line
-			}
+	lines := strings.Split(text, "\n")
+	// Return first substantial line, counting characters rather than bytes
+	for _, line := range lines {
+		if utf8.RuneCountInString(line) > 10 {
+			return line
 		}
-		return lines[0]
 	}
-	return text
+	return lines[0]
 }
 
 // extractOptionText extracts option text from response
 func (e *StoryEngine) extractOptionText(text, prefix string) string {
 	// Find the position of the prefix
-	prefixIndex := findSubstring(text, prefix)
+	prefixIndex := strings.Index(text, prefix)
 	if prefixIndex < 0 {
 		return ""
 	}
@@ -484,11 +959,11 @@ func (e *StoryEngine) extractOptionText(text, prefix string) string {
 
 	// Find the end of the option
 	// Options are typically followed by newline, next option, or end of text
-	endMarkers := []string{"\n\n", "\n", "。", ".", "\r\n", "A.", "B.", "C.", "1.", "2.", "3.", "一、", "二、", "三、"}
+	endMarkers := []string{"\n\n", "\n", "。", ".", "\r\n", "A.", "B.", "C.", "1.", "2.", "3.", "一、", "二、", "三、", "①", "②", "③"}
 
 	earliestEnd := -1
 	for _, marker := range endMarkers {
-		markerIndex := findSubstring(remaining, marker)
+		markerIndex := strings.Index(remaining, marker)
 		if markerIndex >= 0 && (earliestEnd < 0 || markerIndex < earliestEnd) {
 			// Skip if marker is the same as prefix (avoid matching next option's prefix)
 			if marker != prefix {
@@ -501,59 +976,15 @@ func (e *StoryEngine) extractOptionText(text, prefix string) string {
 	if earliestEnd >= 0 {
 		optionText = remaining[:earliestEnd]
 	} else {
-		// Take up to 100 chars as option text
-		if len(remaining) > 100 {
-			optionText = remaining[:100]
-		} else {
-			optionText = remaining
-		}
-	}
-
-	// Trim whitespace
-	return trimWhitespace(optionText)
-}
-
-// trimWhitespace trims leading and trailing whitespace
-func trimWhitespace(s string) string {
-	start := 0
-	for start < len(s) && (s[start] == ' ' || s[start] == '\t' || s[start] == '\n' || s[start] == '\r') {
-		start++
-	}
-
-	end := len(s)
-	for end > 0 && (s[end-1] == ' ' || s[end-1] == '\t' || s[end-1] == '\n' || s[end-1] == '\r') {
-		end--
-	}
-
-	return s[start:end]
-}
-
-// Helper functions
-func containsSubstring(s, substr string) bool {
-	return len(s) >= len(substr) && findSubstring(s, substr) >= 0
-}
-
-func findSubstring(s, substr string) int {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return i
+		// Take up to 100 characters as option text without splitting a rune
+		optionText = remaining
+		if runes := []rune(remaining); len(runes) > 100 {
+			optionText = string(runes[:100])
 		}
 	}
-	return -1
-}
 
-func splitLines(s, sep string) []string {
-	var result []string
-	start := 0
-	for i := 0; i <= len(s)-len(sep); i++ {
-		if s[i:i+len(sep)] == sep {
-			result = append(result, s[start:i])
-			start = i + len(sep)
-			i += len(sep) - 1
-		}
-	}
-	result = append(result, s[start:])
-	return result
+	// Trim whitespace, including full-width spaces
+	return strings.TrimSpace(optionText)
 }
 
 func buildMemoryTexts(memories []*rag.Memory) []string {
@@ -579,15 +1010,19 @@ func min(a, b int) int {
 	return b
 }
 
-// GenerateAudio generates audio for story text
-func (e *StoryEngine) GenerateAudio(ctx context.Context, text string, voiceID string) ([]byte, error) {
+// GenerateAudio generates audio for story text in the given language; empty is Chinese
+func (e *StoryEngine) GenerateAudio(ctx context.Context, text string, voiceID string, language string) ([]byte, error) {
 	// Use default voice if not specified
 	if voiceID == "" {
-		voiceID = e.defaultVoiceID
+		voiceID = e.defaultVoiceID()
 	}
 
 	// Generate cache key
 	opts := generators.NewTTSOptions()
+	opts.Language = prompts.NormalizeLanguage(language)
+	e.mu.RLock()
+	opts.ReferenceAudio = e.voiceRegistry.ReferenceAudio(voiceID)
+	e.mu.RUnlock()
 	cacheKey := generators.GenerateAudioCacheKey(text, voiceID, opts)
 
 	// Check cache first
@@ -596,45 +1031,136 @@ func (e *StoryEngine) GenerateAudio(ctx context.Context, text string, voiceID st
 		// Cache hit
 		return audioData, nil
 	}
+	if errors.Is(err, generators.ErrCachedFailure) {
+		return nil, fmt.Errorf("failed to generate audio: %w", err)
+	}
 
 	// Cache miss - generate new audio
-	audioData, err = e.audioClient.SynthesizeWithOptions(ctx, text, voiceID, opts)
+	e.mu.RLock()
+	audioClient := e.audioClient
+	e.mu.RUnlock()
+
+	audioData, err = audioClient.Synthesize(ctx, text, voiceID, opts)
 	if err != nil {
+		if generators.ShouldCacheFailure(err) {
+			e.audioCache.PutNegative(cacheKey, err, generators.DefaultNegativeTTL)
+		}
 		return nil, fmt.Errorf("failed to generate audio: %w", err)
 	}
 
 	// Store in cache (async to avoid blocking)
 	go func() {
-		duration := generators.EstimateAudioDuration(int64(len(audioData)), "wav", 24000)
-		_ = e.audioCache.Put(context.Background(), cacheKey, audioData, text, voiceID, opts, "wav", duration)
+		duration, sampleRate, err := generators.ParseWAVDuration(audioData)
+		if err != nil {
+			// Header unreadable, fall back to a size-based estimate
+			sampleRate = 24000
+			duration = generators.EstimateAudioDuration(int64(len(audioData)), opts.Format, sampleRate)
+		}
+		_ = e.audioCache.Put(context.Background(), cacheKey, audioData, text, voiceID, opts, opts.Format, duration, sampleRate)
 	}()
 
 	return audioData, nil
 }
 
-// SetDefaultVoice sets the default voice ID for TTS
-func (e *StoryEngine) SetDefaultVoice(voiceID string) error {
+// SetAudioMemoryBudget sets how many bytes of recent narration the audio cache keeps in
+// memory; 0 disables the memory tier
+func (e *StoryEngine) SetAudioMemoryBudget(bytes int64) {
+	e.audioCache.SetMemoryBudget(bytes)
+}
+
+// SetAudioCacheMaxSize caps the bytes of narration the audio cache keeps on disk; 0 removes the cap
+func (e *StoryEngine) SetAudioCacheMaxSize(bytes int64) {
+	e.audioCache.SetMaxSize(bytes)
+}
+
+// AudioCacheKey returns the cache key GenerateAudio uses for the given text, voice and language
+func (e *StoryEngine) AudioCacheKey(text string, voiceID string, language string) string {
+	if voiceID == "" {
+		voiceID = e.defaultVoiceID()
+	}
+	opts := generators.NewTTSOptions()
+	opts.Language = prompts.NormalizeLanguage(language)
+	return generators.GenerateAudioCacheKey(text, voiceID, opts)
+}
+
+// GetCachedAudio returns the cache entry for a previously generated clip
+func (e *StoryEngine) GetCachedAudio(key string) (*generators.AudioCacheEntry, error) {
+	return e.audioCache.GetEntry(key)
+}
+
+// SetTTSProvider replaces the TTS backend used for narration
+func (e *StoryEngine) SetTTSProvider(provider generators.TTSProvider) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.audioClient = provider
+}
 
-	// Verify voice exists
-	if _, err := e.voiceRegistry.GetVoice(voiceID); err != nil {
-		return fmt.Errorf("voice not found: %s", voiceID)
-	}
+// SetVoiceRegistry replaces the voice registry, e.g. with one shared with the HTTP handlers
+func (e *StoryEngine) SetVoiceRegistry(voiceRegistry *generators.VoiceRegistry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.voiceRegistry = voiceRegistry
+}
 
-	e.defaultVoiceID = voiceID
-	return nil
+// SetDefaultVoice sets the default voice ID for TTS
+func (e *StoryEngine) SetDefaultVoice(voiceID string) error {
+	e.mu.RLock()
+	voiceRegistry := e.voiceRegistry
+	e.mu.RUnlock()
+
+	return voiceRegistry.SetDefault(voiceID)
 }
 
 // GetDefaultVoice returns the default voice
 func (e *StoryEngine) GetDefaultVoice() (*generators.VoiceModel, error) {
 	e.mu.RLock()
-	defer e.mu.RUnlock()
+	voiceRegistry := e.voiceRegistry
+	e.mu.RUnlock()
+
+	return voiceRegistry.GetDefaultVoice()
+}
+
+// defaultVoiceID returns the registry's default voice ID
+func (e *StoryEngine) defaultVoiceID() string {
+	e.mu.RLock()
+	voiceRegistry := e.voiceRegistry
+	e.mu.RUnlock()
 
-	return e.voiceRegistry.GetVoice(e.defaultVoiceID)
+	return voiceRegistry.DefaultID()
 }
 
 // GetAvailableVoices returns list of available voices
 func (e *StoryEngine) GetAvailableVoices() []*generators.VoiceModel {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 	return e.voiceRegistry.ListVoices()
 }
+
+// LoadTemplateDir registers the prompt templates in dir over the built-ins and, when
+// interval is positive, keeps picking up edits until ctx is done
+func (e *StoryEngine) LoadTemplateDir(ctx context.Context, dir string, interval time.Duration) error {
+	e.mu.Lock()
+	e.templateDir = dir
+	e.mu.Unlock()
+
+	if interval > 0 {
+		go e.promptEngine.WatchDir(ctx, dir, interval)
+	}
+
+	if _, err := e.promptEngine.LoadFromDir(dir); err != nil {
+		return fmt.Errorf("failed to load templates from %s: %w", dir, err)
+	}
+	return nil
+}
+
+// ReloadTemplates re-reads the template dir and returns how many templates changed
+func (e *StoryEngine) ReloadTemplates() (int, error) {
+	e.mu.RLock()
+	dir := e.templateDir
+	e.mu.RUnlock()
+
+	if dir == "" {
+		return 0, fmt.Errorf("no prompt template dir configured")
+	}
+	return e.promptEngine.LoadFromDir(dir)
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"Cyber-Jianghu/server/internal/config"
+	"Cyber-Jianghu/server/internal/generators"
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+// countingTTSProvider returns silent clips and counts synthesis calls per language
+type countingTTSProvider struct {
+	*generators.NoopTTSProvider
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (p *countingTTSProvider) Synthesize(ctx context.Context, text string, voiceID string, opts *generators.TTSOptions) ([]byte, error) {
+	p.mu.Lock()
+	p.calls[opts.Language]++
+	p.mu.Unlock()
+	return p.NoopTTSProvider.Synthesize(ctx, text, voiceID, opts)
+}
+
+func (p *countingTTSProvider) count(language string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[language]
+}
+
+// waitForCachedAudio waits for GenerateAudio's background write of key to land
+func waitForCachedAudio(t *testing.T, e *StoryEngine, key string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := e.GetCachedAudio(key); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("audio %s never reached the cache", key)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAudioCacheKeyIsStable(t *testing.T) {
+	e := newReplayTestEngine(t, &scriptedChatClient{})
+	voice := e.defaultVoiceID()
+
+	key := e.AudioCacheKey("夜雨敲窗", "", "en")
+	if key != e.AudioCacheKey("夜雨敲窗", "", "en") {
+		t.Fatal("the same request gave two keys")
+	}
+	if key != e.AudioCacheKey("夜雨敲窗", voice, "EN-us") {
+		t.Error("the default voice and an explicit default, or en and EN-us, gave different keys")
+	}
+	if key == e.AudioCacheKey("夜雨敲窗", "", "zh") {
+		t.Error("English and Chinese narration share a key")
+	}
+	if e.AudioCacheKey("夜雨敲窗", "", "") != e.AudioCacheKey("夜雨敲窗", "", "zh") {
+		t.Error("an empty language is not keyed as Chinese")
+	}
+}
+
+func TestGenerateAudioCachesPerLanguage(t *testing.T) {
+	ctx := context.Background()
+	e := newReplayTestEngine(t, &scriptedChatClient{})
+	tts := &countingTTSProvider{NoopTTSProvider: generators.NewNoopTTSProvider(), calls: make(map[string]int)}
+	e.SetTTSProvider(tts)
+
+	if _, err := e.GenerateAudio(ctx, "夜雨敲窗", "", "en"); err != nil {
+		t.Fatalf("GenerateAudio: %v", err)
+	}
+	// The key AudioCacheKey reports is the one GenerateAudio stored under
+	waitForCachedAudio(t, e, e.AudioCacheKey("夜雨敲窗", "", "en"))
+
+	if _, err := e.GenerateAudio(ctx, "夜雨敲窗", e.defaultVoiceID(), "en"); err != nil {
+		t.Fatalf("GenerateAudio again: %v", err)
+	}
+	if n := tts.count("en"); n != 1 {
+		t.Errorf("English synthesized %d times, want 1 with the second served from cache", n)
+	}
+
+	// The same text in Chinese is a different clip
+	if _, err := e.GenerateAudio(ctx, "夜雨敲窗", "", "zh"); err != nil {
+		t.Fatalf("GenerateAudio zh: %v", err)
+	}
+	if n := tts.count("zh"); n != 1 {
+		t.Errorf("Chinese synthesized %d times, want 1", n)
+	}
+	waitForCachedAudio(t, e, e.AudioCacheKey("夜雨敲窗", "", "zh"))
+}
+
+func TestParseOptionsFromResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []StoryOption
+	}{
+		{
+			name: "circled numbers",
+			text: "夜雨敲窗。\n① 拔剑迎敌\n② 转身离开\n③ 静观其变",
+			want: []StoryOption{
+				{ID: "1", Text: "①拔剑迎敌", Description: "拔剑迎敌"},
+				{ID: "2", Text: "②转身离开", Description: "转身离开"},
+				{ID: "3", Text: "③静观其变", Description: "静观其变"},
+			},
+		},
+		{
+			name: "Chinese numerals",
+			text: "掌门问你去留。\n一、拜师学艺\n二、下山闯荡",
+			want: []StoryOption{
+				{ID: "1", Text: "一、拜师学艺", Description: "拜师学艺"},
+				{ID: "2", Text: "二、下山闯荡", Description: "下山闯荡"},
+			},
+		},
+		{
+			name: "letters",
+			text: "客栈门外。\nA. 推门进客栈\nB. 转身离开",
+			want: []StoryOption{
+				{ID: "A", Text: "A.推门进客栈", Description: "推门进客栈"},
+				{ID: "B", Text: "B.转身离开", Description: "转身离开"},
+			},
+		},
+		{
+			name: "digits",
+			text: "山贼拦路\n1. 拔剑\n2. 逃跑",
+			want: []StoryOption{
+				{ID: "1", Text: "1.拔剑", Description: "拔剑"},
+				{ID: "2", Text: "2.逃跑", Description: "逃跑"},
+			},
+		},
+	}
+	e := &StoryEngine{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.parseOptionsFromResponse(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("options = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOptionsFromResponseDefaults(t *testing.T) {
+	got := (&StoryEngine{}).parseOptionsFromResponse("山风呼啸，四下无人。")
+	if len(got) != 3 || got[0].ID != "A" || got[0].Text != "继续前进" {
+		t.Errorf("options without markers = %+v, want the three defaults", got)
+	}
+}
+
+func TestParseOptionsFromResponseCutsAtRuneBoundary(t *testing.T) {
+	// The last option has no end marker, so it falls back to its first 100 characters
+	text := "A.拔剑\nB." + strings.Repeat("剑", 150)
+	options := (&StoryEngine{}).parseOptionsFromResponse(text)
+	if len(options) != 2 {
+		t.Fatalf("options = %+v, want 2", options)
+	}
+	desc := options[1].Description
+	if !utf8.ValidString(desc) || utf8.RuneCountInString(desc) != 100 {
+		t.Errorf("fallback text has %d runes (valid UTF-8: %v), want 100", utf8.RuneCountInString(desc), utf8.ValidString(desc))
+	}
+}
+
+func TestSetEmbeddingModel(t *testing.T) {
+	e := NewStoryEngine("", rag.NewInMemoryVectorStore(64), t.TempDir(), "", config.GLM5Config{})
+
+	e.SetEmbeddingModel("embedding-2")
+	if got := e.embedService.GetStats(); got.Model != "embedding-2" || got.EmbeddingDim != 1024 {
+		t.Errorf("after SetEmbeddingModel: model %q, dimension %d", got.Model, got.EmbeddingDim)
+	}
+	e.SetEmbeddingModel("")
+	if got := e.embedService.GetStats().Model; got != "embedding-2" {
+		t.Errorf("an empty model replaced the configured one with %q", got)
+	}
+}
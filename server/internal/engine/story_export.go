@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Formats accepted by Export
+const (
+	ExportMarkdown = "md"
+	ExportJSON     = "json"
+)
+
+// ErrUnsupportedExportFormat is returned by Export for formats other than md and json
+var ErrUnsupportedExportFormat = errors.New("unsupported export format")
+
+// StoryExport is a story assembled for sharing: its settings and every kept segment
+type StoryExport struct {
+	StoryID     string          `json:"story_id"`
+	Title       string          `json:"title"`
+	Genre       string          `json:"genre"`
+	Protagonist string          `json:"protagonist"`
+	Tone        string          `json:"tone"`
+	Style       string          `json:"style"`
+	Language    string          `json:"language"`
+	StartedAt   int64           `json:"started_at,omitempty"`
+	ExportedAt  int64           `json:"exported_at"`
+	Turns       int             `json:"turns"`
+	Segments    []ExportSegment `json:"segments"`
+}
+
+// ExportSegment is a story segment with the choice that followed it
+type ExportSegment struct {
+	StorySegment
+	ChosenOptionID string `json:"chosen_option_id,omitempty"` // Option picked after this segment
+	NextAction     string `json:"next_action,omitempty"`      // Action or option text that led on; empty for the last segment
+}
+
+// Export renders a story's narrative so far as Markdown (ExportMarkdown) or JSON
+// (ExportJSON), returning the document and its content type
+func (e *StoryEngine) Export(ctx context.Context, storyID, format string) ([]byte, string, error) {
+	if format != ExportMarkdown && format != ExportJSON {
+		return nil, "", fmt.Errorf("%w: %q, expected %s or %s", ErrUnsupportedExportFormat, format, ExportMarkdown, ExportJSON)
+	}
+
+	export, err := e.buildExport(storyID)
+	if err != nil {
+		return nil, "", err
+	}
+	e.loggerFor(ctx).Info("exported story", "story_id", storyID, "format", format, "segments", len(export.Segments))
+
+	if format == ExportJSON {
+		data, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal story export: %w", err)
+		}
+		return data, "application/json; charset=utf-8", nil
+	}
+	return []byte(renderExportMarkdown(export)), "text/markdown; charset=utf-8", nil
+}
+
+// buildExport snapshots a story's settings and history and links each segment to the
+// choice made after it
+func (e *StoryEngine) buildExport(storyID string) (*StoryExport, error) {
+	e.mu.RLock()
+	state, ok := e.state[storyID]
+	if !ok {
+		e.mu.RUnlock()
+		return nil, fmt.Errorf("%w: %s", ErrStoryNotFound, storyID)
+	}
+	export := &StoryExport{
+		StoryID:     storyID,
+		Title:       fmt.Sprintf("%s·%s", state.Genre, state.Protagonist),
+		Genre:       state.Genre,
+		Protagonist: state.Protagonist,
+		Tone:        state.Tone,
+		Style:       state.Style,
+		Language:    storyLanguage(state),
+		StartedAt:   state.StartedAt,
+		ExportedAt:  time.Now().Unix(),
+		Turns:       state.Turn,
+	}
+	segments := append([]StorySegment(nil), e.history[storyID]...)
+	e.mu.RUnlock()
+
+	export.Segments = make([]ExportSegment, len(segments))
+	for i, segment := range segments {
+		export.Segments[i].StorySegment = segment
+		if i+1 < len(segments) {
+			export.Segments[i].ChosenOptionID = segments[i+1].OptionID
+			export.Segments[i].NextAction = segments[i+1].Action
+		}
+	}
+	return export, nil
+}
+
+// renderExportMarkdown writes the export as a Markdown document with a header per scene
+func renderExportMarkdown(export *StoryExport) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", export.Title)
+	fmt.Fprintf(&b, "- 类型：%s\n", export.Genre)
+	fmt.Fprintf(&b, "- 主角：%s\n", export.Protagonist)
+	fmt.Fprintf(&b, "- 基调：%s · 文风：%s\n", export.Tone, export.Style)
+	if export.StartedAt > 0 {
+		fmt.Fprintf(&b, "- 开始时间：%s\n", time.Unix(export.StartedAt, 0).Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(&b, "- 回合数：%d\n", export.Turns)
+
+	scene := ""
+	for _, segment := range export.Segments {
+		if segment.Scene != "" && segment.Scene != scene {
+			scene = segment.Scene
+			fmt.Fprintf(&b, "\n## %s\n", scene)
+		}
+
+		fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(segment.Text))
+
+		if len(segment.Options) > 0 {
+			b.WriteString("\n")
+			for _, option := range segment.Options {
+				marker := ""
+				if segment.ChosenOptionID != "" && option.ID == segment.ChosenOptionID {
+					marker = " ✅"
+				}
+				fmt.Fprintf(&b, "- %s. %s%s\n", option.ID, option.Text, marker)
+			}
+		}
+		if segment.NextAction != "" && segment.ChosenOptionID == "" {
+			fmt.Fprintf(&b, "\n> 行动：%s\n", segment.NextAction)
+		}
+	}
+	return b.String()
+}
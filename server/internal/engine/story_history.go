@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+// maxHistorySegments bounds the narrative kept per story; older segments are dropped first
+const maxHistorySegments = 1000
+
+// StorySegment is one generated passage and the action or choice that led to it
+type StorySegment struct {
+	Turn      int           `json:"turn"`
+	Text      string        `json:"text"`
+	Scene     string        `json:"scene"`
+	Action    string        `json:"action,omitempty"`    // Player action or chosen option text; empty for the opening
+	OptionID  string        `json:"option_id,omitempty"` // Set when the segment followed an option
+	Options   []StoryOption `json:"options,omitempty"`   // Options offered at the end of the segment
+	Timestamp int64         `json:"timestamp"`
+}
+
+// recordSegmentLocked appends a generated segment to the story's history. Callers hold e.mu.
+func (e *StoryEngine) recordSegmentLocked(storyID string, state *StoryState, playerAction, text string, inputMemory rag.Memory) {
+	segment := StorySegment{
+		Turn:      state.Turn,
+		Text:      text,
+		Scene:     state.CurrentScene,
+		Action:    playerAction,
+		Options:   state.Options,
+		Timestamp: time.Now().Unix(),
+	}
+	if inputMemory.Type == rag.MemoryTypeDecision {
+		segment.OptionID, _ = inputMemory.Metadata["option_id"].(string)
+	}
+
+	segments := append(e.history[storyID], segment)
+	if len(segments) > maxHistorySegments {
+		segments = append([]StorySegment(nil), segments[len(segments)-maxHistorySegments:]...)
+	}
+	e.history[storyID] = segments
+}
+
+// GetStoryHistory returns up to limit segments of a story's narrative oldest first,
+// starting at offset, and the total number kept; limit <= 0 returns all from offset
+func (e *StoryEngine) GetStoryHistory(storyID string, offset, limit int) ([]StorySegment, int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if _, ok := e.state[storyID]; !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrStoryNotFound, storyID)
+	}
+
+	segments := e.history[storyID]
+	total := len(segments)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return append([]StorySegment{}, segments[offset:end]...), total, nil
+}
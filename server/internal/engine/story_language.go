@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"Cyber-Jianghu/server/internal/prompts"
+)
+
+// ErrUnsupportedLanguage is returned by CreateStory for a language with no story_continuation variant
+var ErrUnsupportedLanguage = errors.New("unsupported story language")
+
+// languageDefaults holds the settings and fixed prompt text for stories in one language
+type languageDefaults struct {
+	genre         string
+	tone          string
+	style         string
+	protagonist   string
+	openingScene  string
+	openingAction string
+	summaryFormat string // Opening summary, from genre and protagonist
+	retryFormat   string // Content filter retry instruction, from the joined banned terms
+	termSeparator string
+	structured    string // System prompt for structured output
+}
+
+// storyLanguages lists the built-in defaults per language. A language added only through
+// the template dir uses the English ones.
+var storyLanguages = map[string]languageDefaults{
+	prompts.DefaultLanguage: {
+		genre:         "武侠",
+		tone:          "史诗",
+		style:         "古典",
+		protagonist:   defaultProtagonist,
+		openingScene:  "故事开始",
+		openingAction: openingAction,
+		summaryFormat: "%s主角 %s的故事开始了",
+		retryFormat:   "上文出现了不符合武侠世界观的词语：%s。请按原要求重新创作这一段，严禁出现这些词语及任何现代、科幻概念。",
+		termSeparator: "、",
+		structured:    structuredSystemPrompt,
+	},
+	"en": {
+		genre:         "wuxia",
+		tone:          "epic",
+		style:         "classical",
+		protagonist:   "the Nameless Swordsman",
+		openingScene:  "The story begins",
+		openingAction: "(The story opens; the player has not acted yet. Set the opening scene.)",
+		summaryFormat: "The %s tale of %s begins",
+		retryFormat:   "The passage above used words that break the wuxia setting: %s. Rewrite it following the original requirements, without these words or any modern or science fiction concepts.",
+		termSeparator: ", ",
+		structured:    structuredSystemPromptEN,
+	},
+}
+
+// defaultsFor returns the defaults for a story language
+func defaultsFor(lang string) languageDefaults {
+	if defaults, ok := storyLanguages[prompts.NormalizeLanguage(lang)]; ok {
+		return defaults
+	}
+	return storyLanguages["en"]
+}
+
+// storyLanguage returns a story's language; stories saved before languages existed are Chinese
+func storyLanguage(state *StoryState) string {
+	return prompts.NormalizeLanguage(state.Language)
+}
+
+// retryInstruction asks the model to rewrite a segment without the banned terms
+func (d languageDefaults) retryInstruction(terms []string) string {
+	return fmt.Sprintf(d.retryFormat, strings.Join(terms, d.termSeparator))
+}
@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"Cyber-Jianghu/server/internal/interfaces"
+	"Cyber-Jianghu/server/internal/prompts"
+	"Cyber-Jianghu/server/internal/rag"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	npcTimeout = 30 * time.Second
+
+	// Fallbacks so npc_response renders for NPCs extracted without these traits
+	defaultNPCPersonality   = "性格未明"
+	defaultNPCSpeakingStyle = "寻常江湖口吻"
+)
+
+// NPCDialogue is an NPC's reply to a player action that addressed them
+type NPCDialogue struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+// npcCandidate is one character reported by the npc_extraction template
+type npcCandidate struct {
+	Name          string `json:"name"`
+	Relation      string `json:"relation"`
+	Personality   string `json:"personality"`
+	SpeakingStyle string `json:"speaking_style"`
+}
+
+// GetNPCs returns the NPCs tracked for a story in order of appearance
+func (e *StoryEngine) GetNPCs(storyID string) ([]*interfaces.Character, error) {
+	state, err := e.GetStoryState(storyID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Characters == nil {
+		return []*interfaces.Character{}, nil
+	}
+	return state.Characters, nil
+}
+
+// trackNPCs extracts the characters in a generated segment, merges them into the story
+// and stores new or changed ones as NPC memories
+func (e *StoryEngine) trackNPCs(ctx context.Context, storyID string, state *StoryState, generatedText string) {
+	ctx, cancel := context.WithTimeout(ctx, npcTimeout)
+	defer cancel()
+
+	candidates, err := e.extractNPCs(ctx, state, generatedText)
+	if err != nil {
+		e.loggerFor(ctx).Warn("failed to extract NPCs", "story_id", storyID, "error", err)
+		return
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	current, ok := e.state[storyID]
+	var changed []*interfaces.Character
+	if ok {
+		changed = mergeNPCsLocked(storyID, current, candidates)
+	}
+	e.mu.Unlock()
+
+	if len(changed) == 0 {
+		return
+	}
+
+	memories := make([]*rag.Memory, len(changed))
+	for i, npc := range changed {
+		memories[i] = &rag.Memory{
+			ID:        rag.BuildMemoryID(rag.MemoryTypeNPC, storyID),
+			Type:      rag.MemoryTypeNPC,
+			Content:   describeNPC(npc),
+			Timestamp: time.Now().Unix(),
+			StoryID:   storyID,
+			Metadata: map[string]interface{}{
+				"npc_id":   npc.ID,
+				"npc_name": npc.Name,
+				"relation": npc.Relation,
+			},
+		}
+	}
+	if err := e.memoryStore.StoreMemoriesBuffered(ctx, memories...); err != nil {
+		e.loggerFor(ctx).Warn("failed to store NPC memories", "story_id", storyID, "error", err)
+	}
+	e.loggerFor(ctx).Info("tracked NPCs", "story_id", storyID, "changed", len(changed))
+}
+
+// extractNPCs renders the npc_extraction template over a segment and parses the reply
+func (e *StoryEngine) extractNPCs(ctx context.Context, state *StoryState, generatedText string) ([]npcCandidate, error) {
+	known := make([]string, len(state.Characters))
+	for i, npc := range state.Characters {
+		known[i] = npc.Name
+	}
+
+	prompt, err := e.promptEngine.Render("npc_extraction", &prompts.TemplateContext{
+		Protagonist: state.Protagonist,
+		Custom: map[string]string{
+			"known_npcs": strings.Join(known, "、"),
+			"story_text": generatedText,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render NPC prompt: %w", err)
+	}
+
+	content, err := e.chat(ctx, "npc_extraction", prompt)
+	if err != nil {
+		return nil, err
+	}
+	return parseNPCCandidates(content)
+}
+
+// mergeNPCsLocked adds new characters and updates changed ones, returning both; entries
+// are replaced rather than modified so cloned states stay consistent. Callers must hold e.mu.
+func mergeNPCsLocked(storyID string, state *StoryState, candidates []npcCandidate) []*interfaces.Character {
+	index := make(map[string]int, len(state.Characters))
+	for i, npc := range state.Characters {
+		index[npc.Name] = i
+	}
+
+	var changed []*interfaces.Character
+	for _, c := range candidates {
+		name := strings.TrimSpace(c.Name)
+		if name == "" || name == state.Protagonist {
+			continue
+		}
+
+		i, exists := index[name]
+		if !exists {
+			npc := &interfaces.Character{
+				ID:       fmt.Sprintf("%s_npc_%d", storyID, len(state.Characters)+1),
+				Name:     name,
+				Relation: c.Relation,
+				State: map[string]interface{}{
+					"personality":    c.Personality,
+					"speaking_style": c.SpeakingStyle,
+				},
+			}
+			index[name] = len(state.Characters)
+			state.Characters = append(state.Characters, npc)
+			changed = append(changed, npc)
+			continue
+		}
+
+		old := state.Characters[i]
+		updated := &interfaces.Character{
+			ID:       old.ID,
+			Name:     old.Name,
+			Relation: firstNonEmpty(c.Relation, old.Relation),
+			State:    make(map[string]interface{}, len(old.State)),
+		}
+		for k, v := range old.State {
+			updated.State[k] = v
+		}
+		if c.Personality != "" {
+			updated.State["personality"] = c.Personality
+		}
+		if c.SpeakingStyle != "" {
+			updated.State["speaking_style"] = c.SpeakingStyle
+		}
+		if describeNPC(updated) != describeNPC(old) {
+			state.Characters[i] = updated
+			changed = append(changed, updated)
+		}
+	}
+
+	names := make([]string, len(state.Characters))
+	for i, npc := range state.Characters {
+		names[i] = npc.Name
+	}
+	state.NPCs = strings.Join(names, "、")
+	return changed
+}
+
+// targetNPC returns the tracked NPC named in a player action, preferring the longest name
+func targetNPC(state *StoryState, playerAction string) *interfaces.Character {
+	var target *interfaces.Character
+	for _, npc := range state.Characters {
+		if strings.Contains(playerAction, npc.Name) && (target == nil || len(npc.Name) > len(target.Name)) {
+			target = npc
+		}
+	}
+	return target
+}
+
+// generateNPCDialogue renders the npc_response template for an NPC the player addressed
+func (e *StoryEngine) generateNPCDialogue(ctx context.Context, state *StoryState, npc *interfaces.Character, playerAction string) (*NPCDialogue, error) {
+	prompt, err := e.promptEngine.Render("npc_response", &prompts.TemplateContext{
+		PlayerAction: playerAction,
+		Genre:        state.Genre,
+		Custom: map[string]string{
+			"npc_name":           npc.Name,
+			"npc_personality":    firstNonEmpty(npcTrait(npc, "personality"), defaultNPCPersonality),
+			"npc_speaking_style": firstNonEmpty(npcTrait(npc, "speaking_style"), defaultNPCSpeakingStyle),
+			"current_situation":  state.CurrentScene,
+			"mood":               state.Tone,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render NPC response prompt: %w", err)
+	}
+
+	content, err := e.chat(ctx, "npc_response", prompt)
+	if err != nil {
+		return nil, err
+	}
+	return &NPCDialogue{Name: npc.Name, Text: strings.TrimSpace(content)}, nil
+}
+
+// chat sends a single-prompt request with the template's generation params
+func (e *StoryEngine) chat(ctx context.Context, templateName, prompt string) (string, error) {
+	params := e.paramsFor(templateName)
+	resp, err := e.glm5Client.Chat(ctx, &ChatRequest{
+		Messages:    []ChatMessage{{Role: "user", Content: prompt}},
+		Model:       e.storyModel,
+		Temperature: params.Temperature,
+		MaxTokens:   params.MaxTokens,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to call model for %s: %w", templateName, err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned from model")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// parseNPCCandidates decodes the JSON array in a reply, ignoring any surrounding text
+func parseNPCCandidates(content string) ([]npcCandidate, error) {
+	start := strings.Index(content, "[")
+	end := strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in NPC reply")
+	}
+
+	var candidates []npcCandidate
+	if err := json.Unmarshal([]byte(content[start:end+1]), &candidates); err != nil {
+		return nil, fmt.Errorf("failed to parse NPC reply: %w", err)
+	}
+	return candidates, nil
+}
+
+// describeNPC renders an NPC as the text stored in its memory
+func describeNPC(npc *interfaces.Character) string {
+	parts := []string{npc.Name}
+	if npc.Relation != "" {
+		parts = append(parts, "关系："+npc.Relation)
+	}
+	if personality := npcTrait(npc, "personality"); personality != "" {
+		parts = append(parts, "性格："+personality)
+	}
+	if style := npcTrait(npc, "speaking_style"); style != "" {
+		parts = append(parts, "说话风格："+style)
+	}
+	return strings.Join(parts, "，")
+}
+
+// npcTrait returns a string trait from an NPC's state
+func npcTrait(npc *interfaces.Character, key string) string {
+	value, _ := npc.State[key].(string)
+	return value
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"Cyber-Jianghu/server/internal/prompts"
+	"Cyber-Jianghu/server/internal/rag"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSummaryInterval = 5
+	summaryTimeout         = 30 * time.Second
+	maxEventRunes          = 300  // Per-event excerpt of the generated text
+	maxSummaryRunes        = 1000 // Oldest condensed lines are dropped past this
+)
+
+// summaryJob is a batch of events to be condensed into a story's summary
+type summaryJob struct {
+	storyID string
+	scene   string
+	summary string
+	events  []string
+}
+
+// SetSummaryInterval sets how many turns pass between summary condensations; 0 disables it
+func (e *StoryEngine) SetSummaryInterval(turns int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if turns < 0 {
+		turns = 0
+	}
+	e.summaryInterval = turns
+}
+
+// recordTurnLocked notes a finished turn and returns a job once enough events have
+// accumulated; callers must hold e.mu
+func (e *StoryEngine) recordTurnLocked(storyID string, state *StoryState, playerAction, generatedText string) *summaryJob {
+	state.Turn++
+
+	event := "剧情：" + truncateRunes(generatedText, maxEventRunes)
+	if playerAction != "" {
+		event = "玩家：" + playerAction + "\n" + event
+	}
+	state.RecentEvents = append(state.RecentEvents, event)
+
+	if e.summaryInterval <= 0 || state.Turn%e.summaryInterval != 0 {
+		return nil
+	}
+
+	job := &summaryJob{
+		storyID: storyID,
+		scene:   state.CurrentScene,
+		summary: state.Summary,
+		events:  state.RecentEvents,
+	}
+	state.RecentEvents = nil
+	return job
+}
+
+// condenseSummary asks GLM-5 to compress the job's events and appends the result to the
+// story summary. On failure the events are put back for the next attempt.
+func (e *StoryEngine) condenseSummary(ctx context.Context, job *summaryJob) {
+	ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+	defer cancel()
+
+	condensed, err := e.summarizeEvents(ctx, job)
+	if err != nil {
+		e.loggerFor(ctx).Warn("failed to condense summary", "story_id", job.storyID, "error", err)
+	}
+
+	e.mu.Lock()
+	state, ok := e.state[job.storyID]
+	if !ok {
+		e.mu.Unlock()
+		return
+	}
+	if err != nil {
+		state.RecentEvents = append(job.events, state.RecentEvents...)
+		e.mu.Unlock()
+		return
+	}
+
+	state.Summary = appendSummary(state.Summary, condensed)
+	summary := state.Summary
+	e.mu.Unlock()
+
+	e.loggerFor(ctx).Info("condensed events into summary", "story_id", job.storyID, "events", len(job.events))
+	e.refreshStateMemory(ctx, job.storyID, summary)
+}
+
+// refreshStateMemory replaces the story's state memory with the current summary, storing
+// it afresh if the story predates stable state memory IDs
+func (e *StoryEngine) refreshStateMemory(ctx context.Context, storyID, summary string) {
+	id := rag.BuildMemoryID(rag.MemoryTypeStoryState, storyID)
+	err := e.memoryStore.UpdateMemory(ctx, id, summary)
+	if errors.Is(err, rag.ErrMemoryNotFound) {
+		err = e.memoryStore.StoreMemory(ctx, &rag.Memory{
+			ID:        id,
+			Type:      rag.MemoryTypeStoryState,
+			Content:   summary,
+			Timestamp: time.Now().Unix(),
+			StoryID:   storyID,
+		})
+	}
+	if err != nil {
+		e.loggerFor(ctx).Warn("failed to update story state memory", "story_id", storyID, "error", err)
+	}
+}
+
+// summarizeEvents renders the decision_summary template over the events and calls GLM-5
+func (e *StoryEngine) summarizeEvents(ctx context.Context, job *summaryJob) (string, error) {
+	prompt, err := e.promptEngine.Render("decision_summary", &prompts.TemplateContext{
+		Custom: map[string]string{
+			"story_node":    fmt.Sprintf("%s（前情：%s）", job.scene, job.summary),
+			"player_choice": strings.Join(job.events, "\n"),
+			"choice_reason": "概括以上最近发生的事件，保留关键人物、抉择与伏笔",
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render summary prompt: %w", err)
+	}
+
+	params := e.paramsFor("decision_summary")
+	resp, err := e.glm5Client.Chat(ctx, &ChatRequest{
+		Messages:    []ChatMessage{{Role: "user", Content: prompt}},
+		Model:       e.storyModel,
+		Temperature: params.Temperature,
+		MaxTokens:   params.MaxTokens,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate summary: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned from model")
+	}
+
+	condensed := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if condensed == "" {
+		return "", fmt.Errorf("empty summary returned from model")
+	}
+	return condensed, nil
+}
+
+// appendSummary adds a condensed line to the summary, dropping the oldest condensed lines
+// (but never the opening line) once it grows past maxSummaryRunes
+func appendSummary(summary, condensed string) string {
+	lines := []string{}
+	if summary != "" {
+		lines = strings.Split(summary, "\n")
+	}
+	lines = append(lines, strings.ReplaceAll(condensed, "\n", " "))
+
+	for len(lines) > 2 && len([]rune(strings.Join(lines, "\n"))) > maxSummaryRunes {
+		lines = append(lines[:1], lines[2:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncateRunes shortens s to at most n runes
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+// maxUndoDepth is how many turns back a story can be rolled
+const maxUndoDepth = 10
+
+// ErrNothingToUndo is returned by Rollback when no earlier turn is kept for the story
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// turnSnapshot is a story as it was before one generated turn, with what the turn added
+type turnSnapshot struct {
+	state     *StoryState
+	memoryIDs []string // Decision and player action memories the turn stored
+}
+
+// pushUndoLocked saves the state before a turn is applied. The opening segment is not
+// kept, so a story can't be rolled back to before it began. Callers hold e.mu.
+func (e *StoryEngine) pushUndoLocked(storyID string, state *StoryState, memories []*rag.Memory) {
+	if state.Turn == 0 {
+		return
+	}
+
+	snapshot := &turnSnapshot{state: state.clone()}
+	for _, memory := range memories {
+		snapshot.memoryIDs = append(snapshot.memoryIDs, memory.ID)
+	}
+
+	stack := append(e.undo[storyID], snapshot)
+	if len(stack) > maxUndoDepth {
+		stack = append([]*turnSnapshot(nil), stack[len(stack)-maxUndoDepth:]...)
+	}
+	e.undo[storyID] = stack
+}
+
+// Rollback reverts a story to before its last turn, restoring the previous text, options
+// and scene, and deletes the decision and player action memories that turn stored. It
+// returns ErrNothingToUndo, changing nothing, when no earlier turn is kept. Decisions
+// already written to MySQL stay in the audit trail.
+func (e *StoryEngine) Rollback(ctx context.Context, storyID string) (*StoryState, error) {
+	e.mu.Lock()
+	if _, ok := e.state[storyID]; !ok {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrStoryNotFound, storyID)
+	}
+	stack := e.undo[storyID]
+	if len(stack) == 0 {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("%w: story %s has no earlier turn kept", ErrNothingToUndo, storyID)
+	}
+
+	snapshot := stack[len(stack)-1]
+	e.undo[storyID] = stack[:len(stack)-1]
+	snapshot.state.TokenUsage = e.state[storyID].TokenUsage // Tokens spent on the undone turn stay spent
+	e.state[storyID] = snapshot.state
+	history := e.history[storyID]
+	for len(history) > 0 && history[len(history)-1].Turn > snapshot.state.Turn {
+		history = history[:len(history)-1]
+	}
+	e.history[storyID] = history
+	restored := snapshot.state.clone()
+	e.mu.Unlock()
+
+	// Only the points the undone turn added; the rest of the story's memories stay
+	if err := e.memoryStore.DeleteMemories(ctx, snapshot.memoryIDs...); err != nil {
+		e.loggerFor(ctx).Warn("failed to delete memories of undone turn", "story_id", storyID, "ids", snapshot.memoryIDs, "error", err)
+	}
+
+	e.loggerFor(ctx).Info("rolled back story", "story_id", storyID, "turn", restored.Turn, "undo_left", len(stack)-1)
+	return restored, nil
+}
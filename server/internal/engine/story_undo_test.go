@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Cyber-Jianghu/server/internal/config"
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+func TestRollbackDeletesBufferedTurnMemories(t *testing.T) {
+	ctx := context.Background()
+	vectors := rag.NewInMemoryVectorStore(64)
+	e := NewStoryEngine("", vectors, t.TempDir(), "", config.GLM5Config{})
+	e.SetEmbedder(rag.NewHashEmbedder(64))
+	e.SetChatClient(&scriptedChatClient{replies: map[string]string{
+		"## 玩家的行为\n": "山道上落叶纷飞。\nA. 继续赶路\nB. 就地歇息",
+	}})
+	// Keep turn memories buffered so the rollback races a pending flush
+	e.SetMemoryWriteBuffer(100, time.Hour)
+
+	if _, err := e.CreateStory(ctx, "undo", nil); err != nil {
+		t.Fatalf("CreateStory: %v", err)
+	}
+	if _, err := e.ApplyOption(ctx, "undo", "A", "继续赶路"); err != nil {
+		t.Fatalf("first turn: %v", err)
+	}
+	if _, err := e.ApplyOption(ctx, "undo", "B", "就地歇息"); err != nil {
+		t.Fatalf("second turn: %v", err)
+	}
+
+	state, err := e.Rollback(ctx, "undo")
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if state.Turn != 2 {
+		t.Fatalf("rolled back to turn %d, want 2", state.Turn)
+	}
+
+	if err := e.memoryStore.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	points, err := vectors.Scroll(ctx, "memories", nil, 100)
+	if err != nil {
+		t.Fatalf("Scroll: %v", err)
+	}
+	kept := false
+	for _, point := range points {
+		if content, _ := point.Payload["content"].(string); content == "继续赶路" {
+			kept = true
+		}
+		if content, _ := point.Payload["content"].(string); content == "就地歇息" || content == "选择了选项 B: 就地歇息" {
+			t.Errorf("memory %q of the undone turn survived the rollback", content)
+		}
+	}
+	if !kept {
+		t.Error("the first turn's action memory was deleted too")
+	}
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// structuredSystemPrompt asks for the story segment as a JSON object; the user prompt's
+// formatting rules for options and scene markers map onto its fields
+const structuredSystemPrompt = `你必须只输出一个 JSON 对象，不要输出任何其他文字或代码块标记。格式如下：
+{
+  "narrative": "故事正文，不含选项",
+  "scene": "若故事开篇或地点发生转换，填写新场景名（如“悦来客栈”），否则为空字符串",
+  "options": [{"id": "A", "text": "选项内容", "description": "选项的简要说明"}],
+  "visual_prompt": "描绘当前场景的英文图像提示词"
+}
+用户要求中关于选项格式和【场景：】标记的说明，改为分别填入 options 和 scene 字段。`
+
+// structuredSystemPromptEN is structuredSystemPrompt for English stories
+const structuredSystemPromptEN = `Output a single JSON object and nothing else, with no code fences. Use this format:
+{
+  "narrative": "the story text, without the options",
+  "scene": "the new scene name when the story opens or changes place (e.g. \"Yuelai Inn\"), otherwise an empty string",
+  "options": [{"id": "A", "text": "the option", "description": "a short explanation of the option"}],
+  "visual_prompt": "an English image prompt depicting the current scene"
+}
+The requirements about option format and [Scene: ] markers apply to the options and scene fields instead.`
+
+// structuredSegment is the JSON object GLM returns in structured mode
+type structuredSegment struct {
+	Narrative    string        `json:"narrative"`
+	Scene        string        `json:"scene"`
+	Options      []StoryOption `json:"options"`
+	VisualPrompt string        `json:"visual_prompt"`
+}
+
+// segmentParts is a model reply split into the pieces the engine uses
+type segmentParts struct {
+	text         string
+	scene        string // Scene the reply says it moved to, if any
+	options      []StoryOption
+	visualPrompt string // Model-written image prompt; empty to use the image template
+}
+
+// SetStructuredOutput switches story generation to JSON replies; replies that don't parse
+// fall back to the prose parser
+func (e *StoryEngine) SetStructuredOutput(enabled bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.structuredOutput = enabled
+}
+
+// structuredOutputEnabled reports whether story generation asks for JSON replies
+func (e *StoryEngine) structuredOutputEnabled() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.structuredOutput
+}
+
+// parseSegment splits a reply using its JSON form in structured mode, falling back to the
+// scene marker and option scrapers when the model did not comply
+func (e *StoryEngine) parseSegment(ctx context.Context, storyID, content string, structured bool) segmentParts {
+	if structured {
+		segment, err := parseStructuredSegment(content)
+		if err == nil {
+			return segmentParts{
+				text:         segment.Narrative,
+				scene:        strings.TrimSpace(segment.Scene),
+				options:      normalizeOptions(segment.Options),
+				visualPrompt: strings.TrimSpace(segment.VisualPrompt),
+			}
+		}
+		e.loggerFor(ctx).Warn("structured reply unusable, parsing as prose", "story_id", storyID, "error", err)
+	}
+
+	scene, text := parseSceneMarker(content)
+	return segmentParts{
+		text:    text,
+		scene:   scene,
+		options: e.parseOptionsFromResponse(text),
+	}
+}
+
+// parseStructuredSegment decodes the JSON object in a reply, tolerating code fences
+func parseStructuredSegment(content string) (*structuredSegment, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in reply")
+	}
+
+	var segment structuredSegment
+	if err := json.Unmarshal([]byte(content[start:end+1]), &segment); err != nil {
+		return nil, fmt.Errorf("failed to parse structured reply: %w", err)
+	}
+	segment.Narrative = strings.TrimSpace(segment.Narrative)
+	if segment.Narrative == "" {
+		return nil, fmt.Errorf("structured reply has no narrative")
+	}
+	return &segment, nil
+}
+
+// normalizeOptions drops empty options, fills missing IDs with A, B, C... and defaults
+// descriptions to the option text as the prose parser does
+func normalizeOptions(options []StoryOption) []StoryOption {
+	normalized := make([]StoryOption, 0, len(options))
+	for _, opt := range options {
+		opt.Text = strings.TrimSpace(opt.Text)
+		if opt.Text == "" {
+			continue
+		}
+		if opt.ID == "" {
+			opt.ID = string(rune('A' + len(normalized)))
+		}
+		if opt.Description == "" {
+			opt.Description = opt.Text
+		}
+		normalized = append(normalized, opt)
+	}
+	return normalized
+}
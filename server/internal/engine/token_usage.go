@@ -0,0 +1,33 @@
+package engine
+
+import "go.uber.org/atomic"
+
+// Add accumulates other into u
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// usageCounter totals token usage across concurrent requests
+type usageCounter struct {
+	prompt     atomic.Int64
+	completion atomic.Int64
+	total      atomic.Int64
+}
+
+// add records one response's usage
+func (c *usageCounter) add(usage Usage) {
+	c.prompt.Add(int64(usage.PromptTokens))
+	c.completion.Add(int64(usage.CompletionTokens))
+	c.total.Add(int64(usage.TotalTokens))
+}
+
+// snapshot returns the totals so far
+func (c *usageCounter) snapshot() Usage {
+	return Usage{
+		PromptTokens:     int(c.prompt.Load()),
+		CompletionTokens: int(c.completion.Load()),
+		TotalTokens:      int(c.total.Load()),
+	}
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	defaultTranslationModel = "glm-4"
+	translationCacheSize    = 2000
+	translationPrompt       = "你是直播弹幕翻译助手。请将下面的弹幕翻译成简体中文，保持原意和语气，只输出译文，不要添加任何解释。"
+)
+
+// DanmakuTranslator translates non-Chinese danmaku into Chinese for the story engine
+type DanmakuTranslator struct {
+	glm5Client ChatClient
+	model      string
+	cache      map[string]string
+	mu         sync.RWMutex
+}
+
+// NewDanmakuTranslator creates a new danmaku translator backed by GLM-5
+func NewDanmakuTranslator(glm5Client ChatClient, model string) *DanmakuTranslator {
+	if model == "" {
+		model = defaultTranslationModel
+	}
+	return &DanmakuTranslator{
+		glm5Client: glm5Client,
+		model:      model,
+		cache:      make(map[string]string),
+	}
+}
+
+// NeedsTranslation reports whether text is mostly written in a non-Chinese language.
+// Slash commands are left untouched so the command parser still sees them verbatim.
+func NeedsTranslation(text string) bool {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || strings.HasPrefix(trimmed, "/") {
+		return false
+	}
+
+	var han, letters int
+	for _, r := range trimmed {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+
+	return letters >= 2 && han*3 < letters
+}
+
+// Translate translates text into Chinese, using cached results when available
+func (t *DanmakuTranslator) Translate(ctx context.Context, text string) (string, error) {
+	text = strings.TrimSpace(text)
+
+	t.mu.RLock()
+	cached, ok := t.cache[text]
+	t.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	req := &ChatRequest{
+		Messages: []ChatMessage{
+			{Role: "system", Content: translationPrompt},
+			{Role: "user", Content: text},
+		},
+		Model:       t.model,
+		Temperature: 0.3,
+		MaxTokens:   200,
+	}
+
+	resp, err := t.glm5Client.Chat(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to translate danmaku: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned from model")
+	}
+
+	translated := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if translated == "" {
+		return "", fmt.Errorf("empty translation")
+	}
+
+	t.mu.Lock()
+	// Simple bound: reset the cache once it grows too large
+	if len(t.cache) >= translationCacheSize {
+		t.cache = make(map[string]string)
+	}
+	t.cache[text] = translated
+	t.mu.Unlock()
+
+	return translated, nil
+}
+
+// GetCacheSize returns the number of cached translations
+func (t *DanmakuTranslator) GetCacheSize() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.cache)
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingChatClient replies with reply, or fails with err, and counts its calls
+type countingChatClient struct {
+	reply string
+	err   error
+	calls int
+	last  *ChatRequest
+}
+
+func (c *countingChatClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	c.calls++
+	c.last = req
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &ChatResponse{Choices: []Choice{{Message: ChatMessage{Role: "assistant", Content: c.reply}}}}, nil
+}
+
+func (c *countingChatClient) Stats() GLMStats {
+	return GLMStats{}
+}
+
+func TestNeedsTranslation(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"attack the bandit", true},
+		{"  こんにちは ", true},
+		{"攻击山贼", false},
+		{"我选 A", false},
+		{"666", false},
+		{"ok", true},
+		{"a", false},
+		{"/vote 2", false},
+		{"/attack bandit", false},
+		{"", false},
+		{"hello 冲", true},
+		{"冲冲冲 go", false},
+	}
+	for _, tt := range tests {
+		if got := NeedsTranslation(tt.text); got != tt.want {
+			t.Errorf("NeedsTranslation(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDanmakuTranslatorCachesTranslations(t *testing.T) {
+	client := &countingChatClient{reply: "  攻击山贼\n"}
+	translator := NewDanmakuTranslator(client, "")
+	ctx := context.Background()
+
+	got, err := translator.Translate(ctx, "attack the bandit")
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if got != "攻击山贼" {
+		t.Errorf("translation = %q, want 攻击山贼", got)
+	}
+	if client.last.Model != defaultTranslationModel || client.last.Messages[1].Content != "attack the bandit" {
+		t.Errorf("request model %q, text %q", client.last.Model, client.last.Messages[1].Content)
+	}
+
+	// Surrounding whitespace doesn't make a new cache entry
+	if got, _ := translator.Translate(ctx, " attack the bandit "); got != "攻击山贼" {
+		t.Errorf("cached translation = %q, want 攻击山贼", got)
+	}
+	if client.calls != 1 || translator.GetCacheSize() != 1 {
+		t.Errorf("%d model calls and %d cached, want 1 and 1", client.calls, translator.GetCacheSize())
+	}
+}
+
+func TestDanmakuTranslatorErrors(t *testing.T) {
+	ctx := context.Background()
+
+	failing := NewDanmakuTranslator(&countingChatClient{err: errors.New("rate limited")}, "glm-4-flash")
+	if _, err := failing.Translate(ctx, "hello"); err == nil {
+		t.Error("a failed model call returned no error")
+	}
+
+	empty := NewDanmakuTranslator(&countingChatClient{reply: "   "}, "")
+	if _, err := empty.Translate(ctx, "hello"); err == nil {
+		t.Error("an empty translation returned no error")
+	}
+	if empty.GetCacheSize() != 0 {
+		t.Error("an empty translation was cached")
+	}
+}
+
+func TestTranslateForStoryFallsBackToOriginal(t *testing.T) {
+	e := newReplayTestEngine(t, &countingChatClient{err: errors.New("unavailable")})
+	ctx := context.Background()
+
+	if e.NeedsTranslation("hello there") {
+		t.Error("translation needed before it was enabled")
+	}
+	e.EnableTranslation("")
+	if !e.NeedsTranslation("hello there") {
+		t.Error("English danmaku not sent for translation")
+	}
+	if got := e.TranslateForStory(ctx, "hello there"); got != "hello there" {
+		t.Errorf("failed translation gave %q, want the original text", got)
+	}
+	if got := e.TranslateForStory(ctx, "投票2"); got != "投票2" {
+		t.Errorf("Chinese danmaku changed to %q", got)
+	}
+}
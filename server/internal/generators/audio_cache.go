@@ -3,6 +3,7 @@ package generators
 import (
 	"context"
 	"crypto/md5"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -16,7 +17,6 @@ import (
 type AudioCacheEntry struct {
 	Key           string                 `json:"key"`
 	FilePath      string                 `json:"file_path"`
-	AudioData     []byte                 `json:"-"`
 	Base64Data    string                 `json:"base64_data,omitempty"`
 	Text          string                 `json:"text"`
 	VoiceID       string                 `json:"voice_id"`
@@ -37,9 +37,12 @@ type AudioCache struct {
 	entries     map[string]*AudioCacheEntry
 	directory   string
 	maxEntries  int
+	maxSize     int64 // Total bytes on disk before the oldest entries are evicted; 0 is unlimited
 	ttl         time.Duration
 	mu          sync.RWMutex
 	stats       *AudioCacheStats
+	negative    negativeCache // Recent failures, kept in memory only
+	memory      *memoryLRU    // Recently served payloads, bounded by bytes rather than entries
 }
 
 // AudioCacheStats holds statistics about cache performance
@@ -49,6 +52,11 @@ type AudioCacheStats struct {
 	HitRate     float64 `json:"hit_rate"`
 	TotalEntries int    `json:"total_entries"`
 	TotalSize    int64  `json:"total_size"`
+	MemoryHits      int64 `json:"memory_hits"`      // Hits served from the in-memory tier
+	DiskHits        int64 `json:"disk_hits"`        // Hits read back from disk
+	MemorySize      int64 `json:"memory_size"`      // Bytes held in the in-memory tier
+	NegativeHits    int64 `json:"negative_hits"`    // Gets answered by a cached failure
+	NegativeEntries int   `json:"negative_entries"` // Failures currently remembered
 	TotalDuration float64 `json:"total_duration"`
 }
 
@@ -60,6 +68,8 @@ func NewAudioCache(directory string, maxEntries int, ttl time.Duration) *AudioCa
 		maxEntries: maxEntries,
 		ttl:         ttl,
 		stats:       &AudioCacheStats{},
+		negative:    make(negativeCache),
+		memory:      newMemoryLRU(DefaultAudioMemoryBudget),
 	}
 }
 
@@ -124,6 +134,9 @@ func (c *AudioCache) Initialize(ctx context.Context) error {
 		c.stats.TotalDuration += cacheEntry.Duration
 	}
 
+	// Enforce limits that may have shrunk since the files were written
+	c.evictLocked("")
+
 	return nil
 }
 
@@ -134,6 +147,10 @@ func (c *AudioCache) Get(ctx context.Context, key string) ([]byte, error) {
 
 	entry, ok := c.entries[key]
 	if !ok {
+		if err := c.negative.get(key); err != nil {
+			c.stats.NegativeHits++
+			return nil, err
+		}
 		c.stats.Misses++
 		c.updateHitRate()
 		return nil, fmt.Errorf("cache miss: %s", key)
@@ -141,12 +158,10 @@ func (c *AudioCache) Get(ctx context.Context, key string) ([]byte, error) {
 
 	// Check if expired
 	if c.ttl > 0 && time.Since(entry.CreatedAt) > c.ttl {
-		delete(c.entries, key)
+		// Drop the entry's size with it, or eviction would count bytes no longer on disk
+		c.removeLocked(key)
 		c.stats.Misses++
 		c.updateHitRate()
-		// Clean up files
-		_ = os.Remove(entry.FilePath)
-		_ = os.Remove(entry.FilePath + ".meta")
 		return nil, fmt.Errorf("cache entry expired")
 	}
 
@@ -155,25 +170,30 @@ func (c *AudioCache) Get(ctx context.Context, key string) ([]byte, error) {
 	entry.AccessCount++
 	entry.Hits++
 
-	c.stats.Hits++
-	c.updateHitRate()
-
-	// Return cached data
-	if len(entry.AudioData) > 0 {
-		data, err := os.ReadFile(entry.FilePath)
-		if err != nil {
-			c.stats.Misses++
-			c.updateHitRate()
-			return nil, fmt.Errorf("failed to read cached file: %w", err)
-		}
+	// Hot payloads skip the disk entirely
+	if data, ok := c.memory.get(key); ok {
+		c.stats.Hits++
+		c.stats.MemoryHits++
+		c.updateHitRate()
 		return data, nil
 	}
 
-	return entry.AudioData, nil
+	data, err := os.ReadFile(entry.FilePath)
+	if err != nil {
+		c.stats.Misses++
+		c.updateHitRate()
+		return nil, fmt.Errorf("failed to read cached file: %w", err)
+	}
+	c.stats.Hits++
+	c.stats.DiskHits++
+	c.updateHitRate()
+	c.memory.put(key, data)
+
+	return data, nil
 }
 
 // Put stores an audio in cache
-func (c *AudioCache) Put(ctx context.Context, key string, data []byte, text string, voiceID string, opts *TTSOptions, format string, duration float64) error {
+func (c *AudioCache) Put(ctx context.Context, key string, data []byte, text string, voiceID string, opts *TTSOptions, format string, duration float64, sampleRate int) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -195,7 +215,6 @@ func (c *AudioCache) Put(ctx context.Context, key string, data []byte, text stri
 	entry := &AudioCacheEntry{
 		Key:          key,
 		FilePath:     filePath,
-		AudioData:    data,
 		Text:         text,
 		VoiceID:      voiceID,
 		Options:      opts,
@@ -205,6 +224,7 @@ func (c *AudioCache) Put(ctx context.Context, key string, data []byte, text stri
 		FileSize:     int64(len(data)),
 		Duration:     duration,
 		Format:       format,
+		SampleRate:   sampleRate,
 		Hits:         0,
 		Metadata:     make(map[string]interface{}),
 	}
@@ -228,20 +248,54 @@ func (c *AudioCache) Put(ctx context.Context, key string, data []byte, text stri
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
-	// Add to cache
+	// Add to cache, replacing any earlier entry for the key
+	if old, ok := c.entries[key]; ok {
+		c.stats.TotalEntries--
+		c.stats.TotalSize -= old.FileSize
+		c.stats.TotalDuration -= old.Duration
+	}
 	c.entries[key] = entry
+	delete(c.negative, key)
+	c.memory.put(key, data)
 	c.stats.TotalEntries++
 	c.stats.TotalSize += int64(len(data))
 	c.stats.TotalDuration += duration
 
-	// Check if we need to evict entries
-	if len(c.entries) > c.maxEntries {
-		c.evictOldest()
-	}
+	// Evict down to the entry and size limits, keeping what was just stored
+	c.evictLocked(key)
 
 	return nil
 }
 
+// PutNegative remembers that generating key failed with err, so Get returns
+// ErrCachedFailure for ttl instead of sending the request to the backend again.
+// A non-positive ttl uses DefaultNegativeTTL.
+func (c *AudioCache) PutNegative(key string, err error, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.negative.put(key, err, ttl)
+}
+
+// SetMemoryBudget sets how many bytes of recently served payloads are kept in memory in
+// front of the disk store; 0 disables the memory tier
+func (c *AudioCache) SetMemoryBudget(bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.memory.setBudget(bytes)
+}
+
+// SetMaxSize caps the total bytes the cache keeps on disk, evicting the least recently
+// used entries when a Put goes over; 0 removes the cap
+func (c *AudioCache) SetMaxSize(bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxSize = bytes
+	c.evictLocked("")
+}
+
 // Check checks if an entry exists in cache
 func (c *AudioCache) Check(key string) bool {
 	c.mu.RLock()
@@ -265,9 +319,18 @@ func (c *AudioCache) Invalidate(key string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.removeLocked(key)
+	return nil
+}
+
+// removeLocked deletes an entry and its files; callers must hold mu
+func (c *AudioCache) removeLocked(key string) {
+	delete(c.negative, key)
+	c.memory.remove(key)
+
 	entry, ok := c.entries[key]
 	if !ok {
-		return nil
+		return
 	}
 
 	// Delete files
@@ -281,8 +344,6 @@ func (c *AudioCache) Invalidate(key string) error {
 	c.stats.TotalEntries--
 	c.stats.TotalSize -= entry.FileSize
 	c.stats.TotalDuration -= entry.Duration
-
-	return nil
 }
 
 // Clear removes all entries from cache
@@ -306,6 +367,9 @@ func (c *AudioCache) Clear(ctx context.Context) error {
 	c.stats.Hits = 0
 	c.stats.Misses = 0
 	c.stats.HitRate = 0
+	c.negative = make(negativeCache)
+	c.memory.clear()
+	c.stats.NegativeHits = 0
 
 	return nil
 }
@@ -316,25 +380,49 @@ func (c *AudioCache) GetStats() *AudioCacheStats {
 	defer c.mu.RUnlock()
 
 	statsCopy := *c.stats
+	statsCopy.NegativeEntries = len(c.negative)
+	statsCopy.MemorySize = c.memory.size
 	return &statsCopy
 }
 
-// evictOldest removes the oldest entries to make room
-func (c *AudioCache) evictOldest() {
+// evictLocked removes least recently used entries until the cache is within both
+// maxEntries and maxSize, never evicting keep; callers must hold mu
+func (c *AudioCache) evictLocked(keep string) {
+	for c.overLimitLocked() {
+		if !c.evictOldest(keep) {
+			return
+		}
+	}
+}
+
+// overLimitLocked reports whether the cache holds too many entries or bytes
+func (c *AudioCache) overLimitLocked() bool {
+	return (c.maxEntries > 0 && len(c.entries) > c.maxEntries) ||
+		(c.maxSize > 0 && c.stats.TotalSize > c.maxSize)
+}
+
+// evictOldest removes the least recently accessed entry other than keep, reporting
+// whether there was one to remove
+func (c *AudioCache) evictOldest(keep string) bool {
 	// Find oldest entry
 	var oldestKey string
 	var oldestTime time.Time
 
 	for key, entry := range c.entries {
-		if oldestTime.IsZero() || entry.LastAccessed.Before(oldestTime) {
+		if key == keep {
+			continue
+		}
+		if oldestKey == "" || entry.LastAccessed.Before(oldestTime) {
 			oldestKey = key
 			oldestTime = entry.LastAccessed
 		}
 	}
 
-	if oldestKey != "" {
-		_ = c.Invalidate(oldestKey)
+	if oldestKey == "" {
+		return false
 	}
+	c.removeLocked(oldestKey)
+	return true
 }
 
 // updateHitRate recalculates the hit rate
@@ -348,11 +436,13 @@ func (c *AudioCache) updateHitRate() {
 // GenerateCacheKey generates a cache key from text and options
 func GenerateAudioCacheKey(text string, voiceID string, opts *TTSOptions) string {
 	// Create a canonical representation of the request
-	data := fmt.Sprintf("%s|%s|%f|%s",
+	data := fmt.Sprintf("%s|%s|%f|%s|%s|%s",
 		text,
 		voiceID,
 		opts.Speed,
 		opts.Tone,
+		opts.Language,
+		opts.Format,
 	)
 
 	// Generate MD5 hash
@@ -365,11 +455,11 @@ func (c *AudioCache) CleanExpired(ctx context.Context) int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	count := c.negative.cleanExpired()
 	if c.ttl == 0 {
-		return 0
+		return count
 	}
 
-	count := 0
 	now := time.Now()
 
 	for key, entry := range c.entries {
@@ -382,6 +472,7 @@ func (c *AudioCache) CleanExpired(ctx context.Context) int {
 
 			// Remove from cache
 			delete(c.entries, key)
+			c.memory.remove(key)
 			c.stats.TotalEntries--
 			c.stats.TotalSize -= entry.FileSize
 			c.stats.TotalDuration -= entry.Duration
@@ -423,6 +514,57 @@ func EstimateAudioDuration(fileSize int64, format string, sampleRate int) float6
 	return float64(fileSize) / float64(bytesPerSecond)
 }
 
+// ParseWAVDuration reads the RIFF header of a WAV clip and returns its exact duration in seconds and its sample rate
+func ParseWAVDuration(data []byte) (float64, int, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, 0, fmt.Errorf("not a RIFF/WAVE file")
+	}
+
+	var (
+		sampleRate    uint32
+		channels      uint16
+		bitsPerSample uint16
+		haveFormat    bool
+	)
+
+	// Walk the chunks after the RIFF header
+	offset := 12
+	for offset+8 <= len(data) {
+		chunkID := string(data[offset : offset+4])
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := offset + 8
+
+		switch chunkID {
+		case "fmt ":
+			if chunkSize < 16 || body+16 > len(data) {
+				return 0, 0, fmt.Errorf("truncated fmt chunk")
+			}
+			channels = binary.LittleEndian.Uint16(data[body+2 : body+4])
+			sampleRate = binary.LittleEndian.Uint32(data[body+4 : body+8])
+			bitsPerSample = binary.LittleEndian.Uint16(data[body+14 : body+16])
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return 0, 0, fmt.Errorf("data chunk before fmt chunk")
+			}
+			bytesPerSecond := int(sampleRate) * int(channels) * int(bitsPerSample) / 8
+			if bytesPerSecond == 0 {
+				return 0, 0, fmt.Errorf("invalid WAV format: %d Hz, %d channels, %d bits", sampleRate, channels, bitsPerSample)
+			}
+			// Streaming encoders may write a placeholder size; trust the bytes actually present
+			if chunkSize > len(data)-body || chunkSize == 0 {
+				chunkSize = len(data) - body
+			}
+			return float64(chunkSize) / float64(bytesPerSecond), int(sampleRate), nil
+		}
+
+		// Chunks are word-aligned
+		offset = body + chunkSize + chunkSize%2
+	}
+
+	return 0, 0, fmt.Errorf("no data chunk found")
+}
+
 // GetCacheKeys returns all cache keys
 func (c *AudioCache) GetCacheKeys() []string {
 	c.mu.RLock()
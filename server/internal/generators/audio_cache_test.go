@@ -0,0 +1,106 @@
+package generators
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// putClip stores size bytes of audio under key
+func putClip(t *testing.T, cache *AudioCache, key string, size int) {
+	t.Helper()
+	if err := cache.Put(context.Background(), key, make([]byte, size), "text", "narrator", NewTTSOptions(), "wav", 1.0, 24000); err != nil {
+		t.Fatalf("put %s: %v", key, err)
+	}
+}
+
+func TestAudioCacheSizeBound(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewAudioCache(dir, 0, 0)
+	cache.SetMaxSize(10_000)
+
+	for i := 0; i < 40; i++ {
+		key := fmt.Sprintf("clip%d", i)
+		putClip(t, cache, key, 1500)
+		if size := cache.GetStats().TotalSize; size > 10_000 {
+			t.Fatalf("after %d puts total size %d exceeds the 10000 byte cap", i+1, size)
+		}
+		if !cache.Check(key) {
+			t.Fatalf("just written %s was evicted", key)
+		}
+	}
+
+	stats := cache.GetStats()
+	if onDisk := diskBytes(t, dir, ".wav"); onDisk != stats.TotalSize {
+		t.Fatalf("stats report %d bytes but %d are on disk", stats.TotalSize, onDisk)
+	}
+	if stats.TotalEntries != 6 {
+		t.Fatalf("total entries = %d, want 6", stats.TotalEntries)
+	}
+}
+
+func TestAudioCacheExpiredGetReleasesSize(t *testing.T) {
+	ctx := context.Background()
+	cache := NewAudioCache(t.TempDir(), 0, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("old%d", i)
+		putClip(t, cache, key, 1000)
+		cache.entries[key].CreatedAt = time.Now().Add(-2 * time.Hour)
+		if _, err := cache.Get(ctx, key); err == nil {
+			t.Fatalf("expected %s to be expired", key)
+		}
+	}
+	if stats := cache.GetStats(); stats.TotalSize != 0 || stats.TotalEntries != 0 || stats.TotalDuration != 0 {
+		t.Fatalf("expired entries left size %d, %d entries and %vs behind", stats.TotalSize, stats.TotalEntries, stats.TotalDuration)
+	}
+
+	// Fresh entries under the cap must not be evicted for bytes that are already gone
+	cache.SetMaxSize(2500)
+	putClip(t, cache, "n0", 1000)
+	putClip(t, cache, "n1", 1000)
+	for _, key := range []string{"n0", "n1"} {
+		if !cache.Check(key) {
+			t.Fatalf("%s was evicted although the cache is under its size cap", key)
+		}
+	}
+}
+
+func TestGenerateAudioCacheKey(t *testing.T) {
+	base := GenerateAudioCacheKey("夜雨敲窗", "narrator", NewTTSOptions())
+	if len(base) != 32 {
+		t.Fatalf("key %q is not an MD5 hex digest", base)
+	}
+	// Equal requests map to the same key, whatever reference clip the voice resolves to
+	same := NewTTSOptions()
+	same.ReferenceAudio = "/voices/narrator.wav"
+	if got := GenerateAudioCacheKey("夜雨敲窗", "narrator", same); got != base {
+		t.Errorf("equal request key %s, want %s", got, base)
+	}
+
+	variants := map[string]func() (string, string, *TTSOptions){
+		"text":  func() (string, string, *TTSOptions) { return "夜雨敲门", "narrator", NewTTSOptions() },
+		"voice": func() (string, string, *TTSOptions) { return "夜雨敲窗", "elder", NewTTSOptions() },
+		"language": func() (string, string, *TTSOptions) {
+			opts := NewTTSOptions()
+			opts.Language = "en"
+			return "夜雨敲窗", "narrator", opts
+		},
+		"format": func() (string, string, *TTSOptions) {
+			opts := NewTTSOptions()
+			opts.Format = "mp3"
+			return "夜雨敲窗", "narrator", opts
+		},
+		"speed": func() (string, string, *TTSOptions) {
+			opts := NewTTSOptions()
+			opts.Speed = 0.9
+			return "夜雨敲窗", "narrator", opts
+		},
+	}
+	for name, variant := range variants {
+		if got := GenerateAudioCacheKey(variant()); got == base {
+			t.Errorf("changing the %s kept key %s", name, got)
+		}
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 const (
@@ -19,12 +24,56 @@ const (
 	defaultTimeout  = 300 * time.Second
 	pollInterval   = 1 * time.Second
 	maxPollAttempts = 300 // 5 minutes max wait time
+	cancelTimeout   = 5 * time.Second
+
+	// queuePrompt retries transient failures, e.g. while ComfyUI is still starting
+	maxRetries = 3
+	retryDelay = 1 * time.Second
+
+	// First node ID used for chained LoraLoader nodes
+	loraNodeBaseID      = 10
+	defaultLoraStrength = 0.8
 )
 
 // ComfyUIClient connects to local ComfyUI instance
 type ComfyUIClient struct {
-	httpClient *http.Client
-	baseURL    string
+	httpClient            *http.Client
+	baseURL               string
+	defaultNegativePrompt string
+	useWebSocket          bool
+}
+
+// GenerationProgress reports sampler progress for a prompt
+type GenerationProgress struct {
+	PromptID string `json:"prompt_id"`
+	Node     string `json:"node,omitempty"`
+	Value    int    `json:"value"`
+	Max      int    `json:"max"`
+}
+
+// ComfyUIOption configures a ComfyUIClient
+type ComfyUIOption func(*ComfyUIClient)
+
+// WithDefaultNegativePrompt sets a negative prompt merged into every generation request
+func WithDefaultNegativePrompt(prompt string) ComfyUIOption {
+	return func(c *ComfyUIClient) {
+		c.defaultNegativePrompt = prompt
+	}
+}
+
+// WithBaseURL points the client at a ComfyUI instance other than the default
+func WithBaseURL(baseURL string) ComfyUIOption {
+	return func(c *ComfyUIClient) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithWebSocketProgress waits on ComfyUI's /ws event stream instead of polling /history,
+// falling back to polling when the socket can't connect
+func WithWebSocketProgress() ComfyUIOption {
+	return func(c *ComfyUIClient) {
+		c.useWebSocket = true
+	}
 }
 
 // Workflow represents a ComfyUI workflow - use integer node IDs
@@ -69,17 +118,23 @@ type QueueItem struct {
 	Additional  map[string]interface{} `json:"additional_info"`
 }
 
-// HistoryResponse represents generation history
-type HistoryResponse struct {
-	Queue map[string]HistoryItem `json:"queue_running"`
-}
+// HistoryResponse represents generation history, keyed by prompt ID
+type HistoryResponse map[string]HistoryItem
 
 // HistoryItem represents a history item
 type HistoryItem struct {
-	Prompt  []map[string]interface{} `json:"prompt"`
+	Prompt  []interface{} `json:"prompt"` // [number, prompt_id, workflow, extra_data, outputs]
 	Outputs map[string]struct {
 		Images []ImageInfo `json:"images"`
 	} `json:"outputs"`
+	Status HistoryStatus `json:"status"`
+}
+
+// HistoryStatus reports how a prompt finished
+type HistoryStatus struct {
+	StatusStr string          `json:"status_str"` // "success" or "error"
+	Completed bool            `json:"completed"`
+	Messages  [][]interface{} `json:"messages"`
 }
 
 // ImageInfo represents an image in history
@@ -99,14 +154,36 @@ type GenerateOptions struct {
 	CFGScale      float64
 	Seed          int
 	Model         string
-	Lora          string // LoRA model to use
+	Lora          string // LoRA model to use (kept for backward compatibility, applied before Loras)
 	LoraStrength  float64
+	Loras         []LoraSpec // Additional LoRA models, chained in order
 	SamplerName   string
 	Scheduler     string
 }
 
+// LoraSpec describes a single LoRA model applied to the workflow
+type LoraSpec struct {
+	Name     string  `json:"name"`
+	Strength float64 `json:"strength"`
+}
+
+// AllLoras returns the effective LoRA stack, with the single Lora field first
+func (o *GenerateOptions) AllLoras() []LoraSpec {
+	loras := make([]LoraSpec, 0, len(o.Loras)+1)
+	if o.Lora != "" {
+		loras = append(loras, LoraSpec{Name: o.Lora, Strength: o.LoraStrength})
+	}
+	for _, lora := range o.Loras {
+		if lora.Name != "" {
+			loras = append(loras, lora)
+		}
+	}
+	return loras
+}
+
 // GenerateResult represents result of image generation
 type GenerateResult struct {
+	PromptID   string // ComfyUI prompt ID, usable with Cancel
 	ImageID    string
 	ImageData  []byte
 	ImageBase64 string
@@ -117,17 +194,27 @@ type GenerateResult struct {
 }
 
 // NewComfyUIClient creates a new ComfyUI client
-func NewComfyUIClient() *ComfyUIClient {
-	return &ComfyUIClient{
+func NewComfyUIClient(opts ...ComfyUIOption) *ComfyUIClient {
+	c := &ComfyUIClient{
 		httpClient: &http.Client{
 			Timeout: defaultTimeout,
 		},
 		baseURL: comfyBaseURL,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // GenerateImage generates an image using ComfyUI
 func (c *ComfyUIClient) GenerateImage(ctx context.Context, opts *GenerateOptions) (*GenerateResult, error) {
+	return c.GenerateImageWithProgress(ctx, opts, nil)
+}
+
+// GenerateImageWithProgress generates an image, sending sampler progress to the channel when
+// websocket progress is enabled. Sends never block; a nil channel disables reporting.
+func (c *ComfyUIClient) GenerateImageWithProgress(ctx context.Context, opts *GenerateOptions, progress chan<- GenerationProgress) (*GenerateResult, error) {
 	// Build workflow from options
 	workflow := c.buildSDXLWorkflow(opts)
 
@@ -137,19 +224,42 @@ func (c *ComfyUIClient) GenerateImage(ctx context.Context, opts *GenerateOptions
 		ClientID: generateClientID(),
 	}
 
+	// Subscribe before queuing so no events are missed
+	var conn *websocket.Conn
+	if c.useWebSocket {
+		var err error
+		conn, err = c.dialEvents(ctx, req.ClientID)
+		if err != nil {
+			log.Printf("ComfyUI: websocket unavailable, falling back to polling: %v", err)
+		} else {
+			defer conn.Close()
+		}
+	}
+
 	// Send prompt to queue
+	startTime := time.Now()
 	promptID, err := c.queuePrompt(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to queue prompt: %w", err)
 	}
 
-	// Poll for completion
-	result, err := c.pollForResult(ctx, promptID)
+	var result *GenerateResult
+	if conn != nil {
+		result, err = c.waitForExecution(ctx, conn, promptID, progress)
+		if err == errEventStreamClosed {
+			log.Printf("ComfyUI: websocket closed early, falling back to polling")
+			result, err = c.pollForResult(ctx, promptID)
+		}
+	} else {
+		// Poll for completion
+		result, err = c.pollForResult(ctx, promptID)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get result: %w", err)
 	}
 
-	result.Duration = time.Since(time.Now())
+	result.PromptID = promptID
+	result.Duration = time.Since(startTime)
 
 	return result, nil
 }
@@ -190,9 +300,17 @@ func (c *ComfyUIClient) GetQueueStatus(ctx context.Context) (*QueueResponse, err
 }
 
 // GetHistory returns generation history
-func (c *ComfyUIClient) GetHistory(ctx context.Context) (*HistoryResponse, error) {
-	url := fmt.Sprintf("%s/history", c.baseURL)
+func (c *ComfyUIClient) GetHistory(ctx context.Context) (HistoryResponse, error) {
+	return c.getHistory(ctx, fmt.Sprintf("%s/history", c.baseURL))
+}
+
+// GetPromptHistory returns the history for a single prompt; the map is empty until it finishes
+func (c *ComfyUIClient) GetPromptHistory(ctx context.Context, promptID string) (HistoryResponse, error) {
+	return c.getHistory(ctx, fmt.Sprintf("%s/history/%s", c.baseURL, promptID))
+}
 
+// getHistory fetches and decodes a /history response
+func (c *ComfyUIClient) getHistory(ctx context.Context, url string) (HistoryResponse, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -204,12 +322,16 @@ func (c *ComfyUIClient) GetHistory(ctx context.Context) (*HistoryResponse, error
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ComfyUI returned status %d", resp.StatusCode)
+	}
+
 	var historyResp HistoryResponse
 	if err := json.NewDecoder(resp.Body).Decode(&historyResp); err != nil {
 		return nil, err
 	}
 
-	return &historyResp, nil
+	return historyResp, nil
 }
 
 // GetImage retrieves an image by filename
@@ -243,15 +365,65 @@ func (c *ComfyUIClient) GetImageBase64(ctx context.Context, filename, subfolder
 	return base64.StdEncoding.EncodeToString(data), nil
 }
 
-// queuePrompt sends a prompt to the queue
-func (c *ComfyUIClient) queuePrompt(ctx context.Context, req *PromptRequest) (string, error) {
-	url := fmt.Sprintf("%s/prompt", c.baseURL)
+// comfyStatusError is a non-200 response from ComfyUI
+type comfyStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *comfyStatusError) Error() string {
+	return fmt.Sprintf("ComfyUI returned status %d: %s", e.StatusCode, e.Body)
+}
 
+// queuePrompt sends a prompt to the queue, retrying connection failures and 5xx responses
+func (c *ComfyUIClient) queuePrompt(ctx context.Context, req *PromptRequest) (string, error) {
 	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return "", err
 	}
 
+	var lastErr error
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(retryDelay * time.Duration(attempt)):
+			}
+		}
+
+		promptID, err := c.doQueuePrompt(ctx, reqBody)
+		if err == nil {
+			return promptID, nil
+		}
+
+		lastErr = err
+		if !isRetryableQueueError(ctx, err) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("failed after %d retries: %w", maxRetries, lastErr)
+}
+
+// isRetryableQueueError treats transport errors and 5xx as transient; 4xx means a bad workflow
+func isRetryableQueueError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *comfyStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// doQueuePrompt performs a single /prompt request
+func (c *ComfyUIClient) doQueuePrompt(ctx context.Context, reqBody []byte) (string, error) {
+	url := fmt.Sprintf("%s/prompt", c.baseURL)
+
 	log.Printf("ComfyUI queuePrompt: Sending request to %s", url)
 	log.Printf("ComfyUI queuePrompt: Request body: %s", string(reqBody))
 
@@ -272,57 +444,259 @@ func (c *ComfyUIClient) queuePrompt(ctx context.Context, req *PromptRequest) (st
 	bodyBytes, _ := io.ReadAll(resp.Body)
 	log.Printf("ComfyUI queuePrompt: Response status=%d, body=%s", resp.StatusCode, string(bodyBytes))
 
+	if resp.StatusCode != http.StatusOK {
+		return "", &comfyStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
 	var result map[string]interface{}
 	if err := json.Unmarshal(bodyBytes, &result); err != nil {
 		return "", err
 	}
 
-	promptID, ok := result["prompt_id"].(float64)
-	if !ok {
+	// ComfyUI returns a UUID string; very old builds returned a number
+	var promptID string
+	switch id := result["prompt_id"].(type) {
+	case string:
+		promptID = id
+	case float64:
+		promptID = fmt.Sprintf("%.0f", id)
+	default:
 		log.Printf("ComfyUI queuePrompt: Response missing prompt_id, full response: %+v", result)
 		return "", fmt.Errorf("invalid response: missing prompt_id")
 	}
 
-	log.Printf("ComfyUI queuePrompt: Got prompt_id=%.0f", promptID)
-	return fmt.Sprintf("%.0f", promptID), nil
+	log.Printf("ComfyUI queuePrompt: Got prompt_id=%s", promptID)
+	return promptID, nil
+}
+
+// Cancel removes a prompt from ComfyUI's pending queue, or interrupts it if it is already running
+func (c *ComfyUIClient) Cancel(ctx context.Context, promptID string) error {
+	// Drop it from the pending queue (a no-op if it is already running)
+	if err := c.postJSON(ctx, "/queue", map[string]interface{}{"delete": []string{promptID}}); err != nil {
+		return fmt.Errorf("failed to delete queued prompt: %w", err)
+	}
+
+	running, err := c.isRunning(ctx, promptID)
+	if err != nil {
+		return fmt.Errorf("failed to check running prompt: %w", err)
+	}
+	if !running {
+		return nil
+	}
+
+	// /interrupt stops whatever is executing, so only call it for our own prompt
+	if err := c.postJSON(ctx, "/interrupt", map[string]interface{}{"prompt_id": promptID}); err != nil {
+		return fmt.Errorf("failed to interrupt prompt: %w", err)
+	}
+	return nil
+}
+
+// isRunning reports whether a prompt is currently executing
+func (c *ComfyUIClient) isRunning(ctx context.Context, promptID string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/queue", nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	// Queue entries are arrays: [number, prompt_id, prompt, extra_data, outputs]
+	var queue struct {
+		Running [][]interface{} `json:"queue_running"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+		return false, err
+	}
+
+	for _, item := range queue.Running {
+		if len(item) > 1 && fmt.Sprintf("%v", item[1]) == promptID {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
-// pollForResult polls for generation result
+// postJSON posts a JSON body to a ComfyUI endpoint and checks the status
+func (c *ComfyUIClient) postJSON(ctx context.Context, path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ComfyUI returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// cancelAbandoned frees the GPU after the caller gave up on a prompt
+func (c *ComfyUIClient) cancelAbandoned(promptID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+
+	if err := c.Cancel(ctx, promptID); err != nil {
+		log.Printf("ComfyUI: failed to cancel abandoned prompt %s: %v", promptID, err)
+	}
+}
+
+// errEventStreamClosed means the websocket dropped before the prompt finished
+var errEventStreamClosed = fmt.Errorf("event stream closed")
+
+// comfyEvent is a JSON message from ComfyUI's /ws stream
+type comfyEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		PromptID string  `json:"prompt_id"`
+		Node     *string `json:"node"`
+		Value    int     `json:"value"`
+		Max      int     `json:"max"`
+		Output   struct {
+			Images []ImageInfo `json:"images"`
+		} `json:"output"`
+		ExceptionMessage string `json:"exception_message"`
+	} `json:"data"`
+}
+
+// dialEvents connects to ComfyUI's event websocket for a client ID
+func (c *ComfyUIClient) dialEvents(ctx context.Context, clientID string) (*websocket.Conn, error) {
+	wsURL := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/ws?clientId=" + clientID
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// waitForExecution reads the event stream until our prompt outputs an image, fails or finishes
+func (c *ComfyUIClient) waitForExecution(ctx context.Context, conn *websocket.Conn, promptID string, progress chan<- GenerationProgress) (*GenerateResult, error) {
+	// Unblock ReadMessage when ctx ends
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(defaultTimeout))
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				c.cancelAbandoned(promptID)
+				return nil, ctx.Err()
+			}
+			return nil, errEventStreamClosed
+		}
+		if msgType != websocket.TextMessage {
+			// Binary frames are latent previews
+			continue
+		}
+
+		var event comfyEvent
+		if err := json.Unmarshal(data, &event); err != nil || event.Data.PromptID != promptID {
+			continue
+		}
+
+		switch event.Type {
+		case "progress":
+			if progress != nil {
+				update := GenerationProgress{PromptID: promptID, Value: event.Data.Value, Max: event.Data.Max}
+				if event.Data.Node != nil {
+					update.Node = *event.Data.Node
+				}
+				select {
+				case progress <- update:
+				default:
+				}
+			}
+		case "executed":
+			if len(event.Data.Output.Images) == 0 {
+				continue
+			}
+			img := event.Data.Output.Images[0]
+			imageData, err := c.GetImage(ctx, img.Filename, img.Subfolder)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get image: %w", err)
+			}
+			return &GenerateResult{
+				ImageID:   promptID,
+				ImageData: imageData,
+				Filename:  img.Filename,
+			}, nil
+		case "execution_error":
+			return nil, fmt.Errorf("prompt %s failed in ComfyUI: %s", promptID, event.Data.ExceptionMessage)
+		case "executing":
+			// A null node means the prompt finished without an executed event,
+			// e.g. when every node was cached; read the outputs from history
+			if event.Data.Node == nil {
+				return c.pollForResult(ctx, promptID)
+			}
+		}
+	}
+}
+
+// pollForResult polls for generation result, cancelling the prompt if ctx ends first
 func (c *ComfyUIClient) pollForResult(ctx context.Context, promptID string) (*GenerateResult, error) {
 	for attempt := 0; attempt < maxPollAttempts; attempt++ {
 		select {
 		case <-ctx.Done():
+			c.cancelAbandoned(promptID)
 			return nil, ctx.Err()
 		case <-time.After(pollInterval):
 			// Check history for our prompt
-			history, err := c.GetHistory(ctx)
+			history, err := c.GetPromptHistory(ctx, promptID)
 			if err != nil {
 				continue
 			}
 
-			// Search for our prompt in history
-			for key, item := range history.Queue {
-				if key == promptID || len(item.Prompt) == 0 {
-					// Found our result
-					if len(item.Outputs) > 0 {
-						for _, output := range item.Outputs {
-							if len(output.Images) > 0 {
-								img := output.Images[0]
-								imageData, err := c.GetImage(ctx, img.Filename, img.Subfolder)
-								if err != nil {
-									return nil, fmt.Errorf("failed to get image: %w", err)
-								}
-
-								return &GenerateResult{
-									ImageID:     promptID,
-									ImageData:   imageData,
-									ImageBase64: "",
-									Filename:    img.Filename,
-								}, nil
-							}
-						}
-					}
+			item, ok := history[promptID]
+			if !ok {
+				// Still queued or running
+				continue
+			}
+			if item.Status.StatusStr == "error" {
+				return nil, fmt.Errorf("prompt %s failed in ComfyUI", promptID)
+			}
+
+			for _, output := range item.Outputs {
+				if len(output.Images) == 0 {
+					continue
+				}
+				img := output.Images[0]
+				imageData, err := c.GetImage(ctx, img.Filename, img.Subfolder)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get image: %w", err)
 				}
+
+				return &GenerateResult{
+					ImageID:     promptID,
+					ImageData:   imageData,
+					ImageBase64: "",
+					Filename:    img.Filename,
+				}, nil
+			}
+
+			if item.Status.Completed {
+				return nil, fmt.Errorf("prompt %s completed without images", promptID)
 			}
 		}
 	}
@@ -359,17 +733,40 @@ func (c *ComfyUIClient) buildSDXLWorkflow(opts *GenerateOptions) *Workflow {
 		},
 	}
 
+	// Nodes 10+: LoraLoader chain - each node takes MODEL/CLIP from the previous one
+	modelSource := []interface{}{4, 0} // MODEL from CheckpointLoaderSimple (node 4, slot 0)
+	clipSource := []interface{}{4, 1}  // CLIP from CheckpointLoaderSimple (node 4, slot 1)
+	for i, lora := range opts.AllLoras() {
+		strength := lora.Strength
+		if strength <= 0 {
+			strength = defaultLoraStrength
+		}
+		nodeID := loraNodeBaseID + i
+		workflow[nodeID] = &WorkflowNode{
+			ClassType: "LoraLoader",
+			Inputs: map[string]interface{}{
+				"lora_name":      lora.Name,
+				"strength_model": strength,
+				"strength_clip":  strength,
+				"model":          modelSource,
+				"clip":           clipSource,
+			},
+		}
+		modelSource = []interface{}{nodeID, 0} // MODEL from LoraLoader (slot 0)
+		clipSource = []interface{}{nodeID, 1}  // CLIP from LoraLoader (slot 1)
+	}
+
 	// Node 6: CLIPTextEncode - positive prompt
 	workflow[6] = &WorkflowNode{
 		ClassType: "CLIPTextEncode",
 		Inputs: map[string]interface{}{
 			"text": opts.Prompt,
-			"clip": []interface{}{4, 1}, // CLIP from CheckpointLoaderSimple (node 4, slot 1)
+			"clip": clipSource, // CLIP from the last LoRA (or the checkpoint)
 		},
 	}
 
 	// Node 7: CLIPTextEncode - negative prompt
-	negativePrompt := opts.NegativePrompt
+	negativePrompt := MergeNegativePrompts(c.defaultNegativePrompt, opts.NegativePrompt)
 	if negativePrompt == "" {
 		negativePrompt = "text, watermark"
 	}
@@ -377,7 +774,7 @@ func (c *ComfyUIClient) buildSDXLWorkflow(opts *GenerateOptions) *Workflow {
 		ClassType: "CLIPTextEncode",
 		Inputs: map[string]interface{}{
 			"text": negativePrompt,
-			"clip": []interface{}{4, 1}, // CLIP from CheckpointLoaderSimple (node 4, slot 1)
+			"clip": clipSource, // CLIP from the last LoRA (or the checkpoint)
 		},
 	}
 
@@ -401,7 +798,7 @@ func (c *ComfyUIClient) buildSDXLWorkflow(opts *GenerateOptions) *Workflow {
 			"sampler_name": opts.SamplerName,
 			"scheduler":    opts.Scheduler,
 			"denoise":      1,
-			"model":        []interface{}{4, 0}, // MODEL from CheckpointLoaderSimple (node 4, slot 0)
+			"model":        modelSource,         // MODEL from the last LoRA (or the checkpoint)
 			"positive":     []interface{}{6, 0}, // positive from CLIPTextEncode (node 6, slot 0)
 			"negative":     []interface{}{7, 0}, // negative from CLIPTextEncode (node 7, slot 0)
 			"latent_image": []interface{}{5, 0}, // latent from EmptyLatentImage (node 5, slot 0)
@@ -451,6 +848,27 @@ func (c *ComfyUIClient) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// MergeNegativePrompts joins comma-separated negative prompts, dropping duplicate tokens
+func MergeNegativePrompts(prompts ...string) string {
+	seen := make(map[string]bool)
+	tokens := make([]string, 0)
+	for _, prompt := range prompts {
+		for _, token := range strings.Split(prompt, ",") {
+			token = strings.TrimSpace(token)
+			if token == "" {
+				continue
+			}
+			key := strings.ToLower(token)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return strings.Join(tokens, ", ")
+}
+
 // Helper functions
 func generateClientID() string {
 	return fmt.Sprintf("cyber_jianghu_%d", time.Now().UnixNano())
@@ -0,0 +1,308 @@
+package generators
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// nodeInput returns a workflow node's input, failing if the node is missing
+func nodeInput(t *testing.T, workflow Workflow, id int, input string) interface{} {
+	t.Helper()
+	node, ok := workflow[id]
+	if !ok {
+		t.Fatalf("workflow has no node %d", id)
+	}
+	return node.Inputs[input]
+}
+
+func TestBuildSDXLWorkflowChainsLoras(t *testing.T) {
+	c := NewComfyUIClient()
+	workflow := *c.buildSDXLWorkflow(&GenerateOptions{
+		Prompt: "竹林剑客",
+		Model:  "sdxl.safetensors",
+		Lora:   "wuxia_style.safetensors",
+		Loras:  []LoraSpec{{Name: "hero.safetensors", Strength: 0.6}},
+	})
+
+	first, second := loraNodeBaseID, loraNodeBaseID+1
+	if workflow[first].ClassType != "LoraLoader" || workflow[second].ClassType != "LoraLoader" {
+		t.Fatalf("nodes %d and %d should be LoraLoaders", first, second)
+	}
+	if _, ok := workflow[loraNodeBaseID+2]; ok {
+		t.Fatalf("unexpected node %d for a two-LoRA stack", loraNodeBaseID+2)
+	}
+
+	tests := []struct {
+		node  int
+		input string
+		want  interface{}
+	}{
+		// The legacy single LoRA comes first, at the default strength, fed by the checkpoint
+		{first, "lora_name", "wuxia_style.safetensors"},
+		{first, "strength_model", defaultLoraStrength},
+		{first, "model", []interface{}{4, 0}},
+		{first, "clip", []interface{}{4, 1}},
+		// The second LoRA takes MODEL and CLIP from the first
+		{second, "lora_name", "hero.safetensors"},
+		{second, "strength_clip", 0.6},
+		{second, "model", []interface{}{first, 0}},
+		{second, "clip", []interface{}{first, 1}},
+		// Text encoders and the sampler read from the end of the chain
+		{6, "clip", []interface{}{second, 1}},
+		{7, "clip", []interface{}{second, 1}},
+		{3, "model", []interface{}{second, 0}},
+	}
+	for _, tt := range tests {
+		if got := nodeInput(t, workflow, tt.node, tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("node %d %s = %v, want %v", tt.node, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBuildSDXLWorkflowWithoutLoras(t *testing.T) {
+	c := NewComfyUIClient()
+	workflow := *c.buildSDXLWorkflow(&GenerateOptions{Prompt: "客栈", Model: "sdxl.safetensors"})
+
+	if _, ok := workflow[loraNodeBaseID]; ok {
+		t.Fatal("LoraLoader node added without any LoRA")
+	}
+	if got := nodeInput(t, workflow, 3, "model"); !reflect.DeepEqual(got, []interface{}{4, 0}) {
+		t.Errorf("sampler model = %v, want the checkpoint", got)
+	}
+	if got := nodeInput(t, workflow, 6, "clip"); !reflect.DeepEqual(got, []interface{}{4, 1}) {
+		t.Errorf("positive clip = %v, want the checkpoint", got)
+	}
+}
+
+// capturedHistory is a /history/{prompt_id} reply from ComfyUI 0.3 for a finished prompt,
+// trimmed to one workflow node
+const capturedHistory = `{
+  "7c4bfa5e-3f2a-4b8e-9d51-0e6f2a1c9b7d": {
+    "prompt": [
+      12,
+      "7c4bfa5e-3f2a-4b8e-9d51-0e6f2a1c9b7d",
+      {"9": {"class_type": "SaveImage", "inputs": {"filename_prefix": "ComfyUI", "images": ["8", 0]}}},
+      {"client_id": "c1"},
+      ["9"]
+    ],
+    "outputs": {
+      "9": {"images": [{"filename": "ComfyUI_00042_.png", "subfolder": "", "type": "output"}]}
+    },
+    "status": {
+      "status_str": "success",
+      "completed": true,
+      "messages": [
+        ["execution_start", {"prompt_id": "7c4bfa5e-3f2a-4b8e-9d51-0e6f2a1c9b7d", "timestamp": 1717000000000}],
+        ["execution_success", {"prompt_id": "7c4bfa5e-3f2a-4b8e-9d51-0e6f2a1c9b7d", "timestamp": 1717000004200}]
+      ]
+    },
+    "meta": {"9": {"node_id": "9", "display_node": "9"}}
+  }
+}`
+
+const capturedPromptID = "7c4bfa5e-3f2a-4b8e-9d51-0e6f2a1c9b7d"
+
+// newHistoryServer serves history for capturedPromptID and the image it names
+func newHistoryServer(t *testing.T, history string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/history/" + capturedPromptID:
+			io.WriteString(w, history)
+		case "/view":
+			if r.URL.Query().Get("filename") != "ComfyUI_00042_.png" {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, "png-bytes")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDecodeCapturedHistory(t *testing.T) {
+	server := newHistoryServer(t, capturedHistory)
+	c := NewComfyUIClient(WithBaseURL(server.URL))
+
+	history, err := c.GetPromptHistory(context.Background(), capturedPromptID)
+	if err != nil {
+		t.Fatalf("GetPromptHistory: %v", err)
+	}
+	item, ok := history[capturedPromptID]
+	if !ok {
+		t.Fatalf("history has no entry for %s", capturedPromptID)
+	}
+	if item.Status.StatusStr != "success" || !item.Status.Completed || len(item.Status.Messages) != 2 {
+		t.Errorf("status = %+v", item.Status)
+	}
+	images := item.Outputs["9"].Images
+	if len(images) != 1 || images[0].Filename != "ComfyUI_00042_.png" || images[0].Type != "output" {
+		t.Errorf("node 9 images = %+v", images)
+	}
+	if len(item.Prompt) != 5 || item.Prompt[1] != capturedPromptID {
+		t.Errorf("prompt tuple = %v", item.Prompt)
+	}
+
+	result, err := c.pollForResult(context.Background(), capturedPromptID)
+	if err != nil {
+		t.Fatalf("pollForResult: %v", err)
+	}
+	if string(result.ImageData) != "png-bytes" || result.Filename != "ComfyUI_00042_.png" {
+		t.Errorf("result = %q from %s", result.ImageData, result.Filename)
+	}
+}
+
+func TestPollForResultFailsOnErroredPrompt(t *testing.T) {
+	errored := strings.Replace(capturedHistory, `"status_str": "success"`, `"status_str": "error"`, 1)
+	errored = strings.Replace(errored, `"images": [{"filename": "ComfyUI_00042_.png", "subfolder": "", "type": "output"}]`, `"images": []`, 1)
+	c := NewComfyUIClient(WithBaseURL(newHistoryServer(t, errored).URL))
+
+	if _, err := c.pollForResult(context.Background(), capturedPromptID); err == nil || !strings.Contains(err.Error(), "failed in ComfyUI") {
+		t.Fatalf("pollForResult = %v, want the prompt failure", err)
+	}
+}
+
+func TestQueuePromptReadsPromptID(t *testing.T) {
+	replies := map[string]string{
+		capturedPromptID: `{"prompt_id": "` + capturedPromptID + `", "number": 12, "node_errors": {}}`,
+		"12":             `{"prompt_id": 12, "number": 12}`, // Builds before UUID prompt IDs
+	}
+	for want, reply := range replies {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, reply)
+		}))
+		c := NewComfyUIClient(WithBaseURL(server.URL))
+		got, err := c.queuePrompt(context.Background(), &PromptRequest{Prompt: Workflow{}, ClientID: "c1"})
+		server.Close()
+		if err != nil || got != want {
+			t.Errorf("queuePrompt with %s = %q, %v; want %q", reply, got, err, want)
+		}
+	}
+}
+
+// flakyTransport fails its first round trips, as many as failures, with a connection
+// error and passes the rest to the default transport
+type flakyTransport struct {
+	failures int32
+	calls    atomic.Int32
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.calls.Add(1) <= f.failures {
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// flakyPromptServer answers /prompt with the given statuses in turn, then with a prompt ID,
+// and counts the requests it received
+func flakyPromptServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			http.Error(w, "node_errors: checkpoint not found", statuses[n-1])
+			return
+		}
+		io.WriteString(w, `{"prompt_id": "p-1", "number": 1}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestQueuePromptRetries(t *testing.T) {
+	req := &PromptRequest{Prompt: Workflow{}, ClientID: "c1"}
+
+	t.Run("server error", func(t *testing.T) {
+		t.Parallel()
+		server, calls := flakyPromptServer(t, http.StatusBadGateway)
+		c := NewComfyUIClient(WithBaseURL(server.URL))
+		if id, err := c.queuePrompt(context.Background(), req); err != nil || id != "p-1" {
+			t.Fatalf("queuePrompt = %q, %v; want p-1 after a retry", id, err)
+		}
+		if n := calls.Load(); n != 2 {
+			t.Errorf("%d requests, want 2", n)
+		}
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		t.Parallel()
+		server, calls := flakyPromptServer(t)
+		transport := &flakyTransport{failures: 1}
+		c := NewComfyUIClient(WithBaseURL(server.URL))
+		c.httpClient.Transport = transport
+		if id, err := c.queuePrompt(context.Background(), req); err != nil || id != "p-1" {
+			t.Fatalf("queuePrompt = %q, %v; want p-1 after a retry", id, err)
+		}
+		if n := transport.calls.Load(); n != 2 || calls.Load() != 1 {
+			t.Errorf("%d attempts reaching the server %d times, want 2 and 1", n, calls.Load())
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		t.Parallel()
+		server, calls := flakyPromptServer(t, http.StatusBadRequest)
+		c := NewComfyUIClient(WithBaseURL(server.URL))
+		_, err := c.queuePrompt(context.Background(), req)
+		var statusErr *comfyStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || !strings.Contains(statusErr.Body, "checkpoint not found") {
+			t.Fatalf("queuePrompt = %v, want the 400 with its body", err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("%d requests, want 1 with no retry", n)
+		}
+	})
+
+	t.Run("cancelled during backoff", func(t *testing.T) {
+		t.Parallel()
+		server, calls := flakyPromptServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+		c := NewComfyUIClient(WithBaseURL(server.URL))
+		ctx, cancel := context.WithTimeout(context.Background(), retryDelay/2)
+		defer cancel()
+		if _, err := c.queuePrompt(ctx, req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("queuePrompt = %v, want the context deadline", err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("%d requests, want 1 before the deadline", n)
+		}
+	})
+}
+
+func TestIsRetryableQueueError(t *testing.T) {
+	ctx := context.Background()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	transport := &url.Error{Op: "Post", URL: "http://localhost:8188/prompt", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"500", ctx, &comfyStatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"503", ctx, &comfyStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"400", ctx, &comfyStatusError{StatusCode: http.StatusBadRequest}, false},
+		{"404", ctx, &comfyStatusError{StatusCode: http.StatusNotFound}, false},
+		{"transport", ctx, transport, true},
+		{"decode", ctx, errors.New("invalid response: missing prompt_id"), false},
+		{"cancelled", cancelled, transport, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryableQueueError(tt.ctx, tt.err); got != tt.want {
+			t.Errorf("%s: retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -16,7 +16,6 @@ import (
 type CacheEntry struct {
 	Key           string                 `json:"key"`
 	FilePath      string                 `json:"file_path"`
-	ImageData     []byte                 `json:"-"`
 	Base64Data    string                 `json:"base64_data,omitempty"`
 	Prompt        string                 `json:"prompt"`
 	Options       *GenerateOptions        `json:"options"`
@@ -33,9 +32,12 @@ type ImageCache struct {
 	entries    map[string]*CacheEntry
 	directory  string
 	maxEntries int
+	maxSize    int64 // Total bytes on disk before the oldest entries are evicted; 0 is unlimited
 	ttl         time.Duration
 	mu          sync.RWMutex
 	stats       *CacheStats
+	negative    negativeCache // Recent failures, kept in memory only
+	memory      *memoryLRU    // Recently served payloads, bounded by bytes rather than entries
 }
 
 // CacheStats holds statistics about cache performance
@@ -45,6 +47,11 @@ type CacheStats struct {
 	HitRate     float64 `json:"hit_rate"`
 	TotalEntries int    `json:"total_entries"`
 	TotalSize    int64  `json:"total_size"`
+	MemoryHits      int64 `json:"memory_hits"`      // Hits served from the in-memory tier
+	DiskHits        int64 `json:"disk_hits"`        // Hits read back from disk
+	MemorySize      int64 `json:"memory_size"`      // Bytes held in the in-memory tier
+	NegativeHits    int64 `json:"negative_hits"`    // Gets answered by a cached failure
+	NegativeEntries int   `json:"negative_entries"` // Failures currently remembered
 }
 
 // NewImageCache creates a new image cache
@@ -55,6 +62,8 @@ func NewImageCache(directory string, maxEntries int, ttl time.Duration) *ImageCa
 		maxEntries: maxEntries,
 		ttl:         ttl,
 		stats:       &CacheStats{},
+		negative:    make(negativeCache),
+		memory:      newMemoryLRU(DefaultImageMemoryBudget),
 	}
 }
 
@@ -117,6 +126,9 @@ func (c *ImageCache) Initialize(ctx context.Context) error {
 		c.stats.TotalSize += cacheEntry.FileSize
 	}
 
+	// Enforce limits that may have shrunk since the files were written
+	c.evictLocked("")
+
 	return nil
 }
 
@@ -127,6 +139,10 @@ func (c *ImageCache) Get(ctx context.Context, key string) ([]byte, error) {
 
 	entry, ok := c.entries[key]
 	if !ok {
+		if err := c.negative.get(key); err != nil {
+			c.stats.NegativeHits++
+			return nil, err
+		}
 		c.stats.Misses++
 		c.updateHitRate()
 		return nil, fmt.Errorf("cache miss: %s", key)
@@ -134,12 +150,10 @@ func (c *ImageCache) Get(ctx context.Context, key string) ([]byte, error) {
 
 	// Check if expired
 	if c.ttl > 0 && time.Since(entry.CreatedAt) > c.ttl {
-		delete(c.entries, key)
+		// Drop the entry's size with it, or eviction would count bytes no longer on disk
+		c.removeLocked(key)
 		c.stats.Misses++
 		c.updateHitRate()
-		// Clean up files
-		_ = os.Remove(entry.FilePath)
-		_ = os.Remove(entry.FilePath + ".meta")
 		return nil, fmt.Errorf("cache entry expired")
 	}
 
@@ -148,21 +162,26 @@ func (c *ImageCache) Get(ctx context.Context, key string) ([]byte, error) {
 	entry.AccessCount++
 	entry.Hits++
 
-	c.stats.Hits++
-	c.updateHitRate()
-
-	// Return cached data
-	if len(entry.ImageData) > 0 {
-		data, err := os.ReadFile(entry.FilePath)
-		if err != nil {
-			c.stats.Misses++
-			c.updateHitRate()
-			return nil, fmt.Errorf("failed to read cached file: %w", err)
-		}
+	// Hot payloads skip the disk entirely
+	if data, ok := c.memory.get(key); ok {
+		c.stats.Hits++
+		c.stats.MemoryHits++
+		c.updateHitRate()
 		return data, nil
 	}
 
-	return entry.ImageData, nil
+	data, err := os.ReadFile(entry.FilePath)
+	if err != nil {
+		c.stats.Misses++
+		c.updateHitRate()
+		return nil, fmt.Errorf("failed to read cached file: %w", err)
+	}
+	c.stats.Hits++
+	c.stats.DiskHits++
+	c.updateHitRate()
+	c.memory.put(key, data)
+
+	return data, nil
 }
 
 // Put stores an image in cache
@@ -184,7 +203,6 @@ func (c *ImageCache) Put(ctx context.Context, key string, data []byte, prompt st
 	entry := &CacheEntry{
 		Key:          key,
 		FilePath:     filePath,
-		ImageData:    data,
 		Prompt:       prompt,
 		Options:      opts,
 		CreatedAt:    now,
@@ -200,8 +218,8 @@ func (c *ImageCache) Put(ctx context.Context, key string, data []byte, prompt st
 		entry.Metadata["width"] = opts.Width
 		entry.Metadata["height"] = opts.Height
 		entry.Metadata["model"] = opts.Model
-		if opts.Lora != "" {
-			entry.Metadata["lora"] = opts.Lora
+		if loras := opts.AllLoras(); len(loras) > 0 {
+			entry.Metadata["loras"] = loras
 		}
 	}
 
@@ -216,19 +234,52 @@ func (c *ImageCache) Put(ctx context.Context, key string, data []byte, prompt st
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
-	// Add to cache
+	// Add to cache, replacing any earlier entry for the key
+	if old, ok := c.entries[key]; ok {
+		c.stats.TotalEntries--
+		c.stats.TotalSize -= old.FileSize
+	}
 	c.entries[key] = entry
+	delete(c.negative, key)
+	c.memory.put(key, data)
 	c.stats.TotalEntries++
 	c.stats.TotalSize += int64(len(data))
 
-	// Check if we need to evict entries
-	if len(c.entries) > c.maxEntries {
-		c.evictOldest()
-	}
+	// Evict down to the entry and size limits, keeping what was just stored
+	c.evictLocked(key)
 
 	return nil
 }
 
+// PutNegative remembers that generating key failed with err, so Get returns
+// ErrCachedFailure for ttl instead of sending the request to the backend again.
+// A non-positive ttl uses DefaultNegativeTTL.
+func (c *ImageCache) PutNegative(key string, err error, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.negative.put(key, err, ttl)
+}
+
+// SetMemoryBudget sets how many bytes of recently served payloads are kept in memory in
+// front of the disk store; 0 disables the memory tier
+func (c *ImageCache) SetMemoryBudget(bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.memory.setBudget(bytes)
+}
+
+// SetMaxSize caps the total bytes the cache keeps on disk, evicting the least recently
+// used entries when a Put goes over; 0 removes the cap
+func (c *ImageCache) SetMaxSize(bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxSize = bytes
+	c.evictLocked("")
+}
+
 // Check checks if an entry exists in cache
 func (c *ImageCache) Check(key string) bool {
 	c.mu.RLock()
@@ -252,9 +303,18 @@ func (c *ImageCache) Invalidate(key string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.removeLocked(key)
+	return nil
+}
+
+// removeLocked deletes an entry and its files; callers must hold mu
+func (c *ImageCache) removeLocked(key string) {
+	delete(c.negative, key)
+	c.memory.remove(key)
+
 	entry, ok := c.entries[key]
 	if !ok {
-		return nil
+		return
 	}
 
 	// Delete files
@@ -267,8 +327,6 @@ func (c *ImageCache) Invalidate(key string) error {
 	delete(c.entries, key)
 	c.stats.TotalEntries--
 	c.stats.TotalSize -= entry.FileSize
-
-	return nil
 }
 
 // Clear removes all entries from cache
@@ -291,6 +349,9 @@ func (c *ImageCache) Clear(ctx context.Context) error {
 	c.stats.Hits = 0
 	c.stats.Misses = 0
 	c.stats.HitRate = 0
+	c.negative = make(negativeCache)
+	c.memory.clear()
+	c.stats.NegativeHits = 0
 
 	return nil
 }
@@ -301,25 +362,49 @@ func (c *ImageCache) GetStats() *CacheStats {
 	defer c.mu.RUnlock()
 
 	statsCopy := *c.stats
+	statsCopy.NegativeEntries = len(c.negative)
+	statsCopy.MemorySize = c.memory.size
 	return &statsCopy
 }
 
-// evictOldest removes the oldest entries to make room
-func (c *ImageCache) evictOldest() {
+// evictLocked removes least recently used entries until the cache is within both
+// maxEntries and maxSize, never evicting keep; callers must hold mu
+func (c *ImageCache) evictLocked(keep string) {
+	for c.overLimitLocked() {
+		if !c.evictOldest(keep) {
+			return
+		}
+	}
+}
+
+// overLimitLocked reports whether the cache holds too many entries or bytes
+func (c *ImageCache) overLimitLocked() bool {
+	return (c.maxEntries > 0 && len(c.entries) > c.maxEntries) ||
+		(c.maxSize > 0 && c.stats.TotalSize > c.maxSize)
+}
+
+// evictOldest removes the least recently accessed entry other than keep, reporting
+// whether there was one to remove
+func (c *ImageCache) evictOldest(keep string) bool {
 	// Find oldest entry
 	var oldestKey string
 	var oldestTime time.Time
 
 	for key, entry := range c.entries {
-		if oldestTime.IsZero() || entry.LastAccessed.Before(oldestTime) {
+		if key == keep {
+			continue
+		}
+		if oldestKey == "" || entry.LastAccessed.Before(oldestTime) {
 			oldestKey = key
 			oldestTime = entry.LastAccessed
 		}
 	}
 
-	if oldestKey != "" {
-		_ = c.Invalidate(oldestKey)
+	if oldestKey == "" {
+		return false
 	}
+	c.removeLocked(oldestKey)
+	return true
 }
 
 // updateHitRate recalculates the hit rate
@@ -333,15 +418,16 @@ func (c *ImageCache) updateHitRate() {
 // GenerateCacheKey generates a cache key from prompt and options
 func GenerateCacheKey(prompt string, opts *GenerateOptions) string {
 	// Create a canonical representation of the request
-	data := fmt.Sprintf("%s|%dx%d|%d|%f|%s|%s|%s",
+	data := fmt.Sprintf("%s|%dx%d|%d|%f|%s",
 		prompt,
 		opts.Width, opts.Height,
 		opts.Steps,
 		opts.CFGScale,
 		opts.Model,
-		opts.Lora,
-		opts.LoraStrength,
 	)
+	for _, lora := range opts.AllLoras() {
+		data += fmt.Sprintf("|%s:%f", lora.Name, lora.Strength)
+	}
 
 	// Generate MD5 hash
 	hash := md5.Sum([]byte(data))
@@ -353,11 +439,11 @@ func (c *ImageCache) CleanExpired(ctx context.Context) int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	count := c.negative.cleanExpired()
 	if c.ttl == 0 {
-		return 0
+		return count
 	}
 
-	count := 0
 	now := time.Now()
 
 	for key, entry := range c.entries {
@@ -370,6 +456,7 @@ func (c *ImageCache) CleanExpired(ctx context.Context) int {
 
 			// Remove from cache
 			delete(c.entries, key)
+			c.memory.remove(key)
 			c.stats.TotalEntries--
 			c.stats.TotalSize -= entry.FileSize
 			count++
@@ -0,0 +1,89 @@
+package generators
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// diskBytes sums the size of the files in dir with the given extension, which leaves out
+// the .meta files written next to each entry
+func diskBytes(t *testing.T, dir, ext string) int64 {
+	t.Helper()
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read cache dir: %v", err)
+	}
+	var total int64
+	for _, file := range files {
+		if info, err := file.Info(); err == nil && filepath.Ext(file.Name()) == ext {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+func TestImageCacheSizeBound(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cache := NewImageCache(dir, 0, 0)
+	cache.SetMaxSize(10_000)
+
+	blob := make([]byte, 1500)
+	for i := 0; i < 40; i++ {
+		key := fmt.Sprintf("img%d", i)
+		if err := cache.Put(ctx, key, blob, "prompt", nil); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+		if size := cache.GetStats().TotalSize; size > 10_000 {
+			t.Fatalf("after %d puts total size %d exceeds the 10000 byte cap", i+1, size)
+		}
+		if !cache.Check(key) {
+			t.Fatalf("just written %s was evicted", key)
+		}
+	}
+
+	stats := cache.GetStats()
+	if onDisk := diskBytes(t, dir, ".png"); onDisk != stats.TotalSize {
+		t.Fatalf("stats report %d bytes but %d are on disk", stats.TotalSize, onDisk)
+	}
+	if stats.TotalEntries != 6 {
+		t.Fatalf("total entries = %d, want 6", stats.TotalEntries)
+	}
+}
+
+func TestImageCacheExpiredGetReleasesSize(t *testing.T) {
+	ctx := context.Background()
+	cache := NewImageCache(t.TempDir(), 0, time.Hour)
+
+	blob := make([]byte, 1000)
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("old%d", i)
+		if err := cache.Put(ctx, key, blob, "prompt", nil); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		cache.entries[key].CreatedAt = time.Now().Add(-2 * time.Hour)
+		if _, err := cache.Get(ctx, key); err == nil {
+			t.Fatalf("expected %s to be expired", key)
+		}
+	}
+	if stats := cache.GetStats(); stats.TotalSize != 0 || stats.TotalEntries != 0 {
+		t.Fatalf("expired entries left size %d and %d entries behind", stats.TotalSize, stats.TotalEntries)
+	}
+
+	// Fresh entries under the cap must not be evicted for bytes that are already gone
+	cache.SetMaxSize(2500)
+	for _, key := range []string{"n0", "n1"} {
+		if err := cache.Put(ctx, key, blob, "prompt", nil); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+	for _, key := range []string{"n0", "n1"} {
+		if !cache.Check(key) {
+			t.Fatalf("%s was evicted although the cache is under its size cap", key)
+		}
+	}
+}
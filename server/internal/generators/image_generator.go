@@ -0,0 +1,66 @@
+package generators
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+)
+
+// ImageGenerator renders an image from generation options. ComfyUIClient is the
+// production generator; StubImageGenerator returns a fixed image without a GPU.
+type ImageGenerator interface {
+	GenerateImage(ctx context.Context, opts *GenerateOptions) (*GenerateResult, error)
+}
+
+var (
+	_ ImageGenerator = (*ComfyUIClient)(nil)
+	_ ImageGenerator = (*StubImageGenerator)(nil)
+)
+
+// stubImageSize is the width and height of the stub PNG
+const stubImageSize = 8
+
+var (
+	stubImageOnce sync.Once
+	stubImagePNG  []byte
+)
+
+// StubImageGenerator returns the same small gray PNG for every request
+type StubImageGenerator struct{}
+
+// NewStubImageGenerator creates a stub image generator
+func NewStubImageGenerator() *StubImageGenerator {
+	return &StubImageGenerator{}
+}
+
+// GenerateImage returns the stub PNG; the options only need a prompt
+func (g *StubImageGenerator) GenerateImage(ctx context.Context, opts *GenerateOptions) (*GenerateResult, error) {
+	if opts == nil || opts.Prompt == "" {
+		return nil, fmt.Errorf("prompt is required")
+	}
+
+	stubImageOnce.Do(func() {
+		img := image.NewGray(image.Rect(0, 0, stubImageSize, stubImageSize))
+		for i := range img.Pix {
+			img.Pix[i] = color.Gray{Y: 0x80}.Y
+		}
+		var buf bytes.Buffer
+		_ = png.Encode(&buf, img) // Encoding an in-memory image can't fail
+		stubImagePNG = buf.Bytes()
+	})
+
+	data := append([]byte(nil), stubImagePNG...)
+	return &GenerateResult{
+		ImageID:     "stub",
+		ImageData:   data,
+		ImageBase64: base64.StdEncoding.EncodeToString(data),
+		Filename:    "stub.png",
+		Width:       stubImageSize,
+		Height:      stubImageSize,
+	}, nil
+}
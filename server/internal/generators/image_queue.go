@@ -1,19 +1,39 @@
 package generators
 
 import (
+	"container/heap"
 	"context"
-	"fmt"
+	"errors"
 	"sync"
 	"time"
 )
 
+// ErrQueueFull is returned when the queue cannot accept more requests
+var ErrQueueFull = errors.New("queue is full")
+
+// ErrQueueStopped is returned for requests made or still pending once the queue stops
+var ErrQueueStopped = errors.New("queue is stopped")
+
+const (
+	defaultQueueCapacity   = 100
+	defaultResultRetention = 10 * time.Minute
+	maxCleanupInterval     = 5 * time.Minute
+)
+
 // ImageQueue manages image generation requests with queuing
 type ImageQueue struct {
-	requests chan *QueueRequest
+	pending   requestHeap // Pending requests, highest priority first
+	capacity  int
+	seq       uint64     // Enqueue counter for FIFO order within a priority
+	stopped   bool
+	pendingMu sync.Mutex
+	cond      *sync.Cond // Signals workers when pending changes; uses pendingMu
 	results  map[string]*QueueResult
 	mu       sync.RWMutex
 	workerCount int
 	maxWorkers  int
+	retention   time.Duration // How long completed results are kept for GetResult
+	workers     sync.WaitGroup // Running workers, waited on by Shutdown
 }
 
 // QueueRequest represents a queued image generation request
@@ -23,6 +43,33 @@ type QueueRequest struct {
 	ResultCh  chan *QueueResult
 	CreatedAt time.Time
 	Priority  int // Higher = higher priority
+	seq       uint64
+	ctx       context.Context // Caller's context; generation is cancelled when it ends
+}
+
+// requestHeap orders requests by priority, then by enqueue order
+type requestHeap []*QueueRequest
+
+func (h requestHeap) Len() int { return len(h) }
+
+func (h requestHeap) Less(i, j int) bool {
+	if h[i].Priority != h[j].Priority {
+		return h[i].Priority > h[j].Priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h requestHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *requestHeap) Push(x interface{}) { *h = append(*h, x.(*QueueRequest)) }
+
+func (h *requestHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	req := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return req
 }
 
 // QueueResult represents the result of a queued request
@@ -31,105 +78,205 @@ type QueueResult struct {
 	ImageData []byte
 	Error      error
 	Duration   time.Duration
+	CompletedAt time.Time
 }
 
 // NewImageQueue creates a new image generation queue
 func NewImageQueue(maxWorkers int) *ImageQueue {
-	return &ImageQueue{
-		requests:   make(chan *QueueRequest, 100),
+	q := &ImageQueue{
+		capacity:   defaultQueueCapacity,
 		results:    make(map[string]*QueueResult),
 		workerCount: 0,
 		maxWorkers:  maxWorkers,
+		retention:   defaultResultRetention,
 	}
+	q.cond = sync.NewCond(&q.pendingMu)
+	return q
 }
 
-// Start starts the queue workers
-func (q *ImageQueue) Start(ctx context.Context, comfyClient *ComfyUIClient) {
+// SetRetention sets how long completed results are kept; call before Start
+func (q *ImageQueue) SetRetention(retention time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if retention > 0 {
+		q.retention = retention
+	}
+}
+
+// Start starts the queue workers, rendering with generator (usually a ComfyUIClient)
+func (q *ImageQueue) Start(ctx context.Context, generator ImageGenerator) {
 	// Start workers
 	for i := 0; i < q.maxWorkers; i++ {
-		go q.worker(ctx, comfyClient)
+		q.workers.Add(1)
+		go q.worker(ctx, generator)
 		q.workerCount++
 	}
 
 	// Start cleanup goroutine
 	go q.cleanup(ctx)
+
+	// Wake idle workers when the context ends
+	go func() {
+		<-ctx.Done()
+		q.Stop()
+	}()
 }
 
-// Stop stops the queue
+// Stop stops the queue; pending requests are dropped
 func (q *ImageQueue) Stop() {
-	close(q.requests)
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+	q.stopped = true
+	q.cond.Broadcast()
+}
+
+// Shutdown stops accepting requests and waits for the generations already running to
+// finish, or for ctx to end. Pending requests are answered with ErrQueueStopped; it
+// returns how many were dropped.
+func (q *ImageQueue) Shutdown(ctx context.Context) (int, error) {
+	q.pendingMu.Lock()
+	dropped := q.pending
+	q.pending = nil
+	q.stopped = true
+	q.cond.Broadcast()
+	q.pendingMu.Unlock()
+
+	for _, req := range dropped {
+		select {
+		case req.ResultCh <- &QueueResult{ID: req.ID, Error: ErrQueueStopped, CompletedAt: time.Now()}:
+		default:
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return len(dropped), nil
+	case <-ctx.Done():
+		return len(dropped), ctx.Err()
+	}
+}
+
+// next blocks until a request is pending and returns the highest-priority one,
+// or returns false once the queue is stopped
+func (q *ImageQueue) next() (*QueueRequest, bool) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	for len(q.pending) == 0 && !q.stopped {
+		q.cond.Wait()
+	}
+	if q.stopped {
+		return nil, false
+	}
+	return heap.Pop(&q.pending).(*QueueRequest), true
 }
 
 // worker processes queued requests
-func (q *ImageQueue) worker(ctx context.Context, comfyClient *ComfyUIClient) {
+func (q *ImageQueue) worker(ctx context.Context, generator ImageGenerator) {
+	defer q.workers.Done()
+
 	for {
+		req, ok := q.next()
+		if !ok {
+			return
+		}
+
+		// Generate under the caller's context so a disconnected client frees the GPU
+		genCtx := ctx
+		if req.ctx != nil {
+			genCtx = req.ctx
+		}
+
+		// Process request
+		startTime := time.Now()
+		imageData, err := generator.GenerateImage(genCtx, req.Options)
+		duration := time.Since(startTime)
+
+		result := &QueueResult{
+			ID:        req.ID,
+			Error:      err,
+			Duration:   duration,
+			CompletedAt: time.Now(),
+		}
+		if err == nil {
+			result.ImageData = imageData.ImageData
+		}
+
+		// Store result
+		q.mu.Lock()
+		q.results[req.ID] = result
+		q.mu.Unlock()
+
+		// Send to result channel
 		select {
+		case req.ResultCh <- result:
 		case <-ctx.Done():
-			return
-		case req, ok := <-q.requests:
-			if !ok {
-				return
-			}
-
-			// Process request
-			startTime := time.Now()
-			imageData, err := comfyClient.GenerateImage(ctx, req.Options)
-			duration := time.Since(startTime)
-
-			result := &QueueResult{
-				ID:        req.ID,
-				ImageData: imageData.ImageData,
-				Error:      err,
-				Duration:   duration,
-			}
-
-			// Store result
-			q.mu.Lock()
-			q.results[req.ID] = result
-			q.mu.Unlock()
-
-			// Send to result channel
-			select {
-			case req.ResultCh <- result:
-			case <-ctx.Done():
-			case <-time.After(5 * time.Second):
-				// Timeout sending result
-			}
+		case <-time.After(5 * time.Second):
+			// Timeout sending result
 		}
 	}
 }
 
 // cleanup removes old results from the queue
 func (q *ImageQueue) cleanup(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Minute)
+	q.mu.RLock()
+	interval := q.retention
+	q.mu.RUnlock()
+	if interval > maxCleanupInterval {
+		interval = maxCleanupInterval
+	}
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			q.mu.Lock()
-			now := time.Now()
-			for id, result := range q.results {
-				// Remove results older than 10 minutes
-				if result.Error == nil && now.Sub(time.Time{}) > 10*time.Minute {
-					delete(q.results, id)
-				}
-			}
-			q.mu.Unlock()
+		case now := <-ticker.C:
+			q.purgeExpired(now)
+		}
+	}
+}
+
+// purgeExpired removes results completed more than the retention period before now
+func (q *ImageQueue) purgeExpired(now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	purged := 0
+	for id, result := range q.results {
+		if now.Sub(result.CompletedAt) > q.retention {
+			delete(q.results, id)
+			purged++
 		}
 	}
+	return purged
 }
 
-// Enqueue adds a request to the queue
+// Enqueue adds a request to the queue, ahead of any lower-priority pending requests
 func (q *ImageQueue) Enqueue(req *QueueRequest) error {
-	select {
-	case q.requests <- req:
-		return nil
-	default:
-		return fmt.Errorf("queue is full")
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	if q.stopped {
+		return ErrQueueStopped
+	}
+	if len(q.pending) >= q.capacity {
+		return ErrQueueFull
 	}
+
+	q.seq++
+	req.seq = q.seq
+	heap.Push(&q.pending, req)
+	q.cond.Signal()
+	return nil
 }
 
 // GetResult retrieves a result by ID
@@ -143,7 +290,9 @@ func (q *ImageQueue) GetResult(id string) (*QueueResult, bool) {
 
 // GetQueueSize returns the current queue size
 func (q *ImageQueue) GetQueueSize() int {
-	return len(q.requests)
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+	return len(q.pending)
 }
 
 // GetWorkerCount returns the number of active workers
@@ -155,6 +304,7 @@ func (q *ImageQueue) GetWorkerCount() int {
 func (q *ImageQueue) EnqueueWithWait(ctx context.Context, req *QueueRequest) (*QueueResult, error) {
 	resultCh := make(chan *QueueResult, 1)
 	req.ResultCh = resultCh
+	req.ctx = ctx
 
 	if err := q.Enqueue(req); err != nil {
 		return nil, err
@@ -166,6 +316,6 @@ func (q *ImageQueue) EnqueueWithWait(ctx context.Context, req *QueueRequest) (*Q
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case <-time.After(5 * time.Minute):
-		return nil, fmt.Errorf("request timeout")
+		return nil, errors.New("request timeout")
 	}
 }
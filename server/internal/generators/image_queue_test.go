@@ -0,0 +1,128 @@
+package generators
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// generatorFunc adapts a function to ImageGenerator
+type generatorFunc func(ctx context.Context, opts *GenerateOptions) (*GenerateResult, error)
+
+func (f generatorFunc) GenerateImage(ctx context.Context, opts *GenerateOptions) (*GenerateResult, error) {
+	return f(ctx, opts)
+}
+
+func TestImageQueueResultSurvivesOneTick(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewImageQueue(1)
+	q.Start(ctx, generatorFunc(func(ctx context.Context, opts *GenerateOptions) (*GenerateResult, error) {
+		return &GenerateResult{ImageData: []byte(opts.Prompt)}, nil
+	}))
+
+	result, err := q.EnqueueWithWait(ctx, &QueueRequest{ID: "scene-1", Options: &GenerateOptions{Prompt: "竹林"}})
+	if err != nil || result.Error != nil {
+		t.Fatalf("EnqueueWithWait: %v, %v", err, result.Error)
+	}
+	completed := result.CompletedAt
+	if completed.IsZero() {
+		t.Fatal("result has no completion time")
+	}
+
+	// The first cleanup tick comes at most maxCleanupInterval after completion
+	if purged := q.purgeExpired(completed.Add(maxCleanupInterval)); purged != 0 {
+		t.Fatalf("first tick purged %d results, want 0", purged)
+	}
+	if _, ok := q.GetResult("scene-1"); !ok {
+		t.Fatal("result gone after one cleanup tick")
+	}
+
+	if purged := q.purgeExpired(completed.Add(defaultResultRetention)); purged != 0 {
+		t.Fatalf("purged %d results exactly at the retention, want 0", purged)
+	}
+	if purged := q.purgeExpired(completed.Add(defaultResultRetention + time.Second)); purged != 1 {
+		t.Fatalf("purged %d results past the retention, want 1", purged)
+	}
+	if _, ok := q.GetResult("scene-1"); ok {
+		t.Fatal("result still available after the retention")
+	}
+}
+
+func TestImageQueueCustomRetention(t *testing.T) {
+	q := NewImageQueue(0)
+	q.SetRetention(30 * time.Second)
+	q.SetRetention(0) // Ignored
+
+	now := time.Now()
+	q.results["old"] = &QueueResult{ID: "old", CompletedAt: now.Add(-31 * time.Second)}
+	q.results["new"] = &QueueResult{ID: "new", CompletedAt: now.Add(-29 * time.Second)}
+
+	if purged := q.purgeExpired(now); purged != 1 {
+		t.Fatalf("purged %d results, want 1", purged)
+	}
+	if _, ok := q.GetResult("new"); !ok {
+		t.Error("result inside the retention was purged")
+	}
+}
+
+func TestImageQueueServesHigherPriorityFirst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan string, 4)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+
+	q := NewImageQueue(1)
+	q.Start(ctx, generatorFunc(func(ctx context.Context, opts *GenerateOptions) (*GenerateResult, error) {
+		started <- opts.Prompt
+		<-release
+		mu.Lock()
+		order = append(order, opts.Prompt)
+		mu.Unlock()
+		return &GenerateResult{}, nil
+	}))
+
+	enqueue := func(id string, priority int) chan *QueueResult {
+		ch := make(chan *QueueResult, 1)
+		if err := q.Enqueue(&QueueRequest{ID: id, Options: &GenerateOptions{Prompt: id}, ResultCh: ch, Priority: priority}); err != nil {
+			t.Fatalf("Enqueue %s: %v", id, err)
+		}
+		return ch
+	}
+
+	// Occupy the only worker so the rest queue up behind it
+	busy := enqueue("busy", 0)
+	if got := <-started; got != "busy" {
+		t.Fatalf("worker started %s, want busy", got)
+	}
+
+	low := enqueue("low", 1)
+	low2 := enqueue("low-2", 1)
+	high := enqueue("high", 5)
+	if size := q.GetQueueSize(); size != 3 {
+		t.Fatalf("queue size = %d, want 3", size)
+	}
+
+	close(release)
+	for _, ch := range []chan *QueueResult{busy, low, low2, high} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("request never completed")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"busy", "high", "low", "low-2"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("served %v, want %v", order, want)
+		}
+	}
+}
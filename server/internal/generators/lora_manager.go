@@ -2,9 +2,12 @@ package generators
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -23,9 +26,19 @@ type LoRAModel struct {
 	CreatedAt     time.Time              `json:"created_at"`
 	UpdatedAt     time.Time              `json:"updated_at"`
 	Enabled       bool                   `json:"enabled"`
+	Missing       bool                   `json:"missing,omitempty"` // File not found on last Verify
 	Metadata      map[string]interface{} `json:"metadata"`
 }
 
+// loraSidecar is the metadata persisted next to a model as <name>.json
+type loraSidecar struct {
+	Type          string  `json:"type"`
+	CharacterName string  `json:"character_name,omitempty"`
+	Style         string  `json:"style,omitempty"`
+	Description   string  `json:"description,omitempty"`
+	Strength      float64 `json:"strength"`
+}
+
 // LoRARegistry manages LoRA models
 type LoRARegistry struct {
 	models    map[string]*LoRAModel
@@ -70,39 +83,146 @@ func (r *LoRARegistry) LoadModels(ctx context.Context) error {
 			continue
 		}
 
-		// Check file extension
-		ext := filepath.Ext(entry.Name())
-		if ext != ".safetensors" {
+		model := r.loadModelFile(entry)
+		if model == nil {
 			continue
 		}
 
-		// Get file info
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
+		r.models[model.ID] = model
+	}
 
-		// Create model entry
-		model := &LoRAModel{
-			ID:       generateModelID(entry.Name()),
-			Name:     entry.Name()[:len(entry.Name())-len(ext)],
-			Path:     filepath.Join(r.directory, entry.Name()),
-			Type:     inferModelType(entry.Name()),
-			Strength: 0.8,
-			FileSize: info.Size(),
-			CreatedAt: info.ModTime(),
-			UpdatedAt: info.ModTime(),
-			Enabled:   true,
-			Metadata:  make(map[string]interface{}),
-		}
+	return nil
+}
+
+// loadModelFile builds a model from a directory entry, or returns nil if it isn't a LoRA file
+func (r *LoRARegistry) loadModelFile(entry os.DirEntry) *LoRAModel {
+	// Check file extension
+	ext := filepath.Ext(entry.Name())
+	if ext != ".safetensors" {
+		return nil
+	}
 
-		// Add metadata from filename if available
+	// Get file info
+	info, err := entry.Info()
+	if err != nil {
+		return nil
+	}
+
+	// Create model entry
+	model := &LoRAModel{
+		ID:       generateModelID(entry.Name()),
+		Name:     entry.Name()[:len(entry.Name())-len(ext)],
+		Path:     filepath.Join(r.directory, entry.Name()),
+		Type:     inferModelType(entry.Name()),
+		Strength: 0.8,
+		FileSize: info.Size(),
+		CreatedAt: info.ModTime(),
+		UpdatedAt: info.ModTime(),
+		Enabled:   true,
+		Metadata:  make(map[string]interface{}),
+	}
+
+	// Prefer the sidecar; fall back to metadata inferred from the filename
+	sidecar, err := readSidecar(sidecarPath(model.Path))
+	if err == nil {
+		applySidecar(model, sidecar)
+	} else {
+		if !os.IsNotExist(err) {
+			log.Printf("[LoRARegistry] Ignoring sidecar for %s: %v", model.Name, err)
+		}
 		model.Metadata = parseMetadataFromFilename(entry.Name())
+		if name, ok := model.Metadata["character_name"].(string); ok {
+			model.CharacterName = name
+		}
+		if style, ok := model.Metadata["style"].(string); ok {
+			model.Style = style
+		}
+	}
 
-		r.models[model.ID] = model
+	return model
+}
+
+// LoRAVerifyReport describes what a Verify pass changed
+type LoRAVerifyReport struct {
+	Checked  int      `json:"checked"`
+	Missing  []string `json:"missing"`  // Models disabled because their file is gone
+	Restored []string `json:"restored"` // Missing models whose file came back
+	Added    []string `json:"added"`    // New files found in the directory
+}
+
+// Changed reports whether the pass changed the registry
+func (r *LoRAVerifyReport) Changed() bool {
+	return len(r.Missing) > 0 || len(r.Restored) > 0 || len(r.Added) > 0
+}
+
+// Verify checks every model's file, disabling models whose file is missing,
+// and registers new files that appeared in the directory
+func (r *LoRARegistry) Verify(ctx context.Context) (*LoRAVerifyReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &LoRAVerifyReport{}
+	for id, model := range r.models {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Checked++
+
+		_, err := os.Stat(model.Path)
+		switch {
+		case err != nil && !model.Missing:
+			model.Missing = true
+			model.Enabled = false
+			model.UpdatedAt = time.Now()
+			report.Missing = append(report.Missing, id)
+		case err == nil && model.Missing:
+			model.Missing = false
+			model.Enabled = true
+			model.UpdatedAt = time.Now()
+			report.Restored = append(report.Restored, id)
+		}
 	}
 
-	return nil
+	entries, err := os.ReadDir(r.directory)
+	if err != nil {
+		return report, fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if _, exists := r.models[generateModelID(entry.Name())]; exists {
+			continue
+		}
+		if model := r.loadModelFile(entry); model != nil {
+			r.models[model.ID] = model
+			report.Added = append(report.Added, model.ID)
+		}
+	}
+
+	return report, nil
+}
+
+// StartVerifier periodically re-verifies the model directory so hot-swapped files stay in sync
+func (r *LoRARegistry) StartVerifier(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := r.Verify(ctx)
+			if err != nil {
+				log.Printf("[LoRARegistry] Verify failed: %v", err)
+				continue
+			}
+			if report.Changed() {
+				log.Printf("[LoRARegistry] Missing: %v, restored: %v, added: %v", report.Missing, report.Restored, report.Added)
+			}
+		}
+	}
 }
 
 // RegisterModel registers a new LoRA model
@@ -120,6 +240,14 @@ func (r *LoRARegistry) RegisterModel(model *LoRAModel) error {
 	model.CreatedAt = now
 	model.UpdatedAt = now
 
+	if model.Path == "" {
+		model.Path = filepath.Join(r.directory, model.ID+".safetensors")
+	}
+
+	if err := writeSidecar(model); err != nil {
+		return err
+	}
+
 	r.models[model.ID] = model
 
 	return nil
@@ -261,7 +389,7 @@ func (r *LoRARegistry) UpdateModelStrength(id string, strength float64) error {
 	model.Strength = strength
 	model.UpdatedAt = time.Now()
 
-	return nil
+	return writeSidecar(model)
 }
 
 // DeleteModel deletes a model
@@ -278,6 +406,9 @@ func (r *LoRARegistry) DeleteModel(id string) error {
 	if err := os.Remove(model.Path); err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
+	if err := os.Remove(sidecarPath(model.Path)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete sidecar: %w", err)
+	}
 
 	delete(r.models, id)
 
@@ -299,6 +430,22 @@ func (r *LoRARegistry) GetCharacterModel(characterName string) (*LoRAModel, erro
 	return nil, fmt.Errorf("character model not found: %s", characterName)
 }
 
+// GetEnabledCharacterModels returns the enabled character models
+func (r *LoRARegistry) GetEnabledCharacterModels() []*LoRAModel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	models := make([]*LoRAModel, 0)
+	for _, model := range r.models {
+		if model.Type == "character" && model.Enabled {
+			modelCopy := *model
+			models = append(models, &modelCopy)
+		}
+	}
+
+	return models
+}
+
 // ModelExists checks if a model exists
 func (r *LoRARegistry) ModelExists(id string) bool {
 	r.mu.RLock()
@@ -357,6 +504,57 @@ func generateModelID(filename string) string {
 	return filename[:len(filename)-len(ext)]
 }
 
+// sidecarPath returns the metadata file path for a model file
+func sidecarPath(modelPath string) string {
+	return strings.TrimSuffix(modelPath, filepath.Ext(modelPath)) + ".json"
+}
+
+// readSidecar loads a model's metadata file
+func readSidecar(path string) (*loraSidecar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sidecar loraSidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return nil, fmt.Errorf("failed to parse sidecar: %w", err)
+	}
+	return &sidecar, nil
+}
+
+// writeSidecar persists a model's metadata next to its file
+func writeSidecar(model *LoRAModel) error {
+	data, err := json.MarshalIndent(loraSidecar{
+		Type:          model.Type,
+		CharacterName: model.CharacterName,
+		Style:         model.Style,
+		Description:   model.Description,
+		Strength:      model.Strength,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sidecar: %w", err)
+	}
+
+	if err := os.WriteFile(sidecarPath(model.Path), data, 0644); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return nil
+}
+
+// applySidecar overrides inferred fields with persisted metadata
+func applySidecar(model *LoRAModel, sidecar *loraSidecar) {
+	if sidecar.Type != "" {
+		model.Type = sidecar.Type
+	}
+	model.CharacterName = sidecar.CharacterName
+	model.Style = sidecar.Style
+	model.Description = sidecar.Description
+	if sidecar.Strength > 0 {
+		model.Strength = sidecar.Strength
+	}
+}
+
 func inferModelType(filename string) string {
 	lower := filename
 
@@ -0,0 +1,27 @@
+package generators
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoRAVerifierStopsWithContext(t *testing.T) {
+	registry := NewLoRARegistry(t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		registry.StartVerifier(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	// Let a few verify passes run before stopping
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("verifier kept running after its context was cancelled")
+	}
+}
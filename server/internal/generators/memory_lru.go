@@ -0,0 +1,92 @@
+package generators
+
+import "container/list"
+
+// Default memory-tier budgets for the image and audio caches
+const (
+	DefaultImageMemoryBudget int64 = 64 << 20
+	DefaultAudioMemoryBudget int64 = 32 << 20
+)
+
+// lruItem is one cached payload in a memoryLRU
+type lruItem struct {
+	key  string
+	data []byte
+}
+
+// memoryLRU holds recently served payloads up to a byte budget, evicting the least
+// recently used first. It is not safe for concurrent use; the owning cache guards it.
+type memoryLRU struct {
+	budget int64
+	size   int64
+	order  *list.List // Front is most recently used
+	items  map[string]*list.Element
+}
+
+// newMemoryLRU creates a memory tier holding up to budget bytes; 0 disables it
+func newMemoryLRU(budget int64) *memoryLRU {
+	return &memoryLRU{
+		budget: budget,
+		order:  list.New(),
+		items:  make(map[string]*list.Element),
+	}
+}
+
+// get returns the payload for key and marks it most recently used
+func (m *memoryLRU) get(key string) ([]byte, bool) {
+	elem, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(elem)
+	return elem.Value.(*lruItem).data, true
+}
+
+// put stores data for key, evicting older payloads to stay within budget. Payloads
+// larger than the whole budget are not kept.
+func (m *memoryLRU) put(key string, data []byte) {
+	m.remove(key)
+	if int64(len(data)) > m.budget {
+		return
+	}
+
+	m.items[key] = m.order.PushFront(&lruItem{key: key, data: data})
+	m.size += int64(len(data))
+	m.shrink()
+}
+
+// remove drops the payload for key, if any
+func (m *memoryLRU) remove(key string) {
+	if elem, ok := m.items[key]; ok {
+		m.removeElement(elem)
+	}
+}
+
+// clear drops every payload
+func (m *memoryLRU) clear() {
+	m.order.Init()
+	m.items = make(map[string]*list.Element)
+	m.size = 0
+}
+
+// setBudget changes the byte budget, evicting payloads that no longer fit
+func (m *memoryLRU) setBudget(budget int64) {
+	if budget < 0 {
+		budget = 0
+	}
+	m.budget = budget
+	m.shrink()
+}
+
+// shrink evicts least recently used payloads until the tier fits its budget
+func (m *memoryLRU) shrink() {
+	for m.size > m.budget {
+		m.removeElement(m.order.Back())
+	}
+}
+
+func (m *memoryLRU) removeElement(elem *list.Element) {
+	item := m.order.Remove(elem).(*lruItem)
+	delete(m.items, item.key)
+	m.size -= int64(len(item.data))
+}
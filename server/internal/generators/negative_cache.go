@@ -0,0 +1,74 @@
+package generators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultNegativeTTL is how long a failed generation is remembered; it is kept far
+// shorter than the success TTL so a transient backend fault clears quickly
+const DefaultNegativeTTL = 30 * time.Second
+
+// ErrCachedFailure is returned by cache Get when the key recently failed to generate
+var ErrCachedFailure = errors.New("cached generation failure")
+
+// negativeEntry records a failed generation until it expires
+type negativeEntry struct {
+	reason    string
+	expiresAt time.Time
+}
+
+// negativeCache remembers failed generations in memory; the owning cache guards it
+type negativeCache map[string]negativeEntry
+
+// get returns the cached failure for key, or nil; expired failures are dropped
+func (n negativeCache) get(key string) error {
+	entry, ok := n[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(n, key)
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrCachedFailure, entry.reason)
+}
+
+// put records err for key; a non-positive ttl uses DefaultNegativeTTL
+func (n negativeCache) put(key string, err error, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultNegativeTTL
+	}
+	reason := "unknown error"
+	if err != nil {
+		reason = err.Error()
+	}
+	n[key] = negativeEntry{reason: reason, expiresAt: time.Now().Add(ttl)}
+}
+
+// cleanExpired drops expired failures and returns how many were removed
+func (n negativeCache) cleanExpired() int {
+	now := time.Now()
+	count := 0
+	for key, entry := range n {
+		if now.After(entry.expiresAt) {
+			delete(n, key)
+			count++
+		}
+	}
+	return count
+}
+
+// ShouldCacheFailure reports whether a generation error says something about the request
+// itself; cancellations, timeouts and a full or stopped queue are left uncached so a retry
+// can succeed
+func ShouldCacheFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, ErrQueueFull) &&
+		!errors.Is(err, ErrQueueStopped) &&
+		!errors.Is(err, ErrCachedFailure)
+}
@@ -7,7 +7,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -60,9 +65,20 @@ type VoiceModel struct {
 type VoiceRegistry struct {
 	voices     map[string]*VoiceModel
 	directory  string
+	defaultID  string
 	mu          sync.RWMutex
 }
 
+const (
+	builtinDefaultVoice = "narrator"
+	defaultVoiceFile    = "default_voice.json"
+)
+
+// defaultVoiceRecord is the persisted default voice selection
+type defaultVoiceRecord struct {
+	VoiceID string `json:"voice_id"`
+}
+
 // NewGPTSoVITSClient creates a new GPT-SoVITS client
 func NewGPTSoVITSClient() *GPTSoVITSClient {
 	return &GPTSoVITSClient{
@@ -73,8 +89,8 @@ func NewGPTSoVITSClient() *GPTSoVITSClient {
 	}
 }
 
-// Synthesize synthesizes text to speech
-func (c *GPTSoVITSClient) Synthesize(ctx context.Context, text string, voiceID string, options *TTSRequest) ([]byte, error) {
+// SynthesizeRequest synthesizes text to speech using a raw GPT-SoVITS request
+func (c *GPTSoVITSClient) SynthesizeRequest(ctx context.Context, text string, voiceID string, options *TTSRequest) ([]byte, error) {
 	if text == "" {
 		return nil, fmt.Errorf("text cannot be empty")
 	}
@@ -102,8 +118,8 @@ func (c *GPTSoVITSClient) Synthesize(ctx context.Context, text string, voiceID s
 		}
 	}
 
-	// Add voice reference if voiceID specified
-	if voiceID != "" {
+	// Fall back to the voice ID as the reference when none was resolved
+	if reqBody.ReferenceAudio == "" && voiceID != "" {
 		reqBody.ReferenceAudio = voiceID
 	}
 
@@ -243,19 +259,23 @@ func NewVoiceRegistry(directory string) *VoiceRegistry {
 	return &VoiceRegistry{
 		voices:    make(map[string]*VoiceModel),
 		directory: directory,
+		defaultID: builtinDefaultVoice,
 	}
 }
 
-// LoadVoices loads voices from the specified directory
-func (r *VoiceRegistry) LoadVoices(ctx context.Context) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	// Scan directory for voice reference files
-	// This is a simplified implementation
-	// In production, this would parse actual GPT-SoVITS voice format
+// voiceDescriptor is the optional <name>.json sitting next to a reference clip
+type voiceDescriptor struct {
+	Name        string `json:"name"`
+	Gender      string `json:"gender"`
+	Language    string `json:"language"`
+	Style       string `json:"style"`
+	Description string `json:"description"`
+	Enabled     *bool  `json:"enabled"`
+}
 
-	voices := []*VoiceModel{
+// builtinVoices are offered when the directory holds no reference clips
+func builtinVoices() []*VoiceModel {
+	return []*VoiceModel{
 		{
 			ID:          "narrator",
 			Name:        "说书人",
@@ -284,15 +304,152 @@ func (r *VoiceRegistry) LoadVoices(ctx context.Context) error {
 			Enabled:     true,
 		},
 	}
+}
+
+// LoadVoices loads GPT-SoVITS reference clips (.wav) and their optional descriptors
+// from the registry directory, falling back to the built-in voices when there are none
+func (r *VoiceRegistry) LoadVoices(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	voices, err := r.scanDirectory()
+	if err != nil {
+		return err
+	}
+	if len(voices) == 0 {
+		voices = builtinVoices()
+	}
 
-	// Load voices
+	r.voices = make(map[string]*VoiceModel, len(voices))
 	for _, voice := range voices {
 		r.voices[voice.ID] = voice
 	}
 
+	r.loadDefaultLocked()
+	r.ensureDefaultLocked()
+
 	return nil
 }
 
+// Reload rescans the directory and returns the number of voices loaded
+func (r *VoiceRegistry) Reload(ctx context.Context) (int, error) {
+	if err := r.LoadVoices(ctx); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.voices), nil
+}
+
+// scanDirectory builds voices from the reference clips in the registry directory
+func (r *VoiceRegistry) scanDirectory() ([]*VoiceModel, error) {
+	if r.directory == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(r.directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read voice directory: %w", err)
+	}
+
+	voices := make([]*VoiceModel, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".wav") {
+			continue
+		}
+
+		id := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		referencePath, err := filepath.Abs(filepath.Join(r.directory, entry.Name()))
+		if err != nil {
+			referencePath = filepath.Join(r.directory, entry.Name())
+		}
+
+		voice := &VoiceModel{
+			ID:            id,
+			Name:          id,
+			Language:      "zh",
+			ReferencePath: referencePath,
+			Enabled:       true,
+		}
+		r.applyDescriptor(voice, filepath.Join(r.directory, id+".json"))
+
+		voices = append(voices, voice)
+	}
+
+	return voices, nil
+}
+
+// applyDescriptor overlays a voice's JSON descriptor, if one exists
+func (r *VoiceRegistry) applyDescriptor(voice *VoiceModel, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var desc voiceDescriptor
+	if err := json.Unmarshal(data, &desc); err != nil {
+		log.Printf("[VoiceRegistry] Ignoring unreadable descriptor %s: %v", path, err)
+		return
+	}
+
+	if desc.Name != "" {
+		voice.Name = desc.Name
+	}
+	if desc.Language != "" {
+		voice.Language = desc.Language
+	}
+	voice.Gender = desc.Gender
+	voice.Style = desc.Style
+	voice.Description = desc.Description
+	if desc.Enabled != nil {
+		voice.Enabled = *desc.Enabled
+	}
+}
+
+// VoiceStats holds statistics about registered voices
+type VoiceStats struct {
+	TotalCount     int    `json:"total_count"`
+	EnabledCount   int    `json:"enabled_count"`
+	ReferenceCount int    `json:"reference_count"` // Voices backed by a reference clip
+	DefaultID      string `json:"default_id"`
+}
+
+// GetStats returns statistics about registered voices
+func (r *VoiceRegistry) GetStats() *VoiceStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := &VoiceStats{
+		TotalCount: len(r.voices),
+		DefaultID:  r.defaultID,
+	}
+	for _, voice := range r.voices {
+		if voice.Enabled {
+			stats.EnabledCount++
+		}
+		if voice.ReferencePath != "" {
+			stats.ReferenceCount++
+		}
+	}
+
+	return stats
+}
+
+// ReferenceAudio returns the reference clip for a voice, or "" if it has none
+func (r *VoiceRegistry) ReferenceAudio(id string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if voice, ok := r.voices[id]; ok {
+		return voice.ReferencePath
+	}
+	return ""
+}
+
 // GetVoice retrieves a voice by ID
 func (r *VoiceRegistry) GetVoice(id string) (*VoiceModel, error) {
 	r.mu.RLock()
@@ -351,7 +508,79 @@ func (r *VoiceRegistry) DisableVoice(id string) error {
 
 // GetDefaultVoice returns the default voice
 func (r *VoiceRegistry) GetDefaultVoice() (*VoiceModel, error) {
-	return r.GetVoice("narrator")
+	return r.GetVoice(r.DefaultID())
+}
+
+// DefaultID returns the ID of the default voice
+func (r *VoiceRegistry) DefaultID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultID
+}
+
+// SetDefault makes an existing, enabled voice the default and persists the choice
+func (r *VoiceRegistry) SetDefault(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	voice, ok := r.voices[id]
+	if !ok {
+		return fmt.Errorf("voice not found: %s", id)
+	}
+	if !voice.Enabled {
+		return fmt.Errorf("voice is disabled: %s", id)
+	}
+
+	if r.directory != "" {
+		data, err := json.Marshal(defaultVoiceRecord{VoiceID: id})
+		if err != nil {
+			return fmt.Errorf("failed to marshal default voice: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(r.directory, defaultVoiceFile), data, 0644); err != nil {
+			return fmt.Errorf("failed to persist default voice: %w", err)
+		}
+	}
+
+	r.defaultID = id
+	return nil
+}
+
+// loadDefaultLocked restores the persisted default voice if it is still registered; callers must hold r.mu
+func (r *VoiceRegistry) loadDefaultLocked() {
+	if r.directory == "" {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.directory, defaultVoiceFile))
+	if err != nil {
+		return
+	}
+
+	var record defaultVoiceRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		log.Printf("[VoiceRegistry] Ignoring unreadable %s: %v", defaultVoiceFile, err)
+		return
+	}
+
+	if _, ok := r.voices[record.VoiceID]; ok {
+		r.defaultID = record.VoiceID
+	}
+}
+
+// ensureDefaultLocked points the default at a registered voice; callers must hold r.mu
+func (r *VoiceRegistry) ensureDefaultLocked() {
+	if _, ok := r.voices[r.defaultID]; ok {
+		return
+	}
+
+	ids := make([]string, 0, len(r.voices))
+	for id := range r.voices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) > 0 {
+		r.defaultID = ids[0]
+	}
 }
 
 // TTSOptions represents synthesis options
@@ -360,6 +589,7 @@ type TTSOptions struct {
 	Language  string   // Language code (zh, en, etc.)
 	Tone      string   // Tone (classic, modern, soft, etc.)
 	Format    string   // Output format (wav, mp3, etc.)
+	ReferenceAudio string // Reference clip path; defaults to the voice ID
 }
 
 // NewTTSOptions creates default TTS options
@@ -371,20 +601,21 @@ func NewTTSOptions() *TTSOptions {
 	}
 }
 
-// SynthesizeWithOptions synthesizes with additional options
-func (c *GPTSoVITSClient) SynthesizeWithOptions(ctx context.Context, text string, voiceID string, opts *TTSOptions) ([]byte, error) {
+// Synthesize synthesizes text to speech with the given options; it implements TTSProvider
+func (c *GPTSoVITSClient) Synthesize(ctx context.Context, text string, voiceID string, opts *TTSOptions) ([]byte, error) {
 	if opts == nil {
 		opts = NewTTSOptions()
 	}
 
 	req := &TTSRequest{
-		Text:     text,
-		Language: opts.Language,
-		Speed:    opts.Speed,
-		Tone:     opts.Tone,
+		Text:           text,
+		ReferenceAudio: opts.ReferenceAudio,
+		Language:       opts.Language,
+		Speed:          opts.Speed,
+		Tone:           opts.Tone,
 	}
 
-	return c.Synthesize(ctx, text, voiceID, req)
+	return c.SynthesizeRequest(ctx, text, voiceID, req)
 }
 
 // GetAudioFormat returns the audio format based on extension
@@ -0,0 +1,71 @@
+package generators
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// TTSProvider defines a text-to-speech backend the story engine can narrate with
+type TTSProvider interface {
+	// Synthesize converts text to audio bytes using the given voice
+	Synthesize(ctx context.Context, text string, voiceID string, opts *TTSOptions) ([]byte, error)
+
+	// HealthCheck checks if the TTS backend is reachable
+	HealthCheck(ctx context.Context) error
+}
+
+// Ensure GPTSoVITSClient satisfies TTSProvider
+var _ TTSProvider = (*GPTSoVITSClient)(nil)
+
+// NoopTTSProvider is a stub provider that returns a short silent WAV clip
+type NoopTTSProvider struct {
+	SampleRate int
+	Duration   float64 // Seconds of silence to return
+}
+
+// NewNoopTTSProvider creates a stub provider returning 100ms of 24kHz silence
+func NewNoopTTSProvider() *NoopTTSProvider {
+	return &NoopTTSProvider{
+		SampleRate: 24000,
+		Duration:   0.1,
+	}
+}
+
+// Synthesize returns a silent mono 16-bit WAV clip
+func (p *NoopTTSProvider) Synthesize(ctx context.Context, text string, voiceID string, opts *TTSOptions) ([]byte, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	const (
+		channels      = 1
+		bitsPerSample = 16
+	)
+	blockAlign := channels * bitsPerSample / 8
+	dataSize := int(float64(p.SampleRate)*p.Duration) * blockAlign
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(p.SampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(p.SampleRate*blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(bitsPerSample))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+
+	return buf.Bytes(), nil
+}
+
+// HealthCheck always succeeds for the stub provider
+func (p *NoopTTSProvider) HealthCheck(ctx context.Context) error {
+	return nil
+}
@@ -1,27 +1,18 @@
 package infra
 
 import (
+	"Cyber-Jianghu/server/internal/generators"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
-// ComfyUI paths (from user)
-const (
-	// Conda environment path
-	condaEnvPath = "D:\\conda\\envs\\comfyui"
-
-	// Python interpreter path in conda environment
-	pythonExePath = "D:\\conda\\envs\\comfyui\\python.exe"
-
-	// ComfyUI root directory (where models are stored)
-	comfyuiRootDir = "D:\\ComfyUI"
-)
-
 // ComfyUI configuration
 const (
 	comfyuiHost = "127.0.0.1"
@@ -29,6 +20,12 @@ const (
 	maxRetries    = 3
 	retryDelay    = 3 * time.Second
 	startupTimeout = 30 * time.Second
+	readinessPollInterval = 1 * time.Second
+
+	// ComfyUI output log rotation
+	logFileName    = "comfyui.log"
+	logMaxSize     = 5 * 1024 * 1024
+	logMaxBackups  = 3
 )
 
 // ComfyUI status
@@ -45,8 +42,10 @@ const (
 type ComfyUIManager struct {
 	status      ComfyUIStatus
 	process     *os.Process
+	exited      chan struct{} // Closed once the process has been reaped
 	statusMutex sync.RWMutex
 	config      *ComfyUIManagerConfig
+	logFile     *rotatingLog // Child stdout/stderr; nil until first start
 }
 
 // ComfyUIManagerConfig holds ComfyUI manager configuration
@@ -55,10 +54,20 @@ type ComfyUIManagerConfig struct {
 	Port     int
 	ModelsDir string
 	UseGPU   bool
+	LogDir   string // Where comfyui.log is written; empty disables output capture
+
+	CondaEnvPath string // Optional conda environment; PythonPath defaults to its interpreter
+	PythonPath   string // Interpreter used to run main.py; a bare name is looked up in PATH
+	RootDir      string // ComfyUI checkout containing main.py
 }
 
-// NewComfyUIManager creates a new ComfyUI manager
+// NewComfyUIManager creates a new ComfyUI manager, filling unset paths with per-OS defaults
 func NewComfyUIManager(config *ComfyUIManagerConfig) *ComfyUIManager {
+	if config == nil {
+		config = &ComfyUIManagerConfig{UseGPU: true}
+	}
+	applyConfigDefaults(config)
+
 	return &ComfyUIManager{
 		status:     ComfyUIStatusStopped,
 		process:     nil,
@@ -76,32 +85,32 @@ func (m *ComfyUIManager) Start(ctx context.Context) error {
 		return nil
 	}
 
-	// Update status
-	m.status = ComfyUIStatusStarting
-
-	// Check if conda environment exists
-	if _, err := os.Stat(condaEnvPath); os.IsNotExist(err) {
-		return fmt.Errorf("conda environment not found at: %s", condaEnvPath)
-	}
-
-	// Check if Python interpreter exists
-	if _, err := os.Stat(pythonExePath); os.IsNotExist(err) {
-		return fmt.Errorf("Python interpreter not found at: %s", pythonExePath)
+	pythonPath, err := m.validatePaths()
+	if err != nil {
+		m.status = ComfyUIStatusError
+		return err
 	}
 
-	// Check if ComfyUI root directory exists
-	if _, err := os.Stat(comfyuiRootDir); os.IsNotExist(err) {
-		return fmt.Errorf("ComfyUI root directory not found at: %s", comfyuiRootDir)
-	}
+	// Update status
+	m.status = ComfyUIStatusStarting
 
 	// Prepare command
-	// Directly execute main.py with conda python interpreter
-	cmd := exec.Command(pythonExePath, "main.py", "--listen", comfyuiHost, "--port", fmt.Sprintf("%d", comfyuiPort))
+	// Directly execute main.py with the configured python interpreter
+	args := []string{"main.py", "--listen", m.config.Host, "--port", fmt.Sprintf("%d", m.config.Port)}
+	if !m.config.UseGPU {
+		args = append(args, "--cpu")
+	}
+	cmd := exec.Command(pythonPath, args...)
 	// Set working directory to ComfyUI root to ensure model paths are correct
-	cmd.Dir = comfyuiRootDir
+	cmd.Dir = m.config.RootDir
 
 	// Capture output for debugging
-	log.Printf("Starting ComfyUI: %s %s (dir: %s)", pythonExePath, cmd.Args, comfyuiRootDir)
+	log.Printf("Starting ComfyUI: %s %s (dir: %s)", pythonPath, cmd.Args, m.config.RootDir)
+	if logFile := m.openLogLocked(); logFile != nil {
+		fmt.Fprintf(logFile, "=== Starting ComfyUI at %s ===\n", time.Now().Format(time.RFC3339))
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	}
 
 	m.status = ComfyUIStatusStarting
 
@@ -115,12 +124,71 @@ func (m *ComfyUIManager) Start(ctx context.Context) error {
 
 	m.process = cmd.Process
 
+	// Reap the child so liveness checks don't see a zombie
+	exited := make(chan struct{})
+	m.exited = exited
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("ComfyUI process exited: %v", err)
+		}
+		close(exited)
+	}()
+
 	// Wait for startup with timeout
-	go m.waitForStartup(ctx)
+	go m.waitForStartup(ctx, cmd.Process)
 
 	return nil
 }
 
+// validatePaths checks the configured install and returns the resolved interpreter path
+func (m *ComfyUIManager) validatePaths() (string, error) {
+	// Check if conda environment exists
+	if m.config.CondaEnvPath != "" {
+		if _, err := os.Stat(m.config.CondaEnvPath); os.IsNotExist(err) {
+			return "", fmt.Errorf("conda environment not found at: %s", m.config.CondaEnvPath)
+		}
+	}
+
+	// Check if Python interpreter exists
+	pythonPath, err := exec.LookPath(m.config.PythonPath)
+	if err != nil {
+		return "", fmt.Errorf("Python interpreter not found at %s: %w", m.config.PythonPath, err)
+	}
+
+	// Check if ComfyUI root directory exists
+	if _, err := os.Stat(filepath.Join(m.config.RootDir, "main.py")); os.IsNotExist(err) {
+		return "", fmt.Errorf("ComfyUI main.py not found in root directory: %s", m.config.RootDir)
+	}
+
+	return pythonPath, nil
+}
+
+// applyConfigDefaults fills in the host, port and install paths left empty in config
+func applyConfigDefaults(config *ComfyUIManagerConfig) {
+	if config.Host == "" {
+		config.Host = comfyuiHost
+	}
+	if config.Port == 0 {
+		config.Port = comfyuiPort
+	}
+
+	condaEnv, rootDir := defaultInstallPaths()
+
+	// An explicit interpreter means no conda env is assumed
+	if config.CondaEnvPath == "" && config.PythonPath == "" {
+		config.CondaEnvPath = condaEnv
+	}
+	if config.PythonPath == "" {
+		config.PythonPath = condaPython(config.CondaEnvPath)
+	}
+	if config.RootDir == "" {
+		config.RootDir = rootDir
+	}
+	if config.ModelsDir == "" {
+		config.ModelsDir = filepath.Join(config.RootDir, "models")
+	}
+}
+
 // Stop stops ComfyUI
 func (m *ComfyUIManager) Stop(ctx context.Context) error {
 	m.statusMutex.Lock()
@@ -132,26 +200,18 @@ func (m *ComfyUIManager) Stop(ctx context.Context) error {
 
 	m.status = ComfyUIStatusStopped
 
-	if m.process != nil {
-			if err := m.process.Kill(); err != nil {
-			// Log error but don't fail
+	if m.process == nil {
+		return nil
+	}
+
+	// A process that already exited only needs to be reaped
+	if err := m.process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
 		return fmt.Errorf("failed to kill ComfyUI: %w", err)
-		}
 	}
 
 	// Wait for process to exit
-	done := make(chan error, 1)
-	go func() {
-			_, err := m.process.Wait()
-		done <- err
-	}()
-
 	select {
-	case err := <-done:
-		if err != nil {
-			m.status = ComfyUIStatusError
-		return err
-		}
+	case <-m.exited:
 		m.status = ComfyUIStatusStopped
 		return nil
 	case <-ctx.Done():
@@ -166,32 +226,107 @@ func (m *ComfyUIManager) Stop(ctx context.Context) error {
 	}
 }
 
-// waitForStartup waits for ComfyUI to be ready
-func (m *ComfyUIManager) waitForStartup(ctx context.Context) {
+// waitForStartup polls the HTTP API until ComfyUI answers or the startup timeout elapses
+func (m *ComfyUIManager) waitForStartup(ctx context.Context, process *os.Process) {
 	log.Printf("ComfyUI waitForStartup started")
 
-	// Wait a bit for the process to start
-	time.Sleep(3 * time.Second)
+	client := generators.NewComfyUIClient(generators.WithBaseURL(m.GetURL()))
+	deadline := time.NewTimer(startupTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.finishStartup(process, ComfyUIStatusError, fmt.Sprintf("startup aborted: %v", ctx.Err()))
+			return
+		case <-deadline.C:
+			m.finishStartup(process, ComfyUIStatusError, fmt.Sprintf("not ready after %v", startupTimeout))
+			return
+		case <-ticker.C:
+		}
+
+		if !processAlive(process) {
+			m.finishStartup(process, ComfyUIStatusError, "process exited during startup")
+			return
+		}
 
-	// Mark as running - actual HTTP readiness will be checked when making requests
+		checkCtx, cancel := context.WithTimeout(ctx, readinessPollInterval)
+		err := client.HealthCheck(checkCtx)
+		cancel()
+		if err == nil {
+			m.finishStartup(process, ComfyUIStatusRunning, "")
+			return
+		}
+	}
+}
+
+// finishStartup records the startup outcome unless the process was stopped or replaced meanwhile
+func (m *ComfyUIManager) finishStartup(process *os.Process, status ComfyUIStatus, reason string) {
 	m.statusMutex.Lock()
-	if m.status == ComfyUIStatusStarting {
-		m.status = ComfyUIStatusRunning
-		log.Printf("ComfyUI marked as running (PID: %d)", m.process.Pid)
+	defer m.statusMutex.Unlock()
+
+	if m.process != process || m.status != ComfyUIStatusStarting {
+		return
+	}
+
+	m.status = status
+	if status == ComfyUIStatusRunning {
+		log.Printf("ComfyUI is ready (PID: %d)", process.Pid)
+	} else {
+		log.Printf("ComfyUI failed to start (PID: %d): %s", process.Pid, reason)
 	}
-	m.statusMutex.Unlock()
 }
 
-// GetStatus returns current status
+// GetStatus returns current status, downgrading to error if the process has died
 func (m *ComfyUIManager) GetStatus() ComfyUIStatus {
-	m.statusMutex.RLock()
-	defer m.statusMutex.RUnlock()
+	m.statusMutex.Lock()
+	defer m.statusMutex.Unlock()
+
+	if (m.status == ComfyUIStatusRunning || m.status == ComfyUIStatusStarting) && !processAlive(m.process) {
+		log.Printf("ComfyUI process is no longer alive")
+		m.status = ComfyUIStatusError
+	}
 	return m.status
 }
 
 // IsReady checks if ComfyUI is ready to accept requests
 func (m *ComfyUIManager) IsReady() bool {
-	return m.status == ComfyUIStatusRunning
+	return m.GetStatus() == ComfyUIStatusRunning
+}
+
+// GetRecentLog returns up to the last n lines of ComfyUI's output
+func (m *ComfyUIManager) GetRecentLog(n int) []string {
+	m.statusMutex.RLock()
+	logFile := m.logFile
+	m.statusMutex.RUnlock()
+
+	if logFile == nil {
+		return nil
+	}
+
+	lines, err := logFile.Tail(n)
+	if err != nil {
+		log.Printf("ComfyUI failed to read log: %v", err)
+		return nil
+	}
+	return lines
+}
+
+// openLogLocked opens the output log on first use; callers must hold statusMutex
+func (m *ComfyUIManager) openLogLocked() *rotatingLog {
+	if m.logFile != nil || m.config == nil || m.config.LogDir == "" {
+		return m.logFile
+	}
+
+	logFile, err := newRotatingLog(filepath.Join(m.config.LogDir, logFileName), logMaxSize, logMaxBackups)
+	if err != nil {
+		log.Printf("ComfyUI output will not be captured: %v", err)
+		return nil
+	}
+	m.logFile = logFile
+	return logFile
 }
 
 // GetURL returns the ComfyUI API URL
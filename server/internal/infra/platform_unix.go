@@ -0,0 +1,31 @@
+//go:build !windows
+
+package infra
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// processAlive reports whether the process still exists, using signal 0 which delivers nothing
+func processAlive(process *os.Process) bool {
+	if process == nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// defaultInstallPaths returns the conda env and ComfyUI checkout under the user's home directory
+func defaultInstallPaths() (condaEnv string, rootDir string) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, "miniconda3", "envs", "comfyui"), filepath.Join(home, "ComfyUI")
+}
+
+// condaPython returns the interpreter inside a conda environment
+func condaPython(envPath string) string {
+	return filepath.Join(envPath, "bin", "python")
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package infra
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// stillActive is the exit code Windows reports for a process that has not exited
+const stillActive = 259
+
+// processAlive reports whether the process still exists by querying its exit code through a handle
+func processAlive(process *os.Process) bool {
+	if process == nil {
+		return false
+	}
+
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(process.Pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := syscall.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
+
+// defaultInstallPaths returns the conda env and ComfyUI checkout of the original Windows setup
+func defaultInstallPaths() (condaEnv string, rootDir string) {
+	return "D:\\conda\\envs\\comfyui", "D:\\ComfyUI"
+}
+
+// condaPython returns the interpreter inside a conda environment
+func condaPython(envPath string) string {
+	return filepath.Join(envPath, "python.exe")
+}
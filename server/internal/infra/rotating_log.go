@@ -0,0 +1,185 @@
+package infra
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tailReadLimit bounds how much of the log tail reads, so status calls stay cheap
+const tailReadLimit = 256 * 1024
+
+// rotatingLog is an append-only log file that is rotated to numbered backups once it
+// exceeds maxSize
+type rotatingLog struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// newRotatingLog opens (or creates) the log file at path
+func newRotatingLog(path string, maxSize int64, maxBackups int) (*rotatingLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	l := &rotatingLog{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := l.openLocked(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write appends p, rotating first if it would push the file past maxSize
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (l *rotatingLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Tail returns up to the last n lines, reaching into the newest backup if the current
+// file was just rotated
+func (l *rotatingLog) Tail(n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lines, err := tailFile(l.path, n)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) < n && l.maxBackups > 0 {
+		older, err := tailFile(l.path+".1", n-len(lines))
+		if err == nil {
+			lines = append(older, lines...)
+		}
+	}
+	return lines, nil
+}
+
+// tailFile returns up to the last n lines of the file at path
+func tailFile(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := info.Size() - tailReadLimit
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimRight(string(data), "\r\n")
+	if text == "" {
+		return nil, nil
+	}
+
+	lines := strings.Split(text, "\n")
+	// The first line is likely cut short when we started mid-file
+	if offset > 0 && len(lines) > 1 {
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+	return lines, nil
+}
+
+// openLocked opens the log file for appending; callers must hold l.mu
+func (l *rotatingLog) openLocked() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotateLocked shifts path.1..path.N-1 up one slot, moves the current file to path.1
+// and starts a fresh file; callers must hold l.mu
+func (l *rotatingLog) rotateLocked() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	l.file = nil
+
+	if l.maxBackups > 0 {
+		_ = os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxBackups))
+		for i := l.maxBackups - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("failed to truncate log file: %w", err)
+	}
+
+	return l.openLocked()
+}
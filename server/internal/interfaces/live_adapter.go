@@ -8,6 +8,16 @@ type ConnectOptions struct {
 	Cookie string
 }
 
+// DanmakuKind identifies which live event a Danmaku carries
+type DanmakuKind string
+
+const (
+	DanmakuChat      DanmakuKind = "chat"      // 普通弹幕
+	DanmakuGift      DanmakuKind = "gift"      // 礼物
+	DanmakuSuperChat DanmakuKind = "superchat" // 醒目留言
+	DanmakuEnter     DanmakuKind = "enter"     // 进入直播间
+)
+
 // Danmaku represents a live chat message
 type Danmaku struct {
 	Username  string
@@ -17,6 +27,29 @@ type Danmaku struct {
 	IsVip     bool
 	IsAdmin   bool
 	GiftValue int // 赠送礼物价值（抖币/金瓜子）
+	GiftName  string      `json:",omitempty"` // 礼物名称，醒目留言为空
+	GiftCount int         // 礼物数量
+	Kind      DanmakuKind `json:",omitempty"` // 事件类型，旧数据为空时按普通弹幕处理
+}
+
+// EventKind returns the danmaku's kind, inferring it for danmaku built without one
+func (d Danmaku) EventKind() DanmakuKind {
+	switch {
+	case d.Kind != "":
+		return d.Kind
+	case d.GiftName != "":
+		return DanmakuGift
+	case d.IsVip && d.GiftValue > 0:
+		return DanmakuSuperChat
+	default:
+		return DanmakuChat
+	}
+}
+
+// IsPaid reports whether the danmaku is a gift or superchat
+func (d Danmaku) IsPaid() bool {
+	kind := d.EventKind()
+	return kind == DanmakuGift || kind == DanmakuSuperChat
 }
 
 // LiveAdapter defines the interface for live streaming platforms
@@ -36,3 +69,9 @@ type LiveAdapter interface {
 	// Disconnect closes the connection
 	Disconnect() error
 }
+
+// LivePreflighter is implemented by adapters that can check a cookie and room before
+// Connect, so failures are reported precisely instead of as handshake errors
+type LivePreflighter interface {
+	PreflightCheck(ctx context.Context, opts *ConnectOptions) error
+}
@@ -14,10 +14,10 @@ type StoryContext struct {
 
 // Character represents a character in the story
 type Character struct {
-	ID       string
-	Name     string
-	State    map[string]interface{} // 角色状态（血量、位置等）
-	Relation string                  // 与主角关系
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	State    map[string]interface{} `json:"state,omitempty"` // 角色状态（血量、位置等）
+	Relation string                 `json:"relation"`        // 与主角关系
 }
 
 // StoryRequest represents a request to generate story content
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// RequestIDHeader carries the request ID back to the client
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Detach returns a context for work that outlives the request: it keeps ctx's values
+// but not its cancellation, and its request ID is the parent's suffixed with task
+// (e.g. "3f2a…/audio") so the task's logs tie back to the originating request
+func Detach(ctx context.Context, task string) context.Context {
+	detached := context.WithoutCancel(ctx)
+	if id := RequestID(ctx); id != "" {
+		detached = WithRequestID(detached, id+"/"+task)
+	}
+	return detached
+}
+
+// FromContext returns logger annotated with ctx's request ID, if any
+func FromContext(ctx context.Context, logger *slog.Logger) *slog.Logger {
+	logger = OrDefault(logger)
+	if id := RequestID(ctx); id != "" {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
@@ -0,0 +1,100 @@
+// Package logging builds the process-wide structured logger from config.
+package logging
+
+import (
+	"Cyber-Jianghu/server/internal/config"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// New builds a logger from config. Level is debug, info, warn or error (default info);
+// format is json or text (default text); output is stdout, stderr or a file path
+// (default stdout). The returned closer releases the output file, if any.
+func New(cfg config.LoggingConfig) (*slog.Logger, io.Closer, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, closer, err := openOutput(cfg.Output)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("unknown log format: %s", cfg.Format)
+	}
+
+	return slog.New(handler), closer, nil
+}
+
+// Init builds the logger and makes it the default, so log.Printf calls that have not
+// moved to structured logging are routed through it at info level
+func Init(cfg config.LoggingConfig) (*slog.Logger, io.Closer, error) {
+	logger, closer, err := New(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.SetDefault(logger)
+	return logger, closer, nil
+}
+
+// OrDefault returns logger, or the default logger when it is nil
+func OrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// parseLevel maps a config level name to a slog level
+func parseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level: %s", level)
+	}
+}
+
+// nopCloser is returned for the standard streams, which must stay open
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// openOutput resolves the configured destination
+func openOutput(output string) (io.Writer, io.Closer, error) {
+	switch strings.ToLower(output) {
+	case "", "stdout":
+		return os.Stdout, nopCloser{}, nil
+	case "stderr":
+		return os.Stderr, nopCloser{}, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return file, file, nil
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// Danmaku represents an archived live chat message
+type Danmaku struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Platform  string    `gorm:"size:32" json:"platform"`
+	RoomID    string    `gorm:"index:idx_danmaku_room_time;size:64" json:"room_id"`
+	UserID    string    `gorm:"size:64" json:"user_id"`
+	Username  string    `gorm:"size:128" json:"username"`
+	Content   string    `gorm:"type:text" json:"content"`
+	GiftValue int       `json:"gift_value"`
+	Timestamp time.Time `gorm:"index:idx_danmaku_room_time" json:"timestamp"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,137 @@
+package prompts
+
+import "strings"
+
+// DefaultLanguage is the story language the unscoped built-in templates are written in
+const DefaultLanguage = "zh"
+
+// ScopedName names the variant of a template for a language, e.g. story_continuation@en.
+// Template dir files named this way add or override a language variant.
+func ScopedName(name, lang string) string {
+	return name + "@" + lang
+}
+
+// NormalizeLanguage lowercases a language tag and drops its region, so zh-CN and en_US
+// become zh and en; an empty tag is DefaultLanguage
+func NormalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "" {
+		return DefaultLanguage
+	}
+	return lang
+}
+
+// Resolve returns the template to render for name in a story language: the language's
+// variant when one is registered, otherwise name itself
+func (e *TemplateEngine) Resolve(name, lang string) string {
+	lang = NormalizeLanguage(lang)
+	if lang == DefaultLanguage {
+		return name
+	}
+
+	scoped := ScopedName(name, lang)
+	e.mu.RLock()
+	_, ok := e.templates[scoped]
+	e.mu.RUnlock()
+	if ok {
+		return scoped
+	}
+	return name
+}
+
+// SupportsLanguage reports whether stories can be told in lang, which needs a
+// story_continuation variant for any language but the default
+func (e *TemplateEngine) SupportsLanguage(lang string) bool {
+	lang = NormalizeLanguage(lang)
+	return lang == DefaultLanguage || e.Resolve("story_continuation", lang) != "story_continuation"
+}
+
+// englishTemplates are the en variants of the templates a story turn renders
+func englishTemplates() []*Template {
+	return []*Template{
+		{
+			Name:        ScopedName("story_continuation", "en"),
+			Description: "Main template for continuing the story, in English",
+			Content: `You are a novelist steeped in the wuxia tradition of Jin Yong and Gu Long, writing an interactive tale of the jianghu.
+
+{{#if story_summary}}
+## Story so far
+{{story_summary}}
+
+{{/if}}
+## Current scene
+{{current_scene}}
+
+{{#if npcs}}
+## Characters present
+{{npcs}}
+
+{{/if}}
+{{#if previous_text}}
+## Previous passage
+{{previous_text}}
+
+{{/if}}
+## Player action
+{{player_action}}
+
+{{#if npc_dialogue}}
+## Character response
+{{npc_dialogue}}
+
+{{/if}}
+{{#if related_memories}}
+## Related memories
+{{related_memories}}
+
+{{/if}}
+{{#if related_decisions}}
+## Related decisions
+{{related_decisions}}
+
+{{/if}}
+## Writing requirements
+1. Write in English, in the voice and imagery of classic wuxia fiction
+2. Never use modern technology or its vocabulary: neon, microchips, machines, electronics, AI, virtual anything
+3. Never introduce cyberpunk, science fiction, futuristic or high-tech concepts
+4. Set scenes with classical elements: old roads, inns, teahouses, temples, caves, bamboo groves, martial sects
+5. Arm characters with classical weapons: sabres, swords, staffs, whips, fans, hidden darts; no energy blades, lasers or railguns
+6. Give dialogue a formal, old-world register, with forms of address such as "young hero", "sir", "this humble one", "miss", "Daoist master"
+7. Describe {{protagonist}}'s actions and reactions in keeping with their character
+8. Weave in the surroundings of the current scene
+9. Answer the player's action with a plausible turn of the plot
+10. Keep a {{tone}} tone
+11. Keep it to 200-350 words
+12. End with 2-3 actions for the player to choose from, formatted as A. B. C.
+13. When the story opens or moves to a new place, write [Scene: scene name] alone on the first line (e.g. [Scene: Yuelai Inn]); leave it out when the scene has not changed
+
+Continue the story:`,
+			Variables: []string{"story_summary", "current_scene", "npcs", "previous_text", "player_action", "npc_dialogue", "related_memories", "related_decisions", "protagonist", "genre", "tone"},
+			Optional:  []string{"story_summary", "npcs", "previous_text", "npc_dialogue", "related_memories", "related_decisions"},
+		},
+		{
+			Name:        ScopedName("image_generation", "en"),
+			Description: "Template for generating image prompts for English stories",
+			Content: `Generate a detailed image prompt for a wuxia style scene.
+
+Scene: {{scene_description}}
+Style: {{style}}
+Characters: {{characters}}
+Mood: {{mood}}
+Time of day: {{time_of_day}}
+Weather: {{weather}}
+
+The image should have:
+- High quality, detailed art style
+- Atmospheric lighting appropriate for the mood
+- Ancient Chinese architecture, costume and landscape
+- Rich background details matching the scene description
+
+Do not include any text in the image.`,
+			Variables: []string{"scene_description", "style", "characters", "mood", "time_of_day", "weather"},
+		},
+	}
+}
@@ -3,16 +3,30 @@ package prompts
 import (
 	"Cyber-Jianghu/server/internal/interfaces"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
 	"strings"
 	"sync"
 )
 
+// ErrMissingVariables is returned by Render when required template variables are empty
+var ErrMissingVariables = errors.New("missing template variables")
+
+// conditionalRegex matches {{#if var}}...{{/if}} blocks (not nested), along with the
+// newline after each tag so a dropped block leaves no blank line behind
+var conditionalRegex = regexp.MustCompile(`(?s)\{\{#if (\w+)\}\}\n?(.*?)\{\{/if\}\}\n?`)
+
 // TemplateEngine manages prompt templates
 type TemplateEngine struct {
 	templates map[string]*Template
+	builtins  map[string]*Template         // Defaults restored when an override file is removed
+	dirFiles  map[string]templateFileState // Override files last loaded from the template dir
+	rejected  map[string]templateFileState // Malformed file versions, so they are logged once
 	mu        sync.RWMutex
+	loadMu    sync.Mutex // Serializes template dir loads
+	logger    *slog.Logger
 }
 
 // Template represents a prompt template with variables
@@ -20,6 +34,7 @@ type Template struct {
 	Name        string            `json:"name"`
 	Content     string            `json:"content"`
 	Variables   []string          `json:"variables"`
+	Optional    []string          `json:"optional,omitempty"` // Variables that may render empty in strict mode
 	Description string            `json:"description"`
 }
 
@@ -62,9 +77,18 @@ type ImagePromptContext struct {
 func NewTemplateEngine() *TemplateEngine {
 	return &TemplateEngine{
 		templates: make(map[string]*Template),
+		builtins:  make(map[string]*Template),
+		dirFiles:  make(map[string]templateFileState),
+		rejected:  make(map[string]templateFileState),
+		logger:    slog.Default().With("component", "prompts"),
 	}
 }
 
+// SetLogger sets the structured logger; call it before loading or watching a template dir
+func (e *TemplateEngine) SetLogger(logger *slog.Logger) {
+	e.logger = logger.With("component", "prompts")
+}
+
 // RegisterTemplate registers a new template
 func (e *TemplateEngine) RegisterTemplate(tmpl *Template) error {
 	e.mu.Lock()
@@ -86,19 +110,53 @@ func (e *TemplateEngine) GetTemplate(name string) (*Template, error) {
 	return tmpl, nil
 }
 
-// Render renders a template with the given context
+// Render renders a template, failing with ErrMissingVariables if any declared variable
+// outside Optional resolves empty. Empty optional variables render as nothing.
 func (e *TemplateEngine) Render(templateName string, ctx *TemplateContext) (string, error) {
 	tmpl, err := e.GetTemplate(templateName)
 	if err != nil {
 		return "", err
 	}
 
-	return e.renderTemplate(tmpl, ctx)
+	if missing := e.missingVariables(tmpl, ctx); len(missing) > 0 {
+		return "", fmt.Errorf("%w in %s: %s", ErrMissingVariables, templateName, strings.Join(missing, ", "))
+	}
+	return e.renderTemplate(tmpl, ctx, true)
 }
 
-// renderTemplate performs the actual template rendering
-func (e *TemplateEngine) renderTemplate(tmpl *Template, ctx *TemplateContext) (string, error) {
-	result := tmpl.Content
+// RenderPartial renders a template leniently, leaving unresolved placeholders in place
+func (e *TemplateEngine) RenderPartial(templateName string, ctx *TemplateContext) (string, error) {
+	tmpl, err := e.GetTemplate(templateName)
+	if err != nil {
+		return "", err
+	}
+
+	return e.renderTemplate(tmpl, ctx, false)
+}
+
+// missingVariables lists the declared, non-optional variables that resolve empty
+func (e *TemplateEngine) missingVariables(tmpl *Template, ctx *TemplateContext) []string {
+	optional := make(map[string]bool, len(tmpl.Optional))
+	for _, name := range tmpl.Optional {
+		optional[name] = true
+	}
+
+	var missing []string
+	for _, name := range tmpl.Variables {
+		if optional[name] {
+			continue
+		}
+		if _, ok := e.getVariableValue(ctx, name); !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// renderTemplate performs the actual template rendering; dropEmpty replaces unresolved
+// placeholders with nothing instead of keeping them
+func (e *TemplateEngine) renderTemplate(tmpl *Template, ctx *TemplateContext, dropEmpty bool) (string, error) {
+	result := e.resolveConditionals(tmpl.Content, ctx)
 
 	// Replace variables in the format {{variable_name}}
 	varRegex := regexp.MustCompile(`\{\{(\w+)\}\}`)
@@ -106,7 +164,7 @@ func (e *TemplateEngine) renderTemplate(tmpl *Template, ctx *TemplateContext) (s
 	result = varRegex.ReplaceAllStringFunc(result, func(match string) string {
 		varName := varRegex.FindStringSubmatch(match)[1]
 		value, ok := e.getVariableValue(ctx, varName)
-		if ok {
+		if ok || dropEmpty {
 			return value
 		}
 		return match // Keep placeholder if not found
@@ -123,6 +181,18 @@ func (e *TemplateEngine) renderTemplate(tmpl *Template, ctx *TemplateContext) (s
 	return result, nil
 }
 
+// resolveConditionals keeps the body of each {{#if var}} block whose variable is set and
+// drops the rest
+func (e *TemplateEngine) resolveConditionals(content string, ctx *TemplateContext) string {
+	return conditionalRegex.ReplaceAllStringFunc(content, func(match string) string {
+		parts := conditionalRegex.FindStringSubmatch(match)
+		if _, ok := e.getVariableValue(ctx, parts[1]); ok {
+			return parts[2]
+		}
+		return ""
+	})
+}
+
 // getVariableValue retrieves a variable value from context
 func (e *TemplateEngine) getVariableValue(ctx *TemplateContext, varName string) (string, bool) {
 	switch varName {
@@ -208,23 +278,42 @@ func (e *TemplateEngine) InitializeDefaultTemplates() error {
 			Description: "Main template for continuing the story",
 			Content: `你是一位深谙金庸武侠风格的专业小说家，正在创作一部纯正的古龙江湖互动小说。
 
+{{#if story_summary}}
 ## 故事背景
 {{story_summary}}
 
+{{/if}}
 ## 当前场景
 {{current_scene}}
 
+{{#if npcs}}
+## 登场人物
+{{npcs}}
+
+{{/if}}
+{{#if previous_text}}
 ## 之前的剧情
 {{previous_text}}
 
+{{/if}}
 ## 玩家的行为
 {{player_action}}
 
-## 相关记忆与决策
+{{#if npc_dialogue}}
+## 人物回应
+{{npc_dialogue}}
+
+{{/if}}
+{{#if related_memories}}
+## 相关记忆
 {{related_memories}}
 
+{{/if}}
+{{#if related_decisions}}
+## 相关决策
 {{related_decisions}}
 
+{{/if}}
 ## 写作要求
 1. 完全使用金庸古龙江湖风格的语言和描写方式
 2. 严禁出现任何现代科技、霓虹、芯片、机械、电子、AI、虚拟等词汇
@@ -238,9 +327,12 @@ func (e *TemplateEngine) InitializeDefaultTemplates() error {
 10. 保持{{tone}}的语调
 11. 控制在300-500字以内
 12. 结尾给出2-3个供玩家选择的行为选项，选项用 A. B. C. 或 ① ② ③ 格式
+13. 若故事开篇或地点发生转换，在正文第一行单独写【场景：场景名】（如【场景：悦来客栈】），场景未变则不写
 
 请继续创作故事：`,
-			Variables: []string{"story_summary", "current_scene", "previous_text", "player_action", "related_memories", "related_decisions", "protagonist", "genre", "tone"},
+			Variables: []string{"story_summary", "current_scene", "npcs", "previous_text", "player_action", "npc_dialogue", "related_memories", "related_decisions", "protagonist", "genre", "tone"},
+			// Empty on the opening turn, before anything has been remembered or when no NPC is involved
+			Optional: []string{"story_summary", "npcs", "previous_text", "npc_dialogue", "related_memories", "related_decisions"},
 		},
 		{
 			Name:        "scene_description",
@@ -300,6 +392,27 @@ NPC角色：{{npc_name}}
 4. 包含情感色彩（{{mood}}）`,
 			Variables: []string{"npc_name", "npc_personality", "npc_speaking_style", "current_situation", "player_action", "genre", "mood"},
 		},
+		{
+			Name:        "npc_extraction",
+			Description: "Template for extracting characters introduced in a story segment",
+			Content: `## 人物提取
+
+{{#if known_npcs}}
+已知人物：{{known_npcs}}
+
+{{/if}}
+主角：{{protagonist}}
+
+剧情：
+{{story_text}}
+
+请找出剧情中登场的人物（不含主角），包括已知人物的关系或性格变化。
+只输出 JSON 数组，不要任何其他文字，每项格式：
+{"name": "姓名或称号", "relation": "与主角关系", "personality": "性格特点", "speaking_style": "说话风格"}
+若没有人物，输出 []`,
+			Variables: []string{"known_npcs", "protagonist", "story_text"},
+			Optional:  []string{"known_npcs"},
+		},
 		{
 			Name:        "decision_summary",
 			Description: "Template for summarizing player decisions",
@@ -313,8 +426,18 @@ NPC角色：{{npc_name}}
 			Variables: []string{"story_node", "player_choice", "choice_reason"},
 		},
 	}
+	templates = append(templates, englishTemplates()...)
 
 	for _, tmpl := range templates {
+		// Templates loaded from the template dir keep precedence over built-ins
+		e.mu.Lock()
+		e.builtins[tmpl.Name] = tmpl
+		overridden := e.overriddenLocked(tmpl.Name)
+		e.mu.Unlock()
+		if overridden {
+			continue
+		}
+
 		if err := e.RegisterTemplate(tmpl); err != nil {
 			return fmt.Errorf("failed to register template %s: %w", tmpl.Name, err)
 		}
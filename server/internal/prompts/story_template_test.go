@@ -0,0 +1,166 @@
+package prompts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newTestTemplateEngine returns an engine holding one template with a required and an optional variable
+func newTestTemplateEngine(t *testing.T) *TemplateEngine {
+	t.Helper()
+	e := NewTemplateEngine()
+	err := e.RegisterTemplate(&Template{
+		Name:      "greeting",
+		Content:   "{{protagonist}}来到{{current_scene}}。{{previous_text}}",
+		Variables: []string{"protagonist", "current_scene", "previous_text"},
+		Optional:  []string{"previous_text"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterTemplate: %v", err)
+	}
+	return e
+}
+
+func TestRenderStrict(t *testing.T) {
+	e := newTestTemplateEngine(t)
+
+	got, err := e.Render("greeting", &TemplateContext{Protagonist: "李逍遥", CurrentScene: "客栈"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if got != "李逍遥来到客栈。" {
+		t.Errorf("rendered %q, want the empty optional variable dropped", got)
+	}
+
+	_, err = e.Render("greeting", &TemplateContext{PreviousText: "夜雨"})
+	if !errors.Is(err, ErrMissingVariables) {
+		t.Fatalf("Render with missing variables = %v, want ErrMissingVariables", err)
+	}
+	for _, name := range []string{"protagonist", "current_scene"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not name %s", err, name)
+		}
+	}
+	if strings.Contains(err.Error(), "previous_text") {
+		t.Errorf("error %q names the optional variable", err)
+	}
+}
+
+func TestRenderPartialKeepsPlaceholders(t *testing.T) {
+	e := newTestTemplateEngine(t)
+
+	got, err := e.RenderPartial("greeting", &TemplateContext{Protagonist: "李逍遥"})
+	if err != nil {
+		t.Fatalf("RenderPartial: %v", err)
+	}
+	if got != "李逍遥来到{{current_scene}}。{{previous_text}}" {
+		t.Errorf("rendered %q, want unresolved placeholders kept", got)
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	e := NewTemplateEngine()
+	if _, err := e.Render("missing", &TemplateContext{}); err == nil || errors.Is(err, ErrMissingVariables) {
+		t.Errorf("Render of an unknown template = %v, want a not found error", err)
+	}
+}
+
+func TestRenderStoryContinuationOpeningTurn(t *testing.T) {
+	e := NewTemplateEngine()
+	if err := e.InitializeDefaultTemplates(); err != nil {
+		t.Fatalf("InitializeDefaultTemplates: %v", err)
+	}
+
+	// The opening turn has no summary, previous text, memories or decisions yet
+	ctx := &TemplateContext{CurrentScene: "华山", PlayerAction: "拔剑", Protagonist: "令狐冲", Genre: "武侠", Tone: "豪迈"}
+	got, err := e.Render("story_continuation", ctx)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if strings.Contains(got, "{{") {
+		t.Errorf("prompt keeps a placeholder:\n%s", got)
+	}
+
+	ctx.PlayerAction = ""
+	if _, err := e.Render("story_continuation", ctx); !errors.Is(err, ErrMissingVariables) {
+		t.Errorf("Render without a player action = %v, want ErrMissingVariables", err)
+	}
+}
+
+func TestRenderConditionalSections(t *testing.T) {
+	e := NewTemplateEngine()
+	err := e.RegisterTemplate(&Template{
+		Name:      "scene",
+		Content:   "## 场景\n{{current_scene}}\n{{#if story_summary}}\n## 背景\n{{story_summary}}\n{{/if}}\n## 行动\n{{player_action}}",
+		Variables: []string{"current_scene", "story_summary", "player_action"},
+		Optional:  []string{"story_summary"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterTemplate: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		summary string
+		want    string
+	}{
+		{"present", "少林寺被围", "## 场景\n山门\n## 背景\n少林寺被围\n## 行动\n闯山"},
+		{"absent", "", "## 场景\n山门\n## 行动\n闯山"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &TemplateContext{CurrentScene: "山门", PlayerAction: "闯山", StorySummary: tt.summary}
+			for _, render := range []func(string, *TemplateContext) (string, error){e.Render, e.RenderPartial} {
+				got, err := render("scene", ctx)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("rendered %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderConditionalCustomVariable(t *testing.T) {
+	e := NewTemplateEngine()
+	if err := e.RegisterTemplate(&Template{Name: "weather", Content: "夜{{#if rain}}，{{rain}}{{/if}}。"}); err != nil {
+		t.Fatalf("RegisterTemplate: %v", err)
+	}
+
+	if got, _ := e.Render("weather", &TemplateContext{Custom: map[string]string{"rain": "雨打芭蕉"}}); got != "夜，雨打芭蕉。" {
+		t.Errorf("with rain rendered %q", got)
+	}
+	if got, _ := e.Render("weather", &TemplateContext{}); got != "夜。" {
+		t.Errorf("without rain rendered %q", got)
+	}
+}
+
+func TestStoryContinuationDropsEmptySections(t *testing.T) {
+	e := NewTemplateEngine()
+	if err := e.InitializeDefaultTemplates(); err != nil {
+		t.Fatalf("InitializeDefaultTemplates: %v", err)
+	}
+	ctx := &TemplateContext{CurrentScene: "华山", PlayerAction: "拔剑", Protagonist: "令狐冲", Genre: "武侠", Tone: "豪迈"}
+
+	opening, err := e.Render("story_continuation", ctx)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	for _, heading := range []string{"## 故事背景", "## 之前的剧情", "## 相关记忆", "## 相关决策"} {
+		if strings.Contains(opening, heading) {
+			t.Errorf("opening prompt has the empty section %s", heading)
+		}
+	}
+
+	ctx.RelatedMemories = "[npc] 岳不群"
+	later, err := e.Render("story_continuation", ctx)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(later, "## 相关记忆\n[npc] 岳不群") || strings.Contains(later, "## 相关决策") {
+		t.Errorf("prompt with memories only:\n%s", later)
+	}
+}
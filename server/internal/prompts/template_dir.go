@@ -0,0 +1,189 @@
+package prompts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// templateFileState identifies the version of an override file that was last loaded
+type templateFileState struct {
+	name    string
+	modTime time.Time
+	size    int64
+}
+
+// sameVersion reports whether two states describe the same file contents
+func (s templateFileState) sameVersion(other templateFileState) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size
+}
+
+// LoadFromDir registers every *.json template in dir, overriding built-ins of the same
+// name. Unchanged files are skipped, and a removed file restores the built-in it
+// replaced. Malformed files are logged and skipped. It returns how many templates were
+// registered or restored.
+func (e *TemplateEngine) LoadFromDir(dir string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list template dir: %w", err)
+	}
+	// A missing dir counts as empty, so removing it restores every built-in
+	if _, err := os.Stat(dir); err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read template dir: %w", err)
+	}
+	sort.Strings(paths)
+
+	e.loadMu.Lock()
+	defer e.loadMu.Unlock()
+
+	changed := 0
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		seen[path] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			e.logger.Warn("skipping template", "path", path, "error", err)
+			continue
+		}
+
+		current := templateFileState{modTime: info.ModTime(), size: info.Size()}
+		e.mu.RLock()
+		prev, loaded := e.dirFiles[path]
+		bad, rejected := e.rejected[path]
+		e.mu.RUnlock()
+		if (loaded && prev.sameVersion(current)) || (rejected && bad.sameVersion(current)) {
+			continue
+		}
+
+		// A broken edit keeps the previously loaded version in place
+		tmpl, err := readTemplateFile(path)
+		if err != nil {
+			e.logger.Warn("skipping template", "path", path, "error", err)
+			e.mu.Lock()
+			e.rejected[path] = current
+			e.mu.Unlock()
+			continue
+		}
+
+		e.mu.Lock()
+		delete(e.rejected, path)
+		inheritOptional(tmpl, e.builtins[tmpl.Name])
+		if loaded && prev.name != tmpl.Name {
+			e.restoreLocked(path, prev.name)
+		}
+		e.templates[tmpl.Name] = tmpl
+		current.name = tmpl.Name
+		e.dirFiles[path] = current
+		e.mu.Unlock()
+
+		e.logger.Info("loaded template", "template", tmpl.Name, "path", path)
+		changed++
+	}
+
+	// Files that disappeared hand their name back to the built-in, if any
+	e.mu.Lock()
+	for path := range e.rejected {
+		if !seen[path] {
+			delete(e.rejected, path)
+		}
+	}
+	for path, state := range e.dirFiles {
+		if seen[path] || filepath.Dir(path) != filepath.Clean(dir) {
+			continue
+		}
+		e.restoreLocked(path, state.name)
+		e.logger.Info("template file removed", "template", state.name, "path", path)
+		changed++
+	}
+	e.mu.Unlock()
+
+	return changed, nil
+}
+
+// WatchDir reloads the template dir every interval until ctx is done
+func (e *TemplateEngine) WatchDir(ctx context.Context, dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := e.LoadFromDir(dir); err != nil {
+				e.logger.Error("template dir reload failed", "dir", dir, "error", err)
+			}
+		}
+	}
+}
+
+// restoreLocked forgets an override file and reinstates the built-in it shadowed, unless
+// another override file still provides the name; callers must hold mu
+func (e *TemplateEngine) restoreLocked(path, name string) {
+	delete(e.dirFiles, path)
+	if e.overriddenLocked(name) {
+		return
+	}
+	if builtin, ok := e.builtins[name]; ok {
+		e.templates[name] = builtin
+	} else {
+		delete(e.templates, name)
+	}
+}
+
+// overriddenLocked reports whether a loaded override file provides name; callers must hold mu
+func (e *TemplateEngine) overriddenLocked(name string) bool {
+	for _, state := range e.dirFiles {
+		if state.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// inheritOptional gives an override that lists no optional variables the built-in's,
+// limited to variables the override still uses
+func inheritOptional(tmpl, builtin *Template) {
+	if tmpl.Optional != nil || builtin == nil {
+		return
+	}
+	declared := make(map[string]bool, len(tmpl.Variables))
+	for _, name := range tmpl.Variables {
+		declared[name] = true
+	}
+	for _, name := range builtin.Optional {
+		if declared[name] {
+			tmpl.Optional = append(tmpl.Optional, name)
+		}
+	}
+}
+
+// readTemplateFile parses a template file; the name defaults to the file name and the
+// variables to those found in the content
+func readTemplateFile(path string) (*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpl Template
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal template: %w", err)
+	}
+	if strings.TrimSpace(tmpl.Content) == "" {
+		return nil, fmt.Errorf("template has no content")
+	}
+	if tmpl.Name == "" {
+		tmpl.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(tmpl.Variables) == 0 {
+		tmpl.Variables = ParseTemplateVariables(tmpl.Content)
+	}
+	return &tmpl, nil
+}
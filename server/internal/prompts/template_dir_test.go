@@ -0,0 +1,56 @@
+package prompts
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFromDirLogsThroughLogger(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "greeting.json")
+	bad := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(good, []byte(`{"content": "{{protagonist}}拔剑四顾"}`), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	if err := os.WriteFile(bad, []byte(`{"content": `), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	var logs bytes.Buffer
+	e := NewTemplateEngine()
+	e.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	changed, err := e.LoadFromDir(dir)
+	if err != nil {
+		t.Fatalf("LoadFromDir: %v", err)
+	}
+	if changed != 1 {
+		t.Errorf("changed = %d, want 1", changed)
+	}
+	if _, err := e.GetTemplate("greeting"); err != nil {
+		t.Errorf("greeting not loaded: %v", err)
+	}
+
+	for _, want := range []string{
+		`level=INFO msg="loaded template" component=prompts template=greeting path=` + good,
+		`level=WARN msg="skipping template" component=prompts path=` + bad,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs missing %q:\n%s", want, logs.String())
+		}
+	}
+
+	// A removed override is logged with the template it provided
+	os.Remove(good)
+	logs.Reset()
+	if _, err := e.LoadFromDir(dir); err != nil {
+		t.Fatalf("LoadFromDir: %v", err)
+	}
+	if want := `msg="template file removed" component=prompts template=greeting path=` + good; !strings.Contains(logs.String(), want) {
+		t.Errorf("logs missing %q:\n%s", want, logs.String())
+	}
+}
@@ -0,0 +1,78 @@
+package rag
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Distance metrics a collection can be searched with, named as in Qdrant
+const (
+	DistanceCosine = "Cosine"
+	DistanceEuclid = "Euclid"
+	DistanceDot    = "Dot"
+)
+
+// relatedScoreThreshold is the minimum cosine similarity for a memory to count as related
+const relatedScoreThreshold = 0.7
+
+// ValidateDistance rejects metric names other than Cosine, Euclid and Dot
+func ValidateDistance(distance string) error {
+	switch distance {
+	case DistanceCosine, DistanceEuclid, DistanceDot:
+		return nil
+	}
+	return fmt.Errorf("unknown distance metric %q (want %s, %s or %s)", distance, DistanceCosine, DistanceEuclid, DistanceDot)
+}
+
+// LowerIsBetter reports whether smaller scores mean closer vectors under distance, which
+// is true only for Euclid
+func LowerIsBetter(distance string) bool {
+	return distance == DistanceEuclid
+}
+
+// ScoreVectors scores vector against query under distance; an empty distance is Cosine
+func ScoreVectors(distance string, query, vector []float64) (float64, error) {
+	switch distance {
+	case DistanceEuclid:
+		return CalculateEuclideanDistance(query, vector)
+	case DistanceDot:
+		return CalculateDotProduct(query, vector)
+	default:
+		return CalculateCosineSimilarity(query, vector)
+	}
+}
+
+// passesThreshold reports whether score is within threshold under distance. Euclid
+// scores must not exceed a positive threshold; other scores must reach it.
+func passesThreshold(distance string, score, threshold float64) bool {
+	if LowerIsBetter(distance) {
+		return threshold <= 0 || score <= threshold
+	}
+	return score >= threshold
+}
+
+// RelatedScoreThreshold converts the cosine threshold for related memories to distance.
+// Embeddings are unit length, so dot product equals cosine similarity and the Euclidean
+// distance for cosine c is sqrt(2 - 2c).
+func RelatedScoreThreshold(distance string) float64 {
+	if LowerIsBetter(distance) {
+		return math.Sqrt(2 - 2*relatedScoreThreshold)
+	}
+	return relatedScoreThreshold
+}
+
+// scoreBetter reports whether score a ranks ahead of score b under distance
+func scoreBetter(distance string, a, b float64) bool {
+	if LowerIsBetter(distance) {
+		return a < b
+	}
+	return a > b
+}
+
+// sortResults orders search results best first under distance
+func sortResults(distance string, results []*SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return scoreBetter(distance, results[i].Score, results[j].Score)
+	})
+}
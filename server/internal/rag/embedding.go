@@ -3,11 +3,17 @@ package rag
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"math"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,23 +22,33 @@ const (
 	// GLM embedding models
 	embeddingV3       = "embedding-3"
 	embeddingV2      = "embedding-2"
+	defaultBaseURL   = "https://open.bigmodel.cn/api/paas/v4"
 	cacheTTL         = 24 * time.Hour
-	embeddingDim     = 1024 // GLM-5 embedding dimension
+	embeddingDim     = 1024 // Fallback embedding dimension for unknown models
 	defaultTimeout   = 30 * time.Second
 	maxRetries       = 3
 	retryDelay       = 1 * time.Second
 )
 
-// EmbeddingCache stores cached embeddings
+// modelDimensions maps embedding models to the vector size they return
+var modelDimensions = map[string]int{
+	embeddingV2: 1024,
+	embeddingV3: 2048,
+}
+
+// EmbeddingCache stores cached embeddings, optionally mirrored to disk
 type EmbeddingCache struct {
-	cache map[string]*CachedEmbedding
-	mu    sync.RWMutex
+	cache     map[string]*CachedEmbedding
+	directory string // Empty for memory-only caching
+	mu        sync.RWMutex
 }
 
 // CachedEmbedding holds a cached embedding with expiration
 type CachedEmbedding struct {
-	Vector    []float64
-	CreatedAt time.Time
+	Model     string    `json:"model"`
+	Text      string    `json:"text"`
+	Vector    []float64 `json:"vector"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // EmbeddingService handles text embedding generation and caching
@@ -45,10 +61,15 @@ type EmbeddingService struct {
 	client    *http.Client
 }
 
-// NewEmbeddingService creates a new embedding service
-func NewEmbeddingService(apiKey string) *EmbeddingService {
+// NewEmbeddingService creates a new embedding service; an empty baseURL uses the Zhipu endpoint
+func NewEmbeddingService(apiKey string, baseURL string) *EmbeddingService {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
 	return &EmbeddingService{
-		baseURL:   "https://open.bigmodel.cn/api/paas/v4",
+		baseURL:   baseURL,
 		apiKey:    apiKey,
 		cache:     &EmbeddingCache{cache: make(map[string]*CachedEmbedding)},
 		model:     embeddingV3,
@@ -57,9 +78,33 @@ func NewEmbeddingService(apiKey string) *EmbeddingService {
 	}
 }
 
-// SetModel sets the embedding model to use
+// NewEmbeddingServiceWithCacheDir creates an embedding service whose cache persists to dir.
+// Existing entries are loaded on startup and expired files are removed.
+func NewEmbeddingServiceWithCacheDir(apiKey string, baseURL string, dir string) (*EmbeddingService, error) {
+	service := NewEmbeddingService(apiKey, baseURL)
+	service.cache.directory = dir
+
+	if err := service.cache.load(); err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// SetModel sets the embedding model to use; an empty model keeps the current one.
+// Cached vectors are per model, so switching never serves another model's vectors.
 func (s *EmbeddingService) SetModel(model string) {
-	s.model = model
+	if model != "" {
+		s.model = model
+	}
+}
+
+// Dimension returns the vector size produced by the current model
+func (s *EmbeddingService) Dimension() int {
+	if dim, ok := modelDimensions[s.model]; ok {
+		return dim
+	}
+	return embeddingDim
 }
 
 // Embed generates embedding for a single text
@@ -117,7 +162,7 @@ func (s *EmbeddingService) EmbedBatch(ctx context.Context, texts []string) ([][]
 	for i, idx := range uncachedIndices {
 		cachedVectors[idx] = newVectors[i]
 		// Cache the result
-		s.cache.Put(uncachedTexts[i], newVectors[i])
+		s.cache.Put(s.model, uncachedTexts[i], newVectors[i])
 	}
 
 	return cachedVectors, nil
@@ -242,7 +287,7 @@ func (s *EmbeddingService) getFromCache(text string) ([]float64, bool) {
 	s.cache.mu.RLock()
 	defer s.cache.mu.RUnlock()
 
-	cached, ok := s.cache.cache[text]
+	cached, ok := s.cache.cache[cacheKey(s.model, text)]
 	if !ok {
 		return nil, false
 	}
@@ -255,15 +300,91 @@ func (s *EmbeddingService) getFromCache(text string) ([]float64, bool) {
 	return cached.Vector, true
 }
 
-// Put caches an embedding
-func (c *EmbeddingCache) Put(text string, vector []float64) {
+// Put caches the embedding model produced for text
+func (c *EmbeddingCache) Put(model string, text string, vector []float64) {
+	entry := &CachedEmbedding{
+		Model:     model,
+		Text:      text,
+		Vector:    vector,
+		CreatedAt: time.Now(),
+	}
+
+	c.mu.Lock()
+	c.cache[cacheKey(model, text)] = entry
+	directory := c.directory
+	c.mu.Unlock()
+
+	if directory != "" {
+		if err := writeCacheFile(directory, entry); err != nil {
+			log.Printf("[Embedding] Failed to persist cache entry: %v", err)
+		}
+	}
+}
+
+// load reads cached embeddings from disk, removing expired or unreadable files
+func (c *EmbeddingCache) load() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.cache[text] = &CachedEmbedding{
-		Vector:    vector,
-		CreatedAt: time.Now(),
+	if err := os.MkdirAll(c.directory, 0755); err != nil {
+		return fmt.Errorf("failed to create embedding cache directory: %w", err)
+	}
+
+	files, err := os.ReadDir(c.directory)
+	if err != nil {
+		return fmt.Errorf("failed to read embedding cache directory: %w", err)
 	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(c.directory, file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		// Entries written before the model was recorded can't be attributed to one
+		var entry CachedEmbedding
+		if err := json.Unmarshal(data, &entry); err != nil || entry.Text == "" || entry.Model == "" {
+			_ = os.Remove(path)
+			continue
+		}
+
+		// Evict expired entries
+		if time.Since(entry.CreatedAt) > cacheTTL {
+			_ = os.Remove(path)
+			continue
+		}
+
+		c.cache[cacheKey(entry.Model, entry.Text)] = &entry
+	}
+
+	return nil
+}
+
+// writeCacheFile writes an embedding to its MD5-keyed file
+func writeCacheFile(directory string, entry *CachedEmbedding) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding: %w", err)
+	}
+
+	return os.WriteFile(cacheFilePath(directory, entry.Model, entry.Text), data, 0644)
+}
+
+// cacheKey identifies the embedding of text by model; models differ in dimension and
+// vector space, so the same text is cached once per model
+func cacheKey(model string, text string) string {
+	return model + "\x00" + text
+}
+
+// cacheFilePath returns the on-disk path for the embedding of text by model
+func cacheFilePath(directory string, model string, text string) string {
+	hash := md5.Sum([]byte(cacheKey(model, text)))
+	return filepath.Join(directory, hex.EncodeToString(hash[:])+".json")
 }
 
 // ClearCache clears the embedding cache
@@ -272,6 +393,13 @@ func (s *EmbeddingService) ClearCache() {
 	defer s.cache.mu.Unlock()
 
 	s.cache.cache = make(map[string]*CachedEmbedding)
+
+	if s.cache.directory != "" {
+		files, _ := filepath.Glob(filepath.Join(s.cache.directory, "*.json"))
+		for _, file := range files {
+			_ = os.Remove(file)
+		}
+	}
 }
 
 // GetCacheSize returns the number of cached embeddings
@@ -382,6 +510,7 @@ func IsValidVector(vector []float64) bool {
 // EmbeddingStats holds statistics about the embedding service
 type EmbeddingStats struct {
 	CacheSize    int
+	DiskEntries  int
 	Model        string
 	EmbeddingDim int
 	BatchSize    int
@@ -391,12 +520,30 @@ type EmbeddingStats struct {
 func (s *EmbeddingService) GetStats() *EmbeddingStats {
 	return &EmbeddingStats{
 		CacheSize:    s.GetCacheSize(),
+		DiskEntries:  s.getDiskEntryCount(),
 		Model:        s.model,
-		EmbeddingDim: embeddingDim,
+		EmbeddingDim: s.Dimension(),
 		BatchSize:    s.batchSize,
 	}
 }
 
+// getDiskEntryCount counts embeddings persisted in the cache directory
+func (s *EmbeddingService) getDiskEntryCount() int {
+	s.cache.mu.RLock()
+	directory := s.cache.directory
+	s.cache.mu.RUnlock()
+
+	if directory == "" {
+		return 0
+	}
+
+	files, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	if err != nil {
+		return 0
+	}
+	return len(files)
+}
+
 // EmbeddingRequest represents an embedding request
 type EmbeddingRequest struct {
 	Input []string `json:"input"`
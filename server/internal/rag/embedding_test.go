@@ -0,0 +1,168 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingServiceUsesConfiguredBaseURL(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/proxy/v4/embeddings" || r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("request to %q with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+			Model string   `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Input) != 1 || req.Model != embeddingV3 {
+			t.Errorf("request body %+v, err %v", req, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"embedding":[3,4],"index":0}]}`))
+	}))
+	defer server.Close()
+
+	svc := NewEmbeddingService("test-key", server.URL+"/proxy/v4/")
+	vec, err := svc.Embed(context.Background(), "华山论剑")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vec) != 2 || math.Abs(vec[0]-0.6) > 1e-9 || math.Abs(vec[1]-0.8) > 1e-9 {
+		t.Errorf("vector = %v, want the normalized [0.6 0.8]", vec)
+	}
+
+	// A second lookup is served from the cache
+	if _, err := svc.Embed(context.Background(), "华山论剑"); err != nil {
+		t.Fatalf("cached Embed: %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+}
+
+func TestNewEmbeddingServiceDefaultBaseURL(t *testing.T) {
+	if got := NewEmbeddingService("key", "").baseURL; got != defaultBaseURL {
+		t.Errorf("empty base URL gave %q, want %q", got, defaultBaseURL)
+	}
+}
+
+// newModelEchoServer answers embedding calls with a vector that depends on the requested
+// model and records the model of each call
+func newModelEchoServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		models = append(models, req.Model)
+		mu.Unlock()
+
+		embedding := `[1,0]`
+		if req.Model == embeddingV2 {
+			embedding = `[0,1]`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"embedding":` + embedding + `,"index":0}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), models...)
+	}
+}
+
+func TestEmbeddingCacheIsPerModel(t *testing.T) {
+	server, models := newModelEchoServer(t)
+	svc := NewEmbeddingService("key", server.URL)
+	ctx := context.Background()
+
+	v3, err := svc.Embed(ctx, "华山论剑")
+	if err != nil {
+		t.Fatalf("Embed with %s: %v", embeddingV3, err)
+	}
+	svc.SetModel(embeddingV2)
+	v2, err := svc.Embed(ctx, "华山论剑")
+	if err != nil {
+		t.Fatalf("Embed with %s: %v", embeddingV2, err)
+	}
+	if v2[1] != 1 || v3[0] != 1 {
+		t.Errorf("%s gave %v and %s gave %v; a model was served the other's vector", embeddingV3, v3, embeddingV2, v2)
+	}
+
+	// Both embeddings are cached side by side
+	svc.SetModel(embeddingV3)
+	if vec, err := svc.Embed(ctx, "华山论剑"); err != nil || vec[0] != 1 {
+		t.Errorf("cached %s Embed = %v, %v", embeddingV3, vec, err)
+	}
+	if got := models(); len(got) != 2 || got[0] != embeddingV3 || got[1] != embeddingV2 {
+		t.Errorf("server saw models %v, want one call each for %s and %s", got, embeddingV3, embeddingV2)
+	}
+
+	svc.SetModel("")
+	if got := svc.GetStats().Model; got != embeddingV3 {
+		t.Errorf("SetModel(\"\") changed the model to %q", got)
+	}
+}
+
+func TestEmbeddingDiskCacheIsPerModel(t *testing.T) {
+	server, models := newModelEchoServer(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// A file from before the model was recorded is dropped on load
+	legacy := filepath.Join(dir, "legacy.json")
+	data, _ := json.Marshal(map[string]interface{}{"text": "华山论剑", "vector": []float64{0, 1}, "created_at": time.Now()})
+	if err := os.WriteFile(legacy, data, 0644); err != nil {
+		t.Fatalf("write legacy entry: %v", err)
+	}
+
+	first, err := NewEmbeddingServiceWithCacheDir("key", server.URL, dir)
+	if err != nil {
+		t.Fatalf("NewEmbeddingServiceWithCacheDir: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("cache entry without a model was kept: %v", err)
+	}
+	if _, err := first.Embed(ctx, "华山论剑"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	// A restart with another model must not load the first model's vector
+	second, err := NewEmbeddingServiceWithCacheDir("key", server.URL, dir)
+	if err != nil {
+		t.Fatalf("NewEmbeddingServiceWithCacheDir: %v", err)
+	}
+	second.SetModel(embeddingV2)
+	if vec, err := second.Embed(ctx, "华山论剑"); err != nil || vec[1] != 1 {
+		t.Errorf("%s Embed after restart = %v, %v, want its own vector", embeddingV2, vec, err)
+	}
+	second.SetModel(embeddingV3)
+	if vec, err := second.Embed(ctx, "华山论剑"); err != nil || vec[0] != 1 {
+		t.Errorf("%s Embed after restart = %v, %v, want the cached vector", embeddingV3, vec, err)
+	}
+
+	if got := models(); len(got) != 2 || got[1] != embeddingV2 {
+		t.Errorf("server saw models %v, want %s once from the disk cache miss", got, embeddingV2)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 2 {
+		t.Errorf("cache directory holds %d files, want one per model", len(files))
+	}
+}
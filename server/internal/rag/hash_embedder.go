@@ -0,0 +1,57 @@
+package rag
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+)
+
+// HashEmbedder makes deterministic vectors from character bigrams without calling an
+// embedding API. Texts sharing words score as similar, which is enough for replay and
+// offline runs but not for real retrieval quality.
+type HashEmbedder struct {
+	dimension int
+}
+
+// NewHashEmbedder creates an embedder producing vectors of the given size
+func NewHashEmbedder(dimension int) *HashEmbedder {
+	if dimension <= 0 {
+		dimension = embeddingDim
+	}
+	return &HashEmbedder{dimension: dimension}
+}
+
+// Embed returns the normalized bigram histogram of text
+func (h *HashEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vector := make([]float64, h.dimension)
+	runes := []rune(text)
+	for i := range runes {
+		end := min(i+2, len(runes))
+		hasher := fnv.New32a()
+		hasher.Write([]byte(string(runes[i:end])))
+		vector[hasher.Sum32()%uint32(h.dimension)]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm == 0 {
+		vector[0] = 1 // Empty text still needs a valid unit vector
+		return vector, nil
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector, nil
+}
+
+// EmbedBatch embeds each text in order
+func (h *HashEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i], _ = h.Embed(ctx, text)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,195 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultWriteBatchSize is how many buffered memories trigger an early flush
+	DefaultWriteBatchSize = 32
+	// bufferFlushTimeout bounds a background flush's embedding and insert calls
+	bufferFlushTimeout = 30 * time.Second
+)
+
+// memoryWriteBuffer holds memories waiting to be written in one batch
+type memoryWriteBuffer struct {
+	batchSize int
+	interval  time.Duration
+	pending   []*Memory
+	index     map[string]int // Memory ID -> position in pending
+	full      chan struct{}  // Signals the flush loop that a batch is ready
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// EnableWriteBuffer makes StoreMemoriesBuffered coalesce writes, flushing every interval
+// or as soon as batchSize memories are waiting, whichever comes first. A non-positive
+// batchSize uses DefaultWriteBatchSize. It does nothing if the buffer is already enabled.
+func (s *MemoryStore) EnableWriteBuffer(batchSize int, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultWriteBatchSize
+	}
+
+	s.bufferMu.Lock()
+	defer s.bufferMu.Unlock()
+	if s.buffer != nil {
+		return
+	}
+	s.buffer = &memoryWriteBuffer{
+		batchSize: batchSize,
+		interval:  interval,
+		index:     make(map[string]int),
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.flushLoop(s.buffer)
+}
+
+// StoreMemoriesBuffered queues memories for the next batched write and returns at once.
+// A queued memory replaces one still waiting under the same ID. Without a write buffer
+// the memories are stored before returning, as with StoreMemories.
+func (s *MemoryStore) StoreMemoriesBuffered(ctx context.Context, memories ...*Memory) error {
+	s.bufferMu.Lock()
+	buffer := s.buffer
+	if buffer == nil {
+		s.bufferMu.Unlock()
+		return s.StoreMemories(ctx, memories)
+	}
+
+	for _, memory := range memories {
+		if i, ok := buffer.index[memory.ID]; ok {
+			buffer.pending[i] = memory
+			continue
+		}
+		buffer.index[memory.ID] = len(buffer.pending)
+		buffer.pending = append(buffer.pending, memory)
+	}
+	ready := len(buffer.pending) >= buffer.batchSize
+	s.bufferMu.Unlock()
+
+	if ready {
+		select {
+		case buffer.full <- struct{}{}:
+		default: // A flush is already signalled
+		}
+	}
+	return nil
+}
+
+// remove drops pending memories with the given IDs. Callers hold the store's bufferMu.
+func (b *memoryWriteBuffer) remove(ids []string) {
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if _, ok := b.index[id]; ok {
+			drop[id] = true
+		}
+	}
+	if len(drop) == 0 {
+		return
+	}
+	b.dropWhere(func(memory *Memory) bool { return drop[memory.ID] })
+}
+
+// removeStory drops a story's pending memories and returns how many there were.
+// Callers hold the store's bufferMu.
+func (b *memoryWriteBuffer) removeStory(storyID string) int {
+	return b.dropWhere(func(memory *Memory) bool { return memory.StoryID == storyID })
+}
+
+// dropWhere removes the pending memories drop selects and returns how many it removed
+func (b *memoryWriteBuffer) dropWhere(drop func(*Memory) bool) int {
+	kept := b.pending[:0]
+	removed := 0
+	for _, memory := range b.pending {
+		if drop(memory) {
+			delete(b.index, memory.ID)
+			removed++
+			continue
+		}
+		b.index[memory.ID] = len(kept)
+		kept = append(kept, memory)
+	}
+	// Clear the tail so dropped memories can be collected
+	for i := len(kept); i < len(b.pending); i++ {
+		b.pending[i] = nil
+	}
+	b.pending = kept
+	return removed
+}
+
+// Flush writes every buffered memory now, in batches of the buffer's batch size. Deletes
+// wait until it is done.
+func (s *MemoryStore) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.bufferMu.Lock()
+	buffer := s.buffer
+	if buffer == nil || len(buffer.pending) == 0 {
+		s.bufferMu.Unlock()
+		return nil
+	}
+	pending := buffer.pending
+	batchSize := buffer.batchSize
+	buffer.pending = nil
+	buffer.index = make(map[string]int)
+	s.bufferMu.Unlock()
+
+	var errs []error
+	for start := 0; start < len(pending); start += batchSize {
+		end := min(start+batchSize, len(pending))
+		if err := s.StoreMemories(ctx, pending[start:end]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CloseWriteBuffer stops background flushing and writes whatever is still buffered.
+// Later StoreMemoriesBuffered calls write directly.
+func (s *MemoryStore) CloseWriteBuffer(ctx context.Context) error {
+	s.bufferMu.Lock()
+	buffer := s.buffer
+	s.bufferMu.Unlock()
+	if buffer == nil {
+		return nil
+	}
+
+	close(buffer.stop)
+	<-buffer.done
+	err := s.Flush(ctx)
+
+	s.bufferMu.Lock()
+	s.buffer = nil
+	s.bufferMu.Unlock()
+	return err
+}
+
+// flushLoop flushes the buffer on every tick and whenever a full batch is signalled
+func (s *MemoryStore) flushLoop(buffer *memoryWriteBuffer) {
+	defer close(buffer.done)
+
+	ticker := time.NewTicker(buffer.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-buffer.stop:
+			return
+		case <-ticker.C:
+		case <-buffer.full:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), bufferFlushTimeout)
+		if err := s.Flush(ctx); err != nil {
+			s.logger.Error("buffered memory write failed", "error", err)
+		}
+		cancel()
+	}
+}
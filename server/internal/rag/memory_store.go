@@ -2,8 +2,12 @@ package rag
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,6 +21,9 @@ const (
 	MemoryTypeDecision   MemoryType = "decision"      // 玩家决策
 )
 
+// ErrMemoryNotFound is returned when updating a memory that was never stored
+var ErrMemoryNotFound = errors.New("memory not found")
+
 // Memory represents a stored memory
 type Memory struct {
 	ID        string                 `json:"id"`
@@ -25,6 +32,7 @@ type Memory struct {
 	Timestamp int64                  `json:"timestamp"`
 	StoryID   string                 `json:"story_id"`
 	Metadata  map[string]interface{} `json:"metadata"`
+	Score     float64                `json:"score,omitempty"` // Search score; a distance (lower is closer) for Euclid collections
 	Vector    []float64               `json:"-"`
 }
 
@@ -38,20 +46,37 @@ type DecisionMemory struct {
 
 // MemoryStore manages story memories with vector search
 type MemoryStore struct {
-	qdrantClient *QdrantClient
-	embedding    *EmbeddingService
+	backend      VectorBackend
+	embedding    Embedder
 	collection   string
+
+	bufferMu sync.Mutex
+	buffer   *memoryWriteBuffer // Nil writes StoreMemoriesBuffered calls directly
+	flushMu  sync.Mutex         // Held while a flush writes, so deletes wait for it to land
+
+	logger *slog.Logger
 }
 
-// NewMemoryStore creates a new memory store
-func NewMemoryStore(qdrant *QdrantClient, embedding *EmbeddingService) *MemoryStore {
+// NewMemoryStore creates a memory store on a vector backend, usually a QdrantClient
+func NewMemoryStore(backend VectorBackend, embedding Embedder) *MemoryStore {
 	return &MemoryStore{
-		qdrantClient: qdrant,
+		backend:      backend,
 		embedding:    embedding,
 		collection:   memoryCollectionName,
+		logger:       slog.Default().With("component", "memory"),
 	}
 }
 
+// SetLogger sets the structured logger; call it before enabling the write buffer
+func (s *MemoryStore) SetLogger(logger *slog.Logger) {
+	s.logger = logger.With("component", "memory")
+}
+
+// SetEmbedder replaces the embedder; call it before memories are stored
+func (s *MemoryStore) SetEmbedder(embedding Embedder) {
+	s.embedding = embedding
+}
+
 // StoreMemory stores a memory with its embedding
 func (s *MemoryStore) StoreMemory(ctx context.Context, memory *Memory) error {
 	// Generate embedding
@@ -59,8 +84,124 @@ func (s *MemoryStore) StoreMemory(ctx context.Context, memory *Memory) error {
 	if err != nil {
 		return fmt.Errorf("failed to generate embedding: %w", err)
 	}
+	return s.storeWithVector(ctx, memory, vector)
+}
+
+// storeWithVector stores a memory under an embedding the caller already has
+func (s *MemoryStore) storeWithVector(ctx context.Context, memory *Memory, vector []float64) error {
+	if err := s.validateVector(vector); err != nil {
+		return err
+	}
+
+	// Store in Qdrant
+	return s.backend.InsertPoint(ctx, s.collection, memoryToPoint(memory, vector))
+}
+
+// UpdateMemory replaces a stored memory's content in place, re-embedding it and refreshing
+// its timestamp while keeping its type, story and metadata. It returns ErrMemoryNotFound
+// if no memory has the ID.
+func (s *MemoryStore) UpdateMemory(ctx context.Context, id string, content string) error {
+	return s.updateMemory(ctx, id, map[string]interface{}{"content": content})
+}
+
+// updateMemory merges updates into a stored memory's payload and refreshes its timestamp.
+// A "content" update must be a string and re-embeds the memory; other keys are stored as
+// metadata.
+func (s *MemoryStore) updateMemory(ctx context.Context, id string, updates map[string]interface{}) error {
+	existing, err := s.backend.GetPoint(ctx, s.collection, id)
+	if err != nil {
+		return fmt.Errorf("failed to load memory %s: %w", id, err)
+	}
+	if existing == nil {
+		return fmt.Errorf("%w: %s", ErrMemoryNotFound, id)
+	}
+
+	vector := existing.Vector
+	if raw, ok := updates["content"]; ok {
+		content, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("memory content must be a string, got %T", raw)
+		}
+		vector, err = s.embedding.Embed(ctx, content)
+		if err != nil {
+			return fmt.Errorf("failed to generate embedding: %w", err)
+		}
+		if err := s.validateVector(vector); err != nil {
+			return err
+		}
+	}
+
+	payload := make(map[string]interface{}, len(existing.Payload)+len(updates))
+	for k, v := range existing.Payload {
+		payload[k] = v
+	}
+	for k, v := range updates {
+		payload[k] = v
+	}
+	payload["timestamp"] = time.Now().Unix()
+
+	return s.backend.InsertPoint(ctx, s.collection, &Point{ID: id, Vector: vector, Payload: payload})
+}
+
+// validateVector checks that a vector fits the collection's configured size
+func (s *MemoryStore) validateVector(vector []float64) error {
+	if expected := s.backend.VectorSize(); len(vector) != expected {
+		model := "unknown"
+		if service, ok := s.embedding.(*EmbeddingService); ok {
+			model = service.model
+		}
+		return fmt.Errorf("embedding dimension %d from model %s does not match collection vector size %d",
+			len(vector), model, expected)
+	}
+	return nil
+}
+
+// StoreMemories stores several memories with a single embedding call and a single insert.
+// Memories that fail to embed are reported in the returned error; the rest are still stored.
+func (s *MemoryStore) StoreMemories(ctx context.Context, memories []*Memory) error {
+	if len(memories) == 0 {
+		return nil
+	}
+
+	contents := make([]string, len(memories))
+	for i, memory := range memories {
+		contents[i] = memory.Content
+	}
+
+	vectors, err := s.embedding.EmbedBatch(ctx, contents)
+	if err != nil {
+		// Fall back to per-memory embedding so one bad input doesn't sink the batch
+		vectors = make([][]float64, len(memories))
+		for i, content := range contents {
+			vectors[i], _ = s.embedding.Embed(ctx, content)
+		}
+	}
+
+	var errs []error
+	points := make([]*Point, 0, len(memories))
+	for i, memory := range memories {
+		if i >= len(vectors) || len(vectors[i]) == 0 || !IsValidVector(vectors[i]) {
+			errs = append(errs, fmt.Errorf("memory %s: failed to generate embedding", memory.ID))
+			continue
+		}
+		if err := s.validateVector(vectors[i]); err != nil {
+			errs = append(errs, fmt.Errorf("memory %s: %w", memory.ID, err))
+			continue
+		}
+		points = append(points, memoryToPoint(memory, vectors[i]))
+	}
+
+	if len(points) > 0 {
+		if err := s.backend.InsertPoints(ctx, s.collection, points); err != nil {
+			errs = append(errs, fmt.Errorf("failed to insert memories: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
 
-	// Prepare payload
+// memoryToPoint builds a vector point with the memory fields as payload
+func memoryToPoint(memory *Memory, vector []float64) *Point {
 	payload := map[string]interface{}{
 		"type":      string(memory.Type),
 		"content":   memory.Content,
@@ -73,15 +214,11 @@ func (s *MemoryStore) StoreMemory(ctx context.Context, memory *Memory) error {
 		payload[k] = v
 	}
 
-	// Create point
-	point := &Point{
+	return &Point{
 		ID:      memory.ID,
 		Vector:  vector,
 		Payload: payload,
 	}
-
-	// Store in Qdrant
-	return s.qdrantClient.InsertPoint(ctx, s.collection, point)
 }
 
 // StoreDecision stores a player decision
@@ -90,8 +227,9 @@ func (s *MemoryStore) StoreDecision(ctx context.Context, decision *DecisionMemor
 	return s.StoreMemory(ctx, &decision.Memory)
 }
 
-// SearchRelatedMemories searches for memories related to a query
-func (s *MemoryStore) SearchRelatedMemories(ctx context.Context, query string, limit int, memoryTypes []MemoryType) ([]*Memory, error) {
+// SearchRelatedMemories searches for memories related to a query within a story.
+// Results are sorted by descending score; topK > 0 keeps only the best topK matches.
+func (s *MemoryStore) SearchRelatedMemories(ctx context.Context, storyID string, query string, limit int, topK int, memoryTypes []MemoryType) ([]*Memory, error) {
 	// Generate query embedding
 	queryVector, err := s.embedding.Embed(ctx, query)
 	if err != nil {
@@ -102,11 +240,24 @@ func (s *MemoryStore) SearchRelatedMemories(ctx context.Context, query string, l
 	opts := &SearchOptions{
 		Limit:       limit,
 		WithPayload: true,
-		ScoreThreshold: 0.7, // Only return highly similar results
+		ScoreThreshold: RelatedScoreThreshold(s.backend.Distance(s.collection)), // Only return highly similar results
+	}
+
+	// Keep memories scoped to the requesting story
+	if storyID != "" {
+		opts.Filter = &Filter{
+			Must: []Condition{
+				{
+					Key:   "story_id",
+					Match: storyID,
+					Op:    "match",
+				},
+			},
+		}
 	}
 
 	// Search
-	results, err := s.qdrantClient.Search(ctx, s.collection, queryVector, opts)
+	results, err := s.backend.Search(ctx, s.collection, queryVector, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search memories: %w", err)
 	}
@@ -136,6 +287,16 @@ func (s *MemoryStore) SearchRelatedMemories(ctx context.Context, query string, l
 		memories = append(memories, memory)
 	}
 
+	// Most relevant first
+	distance := s.backend.Distance(s.collection)
+	sort.SliceStable(memories, func(i, j int) bool {
+		return scoreBetter(distance, memories[i].Score, memories[j].Score)
+	})
+
+	if topK > 0 && len(memories) > topK {
+		memories = memories[:topK]
+	}
+
 	return memories, nil
 }
 
@@ -164,7 +325,7 @@ func (s *MemoryStore) SearchRecentDecisions(ctx context.Context, storyID string,
 		}
 	}
 
-	results, err := s.qdrantClient.Search(ctx, s.collection, queryVector, opts)
+	results, err := s.backend.Search(ctx, s.collection, queryVector, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +390,7 @@ func (s *MemoryStore) GetMemoriesByType(ctx context.Context, memoryType MemoryTy
 
 	opts.Filter = &Filter{Must: conditions}
 
-	results, err := s.qdrantClient.Search(ctx, s.collection, queryVector, opts)
+	results, err := s.backend.Search(ctx, s.collection, queryVector, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -248,11 +409,58 @@ func (s *MemoryStore) GetMemoriesByType(ctx context.Context, memoryType MemoryTy
 	return memories, nil
 }
 
-// DeleteMemoriesByStory deletes all memories for a story
-func (s *MemoryStore) DeleteMemoriesByStory(ctx context.Context, storyID string) error {
-	// Note: Qdrant doesn't support filtering in delete directly
-	// We would need to first search for IDs, then delete
-	// For now, this is a simplified implementation
+// DeleteMemoriesByStory deletes all memories for a story, including ones still waiting
+// in the write buffer, and returns how many were removed
+func (s *MemoryStore) DeleteMemoriesByStory(ctx context.Context, storyID string) (int, error) {
+	if storyID == "" {
+		return 0, fmt.Errorf("story ID is required")
+	}
+
+	// Drop buffered memories first, or the next flush would write them back. A flush
+	// already writing is waited for, so its points exist by the time they're deleted.
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.bufferMu.Lock()
+	buffered := 0
+	if s.buffer != nil {
+		buffered = s.buffer.removeStory(storyID)
+	}
+	s.bufferMu.Unlock()
+
+	filter := &Filter{
+		Must: []Condition{
+			{
+				Key:   "story_id",
+				Match: storyID,
+				Op:    "match",
+			},
+		},
+	}
+
+	deleted, err := s.backend.DeleteByFilter(ctx, s.collection, filter)
+	if err != nil {
+		return buffered, fmt.Errorf("failed to delete memories: %w", err)
+	}
+	return buffered + deleted, nil
+}
+
+// DeleteMemories removes memories by ID, including ones still waiting in the write buffer
+func (s *MemoryStore) DeleteMemories(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.bufferMu.Lock()
+	if s.buffer != nil {
+		s.buffer.remove(ids)
+	}
+	s.bufferMu.Unlock()
+
+	if err := s.backend.DeletePoints(ctx, s.collection, ids); err != nil {
+		return fmt.Errorf("failed to delete memories: %w", err)
+	}
 	return nil
 }
 
@@ -269,18 +477,32 @@ func (s *MemoryStore) resultToMemory(result *SearchResult) (*Memory, error) {
 	}
 
 	storyID, _ := result.Payload["story_id"].(string)
-	timestamp, _ := result.Payload["timestamp"].(float64)
 
 	return &Memory{
 		ID:        result.ID,
 		Type:      MemoryType(memType),
 		Content:   content,
-		Timestamp: int64(timestamp),
+		Timestamp: payloadInt64(result.Payload["timestamp"]),
 		StoryID:   storyID,
 		Metadata:  result.Payload,
+		Score:     result.Score,
 	}, nil
 }
 
+// payloadInt64 reads a payload number, which is an int64 as stored and a float64 once it
+// has been through JSON
+func payloadInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
 // MemoryStats holds statistics about stored memories
 type MemoryStats struct {
 	TotalCount      int64                    `json:"total_count"`
@@ -291,7 +513,7 @@ type MemoryStats struct {
 // GetStats returns statistics about stored memories
 func (s *MemoryStore) GetStats(ctx context.Context) (*MemoryStats, error) {
 	// Get collection info
-	info, err := s.qdrantClient.GetCollectionInfo(ctx, s.collection)
+	info, err := s.backend.GetCollectionInfo(ctx, s.collection)
 	if err != nil {
 		return nil, err
 	}
@@ -303,8 +525,13 @@ func (s *MemoryStore) GetStats(ctx context.Context) (*MemoryStats, error) {
 	}, nil
 }
 
-// BuildMemoryID generates a unique memory ID
+// BuildMemoryID generates a memory ID. A story has a single story_state memory, so its ID
+// is stable and storing it again replaces it; other types are append-only and get a
+// unique, time-based ID.
 func BuildMemoryID(memoryType MemoryType, storyID string) string {
+	if memoryType == MemoryTypeStoryState {
+		return fmt.Sprintf("%s_%s", memoryType, storyID)
+	}
 	timestamp := time.Now().UnixNano()
 	return fmt.Sprintf("%s_%s_%d", memoryType, storyID, timestamp)
 }
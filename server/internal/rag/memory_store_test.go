@@ -0,0 +1,171 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestMemoryStore builds a memory store on in-memory vectors and hash embeddings
+func newTestMemoryStore() (*MemoryStore, *InMemoryVectorStore) {
+	vectors := NewInMemoryVectorStore(32)
+	return NewMemoryStore(vectors, NewHashEmbedder(32)), vectors
+}
+
+// storyMemory builds a player action memory for a story
+func storyMemory(id, storyID, content string) *Memory {
+	return &Memory{ID: id, Type: MemoryTypePlayerAction, Content: content, StoryID: storyID, Timestamp: time.Now().Unix()}
+}
+
+func TestDeleteMemoriesByStoryDropsBuffered(t *testing.T) {
+	ctx := context.Background()
+	store, vectors := newTestMemoryStore()
+
+	if err := store.StoreMemories(ctx, []*Memory{storyMemory("a-stored", "a", "拜入华山")}); err != nil {
+		t.Fatalf("StoreMemories: %v", err)
+	}
+
+	// An hour-long interval keeps everything buffered until the explicit Flush below
+	store.EnableWriteBuffer(100, time.Hour)
+	defer store.CloseWriteBuffer(ctx)
+	err := store.StoreMemoriesBuffered(ctx,
+		storyMemory("a-1", "a", "夜探藏经阁"),
+		storyMemory("b-1", "b", "独闯少林"),
+		storyMemory("a-2", "a", "偷学剑法"),
+	)
+	if err != nil {
+		t.Fatalf("StoreMemoriesBuffered: %v", err)
+	}
+
+	deleted, err := store.DeleteMemoriesByStory(ctx, "a")
+	if err != nil {
+		t.Fatalf("DeleteMemoriesByStory: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("deleted = %d, want 3 (one stored, two buffered)", deleted)
+	}
+
+	if err := store.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	results, err := vectors.Scroll(ctx, memoryCollectionName, nil, 10)
+	if err != nil {
+		t.Fatalf("Scroll: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "b-1" {
+		ids := make([]string, len(results))
+		for i, r := range results {
+			ids[i] = r.ID
+		}
+		t.Fatalf("points after flush = %v, want only b-1", ids)
+	}
+}
+
+// gatedVectorStore holds InsertPoints until release is closed, to catch a flush mid-write
+type gatedVectorStore struct {
+	*InMemoryVectorStore
+	inserting chan struct{}
+	release   chan struct{}
+}
+
+func (s *gatedVectorStore) InsertPoints(ctx context.Context, collectionName string, points []*Point) error {
+	close(s.inserting)
+	<-s.release
+	return s.InMemoryVectorStore.InsertPoints(ctx, collectionName, points)
+}
+
+func TestDeleteMemoriesWaitsForInFlightFlush(t *testing.T) {
+	ctx := context.Background()
+	vectors := &gatedVectorStore{
+		InMemoryVectorStore: NewInMemoryVectorStore(32),
+		inserting:           make(chan struct{}),
+		release:             make(chan struct{}),
+	}
+	store := NewMemoryStore(vectors, NewHashEmbedder(32))
+	store.EnableWriteBuffer(100, time.Hour)
+	defer store.CloseWriteBuffer(ctx)
+
+	if err := store.StoreMemoriesBuffered(ctx, storyMemory("turn-1", "a", "拔剑出鞘")); err != nil {
+		t.Fatalf("StoreMemoriesBuffered: %v", err)
+	}
+	flushed := make(chan error, 1)
+	go func() { flushed <- store.Flush(ctx) }()
+	<-vectors.inserting // The memory has left the buffer but is not yet a point
+
+	deleted := make(chan error, 1)
+	go func() { deleted <- store.DeleteMemories(ctx, "turn-1") }()
+	select {
+	case err := <-deleted:
+		t.Fatalf("DeleteMemories returned during the flush (err %v); the point would be written after it", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(vectors.release)
+	if err := <-flushed; err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := <-deleted; err != nil {
+		t.Fatalf("DeleteMemories: %v", err)
+	}
+	if point, err := vectors.GetPoint(ctx, memoryCollectionName, "turn-1"); err == nil && point != nil {
+		t.Fatal("memory deleted during a flush was still written")
+	}
+}
+
+// failingVectorStore rejects every insert
+type failingVectorStore struct {
+	*InMemoryVectorStore
+}
+
+func (s *failingVectorStore) InsertPoints(ctx context.Context, collectionName string, points []*Point) error {
+	return errors.New("disk full")
+}
+
+func TestBufferedWriteFailureIsLogged(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(&failingVectorStore{NewInMemoryVectorStore(32)}, NewHashEmbedder(32))
+	logs := &lockedBuffer{}
+	store.SetLogger(slog.New(slog.NewTextHandler(logs, nil)))
+
+	// A batch of one flushes straight away
+	store.EnableWriteBuffer(1, time.Hour)
+	defer store.CloseWriteBuffer(ctx)
+	if err := store.StoreMemoriesBuffered(ctx, storyMemory("a-1", "a", "拜入华山")); err != nil {
+		t.Fatalf("StoreMemoriesBuffered: %v", err)
+	}
+
+	want := `level=ERROR msg="buffered memory write failed" component=memory error=`
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("logs missing %q:\n%s", want, logs.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !strings.Contains(logs.String(), "disk full") {
+		t.Errorf("logged failure does not carry the cause:\n%s", logs.String())
+	}
+}
+
+// lockedBuffer collects log output written from the flush goroutine
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
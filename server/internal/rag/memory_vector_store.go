@@ -0,0 +1,224 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// InMemoryVectorStore is a VectorBackend kept in a slice per collection and searched
+// linearly with the collection's distance metric. It applies Filter and ScoreThreshold the
+// same way the Qdrant backend does, so a MemoryStore over it behaves like production
+// without a server.
+type InMemoryVectorStore struct {
+	mu          sync.RWMutex
+	collections map[string][]*StoredPoint // Collection name -> points in insertion order
+	vectorSize  int
+	distances   map[string]string // Collection name -> distance metric; unset is Cosine
+}
+
+// NewInMemoryVectorStore creates an empty store for vectors of vectorSize dimensions;
+// a non-positive size uses the default embedding dimension
+func NewInMemoryVectorStore(vectorSize int) *InMemoryVectorStore {
+	if vectorSize <= 0 {
+		vectorSize = defaultVectorSize
+	}
+	return &InMemoryVectorStore{
+		collections: make(map[string][]*StoredPoint),
+		vectorSize:  vectorSize,
+		distances:   make(map[string]string),
+	}
+}
+
+// SetDistance sets the metric a collection is searched with
+func (s *InMemoryVectorStore) SetDistance(collectionName, distance string) error {
+	if err := ValidateDistance(distance); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.distances[collectionName] = distance
+	return nil
+}
+
+// Distance returns the metric a collection is searched with
+func (s *InMemoryVectorStore) Distance(collectionName string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if distance, ok := s.distances[collectionName]; ok {
+		return distance
+	}
+	return DistanceCosine
+}
+
+// VectorSize returns the dimension stored vectors must have
+func (s *InMemoryVectorStore) VectorSize() int {
+	return s.vectorSize
+}
+
+// InsertPoints adds points, replacing any already stored under the same ID in the
+// collection
+func (s *InMemoryVectorStore) InsertPoints(ctx context.Context, collectionName string, points []*Point) error {
+	for i, point := range points {
+		if point == nil || point.ID == "" {
+			return fmt.Errorf("point %d has no ID", i)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.collections[collectionName]
+	for _, point := range points {
+		p := &StoredPoint{ID: point.ID, Vector: point.Vector, Payload: point.Payload}
+		if i := indexOf(stored, point.ID); i >= 0 {
+			stored[i] = p
+		} else {
+			stored = append(stored, p)
+		}
+	}
+	s.collections[collectionName] = stored
+	return nil
+}
+
+// InsertPoint adds a single point
+func (s *InMemoryVectorStore) InsertPoint(ctx context.Context, collectionName string, point *Point) error {
+	return s.InsertPoints(ctx, collectionName, []*Point{point})
+}
+
+// GetPoint returns the point with the given ID, or nil if there is none
+func (s *InMemoryVectorStore) GetPoint(ctx context.Context, collectionName string, id string) (*Point, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	points := s.collections[collectionName]
+	i := indexOf(points, id)
+	if i < 0 {
+		return nil, nil
+	}
+	stored := points[i]
+	return &Point{ID: stored.ID, Vector: stored.Vector, Payload: stored.Payload}, nil
+}
+
+// Search returns the points closest to vector that pass the filter and score threshold,
+// closest first
+func (s *InMemoryVectorStore) Search(ctx context.Context, collectionName string, vector []float64, opts *SearchOptions) ([]*SearchResult, error) {
+	if opts == nil {
+		opts = &SearchOptions{Limit: 10, WithPayload: true}
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	distance := s.distances[collectionName]
+
+	results := make([]*SearchResult, 0)
+	for _, point := range s.collections[collectionName] {
+		if !opts.Filter.Matches(point.Payload) {
+			continue
+		}
+		similarity, err := ScoreVectors(distance, vector, point.Vector)
+		if err != nil || !passesThreshold(distance, similarity, opts.ScoreThreshold) {
+			continue
+		}
+
+		result := &SearchResult{ID: point.ID, Score: similarity}
+		if opts.WithPayload {
+			result.Payload = point.Payload
+		}
+		if opts.WithVector {
+			result.Vector = point.Vector
+		}
+		results = append(results, result)
+	}
+
+	sortResults(distance, results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// Scroll returns up to limit points matching the filter in insertion order; a limit of
+// 0 or less returns every match
+func (s *InMemoryVectorStore) Scroll(ctx context.Context, collectionName string, filter *Filter, limit int) ([]*SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*SearchResult, 0)
+	for _, point := range s.collections[collectionName] {
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+		if filter.Matches(point.Payload) {
+			results = append(results, &SearchResult{ID: point.ID, Payload: point.Payload})
+		}
+	}
+	return results, nil
+}
+
+// DeletePoints removes points by ID
+func (s *InMemoryVectorStore) DeletePoints(ctx context.Context, collectionName string, ids []string) error {
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepLocked(collectionName, func(point *StoredPoint) bool { return !remove[point.ID] })
+	return nil
+}
+
+// DeleteByFilter removes every point whose payload matches the filter and returns how
+// many were removed
+func (s *InMemoryVectorStore) DeleteByFilter(ctx context.Context, collectionName string, filter *Filter) (int, error) {
+	if filter == nil {
+		return 0, fmt.Errorf("delete filter is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keepLocked(collectionName, func(point *StoredPoint) bool { return !filter.Matches(point.Payload) }), nil
+}
+
+// GetCollectionInfo reports the vector size and number of stored points
+func (s *InMemoryVectorStore) GetCollectionInfo(ctx context.Context, collectionName string) (*CollectionInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &CollectionInfo{
+		Name:       collectionName,
+		VectorSize: s.vectorSize,
+		PointCount: len(s.collections[collectionName]),
+	}, nil
+}
+
+// indexOf returns the position of the point with id in points, or -1
+func indexOf(points []*StoredPoint, id string) int {
+	for i, point := range points {
+		if point.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// keepLocked drops the points of a collection keep rejects, preserving the order of the
+// rest, and returns how many were dropped
+func (s *InMemoryVectorStore) keepLocked(collectionName string, keep func(*StoredPoint) bool) int {
+	points := s.collections[collectionName]
+	kept := points[:0]
+	for _, point := range points {
+		if keep(point) {
+			kept = append(kept, point)
+		}
+	}
+	for i := len(kept); i < len(points); i++ {
+		points[i] = nil
+	}
+	s.collections[collectionName] = kept
+	return len(points) - len(kept)
+}
@@ -0,0 +1,240 @@
+package rag
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// pointIDs lists the IDs of every point in the store, in order
+func pointIDs(t *testing.T, store *InMemoryVectorStore) []string {
+	t.Helper()
+	results, err := store.Scroll(context.Background(), memoryCollectionName, nil, 0)
+	if err != nil {
+		t.Fatalf("Scroll: %v", err)
+	}
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+// seededVectorStore returns a store holding memories from two stories across several turns
+func seededVectorStore(t *testing.T) *InMemoryVectorStore {
+	t.Helper()
+	store := NewInMemoryVectorStore(2)
+	points := []*Point{
+		{ID: "a-1", Vector: []float64{1, 0}, Payload: map[string]interface{}{"story_id": "a", "type": "decision", "timestamp": int64(100)}},
+		{ID: "b-1", Vector: []float64{0, 1}, Payload: map[string]interface{}{"story_id": "b", "type": "decision", "timestamp": int64(150)}},
+		{ID: "a-2", Vector: []float64{1, 1}, Payload: map[string]interface{}{"story_id": "a", "type": "npc", "timestamp": int64(200)}},
+		{ID: "a-3", Vector: []float64{1, 0}, Payload: map[string]interface{}{"story_id": "a", "type": "player_action", "timestamp": int64(300)}},
+		{ID: "orphan", Vector: []float64{0, 1}, Payload: map[string]interface{}{"type": "decision"}},
+	}
+	if err := store.InsertPoints(context.Background(), memoryCollectionName, points); err != nil {
+		t.Fatalf("InsertPoints: %v", err)
+	}
+	return store
+}
+
+func TestInMemoryDeleteByFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  *Filter
+		deleted int
+		kept    []string
+	}{
+		{
+			name:    "story",
+			filter:  &Filter{Must: []Condition{{Key: "story_id", Match: "a", Op: "match"}}},
+			deleted: 3,
+			kept:    []string{"b-1", "orphan"},
+		},
+		{
+			name: "story and type",
+			filter: &Filter{Must: []Condition{
+				{Key: "story_id", Match: "a", Op: "match"},
+				{Key: "type", Match: []string{"decision", "npc"}, Op: "match_any"},
+			}},
+			deleted: 2,
+			kept:    []string{"b-1", "a-3", "orphan"},
+		},
+		{
+			name: "story except actions",
+			filter: &Filter{
+				Must:    []Condition{{Key: "story_id", Match: "a", Op: "match"}},
+				MustNot: []Condition{{Key: "type", Match: "player_action", Op: "match"}},
+			},
+			deleted: 2,
+			kept:    []string{"b-1", "a-3", "orphan"},
+		},
+		{
+			name:    "turns at or after a timestamp",
+			filter:  &Filter{Must: []Condition{{Key: "timestamp", Match: Range{GTE: float(150)}, Op: "range"}}},
+			deleted: 3,
+			kept:    []string{"a-1", "orphan"},
+		},
+		{
+			name:    "no match",
+			filter:  &Filter{Must: []Condition{{Key: "story_id", Match: "c", Op: "match"}}},
+			deleted: 0,
+			kept:    []string{"a-1", "b-1", "a-2", "a-3", "orphan"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := seededVectorStore(t)
+			deleted, err := store.DeleteByFilter(context.Background(), memoryCollectionName, tt.filter)
+			if err != nil {
+				t.Fatalf("DeleteByFilter: %v", err)
+			}
+			if deleted != tt.deleted {
+				t.Errorf("deleted = %d, want %d", deleted, tt.deleted)
+			}
+			if got := pointIDs(t, store); !reflect.DeepEqual(got, tt.kept) {
+				t.Errorf("kept %v, want %v", got, tt.kept)
+			}
+		})
+	}
+}
+
+func TestInMemoryDeleteByFilterRequiresFilter(t *testing.T) {
+	store := seededVectorStore(t)
+	if _, err := store.DeleteByFilter(context.Background(), memoryCollectionName, nil); err == nil {
+		t.Fatal("a nil filter deleted without an error")
+	}
+	if got := pointIDs(t, store); len(got) != 5 {
+		t.Errorf("a rejected delete left %v", got)
+	}
+}
+
+func TestDeleteMemoriesByStoryKeepsOtherStories(t *testing.T) {
+	ctx := context.Background()
+	store, vectors := newTestMemoryStore()
+
+	err := store.StoreMemories(ctx, []*Memory{
+		storyMemory("a-1", "a", "拜入华山"),
+		storyMemory("b-1", "b", "独闯少林"),
+		storyMemory("a-2", "a", "夜探藏经阁"),
+	})
+	if err != nil {
+		t.Fatalf("StoreMemories: %v", err)
+	}
+
+	deleted, err := store.DeleteMemoriesByStory(ctx, "a")
+	if err != nil {
+		t.Fatalf("DeleteMemoriesByStory: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted = %d, want 2", deleted)
+	}
+	if got := pointIDs(t, vectors); !reflect.DeepEqual(got, []string{"b-1"}) {
+		t.Errorf("points left = %v, want only b-1", got)
+	}
+
+	if _, err := store.DeleteMemoriesByStory(ctx, ""); err == nil {
+		t.Error("an empty story ID was accepted")
+	}
+}
+
+func TestInMemoryCollectionsAreSeparate(t *testing.T) {
+	ctx := context.Background()
+	store := seededVectorStore(t)
+	other := []*Point{
+		{ID: "a-1", Vector: []float64{0, 1}, Payload: map[string]interface{}{"story_id": "a"}},
+		{ID: "d-1", Vector: []float64{1, 0}, Payload: map[string]interface{}{"story_id": "d"}},
+	}
+	if err := store.InsertPoints(ctx, decisionCollectionName, other); err != nil {
+		t.Fatalf("InsertPoints: %v", err)
+	}
+
+	// The same ID in another collection is a different point
+	if got := pointIDs(t, store); len(got) != 5 {
+		t.Fatalf("memories collection holds %v after inserting into decisions", got)
+	}
+	point, err := store.GetPoint(ctx, memoryCollectionName, "a-1")
+	if err != nil || point == nil || !reflect.DeepEqual(point.Vector, []float64{1, 0}) {
+		t.Fatalf("GetPoint(memories, a-1) = %+v, %v", point, err)
+	}
+	if point, _ := store.GetPoint(ctx, memoryCollectionName, "d-1"); point != nil {
+		t.Errorf("GetPoint found decisions point d-1 in memories")
+	}
+
+	results, err := store.Search(ctx, decisionCollectionName, []float64{1, 0}, &SearchOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Search on decisions returned %d results, want 2", len(results))
+	}
+
+	if err := store.DeletePoints(ctx, decisionCollectionName, []string{"a-1"}); err != nil {
+		t.Fatalf("DeletePoints: %v", err)
+	}
+	if point, _ := store.GetPoint(ctx, memoryCollectionName, "a-1"); point == nil {
+		t.Error("deleting a-1 from decisions removed it from memories")
+	}
+	info, err := store.GetCollectionInfo(ctx, decisionCollectionName)
+	if err != nil || info.PointCount != 1 {
+		t.Errorf("decisions info = %+v, %v, want 1 point", info, err)
+	}
+}
+
+// searchIDs runs a search on the memories collection and returns the result IDs in order
+func searchIDs(t *testing.T, store *InMemoryVectorStore, vector []float64, opts *SearchOptions) []string {
+	t.Helper()
+	results, err := store.Search(context.Background(), memoryCollectionName, vector, opts)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestInMemorySearchFilter(t *testing.T) {
+	store := seededVectorStore(t)
+
+	story := &Filter{Must: []Condition{{Key: "story_id", Match: "a", Op: "match"}}}
+	got := searchIDs(t, store, []float64{0, 1}, &SearchOptions{Limit: 10, Filter: story})
+	if len(got) != 3 || got[0] != "a-2" || !slices.Contains(got, "a-1") || !slices.Contains(got, "a-3") {
+		t.Errorf("story filter returned %v, want a-2 then a-1 and a-3", got)
+	}
+
+	decisions := &Filter{Must: []Condition{
+		{Key: "story_id", Match: "a", Op: "match"},
+		{Key: "type", Match: []string{"decision", "npc"}, Op: "match_any"},
+	}}
+	if got := searchIDs(t, store, []float64{1, 0}, &SearchOptions{Limit: 10, Filter: decisions}); !reflect.DeepEqual(got, []string{"a-1", "a-2"}) {
+		t.Errorf("story and type filter returned %v, want [a-1 a-2]", got)
+	}
+
+	none := &Filter{Must: []Condition{{Key: "story_id", Match: "z", Op: "match"}}}
+	if got := searchIDs(t, store, []float64{1, 0}, &SearchOptions{Limit: 10, Filter: none}); len(got) != 0 {
+		t.Errorf("filter on a missing story returned %v", got)
+	}
+}
+
+func TestInMemorySearchScoreThreshold(t *testing.T) {
+	store := seededVectorStore(t)
+
+	// Cosine to [1 0]: a-1 and a-3 score 1, a-2 about 0.707, b-1 and orphan 0
+	if got := searchIDs(t, store, []float64{1, 0}, &SearchOptions{Limit: 10, ScoreThreshold: 0.9}); len(got) != 2 ||
+		!slices.Contains(got, "a-1") || !slices.Contains(got, "a-3") {
+		t.Errorf("cosine threshold 0.9 returned %v, want a-1 and a-3", got)
+	}
+	if got := searchIDs(t, store, []float64{1, 0}, &SearchOptions{Limit: 10, ScoreThreshold: 0.5}); len(got) != 3 || got[2] != "a-2" {
+		t.Errorf("cosine threshold 0.5 returned %v, want a-1, a-3, then a-2", got)
+	}
+
+	// Euclidean distance is better when lower, so the threshold is an upper bound
+	if err := store.SetDistance(memoryCollectionName, DistanceEuclid); err != nil {
+		t.Fatalf("SetDistance: %v", err)
+	}
+	if got := searchIDs(t, store, []float64{1, 0}, &SearchOptions{Limit: 10, ScoreThreshold: 1.1}); len(got) != 3 || got[2] != "a-2" {
+		t.Errorf("euclid threshold 1.1 returned %v, want a-1, a-3, then a-2", got)
+	}
+}
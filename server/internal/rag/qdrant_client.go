@@ -2,7 +2,16 @@ package rag
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
+	"time"
 )
 
 const (
@@ -12,12 +21,26 @@ const (
 	defaultVectorSize   = 1024  // Embedding dimension
 )
 
-// QdrantClient wraps Qdrant vector database client (stub implementation)
+// QdrantClient stores and searches vectors on a Qdrant server through its REST API
 type QdrantClient struct {
 	mu         sync.RWMutex
-	points     map[string]*StoredPoint
-	collection string
+	distances  map[string]string // Collection name -> distance metric; unset is Cosine
+	vectorSize int
 	connected  bool
+
+	address       string
+	baseURL       string
+	apiKey        string
+	httpClient    *http.Client
+	connectWindow time.Duration // How long NewQdrantClient retries the first connection
+	logger        *slog.Logger
+
+	initMu             sync.Mutex          // Serializes creating pending collections
+	pendingCollections []*CollectionConfig // Collections to create once Qdrant is reachable
+
+	closed          bool
+	stopReconnector context.CancelFunc // Cancels the running reconnector, if any
+	reconnectorDone chan struct{}      // Closed when the running reconnector returns
 }
 
 // StoredPoint represents a stored point
@@ -27,24 +50,112 @@ type StoredPoint struct {
 	Payload map[string]interface{}
 }
 
-// NewQdrantClient creates a new Qdrant client (in-memory stub for now)
-func NewQdrantClient(host string, port int, apiKey string) (*QdrantClient, error) {
-	// For now, use an in-memory stub
-	// TODO: Replace with actual Qdrant client when needed
-	return &QdrantClient{
-		points:    make(map[string]*StoredPoint),
-		connected: true,
-	}, nil
+// qdrantRequestTimeout bounds a single REST call
+const qdrantRequestTimeout = 10 * time.Second
+
+// NewQdrantClient creates a client for the Qdrant REST API at host:port and waits for
+// the server to answer, retrying for the window set by WithConnectRetry. If Qdrant is
+// still not up, the client starts disconnected; operations and the reconnector connect
+// it once Qdrant answers.
+func NewQdrantClient(host string, port int, apiKey string, opts ...QdrantOption) *QdrantClient {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	c := &QdrantClient{
+		distances:  make(map[string]string),
+		vectorSize: defaultVectorSize,
+		address:    address,
+		baseURL:    "http://" + address,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: qdrantRequestTimeout},
+		logger:     slog.Default().With("component", "qdrant"),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.connect(context.Background()); err != nil {
+		c.logger.Warn("qdrant unreachable, starting disconnected", "address", address, "error", err)
+	}
+	return c
 }
 
-// InitializeCollections initializes required collections
-func (c *QdrantClient) InitializeCollections(ctx context.Context) error {
+// InitializeCollections initializes required collections with the configured vector size
+// and distance metric; overrides sets the metric for individual collections by name.
+// A non-positive vectorSize falls back to the default and an empty distance to Cosine.
+// Collections that can't be created because Qdrant is unreachable are created once the
+// client reconnects.
+func (c *QdrantClient) InitializeCollections(ctx context.Context, vectorSize int, distance string, overrides map[string]string) error {
+	if vectorSize <= 0 {
+		vectorSize = defaultVectorSize
+	}
+	if distance == "" {
+		distance = DistanceCosine
+	}
+
+	configs := make([]*CollectionConfig, 0, 3)
+	for _, name := range []string{defaultCollectionName, memoryCollectionName, decisionCollectionName} {
+		collectionDistance := distance
+		if override, ok := overrides[name]; ok {
+			collectionDistance = override
+		}
+		if err := ValidateDistance(collectionDistance); err != nil {
+			return fmt.Errorf("collection %s: %w", name, err)
+		}
+		configs = append(configs, &CollectionConfig{Name: name, VectorSize: vectorSize, Distance: collectionDistance})
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	// Stub implementation
+	c.vectorSize = vectorSize
+	for _, cfg := range configs {
+		c.distances[cfg.Name] = cfg.Distance
+	}
+	c.mu.Unlock()
+
+	c.initMu.Lock()
+	c.pendingCollections = configs
+	c.initMu.Unlock()
+
+	if !c.Connected() {
+		return fmt.Errorf("%w: collections will be created once it is reachable", ErrQdrantUnavailable)
+	}
+	return c.createPendingCollections(ctx)
+}
+
+// createPendingCollections creates the collections InitializeCollections has not created
+// yet, keeping the rest pending when one fails
+func (c *QdrantClient) createPendingCollections(ctx context.Context) error {
+	c.initMu.Lock()
+	defer c.initMu.Unlock()
+
+	for len(c.pendingCollections) > 0 {
+		cfg := c.pendingCollections[0]
+		if err := c.CreateCollection(ctx, cfg); err != nil {
+			if isConnectionError(err) {
+				c.setConnected(false)
+			}
+			return fmt.Errorf("failed to create collection %s: %w", cfg.Name, err)
+		}
+		c.pendingCollections = c.pendingCollections[1:]
+	}
 	return nil
 }
 
+// Distance returns the metric a collection is searched with
+func (c *QdrantClient) Distance(collectionName string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if distance, ok := c.distances[collectionName]; ok {
+		return distance
+	}
+	return DistanceCosine
+}
+
+// VectorSize returns the vector size collections are configured with
+func (c *QdrantClient) VectorSize() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.vectorSize
+}
+
 // Point represents a vector point with payload
 type Point struct {
 	ID      string
@@ -71,10 +182,121 @@ type Filter struct {
 // Condition represents a filter condition
 type Condition struct {
 	Key   string
-	Match interface{} // string, int64, []string
+	Match interface{} // string, int64, []string, Range
 	Op    string      // "match", "match_any", "range", etc.
 }
 
+// Range represents numeric bounds for a "range" condition; nil bounds are ignored
+type Range struct {
+	GT  *float64
+	GTE *float64
+	LT  *float64
+	LTE *float64
+}
+
+// Matches reports whether a payload satisfies the filter. A nil filter matches everything.
+func (f *Filter) Matches(payload map[string]interface{}) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, cond := range f.Must {
+		if !cond.Matches(payload) {
+			return false
+		}
+	}
+
+	for _, cond := range f.MustNot {
+		if cond.Matches(payload) {
+			return false
+		}
+	}
+
+	if len(f.Should) > 0 {
+		for _, cond := range f.Should {
+			if cond.Matches(payload) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// Matches reports whether a payload satisfies the condition
+func (c Condition) Matches(payload map[string]interface{}) bool {
+	value, ok := payload[c.Key]
+	if !ok {
+		return false
+	}
+
+	switch c.Op {
+	case "match", "":
+		return fmt.Sprint(value) == fmt.Sprint(c.Match)
+	case "match_any":
+		candidates, ok := c.Match.([]string)
+		if !ok {
+			return false
+		}
+		for _, candidate := range candidates {
+			if fmt.Sprint(value) == candidate {
+				return true
+			}
+		}
+		return false
+	case "range":
+		bounds, ok := c.Match.(Range)
+		if !ok {
+			return false
+		}
+		number, ok := toFloat64(value)
+		if !ok {
+			return false
+		}
+		return bounds.contains(number)
+	default:
+		return false
+	}
+}
+
+// contains reports whether a value lies within the range bounds
+func (r Range) contains(value float64) bool {
+	if r.GT != nil && value <= *r.GT {
+		return false
+	}
+	if r.GTE != nil && value < *r.GTE {
+		return false
+	}
+	if r.LT != nil && value >= *r.LT {
+		return false
+	}
+	if r.LTE != nil && value > *r.LTE {
+		return false
+	}
+	return true
+}
+
+// toFloat64 converts numeric payload values to float64
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
 // CollectionConfig holds collection configuration
 type CollectionConfig struct {
 	Name       string
@@ -82,26 +304,51 @@ type CollectionConfig struct {
 	Distance   string // "Cosine", "Euclid", "Dot"
 }
 
-// CreateCollection creates a new collection
+// CreateCollection creates a collection unless it already exists
 func (q *QdrantClient) CreateCollection(ctx context.Context, config *CollectionConfig) error {
-	return nil // Stub
+	exists, err := q.CollectionExists(ctx, config.Name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	distance := config.Distance
+	if distance == "" {
+		distance = DistanceCosine
+	}
+	body := map[string]interface{}{
+		"vectors": map[string]interface{}{"size": config.VectorSize, "distance": distance},
+	}
+	return q.do(ctx, http.MethodPut, "/collections/"+url.PathEscape(config.Name), body, nil)
 }
 
-// InsertPoints inserts points into a collection
+// InsertPoints inserts points into a collection.
+// Points are keyed by their caller-supplied ID, so distinct IDs never overwrite each other.
 func (q *QdrantClient) InsertPoints(ctx context.Context, collectionName string, points []*Point) error {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	for _, point := range points {
-		if point.ID != "" {
-			q.points[point.ID] = &StoredPoint{
-				ID:      point.ID,
-				Vector:  point.Vector,
-				Payload: point.Payload,
-			}
+	return q.withReconnect(ctx, func() error {
+		return q.insertPoints(ctx, collectionName, points)
+	})
+}
+
+// insertPoints is InsertPoints without reconnect handling
+func (q *QdrantClient) insertPoints(ctx context.Context, collectionName string, points []*Point) error {
+	// Validate the whole batch first so a bad point doesn't leave a partial insert
+	for i, point := range points {
+		if point == nil || point.ID == "" {
+			return fmt.Errorf("point %d has no ID", i)
 		}
 	}
-	return nil
+	if len(points) == 0 {
+		return nil
+	}
+
+	upload := make([]qdrantPoint, len(points))
+	for i, point := range points {
+		upload[i] = toQdrantPoint(point)
+	}
+	return q.do(ctx, http.MethodPut, pointsPath(collectionName, "?wait=true"), map[string]interface{}{"points": upload}, nil)
 }
 
 // InsertPoint inserts a single point into a collection
@@ -111,9 +358,18 @@ func (q *QdrantClient) InsertPoint(ctx context.Context, collectionName string, p
 
 // Search searches for similar vectors
 func (q *QdrantClient) Search(ctx context.Context, collectionName string, vector []float64, opts *SearchOptions) ([]*SearchResult, error) {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
+	var result []*SearchResult
+	err := q.withReconnect(ctx, func() error {
+		var err error
+		result, err = q.search(ctx, collectionName, vector, opts)
+		return err
+	})
+	return result, err
+}
 
+// search is Search without reconnect handling. The filter and score threshold are
+// applied by Qdrant, which returns the best matches first.
+func (q *QdrantClient) search(ctx context.Context, collectionName string, vector []float64, opts *SearchOptions) ([]*SearchResult, error) {
 	if opts == nil {
 		opts = &SearchOptions{
 			Limit:       10,
@@ -121,19 +377,44 @@ func (q *QdrantClient) Search(ctx context.Context, collectionName string, vector
 		}
 	}
 
-	// Simple linear search (replace with proper vector search when using real Qdrant)
-	results := make([]*SearchResult, 0)
-	for _, point := range q.points {
-		similarity := 0.5 // Stub similarity
-		results = append(results, &SearchResult{
-			ID:      point.ID,
-			Score:   similarity,
-			Vector:  point.Vector,
-			Payload: point.Payload,
-		})
-		if len(results) >= opts.Limit {
-			break
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	filter, err := toQdrantFilter(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// The payload always comes back, since it carries the caller-supplied ID
+	body := map[string]interface{}{
+		"vector":       vector,
+		"limit":        limit,
+		"with_payload": true,
+		"with_vector":  opts.WithVector,
+	}
+	if filter != nil {
+		body["filter"] = filter
+	}
+	if opts.ScoreThreshold > 0 {
+		body["score_threshold"] = opts.ScoreThreshold
+	}
+
+	var points []qdrantPoint
+	if err := q.do(ctx, http.MethodPost, pointsPath(collectionName, "/search"), body, &points); err != nil {
+		return nil, err
+	}
+
+	results := make([]*SearchResult, len(points))
+	for i := range points {
+		result := &SearchResult{ID: points[i].originalID(), Score: points[i].Score}
+		if opts.WithPayload {
+			result.Payload = points[i].Payload
 		}
+		if opts.WithVector {
+			result.Vector = points[i].Vector
+		}
+		results[i] = result
 	}
 	return results, nil
 }
@@ -146,20 +427,144 @@ type SearchResult struct {
 	Payload map[string]interface{}
 }
 
-// DeletePoints deletes points from a collection
+// GetPoint returns the point with the given ID, or nil if there is none
+func (q *QdrantClient) GetPoint(ctx context.Context, collectionName string, id string) (*Point, error) {
+	var result *Point
+	err := q.withReconnect(ctx, func() error {
+		var err error
+		result, err = q.getPoint(ctx, collectionName, id)
+		return err
+	})
+	return result, err
+}
+
+// getPoint is GetPoint without reconnect handling
+func (q *QdrantClient) getPoint(ctx context.Context, collectionName string, id string) (*Point, error) {
+	var point qdrantPoint
+	err := q.do(ctx, http.MethodGet, pointsPath(collectionName, "/"+qdrantPointID(id)), nil, &point)
+	var qerr *qdrantError
+	if errors.As(err, &qerr) && qerr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Point{ID: point.originalID(), Vector: point.Vector, Payload: point.Payload}, nil
+}
+
+// Scroll returns up to limit points whose payload matches the filter, in no particular
+// order; a limit of 0 or less returns every match
+func (q *QdrantClient) Scroll(ctx context.Context, collectionName string, filter *Filter, limit int) ([]*SearchResult, error) {
+	var result []*SearchResult
+	err := q.withReconnect(ctx, func() error {
+		var err error
+		result, err = q.scroll(ctx, collectionName, filter, limit)
+		return err
+	})
+	return result, err
+}
+
+// scroll is Scroll without reconnect handling; it pages through matches until limit
+func (q *QdrantClient) scroll(ctx context.Context, collectionName string, filter *Filter, limit int) ([]*SearchResult, error) {
+	qfilter, err := toQdrantFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*SearchResult, 0)
+	var offset interface{}
+	for {
+		pageSize := scrollPageSize
+		if limit > 0 {
+			pageSize = min(pageSize, limit-len(results))
+		}
+		body := map[string]interface{}{"limit": pageSize, "with_payload": true}
+		if qfilter != nil {
+			body["filter"] = qfilter
+		}
+		if offset != nil {
+			body["offset"] = offset
+		}
+
+		var page struct {
+			Points         []qdrantPoint `json:"points"`
+			NextPageOffset interface{}   `json:"next_page_offset"`
+		}
+		if err := q.do(ctx, http.MethodPost, pointsPath(collectionName, "/scroll"), body, &page); err != nil {
+			return nil, err
+		}
+		for i := range page.Points {
+			results = append(results, &SearchResult{ID: page.Points[i].originalID(), Payload: page.Points[i].Payload})
+		}
+
+		offset = page.NextPageOffset
+		if offset == nil || (limit > 0 && len(results) >= limit) {
+			return results, nil
+		}
+	}
+}
+
+// DeletePoints deletes points from a collection by their caller-supplied IDs
 func (q *QdrantClient) DeletePoints(ctx context.Context, collectionName string, ids []string) error {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+	return q.withReconnect(ctx, func() error {
+		return q.deletePoints(ctx, collectionName, ids)
+	})
+}
 
-	for _, id := range ids {
-		delete(q.points, id)
+// deletePoints is DeletePoints without reconnect handling
+func (q *QdrantClient) deletePoints(ctx context.Context, collectionName string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
 	}
-	return nil
+	pointIDs := make([]string, len(ids))
+	for i, id := range ids {
+		pointIDs[i] = qdrantPointID(id)
+	}
+	return q.do(ctx, http.MethodPost, pointsPath(collectionName, "/delete?wait=true"), map[string]interface{}{"points": pointIDs}, nil)
+}
+
+// DeleteByFilter deletes all points whose payload matches the filter and returns how many were removed
+func (q *QdrantClient) DeleteByFilter(ctx context.Context, collectionName string, filter *Filter) (int, error) {
+	var result int
+	err := q.withReconnect(ctx, func() error {
+		var err error
+		result, err = q.deleteByFilter(ctx, collectionName, filter)
+		return err
+	})
+	return result, err
+}
+
+// deleteByFilter is DeleteByFilter without reconnect handling. Qdrant doesn't report how
+// many points a delete removed, so they are counted first.
+func (q *QdrantClient) deleteByFilter(ctx context.Context, collectionName string, filter *Filter) (int, error) {
+	if filter == nil {
+		return 0, fmt.Errorf("delete filter is required")
+	}
+	qfilter, err := toQdrantFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var counted struct {
+		Count int `json:"count"`
+	}
+	body := map[string]interface{}{"filter": qfilter, "exact": true}
+	if err := q.do(ctx, http.MethodPost, pointsPath(collectionName, "/count"), body, &counted); err != nil {
+		return 0, err
+	}
+	if counted.Count == 0 {
+		return 0, nil
+	}
+
+	if err := q.do(ctx, http.MethodPost, pointsPath(collectionName, "/delete?wait=true"), map[string]interface{}{"filter": qfilter}, nil); err != nil {
+		return 0, err
+	}
+	return counted.Count, nil
 }
 
 // DeleteCollection deletes a collection
 func (q *QdrantClient) DeleteCollection(ctx context.Context, collectionName string) error {
-	return nil // Stub
+	return q.do(ctx, http.MethodDelete, "/collections/"+url.PathEscape(collectionName), nil, nil)
 }
 
 // GetCollectionInfo returns information about a collection
@@ -171,27 +576,80 @@ type CollectionInfo struct {
 
 // GetCollectionInfo returns information about a collection
 func (q *QdrantClient) GetCollectionInfo(ctx context.Context, collectionName string) (*CollectionInfo, error) {
+	var info struct {
+		PointsCount int `json:"points_count"`
+		Config      struct {
+			Params struct {
+				Vectors struct {
+					Size int `json:"size"`
+				} `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}
+	if err := q.do(ctx, http.MethodGet, "/collections/"+url.PathEscape(collectionName), nil, &info); err != nil {
+		return nil, err
+	}
 	return &CollectionInfo{
 		Name:       collectionName,
-		VectorSize: defaultVectorSize,
-		PointCount: len(q.points),
+		VectorSize: info.Config.Params.Vectors.Size,
+		PointCount: info.PointsCount,
 	}, nil
 }
 
-// Close closes client connection
+// Close stops the reconnector, waiting for an in-flight probe to end, and closes idle
+// connections. Later calls to StartReconnector return immediately.
 func (q *QdrantClient) Close() error {
 	q.mu.Lock()
-	defer q.mu.Unlock()
 	q.connected = false
+	q.closed = true
+	stop, done := q.stopReconnector, q.reconnectorDone
+	q.stopReconnector, q.reconnectorDone = nil, nil
+	q.mu.Unlock()
+
+	if stop != nil {
+		stop()
+		<-done
+	}
+	q.httpClient.CloseIdleConnections()
 	return nil
 }
 
-// HealthCheck checks if Qdrant is healthy
+// HealthCheck checks that Qdrant answers its health endpoint
 func (q *QdrantClient) HealthCheck(ctx context.Context) error {
-	return nil // Stub
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, q.baseURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	if q.apiKey != "" {
+		req.Header.Set("api-key", q.apiKey)
+	}
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: health check returned %s", ErrQdrantUnavailable, resp.Status)
+	}
+	return nil
 }
 
 // CollectionExists checks if a collection exists
 func (q *QdrantClient) CollectionExists(ctx context.Context, collectionName string) (bool, error) {
-	return true, nil // Stub
+	err := q.do(ctx, http.MethodGet, "/collections/"+url.PathEscape(collectionName), nil, nil)
+	var qerr *qdrantError
+	if errors.As(err, &qerr) && qerr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// pointsPath is the REST path of a collection's points endpoint followed by suffix
+func pointsPath(collectionName, suffix string) string {
+	return "/collections/" + url.PathEscape(collectionName) + "/points" + suffix
 }
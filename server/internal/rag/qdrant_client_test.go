@@ -0,0 +1,312 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestQdrantClient starts a fake Qdrant answering /healthz and handing every other
+// request to handler, and returns a client connected to it
+func newTestQdrantClient(t *testing.T, handler http.HandlerFunc) *QdrantClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			io.WriteString(w, "healthz check passed")
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	host, portText, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("split address: %v", err)
+	}
+	port, _ := strconv.Atoi(portText)
+	return NewQdrantClient(host, port, "secret")
+}
+
+// writeQdrantResult replies with result in Qdrant's response envelope
+func writeQdrantResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "status": "ok", "time": 0.001})
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestToQdrantFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *Filter
+		want   string
+	}{
+		{
+			name:   "match",
+			filter: &Filter{Must: []Condition{{Key: "story_id", Match: "s1", Op: "match"}, {Key: "turn", Match: int64(3)}}},
+			want:   `{"must":[{"key":"story_id","match":{"value":"s1"}},{"key":"turn","match":{"value":3}}]}`,
+		},
+		{
+			name:   "match any",
+			filter: &Filter{Should: []Condition{{Key: "type", Match: []string{"decision", "npc"}, Op: "match_any"}}},
+			want:   `{"should":[{"key":"type","match":{"any":["decision","npc"]}}]}`,
+		},
+		{
+			name:   "range",
+			filter: &Filter{Must: []Condition{{Key: "timestamp", Match: Range{GTE: float(100), LT: float(200)}, Op: "range"}}},
+			want:   `{"must":[{"key":"timestamp","range":{"gte":100,"lt":200}}]}`,
+		},
+		{
+			name:   "must not",
+			filter: &Filter{MustNot: []Condition{{Key: "type", Match: "story_state", Op: "match"}}},
+			want:   `{"must_not":[{"key":"type","match":{"value":"story_state"}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := toQdrantFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("toQdrantFilter: %v", err)
+			}
+			got, _ := json.Marshal(filter)
+			if string(got) != tt.want {
+				t.Errorf("filter = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	invalid := []Condition{
+		{Key: "", Match: "x", Op: "match"},
+		{Key: "type", Match: "x", Op: "prefix"},
+		{Key: "type", Match: "x", Op: "match_any"},
+		{Key: "timestamp", Match: 5, Op: "range"},
+	}
+	for _, cond := range invalid {
+		if _, err := toQdrantFilter(&Filter{Must: []Condition{cond}}); err == nil {
+			t.Errorf("condition %+v translated, want an error", cond)
+		}
+	}
+}
+
+func TestQdrantSearchSendsFilterAndThreshold(t *testing.T) {
+	var body map[string]interface{}
+	client := newTestQdrantClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/collections/memories/points/search" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("api-key") != "secret" {
+			http.Error(w, "missing api key", http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		writeQdrantResult(w, []map[string]interface{}{{
+			"id":      qdrantPointID("decision_s1_1"),
+			"score":   0.91,
+			"payload": map[string]interface{}{pointIDKey: "decision_s1_1", "story_id": "s1", "timestamp": 150},
+		}})
+	})
+
+	results, err := client.Search(context.Background(), "memories", []float64{0.1, 0.2}, &SearchOptions{
+		Limit:          5,
+		ScoreThreshold: 0.7,
+		WithPayload:    true,
+		Filter: &Filter{Must: []Condition{
+			{Key: "story_id", Match: "s1", Op: "match"},
+			{Key: "timestamp", Match: Range{GT: float(100)}, Op: "range"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	if body["score_threshold"] != 0.7 || body["limit"] != float64(5) {
+		t.Errorf("search body threshold %v, limit %v; want 0.7 and 5", body["score_threshold"], body["limit"])
+	}
+	filter, _ := json.Marshal(body["filter"])
+	if want := `{"must":[{"key":"story_id","match":{"value":"s1"}},{"key":"timestamp","range":{"gt":100}}]}`; string(filter) != want {
+		t.Errorf("search filter = %s, want %s", filter, want)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if results[0].ID != "decision_s1_1" || results[0].Score != 0.91 {
+		t.Errorf("result = %s at %v, want decision_s1_1 at 0.91", results[0].ID, results[0].Score)
+	}
+	if _, ok := results[0].Payload[pointIDKey]; ok || results[0].Payload["story_id"] != "s1" {
+		t.Errorf("payload = %v, want story_id without %s", results[0].Payload, pointIDKey)
+	}
+}
+
+func TestQdrantInsertAndDeleteByFilter(t *testing.T) {
+	var inserted []qdrantPoint
+	var deleteBody map[string]interface{}
+	client := newTestQdrantClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/collections/memories/points":
+			var body struct {
+				Points []qdrantPoint `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			inserted = body.Points
+			writeQdrantResult(w, map[string]interface{}{"status": "completed"})
+		case "/collections/memories/points/count":
+			writeQdrantResult(w, map[string]interface{}{"count": 2})
+		case "/collections/memories/points/delete":
+			json.NewDecoder(r.Body).Decode(&deleteBody)
+			writeQdrantResult(w, map[string]interface{}{"status": "completed"})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ctx := context.Background()
+
+	err := client.InsertPoints(ctx, "memories", []*Point{{ID: "npc_s1_1", Vector: []float64{1, 0}, Payload: map[string]interface{}{"story_id": "s1"}}})
+	if err != nil {
+		t.Fatalf("InsertPoints: %v", err)
+	}
+	if len(inserted) != 1 || inserted[0].ID != qdrantPointID("npc_s1_1") || inserted[0].Payload[pointIDKey] != "npc_s1_1" {
+		t.Fatalf("inserted %+v, want the point under its UUID with the ID in the payload", inserted)
+	}
+
+	deleted, err := client.DeleteByFilter(ctx, "memories", &Filter{Must: []Condition{{Key: "story_id", Match: "s1", Op: "match"}}})
+	if err != nil {
+		t.Fatalf("DeleteByFilter: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted = %d, want the counted 2", deleted)
+	}
+	filter, _ := json.Marshal(deleteBody["filter"])
+	if want := `{"must":[{"key":"story_id","match":{"value":"s1"}}]}`; string(filter) != want {
+		t.Errorf("delete filter = %s, want %s", filter, want)
+	}
+}
+
+func TestQdrantPointIDIsStableUUID(t *testing.T) {
+	id := qdrantPointID("player_action_s1_1")
+	if id != qdrantPointID("player_action_s1_1") {
+		t.Fatal("point ID is not deterministic")
+	}
+	if id == qdrantPointID("player_action_s1_2") {
+		t.Fatal("distinct IDs map to the same point")
+	}
+	if len(id) != 36 || id[14] != '5' {
+		t.Errorf("point ID %q is not a version 5 style UUID", id)
+	}
+}
+
+func TestQdrantInsertPointsValidatesBatch(t *testing.T) {
+	var uploads [][]qdrantPoint
+	client := newTestQdrantClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Points []qdrantPoint `json:"points"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		uploads = append(uploads, body.Points)
+		writeQdrantResult(w, map[string]interface{}{"status": "completed"})
+	})
+	ctx := context.Background()
+
+	// One bad point rejects the whole batch before anything is sent
+	for _, bad := range []*Point{nil, {Vector: []float64{1, 0}}} {
+		batch := []*Point{{ID: "npc_s1_1", Vector: []float64{1, 0}}, bad}
+		if err := client.InsertPoints(ctx, "memories", batch); err == nil || !strings.Contains(err.Error(), "point 1 has no ID") {
+			t.Errorf("InsertPoints with %+v = %v, want point 1 rejected", bad, err)
+		}
+	}
+	if len(uploads) != 0 {
+		t.Fatalf("invalid batches sent %d uploads, want none", len(uploads))
+	}
+
+	// Distinct IDs land on distinct points
+	err := client.InsertPoints(ctx, "memories", []*Point{
+		{ID: "npc_s1_1", Vector: []float64{1, 0}},
+		{ID: "npc_s1_2", Vector: []float64{0, 1}},
+	})
+	if err != nil {
+		t.Fatalf("InsertPoints: %v", err)
+	}
+	if len(uploads) != 1 || len(uploads[0]) != 2 || uploads[0][0].ID == uploads[0][1].ID {
+		t.Fatalf("uploads = %+v, want one batch of two distinct points", uploads)
+	}
+
+	// An empty batch is a no-op
+	if err := client.InsertPoints(ctx, "memories", nil); err != nil || len(uploads) != 1 {
+		t.Errorf("empty batch: err %v, %d uploads", err, len(uploads))
+	}
+}
+
+func TestMemoryStoreRoundTripsThroughQdrant(t *testing.T) {
+	var mu sync.Mutex
+	stored := make(map[string]qdrantPoint) // Keyed by Qdrant point ID, as the server does
+	client := newTestQdrantClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/collections/memories/points":
+			var body struct {
+				Points []qdrantPoint `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, point := range body.Points {
+				stored[fmt.Sprint(point.ID)] = point
+			}
+			writeQdrantResult(w, map[string]interface{}{"status": "completed"})
+		case "/collections/memories/points/search":
+			points := make([]qdrantPoint, 0, len(stored))
+			for _, point := range stored {
+				point.Score = 1
+				points = append(points, point)
+			}
+			writeQdrantResult(w, points)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	store := NewMemoryStore(client, NewHashEmbedder(client.VectorSize()))
+	ctx := context.Background()
+
+	err := store.StoreMemories(ctx, []*Memory{
+		storyMemory("player_action_s1_1", "s1", "拜入华山"),
+		storyMemory("player_action_s1_2", "s1", "夜探藏经阁"),
+		storyMemory("player_action_s1_3", "s1", "独闯少林"),
+	})
+	if err != nil {
+		t.Fatalf("StoreMemories: %v", err)
+	}
+	mu.Lock()
+	points := len(stored)
+	mu.Unlock()
+	if points != 3 {
+		t.Fatalf("server holds %d points, want 3", points)
+	}
+
+	memories, err := store.GetMemoriesByType(ctx, MemoryTypePlayerAction, "s1", 10)
+	if err != nil {
+		t.Fatalf("GetMemoriesByType: %v", err)
+	}
+	got := make(map[string]string, len(memories))
+	for _, memory := range memories {
+		got[memory.ID] = memory.Content
+	}
+	want := map[string]string{
+		"player_action_s1_1": "拜入华山",
+		"player_action_s1_2": "夜探藏经阁",
+		"player_action_s1_3": "独闯少林",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("retrieved %v, want %v", got, want)
+	}
+}
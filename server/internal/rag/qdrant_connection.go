@@ -0,0 +1,200 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const (
+	initialConnectBackoff = 500 * time.Millisecond
+	maxConnectBackoff     = 5 * time.Second
+	reconnectProbeTimeout = 5 * time.Second
+)
+
+// ErrQdrantUnavailable is returned by operations while Qdrant can't be reached
+var ErrQdrantUnavailable = errors.New("qdrant unavailable")
+
+// QdrantOption configures a QdrantClient
+type QdrantOption func(*QdrantClient)
+
+// WithConnectRetry keeps retrying the initial connection with backoff for up to window
+// before NewQdrantClient returns a disconnected client, for when Qdrant starts after the
+// server
+func WithConnectRetry(window time.Duration) QdrantOption {
+	return func(c *QdrantClient) {
+		c.connectWindow = window
+	}
+}
+
+// WithLogger sets the structured logger for connection state changes
+func WithLogger(logger *slog.Logger) QdrantOption {
+	return func(c *QdrantClient) {
+		c.logger = logger.With("component", "qdrant")
+	}
+}
+
+// connect probes Qdrant until it answers, backing off between attempts, or until the
+// connect window has passed
+func (c *QdrantClient) connect(ctx context.Context) error {
+	deadline := time.Now().Add(c.connectWindow)
+	backoff := initialConnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := c.probe(ctx)
+		if err == nil {
+			c.setConnected(true)
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("failed to connect to qdrant at %s after %d attempts: %w", c.address, attempt, err)
+		}
+
+		c.logger.Debug("connection attempt failed", "address", c.address, "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
+// StartReconnector probes Qdrant every interval until ctx ends or Close is called,
+// marking the client disconnected while probes fail and reconnecting once they succeed
+// again
+func (c *QdrantClient) StartReconnector(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	// Only one reconnector runs at a time; the newest replaces the old
+	stopPrev, prevDone := c.stopReconnector, c.reconnectorDone
+	c.stopReconnector, c.reconnectorDone = cancel, done
+	c.mu.Unlock()
+	if stopPrev != nil {
+		stopPrev()
+		<-prevDone
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			probeCtx, cancel := context.WithTimeout(ctx, reconnectProbeTimeout)
+			err := c.probe(probeCtx)
+			cancel()
+			if ctx.Err() != nil {
+				// Stopped mid-probe; the failure says nothing about Qdrant
+				return
+			}
+			c.setConnected(err == nil)
+			if err != nil {
+				c.logger.Debug("health probe failed", "address", c.address, "error", err)
+				continue
+			}
+			if err := c.createPendingCollections(ctx); err != nil {
+				c.logger.Warn("failed to create collections after reconnecting", "error", err)
+			}
+		}
+	}
+}
+
+// Connected reports whether the last probe or operation reached Qdrant
+func (c *QdrantClient) Connected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connected
+}
+
+// ensureConnected tries one reconnect when the client is marked disconnected
+func (c *QdrantClient) ensureConnected(ctx context.Context) error {
+	if c.Connected() {
+		return nil
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, reconnectProbeTimeout)
+	defer cancel()
+	if err := c.probe(probeCtx); err != nil {
+		return fmt.Errorf("%w: %v", ErrQdrantUnavailable, err)
+	}
+	c.setConnected(true)
+	if err := c.createPendingCollections(ctx); err != nil {
+		c.logger.Warn("failed to create collections after reconnecting", "error", err)
+	}
+	return nil
+}
+
+// withReconnect runs op, and if it fails with a connection error, reconnects and runs
+// it once more
+func (c *QdrantClient) withReconnect(ctx context.Context, op func() error) error {
+	if err := c.ensureConnected(ctx); err != nil {
+		return err
+	}
+	err := op()
+	if !isConnectionError(err) {
+		return err
+	}
+
+	c.setConnected(false)
+	if err := c.ensureConnected(ctx); err != nil {
+		return err
+	}
+	return op()
+}
+
+// setConnected records the connection state, logging transitions
+func (c *QdrantClient) setConnected(connected bool) {
+	c.mu.Lock()
+	changed := c.connected != connected
+	c.connected = connected
+	c.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if connected {
+		c.logger.Info("connected", "address", c.address)
+	} else {
+		c.logger.Warn("lost connection", "address", c.address)
+	}
+}
+
+// probe checks that Qdrant answers
+func (c *QdrantClient) probe(ctx context.Context) error {
+	return c.HealthCheck(ctx)
+}
+
+// isConnectionError reports whether err means Qdrant couldn't be reached, as opposed to
+// rejecting the request
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var qerr *qdrantError
+	return errors.As(err, &netErr) ||
+		// A proxy or gateway in front of a Qdrant that is down or restarting
+		(errors.As(err, &qerr) && qerr.StatusCode >= http.StatusBadGateway && qerr.StatusCode <= http.StatusGatewayTimeout) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, ErrQdrantUnavailable)
+}
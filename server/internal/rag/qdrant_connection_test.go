@@ -0,0 +1,265 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeQdrant answers /healthz, collection lookups and creation, and an empty scroll, and
+// can be stopped and restarted on the same address to simulate a Qdrant restart
+type fakeQdrant struct {
+	t       *testing.T
+	addr    string
+	server  *httptest.Server
+	healthy atomic.Bool
+	probes  atomic.Int32
+
+	mu          sync.Mutex
+	collections []string // Created collections, in order
+}
+
+func startFakeQdrant(t *testing.T) *fakeQdrant {
+	t.Helper()
+	f := &fakeQdrant{t: t}
+	f.healthy.Store(true)
+	f.start("127.0.0.1:0")
+	t.Cleanup(func() { f.server.Close() })
+	return f
+}
+
+func (f *fakeQdrant) start(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		f.t.Fatalf("listen on %s: %v", addr, err)
+	}
+	f.addr = listener.Addr().String()
+	f.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			f.probes.Add(1)
+			if !f.healthy.Load() {
+				http.Error(w, "starting", http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, "healthz check passed")
+			return
+		}
+		if name, ok := strings.CutPrefix(r.URL.Path, "/collections/"); ok && !strings.Contains(name, "/") {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			switch {
+			case r.Method == http.MethodPut:
+				f.collections = append(f.collections, name)
+			case !slices.Contains(f.collections, name):
+				http.Error(w, `{"status":{"error":"Not found"}}`, http.StatusNotFound)
+				return
+			}
+			writeQdrantResult(w, true)
+			return
+		}
+		writeQdrantResult(w, map[string]interface{}{"points": []interface{}{}, "next_page_offset": nil})
+	}))
+	f.server.Listener.Close()
+	f.server.Listener = listener
+	f.server.Start()
+}
+
+// createdCollections returns the collections created on the server
+func (f *fakeQdrant) createdCollections() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.collections)
+}
+
+func (f *fakeQdrant) client(opts ...QdrantOption) *QdrantClient {
+	host, portText, _ := net.SplitHostPort(f.addr)
+	port, _ := strconv.Atoi(portText)
+	return NewQdrantClient(host, port, "", opts...)
+}
+
+func TestQdrantHealthCheckProbesServer(t *testing.T) {
+	f := startFakeQdrant(t)
+	client := f.client()
+
+	if err := client.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck on a healthy server: %v", err)
+	}
+	f.healthy.Store(false)
+	if err := client.HealthCheck(context.Background()); !errors.Is(err, ErrQdrantUnavailable) {
+		t.Fatalf("HealthCheck on an unhealthy server = %v, want ErrQdrantUnavailable", err)
+	}
+	f.server.Close()
+	if err := client.HealthCheck(context.Background()); err == nil {
+		t.Fatal("HealthCheck on a stopped server succeeded")
+	}
+}
+
+func TestQdrantConnectRetriesUntilHealthy(t *testing.T) {
+	f := startFakeQdrant(t)
+	f.healthy.Store(false)
+	time.AfterFunc(700*time.Millisecond, func() { f.healthy.Store(true) })
+
+	client := f.client(WithConnectRetry(5 * time.Second))
+	if !client.Connected() || f.probes.Load() < 2 {
+		t.Fatalf("connected %v after %d probes, want connected after retrying", client.Connected(), f.probes.Load())
+	}
+}
+
+func TestQdrantStartsDisconnectedAndReconnects(t *testing.T) {
+	f := startFakeQdrant(t)
+	f.healthy.Store(false)
+
+	client := f.client()
+	defer client.Close()
+	if client.Connected() {
+		t.Fatal("client connected to an unhealthy server")
+	}
+	ctx := context.Background()
+	if err := client.InitializeCollections(ctx, 64, "", nil); !errors.Is(err, ErrQdrantUnavailable) {
+		t.Fatalf("InitializeCollections while Qdrant is down = %v, want ErrQdrantUnavailable", err)
+	}
+
+	f.healthy.Store(true)
+	runReconnector(ctx, client, 10*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for !client.Connected() || len(f.createdCollections()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connected %v with collections %v, want connected with all three created", client.Connected(), f.createdCollections())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, name := range []string{defaultCollectionName, memoryCollectionName, decisionCollectionName} {
+		if !slices.Contains(f.createdCollections(), name) {
+			t.Errorf("collection %s not created after reconnecting", name)
+		}
+	}
+}
+
+func TestQdrantReconnectsAfterRestart(t *testing.T) {
+	f := startFakeQdrant(t)
+	client := f.client()
+	ctx := context.Background()
+
+	addr := f.addr
+	f.server.Close()
+	if _, err := client.Scroll(ctx, "memories", nil, 10); !errors.Is(err, ErrQdrantUnavailable) {
+		t.Fatalf("Scroll while Qdrant is down = %v, want ErrQdrantUnavailable", err)
+	}
+	if client.Connected() {
+		t.Fatal("client still marked connected after a connection error")
+	}
+
+	f.start(addr)
+	if _, err := client.Scroll(ctx, "memories", nil, 10); err != nil {
+		t.Fatalf("Scroll after restart: %v", err)
+	}
+	if !client.Connected() {
+		t.Fatal("client not marked connected after reconnecting")
+	}
+}
+
+func TestQdrantReconnectorTracksHealth(t *testing.T) {
+	f := startFakeQdrant(t)
+	client := f.client()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.StartReconnector(ctx, 10*time.Millisecond)
+
+	waitFor := func(connected bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for client.Connected() != connected {
+			if time.Now().After(deadline) {
+				t.Fatalf("Connected() never became %v", connected)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	f.healthy.Store(false)
+	waitFor(false)
+	f.healthy.Store(true)
+	waitFor(true)
+}
+
+// runReconnector starts the client's reconnector and returns a channel closed when it returns
+func runReconnector(ctx context.Context, client *QdrantClient, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		client.StartReconnector(ctx, interval)
+		close(done)
+	}()
+	return done
+}
+
+// waitForProbes waits until the fake server has seen more than n health probes
+func waitForProbes(t *testing.T, f *fakeQdrant, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for f.probes.Load() <= n {
+		if time.Now().After(deadline) {
+			t.Fatalf("no health probe after %d", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQdrantCloseStopsReconnector(t *testing.T) {
+	f := startFakeQdrant(t)
+	client := f.client()
+
+	done := runReconnector(context.Background(), client, 10*time.Millisecond)
+	waitForProbes(t, f, f.probes.Load())
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Close waits for the reconnector, so it has already returned
+	select {
+	case <-done:
+	default:
+		t.Fatal("reconnector still running after Close")
+	}
+	probes := f.probes.Load()
+	time.Sleep(50 * time.Millisecond)
+	if got := f.probes.Load(); got != probes {
+		t.Errorf("%d probes after Close", got-probes)
+	}
+
+	// A reconnector started after Close never runs
+	finished := make(chan struct{})
+	go func() {
+		client.StartReconnector(context.Background(), 10*time.Millisecond)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("StartReconnector ran after Close")
+	}
+}
+
+func TestQdrantReconnectorReplacesPrevious(t *testing.T) {
+	f := startFakeQdrant(t)
+	client := f.client()
+	defer client.Close()
+
+	first := runReconnector(context.Background(), client, 10*time.Millisecond)
+	waitForProbes(t, f, f.probes.Load())
+	runReconnector(context.Background(), client, 10*time.Millisecond)
+
+	select {
+	case <-first:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first reconnector kept running after a second one started")
+	}
+}
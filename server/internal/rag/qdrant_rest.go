@@ -0,0 +1,206 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// pointIDKey is the payload field holding a point's caller-supplied ID. Qdrant only
+// accepts integer and UUID IDs, so points are stored under a UUID derived from it.
+const pointIDKey = "point_id"
+
+// scrollPageSize is how many points one scroll request fetches
+const scrollPageSize = 256
+
+// qdrantError is a non-2xx reply from the Qdrant REST API
+type qdrantError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *qdrantError) Error() string {
+	return fmt.Sprintf("qdrant returned %d: %s", e.StatusCode, e.Message)
+}
+
+// qdrantFilter is the REST form of Filter
+type qdrantFilter struct {
+	Must    []qdrantCondition `json:"must,omitempty"`
+	MustNot []qdrantCondition `json:"must_not,omitempty"`
+	Should  []qdrantCondition `json:"should,omitempty"`
+}
+
+// qdrantCondition is the REST form of a field Condition
+type qdrantCondition struct {
+	Key   string       `json:"key"`
+	Match *qdrantMatch `json:"match,omitempty"`
+	Range *qdrantRange `json:"range,omitempty"`
+}
+
+// qdrantMatch matches a field against one value or any of several
+type qdrantMatch struct {
+	Value interface{} `json:"value,omitempty"`
+	Any   []string    `json:"any,omitempty"`
+}
+
+// qdrantRange is the REST form of Range
+type qdrantRange struct {
+	GT  *float64 `json:"gt,omitempty"`
+	GTE *float64 `json:"gte,omitempty"`
+	LT  *float64 `json:"lt,omitempty"`
+	LTE *float64 `json:"lte,omitempty"`
+}
+
+// qdrantPoint is a point as Qdrant stores and returns it
+type qdrantPoint struct {
+	ID      interface{}            `json:"id"`
+	Vector  []float64              `json:"vector,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	Score   float64                `json:"score,omitempty"`
+}
+
+// toQdrantFilter translates a Filter into Qdrant's filter JSON; a nil filter is nil
+func toQdrantFilter(f *Filter) (*qdrantFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	var out qdrantFilter
+	clauses := []struct {
+		conditions []Condition
+		dst        *[]qdrantCondition
+	}{
+		{f.Must, &out.Must},
+		{f.MustNot, &out.MustNot},
+		{f.Should, &out.Should},
+	}
+	for _, clause := range clauses {
+		for _, cond := range clause.conditions {
+			converted, err := toQdrantCondition(cond)
+			if err != nil {
+				return nil, err
+			}
+			*clause.dst = append(*clause.dst, converted)
+		}
+	}
+	return &out, nil
+}
+
+// toQdrantCondition translates one Condition, rejecting ops and values Qdrant can't express
+func toQdrantCondition(c Condition) (qdrantCondition, error) {
+	if c.Key == "" {
+		return qdrantCondition{}, fmt.Errorf("filter condition has no key")
+	}
+
+	switch c.Op {
+	case "match", "":
+		switch c.Match.(type) {
+		case string, bool, int, int32, int64, uint64:
+		default:
+			return qdrantCondition{}, fmt.Errorf("filter %s: match needs a string, integer or bool, got %T", c.Key, c.Match)
+		}
+		return qdrantCondition{Key: c.Key, Match: &qdrantMatch{Value: c.Match}}, nil
+	case "match_any":
+		values, ok := c.Match.([]string)
+		if !ok {
+			return qdrantCondition{}, fmt.Errorf("filter %s: match_any needs []string, got %T", c.Key, c.Match)
+		}
+		return qdrantCondition{Key: c.Key, Match: &qdrantMatch{Any: values}}, nil
+	case "range":
+		bounds, ok := c.Match.(Range)
+		if !ok {
+			return qdrantCondition{}, fmt.Errorf("filter %s: range needs a Range, got %T", c.Key, c.Match)
+		}
+		return qdrantCondition{Key: c.Key, Range: &qdrantRange{GT: bounds.GT, GTE: bounds.GTE, LT: bounds.LT, LTE: bounds.LTE}}, nil
+	default:
+		return qdrantCondition{}, fmt.Errorf("filter %s: unsupported op %q", c.Key, c.Op)
+	}
+}
+
+// qdrantPointID derives the UUID a caller-supplied ID is stored under, in the style of
+// a version 5 UUID so the same ID always maps to the same point
+func qdrantPointID(id string) string {
+	h := sha1.Sum([]byte(id))
+	h[6] = (h[6] & 0x0f) | 0x50
+	h[8] = (h[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// toQdrantPoint copies a point for upload, recording its ID in the payload
+func toQdrantPoint(point *Point) qdrantPoint {
+	payload := make(map[string]interface{}, len(point.Payload)+1)
+	for k, v := range point.Payload {
+		payload[k] = v
+	}
+	payload[pointIDKey] = point.ID
+	return qdrantPoint{ID: qdrantPointID(point.ID), Vector: point.Vector, Payload: payload}
+}
+
+// originalID returns the caller-supplied ID of a returned point and strips it from the payload
+func (p *qdrantPoint) originalID() string {
+	if id, ok := p.Payload[pointIDKey].(string); ok {
+		delete(p.Payload, pointIDKey)
+		return id
+	}
+	return fmt.Sprint(p.ID)
+}
+
+// do sends a request to the Qdrant REST API and decodes the reply's result into out,
+// which may be nil
+func (q *QdrantClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode qdrant request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, q.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if q.apiKey != "" {
+		req.Header.Set("api-key", q.apiKey)
+	}
+
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+		Status interface{}     `json:"status"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&envelope)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message := resp.Status
+		if status, ok := envelope.Status.(map[string]interface{}); ok {
+			if text, ok := status["error"].(string); ok {
+				message = text
+			}
+		}
+		return &qdrantError{StatusCode: resp.StatusCode, Message: message}
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failed to decode qdrant response: %w", decodeErr)
+	}
+	if out == nil || len(envelope.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, out); err != nil {
+		return fmt.Errorf("failed to decode qdrant result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package rag
+
+import "context"
+
+// VectorBackend is the point storage and similarity search a MemoryStore runs on.
+// QdrantClient is the production backend; InMemoryVectorStore needs no server.
+type VectorBackend interface {
+	VectorSize() int
+	Distance(collectionName string) string
+	InsertPoints(ctx context.Context, collectionName string, points []*Point) error
+	InsertPoint(ctx context.Context, collectionName string, point *Point) error
+	GetPoint(ctx context.Context, collectionName string, id string) (*Point, error)
+	Search(ctx context.Context, collectionName string, vector []float64, opts *SearchOptions) ([]*SearchResult, error)
+	Scroll(ctx context.Context, collectionName string, filter *Filter, limit int) ([]*SearchResult, error)
+	DeletePoints(ctx context.Context, collectionName string, ids []string) error
+	DeleteByFilter(ctx context.Context, collectionName string, filter *Filter) (int, error)
+	GetCollectionInfo(ctx context.Context, collectionName string) (*CollectionInfo, error)
+}
+
+// Embedder turns text into vectors; EmbeddingService implements it
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+	EmbedBatch(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// Both backends satisfy VectorBackend
+var (
+	_ VectorBackend = (*QdrantClient)(nil)
+	_ VectorBackend = (*InMemoryVectorStore)(nil)
+	_ Embedder      = (*EmbeddingService)(nil)
+	_ Embedder      = (*HashEmbedder)(nil)
+)
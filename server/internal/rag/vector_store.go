@@ -0,0 +1,116 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"Cyber-Jianghu/server/internal/interfaces"
+)
+
+// memoryVectorStore adapts a MemoryStore to interfaces.VectorStore. Session IDs map to
+// story IDs and memory types pass through unchanged.
+type memoryVectorStore struct {
+	store *MemoryStore
+}
+
+var _ interfaces.VectorStore = (*memoryVectorStore)(nil)
+
+// AsVectorStore returns the store behind the generic interfaces.VectorStore contract
+func (s *MemoryStore) AsVectorStore() interfaces.VectorStore {
+	return &memoryVectorStore{store: s}
+}
+
+// StoreMemory stores a memory, using its embedding when set and embedding its content
+// otherwise. A memory without an ID gets one from BuildMemoryID.
+func (v *memoryVectorStore) StoreMemory(ctx context.Context, memory *interfaces.Memory) error {
+	m := fromInterfaceMemory(memory)
+	if m.ID == "" {
+		m.ID = BuildMemoryID(m.Type, m.StoryID)
+		memory.ID = m.ID
+	}
+	if len(memory.Embedding) > 0 {
+		return v.store.storeWithVector(ctx, m, memory.Embedding)
+	}
+	return v.store.StoreMemory(ctx, m)
+}
+
+// SearchMemories searches every story for memories related to query
+func (v *memoryVectorStore) SearchMemories(ctx context.Context, query string, limit int) ([]*interfaces.Memory, error) {
+	memories, err := v.store.SearchRelatedMemories(ctx, "", query, limit, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return toInterfaceMemories(memories), nil
+}
+
+// SearchMemoriesBySession returns a story's most recent memories, newest first
+func (v *memoryVectorStore) SearchMemoriesBySession(ctx context.Context, sessionID string, limit int) ([]*interfaces.Memory, error) {
+	filter := &Filter{Must: []Condition{{Key: "story_id", Match: sessionID, Op: "match"}}}
+	results, err := v.store.backend.Scroll(ctx, v.store.collection, filter, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memories: %w", err)
+	}
+
+	memories := make([]*Memory, 0, len(results))
+	for _, result := range results {
+		if memory, err := v.store.resultToMemory(result); err == nil {
+			memories = append(memories, memory)
+		}
+	}
+	sort.SliceStable(memories, func(i, j int) bool {
+		return memories[i].Timestamp > memories[j].Timestamp
+	})
+	if limit > 0 && len(memories) > limit {
+		memories = memories[:limit]
+	}
+	return toInterfaceMemories(memories), nil
+}
+
+// UpdateMemory merges updates into a memory; a "content" update re-embeds it
+func (v *memoryVectorStore) UpdateMemory(ctx context.Context, memoryID string, updates map[string]interface{}) error {
+	return v.store.updateMemory(ctx, memoryID, updates)
+}
+
+// DeleteMemory removes a memory
+func (v *memoryVectorStore) DeleteMemory(ctx context.Context, memoryID string) error {
+	if err := v.store.backend.DeletePoints(ctx, v.store.collection, []string{memoryID}); err != nil {
+		return fmt.Errorf("failed to delete memory: %w", err)
+	}
+	return nil
+}
+
+// DeleteSessionMemories removes all memories for a story
+func (v *memoryVectorStore) DeleteSessionMemories(ctx context.Context, sessionID string) error {
+	_, err := v.store.DeleteMemoriesByStory(ctx, sessionID)
+	return err
+}
+
+// fromInterfaceMemory converts a generic memory to the story memory stored in Qdrant
+func fromInterfaceMemory(memory *interfaces.Memory) *Memory {
+	return &Memory{
+		ID:        memory.ID,
+		Type:      MemoryType(memory.Type),
+		Content:   memory.Content,
+		Timestamp: memory.Timestamp,
+		StoryID:   memory.SessionID,
+		Metadata:  memory.Metadata,
+	}
+}
+
+// toInterfaceMemories converts story memories to the generic memory type
+func toInterfaceMemories(memories []*Memory) []*interfaces.Memory {
+	converted := make([]*interfaces.Memory, len(memories))
+	for i, memory := range memories {
+		converted[i] = &interfaces.Memory{
+			ID:        memory.ID,
+			SessionID: memory.StoryID,
+			Type:      interfaces.MemoryType(memory.Type),
+			Content:   memory.Content,
+			Metadata:  memory.Metadata,
+			Embedding: memory.Vector,
+			Timestamp: memory.Timestamp,
+		}
+	}
+	return converted
+}
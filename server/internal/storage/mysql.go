@@ -5,6 +5,7 @@ import (
 	"Cyber-Jianghu/server/internal/models"
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"gorm.io/driver/mysql"
@@ -41,14 +42,26 @@ func NewMySQLStore(cfg config.MySQLConfig) (*MySQLStore, error) {
 	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	// Auto migrate tables (will be expanded in later phases)
-	if err := db.AutoMigrate(); err != nil {
+	if err := migrateTables(db); err != nil {
 		return nil, err
 	}
 
 	return &MySQLStore{db: db}, nil
 }
 
+// migrateTables creates or updates the tables for every model the store persists
+func migrateTables(db *gorm.DB) error {
+	if err := db.AutoMigrate(
+		&models.Story{},
+		&models.StoryDecision{},
+		&models.StoryMemory{},
+		&models.Danmaku{},
+	); err != nil {
+		return fmt.Errorf("failed to migrate tables: %w", err)
+	}
+	return nil
+}
+
 func (s *MySQLStore) Close() error {
 	sqlDB, err := s.db.DB()
 	if err != nil {
@@ -57,6 +70,15 @@ func (s *MySQLStore) Close() error {
 	return sqlDB.Close()
 }
 
+// Ping checks that MySQL is reachable
+func (s *MySQLStore) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
 func (s *MySQLStore) GetDB() *gorm.DB {
 	return s.db
 }
@@ -175,3 +197,54 @@ func (s *MySQLStore) GetMemoryCount(ctx context.Context, storyID string) (int64,
 	err := query.Count(&count).Error
 	return count, err
 }
+
+// SaveDanmaku archives a danmaku message
+func (s *MySQLStore) SaveDanmaku(ctx context.Context, danmaku *models.Danmaku) error {
+	return s.db.WithContext(ctx).Create(danmaku).Error
+}
+
+// GetDanmakuByRoom retrieves archived danmaku for a room within a time range
+func (s *MySQLStore) GetDanmakuByRoom(ctx context.Context, roomID string, start, end time.Time, limit int) ([]models.Danmaku, error) {
+	var danmakus []models.Danmaku
+	query := s.db.WithContext(ctx).Where("room_id = ?", roomID)
+	if !start.IsZero() {
+		query = query.Where("timestamp >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where("timestamp <= ?", end)
+	}
+	query = query.Order("timestamp ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&danmakus).Error
+	return danmakus, err
+}
+
+// CleanExpiredDanmaku removes archived danmaku older than the retention period
+func (s *MySQLStore) CleanExpiredDanmaku(ctx context.Context, retention time.Duration) (int64, error) {
+	result := s.db.WithContext(ctx).Where("timestamp < ?", time.Now().Add(-retention)).Delete(&models.Danmaku{})
+	return result.RowsAffected, result.Error
+}
+
+// StartDanmakuCleaner periodically removes archived danmaku older than the retention period
+func (s *MySQLStore) StartDanmakuCleaner(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.CleanExpiredDanmaku(ctx, retention)
+			if err != nil {
+				log.Printf("[MySQLStore] Failed to clean expired danmaku: %v", err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("[MySQLStore] Cleaned %d expired danmaku", count)
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Cyber-Jianghu/server/internal/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordedStatement is one statement the fake driver received
+type recordedStatement struct {
+	query string
+	args  []driver.NamedValue
+}
+
+// recordingDriver is a database/sql connector that records every statement instead of
+// running it. Exec reports rowsAffected rows, counts answer a single row of 0 and every
+// other query returns no rows.
+type recordingDriver struct {
+	mu           sync.Mutex
+	statements   []recordedStatement
+	rowsAffected int64
+}
+
+func (d *recordingDriver) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{d}, nil
+}
+func (d *recordingDriver) Driver() driver.Driver { return nil }
+
+func (d *recordingDriver) record(query string, args []driver.NamedValue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, recordedStatement{query: query, args: args})
+}
+
+// matching returns the recorded statements that start with prefix
+func (d *recordingDriver) matching(prefix string) []recordedStatement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []recordedStatement
+	for _, stmt := range d.statements {
+		if strings.HasPrefix(stmt.query, prefix) {
+			out = append(out, stmt)
+		}
+	}
+	return out
+}
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *recordingConn) Close() error                        { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c *recordingConn) Commit() error                       { return nil }
+func (c *recordingConn) Rollback() error                     { return nil }
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.record(query, args)
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	return recordingResult{c.d.rowsAffected}, nil
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.record(query, args)
+	if !strings.Contains(strings.ToLower(query), "count(") {
+		return &zeroRows{done: true}, nil
+	}
+	return &zeroRows{}, nil
+}
+
+type recordingResult struct{ rows int64 }
+
+func (r recordingResult) LastInsertId() (int64, error) { return 1, nil }
+func (r recordingResult) RowsAffected() (int64, error) { return r.rows, nil }
+
+// zeroRows is a single-column result holding one row of 0, or none once done
+type zeroRows struct{ done bool }
+
+func (r *zeroRows) Columns() []string { return []string{"count"} }
+func (r *zeroRows) Close() error      { return nil }
+
+func (r *zeroRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(0)
+	return nil
+}
+
+// newRecordingStore returns a MySQLStore whose statements are recorded by the returned driver
+func newRecordingStore(t *testing.T) (*MySQLStore, *recordingDriver) {
+	t.Helper()
+	d := &recordingDriver{}
+	sqlDB := sql.OpenDB(d)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open gorm: %v", err)
+	}
+	return &MySQLStore{db: db}, d
+}
+
+func TestSaveDanmakuArchivesMessage(t *testing.T) {
+	store, d := newRecordingStore(t)
+	sent := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+
+	err := store.SaveDanmaku(context.Background(), &models.Danmaku{
+		Platform:  "bilibili",
+		RoomID:    "7300",
+		UserID:    "42",
+		Username:  "侠客",
+		Content:   "投票2",
+		Timestamp: sent,
+	})
+	if err != nil {
+		t.Fatalf("SaveDanmaku: %v", err)
+	}
+
+	inserts := d.matching("INSERT INTO `danmakus`")
+	if len(inserts) != 1 {
+		t.Fatalf("got %d danmaku inserts, want 1", len(inserts))
+	}
+	values := make(map[interface{}]bool)
+	for _, arg := range inserts[0].args {
+		values[arg.Value] = true
+	}
+	for _, want := range []interface{}{"bilibili", "7300", "42", "侠客", "投票2", sent} {
+		if !values[want] {
+			t.Errorf("insert %s missing value %v", inserts[0].query, want)
+		}
+	}
+}
+
+func TestCleanExpiredDanmakuDeletesBeforeCutoff(t *testing.T) {
+	store, d := newRecordingStore(t)
+	d.rowsAffected = 3
+
+	before := time.Now()
+	count, err := store.CleanExpiredDanmaku(context.Background(), 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("CleanExpiredDanmaku: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("count = %d, want the 3 rows deleted", count)
+	}
+
+	deletes := d.matching("DELETE FROM `danmakus`")
+	if len(deletes) != 1 {
+		t.Fatalf("got %d danmaku deletes, want 1", len(deletes))
+	}
+	if !strings.Contains(deletes[0].query, "timestamp <") || len(deletes[0].args) != 1 {
+		t.Fatalf("delete = %s with %d args, want a timestamp cutoff", deletes[0].query, len(deletes[0].args))
+	}
+	cutoff, ok := deletes[0].args[0].Value.(time.Time)
+	if !ok {
+		t.Fatalf("cutoff arg is %T, want time.Time", deletes[0].args[0].Value)
+	}
+	if want := before.Add(-7 * 24 * time.Hour); cutoff.Before(want.Add(-time.Second)) || cutoff.After(time.Now().Add(-7*24*time.Hour)) {
+		t.Errorf("cutoff = %v, want about %v", cutoff, want)
+	}
+}
+
+func TestDanmakuCleanerStopsWithContext(t *testing.T) {
+	store, d := newRecordingStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		store.StartDanmakuCleaner(ctx, time.Hour, 5*time.Millisecond)
+		close(stopped)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(d.matching("DELETE FROM `danmakus`")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("cleaner never purged expired danmaku")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cleaner still running after its context was cancelled")
+	}
+}
+
+func TestMigrateTablesCreatesStoryTables(t *testing.T) {
+	store, d := newRecordingStore(t)
+	if err := migrateTables(store.db); err != nil {
+		t.Fatalf("migrateTables: %v", err)
+	}
+
+	// The recording driver reports no existing tables, so each one is created in full
+	want := map[string][]string{
+		"stories":         {"`id` varchar(191)", "`session_id` varchar(64)", "`status` varchar(32)", "`current_scene` varchar(128)", "`json_context` text", "`deleted_at` datetime(3)", "PRIMARY KEY (`id`)"},
+		"story_decisions": {"`id` varchar(191)", "`story_id` varchar(191)", "`action` text", "`selected` boolean", "`timestamp` bigint", "INDEX `idx_story_decisions_story_id` (`story_id`)"},
+		"story_memories":  {"`id` varchar(191)", "`story_id` varchar(191)", "`type` varchar(32)", "`metadata` text", "`expires_at` datetime(3)", "INDEX `idx_story_memories_expires_at` (`expires_at`)"},
+		"danmakus":        {"`id` bigint unsigned AUTO_INCREMENT", "`room_id` varchar(64)", "`gift_value` bigint", "INDEX `idx_danmaku_room_time` (`room_id`,`timestamp`)"},
+	}
+	for table, columns := range want {
+		creates := d.matching("CREATE TABLE `" + table + "`")
+		if len(creates) != 1 {
+			t.Errorf("got %d CREATE TABLE statements for %s, want 1", len(creates), table)
+			continue
+		}
+		for _, column := range columns {
+			if !strings.Contains(creates[0].query, column) {
+				t.Errorf("%s is missing %s in %s", table, column, creates[0].query)
+			}
+		}
+	}
+}
+
+func TestGetDanmakuByRoomFiltersRangeAndLimit(t *testing.T) {
+	store, d := newRecordingStore(t)
+	start := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	if _, err := store.GetDanmakuByRoom(context.Background(), "7300", start, end, 50); err != nil {
+		t.Fatalf("GetDanmakuByRoom: %v", err)
+	}
+
+	selects := d.matching("SELECT * FROM `danmakus`")
+	if len(selects) != 1 {
+		t.Fatalf("got %d danmaku selects, want 1", len(selects))
+	}
+	stmt := selects[0]
+	for _, clause := range []string{"room_id = ?", "timestamp >= ?", "timestamp <= ?", "ORDER BY timestamp ASC", "LIMIT ?"} {
+		if !strings.Contains(stmt.query, clause) {
+			t.Errorf("query %q missing %q", stmt.query, clause)
+		}
+	}
+	want := []interface{}{"7300", start, end, int64(50)}
+	if len(stmt.args) != len(want) {
+		t.Fatalf("query args = %v, want %v", stmt.args, want)
+	}
+	for i, arg := range stmt.args {
+		if arg.Value != want[i] {
+			t.Errorf("arg %d = %v, want %v", i, arg.Value, want[i])
+		}
+	}
+}
+
+func TestGetDanmakuByRoomOmitsUnsetBounds(t *testing.T) {
+	store, d := newRecordingStore(t)
+
+	if _, err := store.GetDanmakuByRoom(context.Background(), "7300", time.Time{}, time.Time{}, 0); err != nil {
+		t.Fatalf("GetDanmakuByRoom: %v", err)
+	}
+
+	selects := d.matching("SELECT * FROM `danmakus`")
+	if len(selects) != 1 {
+		t.Fatalf("got %d danmaku selects, want 1", len(selects))
+	}
+	query := selects[0].query
+	if !strings.Contains(query, "room_id = ?") || strings.Contains(query, "timestamp >=") ||
+		strings.Contains(query, "timestamp <=") || strings.Contains(query, "LIMIT") {
+		t.Errorf("query %q filters on unset bounds or limits without a limit", query)
+	}
+	if len(selects[0].args) != 1 || selects[0].args[0].Value != "7300" {
+		t.Errorf("query args = %v, want only the room ID", selects[0].args)
+	}
+}
@@ -37,6 +37,11 @@ func (s *RedisStore) Close() error {
 	return s.client.Close()
 }
 
+// Ping checks that Redis is reachable
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
 func (s *RedisStore) GetClient() *redis.Client {
 	return s.client
 }
@@ -46,6 +51,11 @@ func (s *RedisStore) Set(ctx context.Context, key string, value interface{}, exp
 	return s.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetNX sets key only if it does not exist, reporting whether it was set
+func (s *RedisStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, expiration).Result()
+}
+
 func (s *RedisStore) Get(ctx context.Context, key string) (string, error) {
 	return s.client.Get(ctx, key).Result()
 }
@@ -147,3 +157,58 @@ func (s *RedisStore) GetDanmakuCount(ctx context.Context) (int64, error) {
 func (s *RedisStore) ClearDanmaku(ctx context.Context) error {
 	return s.Del(ctx, danmakuListKey)
 }
+
+// Story timeline methods
+const (
+	timelineKeyPrefix  = "story:timeline:"
+	timelineMaxEvents  = 1000 // Oldest events are trimmed past this
+	timelineTTL        = 24 * time.Hour
+)
+
+// TimelineEvent records one decision the audience made for a story
+type TimelineEvent struct {
+	Turn      int                `json:"turn"`       // Story turn the decision produced
+	Timestamp int64              `json:"timestamp"`
+	Source    string             `json:"source"`     // "vote" or "action"
+	OptionID  string             `json:"option_id,omitempty"`
+	Choice    string             `json:"choice"`     // Winning option text or merged action
+	Votes     map[string]float64 `json:"votes"`      // Option ID or action -> weighted count
+	Voters    int                `json:"voters,omitempty"`
+	Summary   string             `json:"summary"`    // Opening of the resulting narrative
+}
+
+// AppendTimelineEvent adds an event to the end of a story's timeline and refreshes its TTL
+func (s *RedisStore) AppendTimelineEvent(ctx context.Context, storyID string, event TimelineEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal timeline event: %w", err)
+	}
+
+	key := timelineKeyPrefix + storyID
+	pipe := s.client.TxPipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, -timelineMaxEvents, -1)
+	pipe.Expire(ctx, key, timelineTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to append timeline event: %w", err)
+	}
+	return nil
+}
+
+// GetTimeline returns a story's timeline oldest first; an unknown story has an empty timeline
+func (s *RedisStore) GetTimeline(ctx context.Context, storyID string) ([]TimelineEvent, error) {
+	results, err := s.client.LRange(ctx, timelineKeyPrefix+storyID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timeline: %w", err)
+	}
+
+	events := make([]TimelineEvent, 0, len(results))
+	for _, result := range results {
+		var event TimelineEvent
+		if err := json.Unmarshal([]byte(result), &event); err != nil {
+			continue // Skip invalid entries
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,230 @@
+package web
+
+import (
+	"Cyber-Jianghu/server/internal/engine"
+	"Cyber-Jianghu/server/internal/rag"
+	"Cyber-Jianghu/server/internal/storage"
+	"context"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultActionWindow = 5 * time.Second
+	maxBatchedActions   = 3
+)
+
+// defaultActionCommands maps danmaku command verbs to story action prefixes
+var defaultActionCommands = map[string]string{
+	"attack":  "攻击",
+	"defend":  "防御",
+	"flee":    "逃跑",
+	"talk":    "交谈",
+	"explore": "探索",
+	"rest":    "休息",
+}
+
+// ActionBatcher turns danmaku action commands into story actions.
+// Commands arriving within one window are merged into a single story generation call.
+type ActionBatcher struct {
+	storyEngine *engine.StoryEngine
+	hub         *DanmakuHub
+	window      time.Duration
+	commands    map[string]string
+	timeline    *storage.RedisStore // Records each applied batch; nil disables it
+	logger      *slog.Logger
+
+	mu      sync.Mutex
+	storyID string
+	pending map[string]int // Action text -> occurrences
+	order   []string       // First-seen order for stable tie-breaking
+	timer   *time.Timer
+	running bool
+}
+
+// NewActionBatcher creates a batcher; extra commands override or extend the defaults
+func NewActionBatcher(storyEngine *engine.StoryEngine, hub *DanmakuHub, window time.Duration, commands map[string]string) *ActionBatcher {
+	if window <= 0 {
+		window = defaultActionWindow
+	}
+
+	merged := make(map[string]string, len(defaultActionCommands)+len(commands))
+	for verb, prefix := range defaultActionCommands {
+		merged[verb] = prefix
+	}
+	for verb, prefix := range commands {
+		merged[strings.ToLower(verb)] = prefix
+	}
+
+	return &ActionBatcher{
+		storyEngine: storyEngine,
+		hub:         hub,
+		window:      window,
+		commands:    merged,
+		logger:      slog.Default().With("component", "actions"),
+		pending:     make(map[string]int),
+	}
+}
+
+// SetStory sets the story that actions are applied to and drops pending actions
+func (b *ActionBatcher) SetStory(storyID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.storyID = storyID
+	b.resetLocked()
+}
+
+// SetTimeline sets the store each applied batch is recorded to
+func (b *ActionBatcher) SetTimeline(store *storage.RedisStore) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.timeline = store
+}
+
+// SetLogger sets the structured logger
+func (b *ActionBatcher) SetLogger(logger *slog.Logger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.logger = logger.With("component", "actions")
+}
+
+// Commands returns a copy of the command verbs and the story action prefix each maps to
+func (b *ActionBatcher) Commands() map[string]string {
+	commands := make(map[string]string, len(b.commands))
+	for verb, prefix := range b.commands {
+		commands[verb] = prefix
+	}
+	return commands
+}
+
+// Submit queues an action command with the text after its verb as the target;
+// unrecognized verbs are ignored
+func (b *ActionBatcher) Submit(verb string, target string) bool {
+	prefix, ok := b.commands[strings.ToLower(verb)]
+	if !ok {
+		return false
+	}
+
+	target = strings.TrimSpace(target)
+	action := prefix
+	if target != "" {
+		action = prefix + " " + target
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.storyID == "" || b.storyEngine == nil {
+		return false
+	}
+
+	if _, seen := b.pending[action]; !seen {
+		b.order = append(b.order, action)
+	}
+	b.pending[action]++
+
+	if b.timer == nil {
+		storyID := b.storyID
+		b.timer = time.AfterFunc(b.window, func() {
+			b.flush(storyID)
+		})
+	}
+	return true
+}
+
+// SubmitNow queues an action command and flushes the batch without waiting for the window
+func (b *ActionBatcher) SubmitNow(verb string, target string) bool {
+	if !b.Submit(verb, target) {
+		return false
+	}
+
+	b.mu.Lock()
+	storyID := b.storyID
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	go b.flush(storyID)
+	return true
+}
+
+// flush merges the pending actions into one player action and generates the next segment
+func (b *ActionBatcher) flush(storyID string) {
+	b.mu.Lock()
+	if b.storyID != storyID || len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	// Only one generation at a time; actions keep accumulating meanwhile
+	if b.running {
+		b.timer = time.AfterFunc(b.window, func() {
+			b.flush(storyID)
+		})
+		b.mu.Unlock()
+		return
+	}
+
+	playerAction := b.mergeLocked()
+	votes := make(map[string]float64, len(b.pending))
+	for action, count := range b.pending {
+		votes[action] = float64(count)
+	}
+	timeline, logger := b.timeline, b.logger
+	b.resetLocked()
+	b.running = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.running = false
+		b.mu.Unlock()
+	}()
+
+	log.Printf("[ActionBatcher] Applying audience action to story %s: %s", storyID, playerAction)
+	response, err := b.storyEngine.GenerateStorySegment(context.Background(), storyID, playerAction, rag.Memory{})
+	if err != nil {
+		log.Printf("[ActionBatcher] Failed to generate story segment: %v", err)
+		return
+	}
+
+	if b.hub != nil {
+		b.hub.BroadcastStoryUpdate(storyID, response)
+	}
+
+	recordTimeline(timeline, logger, b.storyEngine, storyID, storage.TimelineEvent{
+		Source: "action",
+		Choice: playerAction,
+		Votes:  votes,
+	}, response)
+}
+
+// mergeLocked joins the most frequent actions; callers must hold b.mu
+func (b *ActionBatcher) mergeLocked() string {
+	actions := append([]string(nil), b.order...)
+	sort.SliceStable(actions, func(i, j int) bool {
+		return b.pending[actions[i]] > b.pending[actions[j]]
+	})
+
+	if len(actions) > maxBatchedActions {
+		actions = actions[:maxBatchedActions]
+	}
+	return strings.Join(actions, "；")
+}
+
+// resetLocked clears pending actions; callers must hold b.mu
+func (b *ActionBatcher) resetLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.pending = make(map[string]int)
+	b.order = nil
+}
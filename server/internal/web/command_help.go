@@ -0,0 +1,89 @@
+package web
+
+import (
+	"Cyber-Jianghu/server/internal/adapters"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// helpCooldown is the minimum gap between answers to /help, so a room spamming it
+// gets one reply instead of a flood
+const helpCooldown = 10 * time.Second
+
+// commandHelpEntry describes one danmaku command in a "commands" message
+type commandHelpEntry struct {
+	Verb    string   `json:"verb"`
+	Usage   string   `json:"usage"`
+	Action  string   `json:"action,omitempty"` // Story action prefix, for action commands
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// commandsMessage lists the available danmaku commands
+type commandsMessage struct {
+	Commands []commandHelpEntry `json:"commands"`
+	Text     string             `json:"text"` // One-line summary for plain rendering
+}
+
+// answerHelp broadcasts the available commands unless it already did within helpCooldown
+func (s *LiveService) answerHelp(hub *DanmakuHub) {
+	s.mu.Lock()
+	if time.Since(s.lastHelp) < helpCooldown {
+		s.mu.Unlock()
+		return
+	}
+	s.lastHelp = time.Now()
+	actionBatcher := s.actionBatcher
+	s.mu.Unlock()
+
+	var commands map[string]string
+	if actionBatcher != nil {
+		commands = actionBatcher.Commands()
+	}
+	hub.BroadcastMessage("commands", buildCommandHelp(s.danmakuParser.Aliases(), commands))
+}
+
+// buildCommandHelp lists voting, each action verb and help, with the keywords that
+// trigger them without a slash
+func buildCommandHelp(aliases map[string][]string, commands map[string]string) commandsMessage {
+	entries := []commandHelpEntry{{
+		Verb:    adapters.VerbVote,
+		Usage:   "/vote <选项编号>",
+		Aliases: aliases[adapters.VerbVote],
+	}}
+
+	verbs := make([]string, 0, len(commands))
+	for verb := range commands {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	for _, verb := range verbs {
+		entries = append(entries, commandHelpEntry{
+			Verb:    verb,
+			Usage:   "/" + verb + " [目标]",
+			Action:  commands[verb],
+			Aliases: aliases[verb],
+		})
+	}
+
+	entries = append(entries, commandHelpEntry{
+		Verb:    adapters.VerbHelp,
+		Usage:   "/help",
+		Aliases: aliases[adapters.VerbHelp],
+	})
+
+	parts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		part := entry.Usage
+		if len(entry.Aliases) > 0 {
+			part = fmt.Sprintf("%s（%s）", part, strings.Join(entry.Aliases, "/"))
+		}
+		parts = append(parts, part)
+	}
+
+	return commandsMessage{
+		Commands: entries,
+		Text:     "可用指令：" + strings.Join(parts, "  "),
+	}
+}
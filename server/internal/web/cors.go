@@ -0,0 +1,92 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"Cyber-Jianghu/server/internal/logging"
+)
+
+// corsRequestHeaders are the request headers the API reads. Credentialed responses must
+// list them, since browsers take "*" literally when credentials are allowed.
+var corsRequestHeaders = strings.Join([]string{"Content-Type", IdempotencyKeyHeader, logging.RequestIDHeader}, ", ")
+
+// originPolicy decides which cross-origin callers may use the API and the danmaku websocket
+type originPolicy struct {
+	any     bool            // "*" was configured: any origin, without credentials
+	origins map[string]bool // Normalized scheme://host[:port]
+}
+
+// newOriginPolicy builds a policy from server.allowed_origins
+func newOriginPolicy(allowed []string) *originPolicy {
+	p := &originPolicy{origins: make(map[string]bool, len(allowed))}
+	for _, origin := range allowed {
+		if origin == "*" {
+			p.any = true
+			continue
+		}
+		p.origins[normalizeOrigin(origin)] = true
+	}
+	return p
+}
+
+// normalizeOrigin lower-cases an origin and drops a trailing slash, as browsers send it
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// allows reports whether a cross-origin request from origin is permitted
+func (p *originPolicy) allows(origin string) bool {
+	return p.any || p.origins[normalizeOrigin(origin)]
+}
+
+// cors sets CORS headers for allowed origins. Listed origins are echoed back with
+// credentials allowed; the "*" wildcard is sent as is, without credentials, since browsers
+// reject credentialed requests to a wildcard. Preflights from other origins get 403.
+func (p *originPolicy) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+
+		listed := origin != "" && p.origins[normalizeOrigin(origin)]
+		allowed := listed || (origin != "" && p.any)
+		if allowed {
+			if listed {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Access-Control-Allow-Headers", corsRequestHeaders)
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+				w.Header().Set("Access-Control-Allow-Headers", "*")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Expose-Headers", logging.RequestIDHeader+", "+IdempotentReplayHeader+", Retry-After")
+			w.Header().Set("Access-Control-Max-Age", "300")
+		}
+
+		if r.Method == http.MethodOptions {
+			if origin != "" && !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkWebSocketOrigin accepts upgrades without an Origin (non-browser clients), from the
+// server's own origin, or from an allowed origin
+func (p *originPolicy) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p.allows(origin)
+}
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Cyber-Jianghu/server/internal/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// preflight sends a CORS preflight for a JSON POST with an idempotency key
+func preflight(policy *originPolicy, origin string) *httptest.ResponseRecorder {
+	handler := policy.cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/story/create", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,idempotency-key")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSCredentialedPreflightListsHeaders(t *testing.T) {
+	rec := preflight(newOriginPolicy([]string{"https://studio.example.com"}), "https://studio.example.com")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://studio.example.com" {
+		t.Fatalf("Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Fatalf("Allow-Credentials = %q, want true", got)
+	}
+
+	allowHeaders := strings.ToLower(rec.Header().Get("Access-Control-Allow-Headers"))
+	if strings.Contains(allowHeaders, "*") {
+		t.Fatalf("credentialed preflight must not allow headers by wildcard, got %q", allowHeaders)
+	}
+	for _, header := range []string{"content-type", "idempotency-key", "x-request-id"} {
+		if !strings.Contains(allowHeaders, header) {
+			t.Fatalf("Allow-Headers %q is missing %s", allowHeaders, header)
+		}
+	}
+}
+
+func TestCORSWildcardOmitsCredentials(t *testing.T) {
+	rec := preflight(newOriginPolicy([]string{"*"}), "https://anywhere.example.com")
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Fatalf("wildcard mode must not allow credentials, got %q", got)
+	}
+}
+
+func TestCORSRejectsUnlistedPreflight(t *testing.T) {
+	rec := preflight(newOriginPolicy([]string{"https://studio.example.com"}), "https://evil.example.com")
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("unlisted origin got Allow-Origin %q", got)
+	}
+}
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	policy := newOriginPolicy([]string{"https://studio.example.com/"})
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no origin", "", true},
+		{"same host", "http://live.example.com:8080", true},
+		{"listed", "https://studio.example.com", true},
+		{"listed, different case", "HTTPS://Studio.Example.com", true},
+		{"unlisted", "https://evil.example.com", false},
+		{"listed host, other scheme", "http://studio.example.com", false},
+		{"same host name, other port", "http://live.example.com:9090", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://live.example.com:8080/api/v1/live/danmaku", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := policy.checkWebSocketOrigin(req); got != tt.want {
+			t.Errorf("%s: checkWebSocketOrigin(%q) = %v, want %v", tt.name, tt.origin, got, tt.want)
+		}
+	}
+
+	wildcard := newOriginPolicy([]string{"*"})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/live/danmaku", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	if !wildcard.checkWebSocketOrigin(req) {
+		t.Error("the wildcard policy rejected an origin")
+	}
+}
+
+func TestDanmakuStreamRejectsDisallowedOrigin(t *testing.T) {
+	hub := NewDanmakuHub()
+	hub.Start()
+	cfg := &config.Config{}
+	cfg.Server.AllowedOrigins = []string{"https://studio.example.com"}
+	handlers := NewHandlers(cfg, hub, nil, nil, nil)
+	server := httptest.NewServer(http.HandlerFunc(handlers.GetDanmakuStream))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {"https://evil.example.com"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("dial from a disallowed origin: %v, response %v, want 403", err, resp)
+	}
+	if hub.GetClientCount() != 0 {
+		t.Fatal("a rejected origin registered a client")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {"https://studio.example.com"}})
+	if err != nil {
+		t.Fatalf("dial from an allowed origin: %v", err)
+	}
+	defer conn.Close()
+	waitForClients(t, hub, 1)
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+const (
+	defaultDebugSearchLimit = 10
+	maxDebugSearchLimit     = 50
+)
+
+// DebugSearchRequest is a memory similarity query against one story
+type DebugSearchRequest struct {
+	StoryID string           `json:"story_id"`
+	Query   string           `json:"query"`
+	Limit   int              `json:"limit,omitempty"` // Defaults to 10, at most 50
+	Types   []rag.MemoryType `json:"types,omitempty"` // Empty searches every memory type
+}
+
+// DebugSearchResponse lists the memories a query retrieves, most relevant first
+type DebugSearchResponse struct {
+	Success  bool          `json:"success"`
+	StoryID  string        `json:"story_id"`
+	Query    string        `json:"query"`
+	Memories []*rag.Memory `json:"memories"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// DebugSearch runs a memory similarity search and returns the matches with their scores
+// and types, for seeing what context a player action would pull into generation
+func (h *StoryHandlers) DebugSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req DebugSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(DebugSearchResponse{Error: "Invalid request body"})
+		return
+	}
+	if req.StoryID == "" || req.Query == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(DebugSearchResponse{StoryID: req.StoryID, Query: req.Query, Error: "story_id and query are required"})
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultDebugSearchLimit
+	}
+	if req.Limit > maxDebugSearchLimit {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(DebugSearchResponse{
+			StoryID: req.StoryID,
+			Query:   req.Query,
+			Error:   fmt.Sprintf("limit must be at most %d", maxDebugSearchLimit),
+		})
+		return
+	}
+
+	if h.storyEngine == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(DebugSearchResponse{StoryID: req.StoryID, Query: req.Query, Error: "Story engine not initialized"})
+		return
+	}
+
+	memories, err := h.storyEngine.SearchMemories(r.Context(), req.StoryID, req.Query, req.Limit, req.Types)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(DebugSearchResponse{StoryID: req.StoryID, Query: req.Query, Error: err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(DebugSearchResponse{
+		Success:  true,
+		StoryID:  req.StoryID,
+		Query:    req.Query,
+		Memories: memories,
+	})
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"Cyber-Jianghu/server/internal/config"
+	"math"
+	"sync"
+)
+
+// GiftInfluence converts a viewer's accumulated gift value into influence
+type GiftInfluence struct {
+	threshold int
+	curve     string
+	maxWeight float64
+
+	mu      sync.Mutex
+	credits map[string]int // User ID -> gift value this session
+}
+
+// NewGiftInfluence creates gift weighting from config; a zero threshold disables it
+func NewGiftInfluence(cfg config.GiftInfluenceConfig) *GiftInfluence {
+	maxWeight := cfg.MaxWeight
+	if maxWeight < 1 {
+		maxWeight = 1
+	}
+	return &GiftInfluence{
+		threshold: cfg.Threshold,
+		curve:     cfg.Curve,
+		maxWeight: maxWeight,
+		credits:   make(map[string]int),
+	}
+}
+
+// AddGift records gift value sent by a user
+func (g *GiftInfluence) AddGift(userID string, value int) {
+	if userID == "" || value <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.credits[userID] += value
+}
+
+// Weight returns the vote weight for a user based on their gifts
+func (g *GiftInfluence) Weight(userID string) float64 {
+	g.mu.Lock()
+	value := g.credits[userID]
+	g.mu.Unlock()
+
+	return g.weightFor(value)
+}
+
+// ExceedsThreshold reports whether a user's gifts are enough to act immediately
+func (g *GiftInfluence) ExceedsThreshold(userID string) bool {
+	if g.threshold <= 0 {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.credits[userID] >= g.threshold
+}
+
+// Reset clears all gift credits, e.g. when the live session ends
+func (g *GiftInfluence) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.credits = make(map[string]int)
+}
+
+// weightFor applies the configured curve to a gift value
+func (g *GiftInfluence) weightFor(value int) float64 {
+	if g.threshold <= 0 || value < g.threshold {
+		return 1
+	}
+
+	ratio := float64(value) / float64(g.threshold)
+	var weight float64
+	switch g.curve {
+	case "step":
+		weight = g.maxWeight
+	case "linear":
+		weight = 1 + ratio
+	default: // "log"
+		weight = 1 + math.Log2(1+ratio)
+	}
+
+	return math.Min(weight, g.maxWeight)
+}
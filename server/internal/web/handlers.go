@@ -5,57 +5,60 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gorilla/websocket"
 
+	"Cyber-Jianghu/server/internal/adapters"
+	"Cyber-Jianghu/server/internal/backpressure"
 	"Cyber-Jianghu/server/internal/config"
 	"Cyber-Jianghu/server/internal/engine"
 	"Cyber-Jianghu/server/internal/generators"
 	"Cyber-Jianghu/server/internal/infra"
+	"Cyber-Jianghu/server/internal/logging"
 	"Cyber-Jianghu/server/internal/storage"
 )
 
-// WebSocket upgrader configuration
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
-}
-
 type Handlers struct {
 	config         *config.Config
 	hub            *DanmakuHub
 	liveService    *LiveService
 	redisStore     *storage.RedisStore
 	comfyuiManager *infra.ComfyUIManager
+	health         *HealthChecks
+	origins        *originPolicy
+	upgrader       websocket.Upgrader
 }
 
-func NewHandlers(cfg *config.Config, hub *DanmakuHub, redisStore *storage.RedisStore, comfyuiManager *infra.ComfyUIManager) *Handlers {
+func NewHandlers(cfg *config.Config, hub *DanmakuHub, liveService *LiveService, redisStore *storage.RedisStore, comfyuiManager *infra.ComfyUIManager) *Handlers {
+	origins := newOriginPolicy(cfg.Server.AllowedOrigins)
 	return &Handlers{
 		config:         cfg,
 		hub:            hub,
-		liveService:    nil,
+		liveService:    liveService,
 		redisStore:     redisStore,
 		comfyuiManager: comfyuiManager,
+		origins:        origins,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     origins.checkWebSocketOrigin,
+		},
 	}
 }
 
-func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "ok",
-		"service": "cyber-jianghu",
-	})
+// SetHealthChecks sets the dependency checks run by the readiness endpoint
+func (h *Handlers) SetHealthChecks(health *HealthChecks) {
+	h.health = health
 }
 
 func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
@@ -69,44 +72,113 @@ func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, indexPath)
 }
 
-// CORS middleware
-func corsMiddleware(next http.Handler) http.Handler {
+// requestID tags each request with a fresh ID, stored in its context and echoed in the
+// X-Request-ID response header so client reports can be matched to server logs
+func requestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "*")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Max-Age", "300")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
+		id := generateClientID()
+		w.Header().Set(logging.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
 	})
 }
 
-func NewRouter(cfg *config.Config, storyEngine interface{}, redis interface{}, comfyuiManager *infra.ComfyUIManager) *chi.Mux {
-	r := chi.NewRouter()
-
-	// Request logging middleware
-	r.Use(func(next http.Handler) http.Handler {
+// requestLogger logs each request with its status and duration; server errors at error
+// level, client errors at warn and everything else at info
+func requestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	logger = logger.With("component", "http")
+	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("REQUEST: %s %s", r.Method, r.URL.Path)
-			next.ServeHTTP(w, r)
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			switch {
+			case status >= 500:
+				level = slog.LevelError
+			case status >= 400:
+				level = slog.LevelWarn
+			}
+			logging.FromContext(r.Context(), logger).LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			)
 		})
-	})
+	}
+}
+
+// Services are the long-running components NewRouter creates, exposed so they can be
+// stopped on shutdown. StoryHandlers is nil when no story engine was given.
+type Services struct {
+	LiveService   *LiveService
+	StoryHandlers *StoryHandlers
+	Health        *HealthChecks // Dependencies without a store of their own here are registered by the caller
+}
 
-	// CORS middleware
-	r.Use(corsMiddleware)
+func NewRouter(cfg *config.Config, storyEngine interface{}, redis interface{}, mysql interface{}, comfyuiManager *infra.ComfyUIManager, loraRegistry *generators.LoRARegistry, voiceRegistry *generators.VoiceRegistry, logger *slog.Logger) (*chi.Mux, *Services) {
+	logger = logging.OrDefault(logger)
+	r := chi.NewRouter()
+
+	// Request ID and logging middleware
+	r.Use(requestID)
+	r.Use(requestLogger(logger))
+
+	// CORS for the origins in server.allowed_origins
+	r.Use(newOriginPolicy(cfg.Server.AllowedOrigins).cors)
 
 	// Type assertion for redis store
 	var redisStore *storage.RedisStore
 	if redis != nil {
 		redisStore = redis.(*storage.RedisStore)
 	}
-	handlers := NewHandlers(cfg, nil, redisStore, comfyuiManager)
+
+	// Type assertion for mysql store
+	var mysqlStore *storage.MySQLStore
+	if mysql != nil {
+		mysqlStore = mysql.(*storage.MySQLStore)
+	}
+
+	// Live streaming: a single hub and service shared by all requests
+	hub := NewDanmakuHub()
+	hub.SetLogger(logger)
+	hub.SetReplay(redisStore, cfg.Live.ReplayCount)
+	hub.SetBackpressure(cfg.Live.Backpressure.HubBuffer, cfg.Live.Backpressure.SampleEvery)
+	hub.SetSlowClientDrops(cfg.Live.Backpressure.SlowClientDrops)
+	hub.Start()
+
+	liveService := NewLiveService("")
+	liveService.SetLogger(logger)
+	liveService.SetBackpressure(cfg.Live.Backpressure.AdapterBuffer, cfg.Live.Backpressure.SampleEvery)
+	liveService.SetRedisStore(redisStore)
+	if cfg.Live.Archive.Enabled {
+		liveService.SetMySQLStore(mysqlStore)
+	}
+	liveService.SetDedupWindow("bilibili", cfg.Live.Bilibili.DedupWindow)
+	liveService.SetDedupWindow("douyin", cfg.Live.Douyin.DedupWindow)
+	if cfg.Live.Douyin.SignerURL != "" {
+		liveService.SetDouyinSigner(adapters.NewHTTPDouyinSigner(cfg.Live.Douyin.SignerURL, cfg.Live.Douyin.SignerTimeout))
+	}
+
+	handlers := NewHandlers(cfg, hub, liveService, redisStore, comfyuiManager)
+
+	// Dependencies that failed to connect at startup are reported as disabled
+	health := NewHealthChecks()
+	health.Register("redis", nil)
+	if redisStore != nil {
+		health.Register("redis", redisStore.Ping)
+	}
+	health.Register("mysql", nil)
+	if mysqlStore != nil {
+		health.Register("mysql", mysqlStore.Ping)
+	}
+	handlers.SetHealthChecks(health)
 
 	// Type assertion for story engine
 	var storyHandlers *StoryHandlers
@@ -114,14 +186,48 @@ func NewRouter(cfg *config.Config, storyEngine interface{}, redis interface{}, c
 
 	if storyEngine != nil {
 		// Create ComfyUI client
-		comfyClient = generators.NewComfyUIClient()
+		comfyClient = generators.NewComfyUIClient(
+			generators.WithDefaultNegativePrompt(cfg.AI.ComfyUI.NegativePrompt),
+			generators.WithWebSocketProgress(),
+		)
 
 		// Get cache directory
 		baseDir, _ := filepath.Abs(filepath.Join(os.Getenv("USERPROFILE"), "cyber-jianghu"))
 		imageCacheDir := filepath.Join(baseDir, "image_cache")
 		_ = os.MkdirAll(imageCacheDir, 0755)
 
-		storyHandlers = NewStoryHandlers(storyEngine.(*engine.StoryEngine), comfyClient, imageCacheDir)
+		// Replay mode renders a fixed stub instead of calling ComfyUI
+		var images generators.ImageGenerator = comfyClient
+		if cfg.AI.Replay.Fixture != "" {
+			images = generators.NewStubImageGenerator()
+		}
+
+		storyHandlers = NewStoryHandlers(storyEngine.(*engine.StoryEngine), images, imageCacheDir)
+		storyHandlers.imageCache.SetMemoryBudget(config.Megabytes(cfg.Cache.ImageMemoryMB))
+		storyHandlers.imageCache.SetMaxSize(config.Megabytes(cfg.Cache.ImageMaxSizeMB))
+		hub.SetSceneImageRenderer(storyHandlers.RenderSceneImage)
+		if cfg.AI.Replay.Fixture == "" {
+			health.Register("comfyui", comfyClient.HealthCheck)
+		}
+		liveService.SetStoryEngine(storyEngine.(*engine.StoryEngine))
+		voteTally := NewVoteTally(storyEngine.(*engine.StoryEngine), hub, cfg.Live.VoteWindow)
+		actionBatcher := NewActionBatcher(storyEngine.(*engine.StoryEngine), hub, cfg.Live.ActionWindow, cfg.Live.ActionCommands)
+		voteTally.SetLogger(logger)
+		actionBatcher.SetLogger(logger)
+		if redisStore != nil {
+			voteTally.SetTimeline(redisStore)
+			actionBatcher.SetTimeline(redisStore)
+			storyHandlers.SetTimeline(redisStore)
+		}
+		liveService.SetVoteTally(voteTally)
+		liveService.SetActionBatcher(actionBatcher)
+		liveService.SetCommandAliases(cfg.Live.CommandAliases)
+		giftInfluence := NewGiftInfluence(cfg.Live.Gift)
+		liveService.SetGiftInfluence(giftInfluence)
+		if limiter := NewActionRateLimiter(cfg.Server.RateLimit, redisStore); limiter != nil {
+			limiter.SetGiftInfluence(giftInfluence)
+			storyHandlers.SetRateLimiter(limiter)
+		}
 	}
 
 	// Static file server for client assets
@@ -133,25 +239,46 @@ func NewRouter(cfg *config.Config, storyEngine interface{}, redis interface{}, c
 	// Public routes
 	r.Get("/", handlers.Home)
 	r.Get("/health", handlers.HealthCheck)
+	r.Get("/health/ready", handlers.HealthCheck)
+	r.Get("/health/live", handlers.Liveness)
 	r.Mount("/static", FileServer)
 
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
 		// Story endpoints (demo mode)
 		if storyHandlers != nil {
+			// Retried turns replay the first response instead of generating twice
+			idempotent := idempotency(redisStore, cfg.Server.IdempotencyTTL, logger)
 			r.Route("/story", func(r chi.Router) {
 				r.Post("/create", storyHandlers.CreateStory)
-				r.Post("/continue", storyHandlers.ContinueStory)
-				r.Post("/select", storyHandlers.SelectOption)
+				r.With(idempotent).Post("/continue", storyHandlers.ContinueStory)
+				r.With(idempotent).Post("/select", storyHandlers.SelectOption)
+				r.Post("/end", storyHandlers.EndStory)
 				r.Get("/{story_id}", storyHandlers.GetStoryStatus)
+				r.Get("/{story_id}/decisions", storyHandlers.GetDecisionHistory)
+				r.Get("/{story_id}/npcs", storyHandlers.GetNPCs)
+				r.Get("/{story_id}/timeline", storyHandlers.GetTimeline)
+				r.Get("/{story_id}/history", storyHandlers.GetStoryHistory)
+				r.Post("/{story_id}/undo", storyHandlers.UndoTurn)
+				r.Get("/{story_id}/export", storyHandlers.ExportStory)
 			})
 			// Audio endpoints
 			r.Post("/audio/generate", storyHandlers.GenerateAudio)
+			r.Get("/audio/stream", storyHandlers.StreamAudio)
 			// Image endpoints
 			r.Post("/image/generate", storyHandlers.GenerateImage)
-			// Voice endpoints
-			r.Get("/voice/list", storyHandlers.GetVoices)
-			r.Post("/voice/default", storyHandlers.SetDefaultVoice)
+			r.Post("/image/preload", storyHandlers.PreloadImages)
+			r.Get("/image/queue", storyHandlers.GetImageQueueStatus)
+			r.Get("/image/{key}", storyHandlers.ServeImage)
+			// GLM endpoints
+			r.Get("/glm/stats", storyHandlers.GetGLMStats)
+			// Prompt endpoints
+			r.Post("/prompts/reload", storyHandlers.ReloadTemplates)
+			// Debug endpoints expose story internals and are off unless configured
+			if cfg.Server.Debug {
+				logger.Warn("debug endpoints enabled", "prefix", "/api/v1/debug")
+				r.Post("/debug/search", storyHandlers.DebugSearch)
+			}
 		}
 
 		// Live endpoints (Phase 2 - completed)
@@ -159,6 +286,7 @@ func NewRouter(cfg *config.Config, storyEngine interface{}, redis interface{}, c
 			r.Post("/connect", handlers.ConnectLive)
 			r.Post("/disconnect", handlers.DisconnectLive)
 			r.Get("/status", handlers.GetLiveStatus)
+			r.Get("/metrics", handlers.GetLiveMetrics)
 			r.Get("/danmaku", handlers.GetDanmakuStream)
 		})
 
@@ -168,17 +296,23 @@ func NewRouter(cfg *config.Config, storyEngine interface{}, redis interface{}, c
 			r.Post("/audio", handlers.GenerateAudio)
 		})
 
-		// Lora endpoints (placeholder for Phase 4)
+		// LoRA endpoints
+		loraHandlers := NewLoRAHandlers(loraRegistry)
 		r.Route("/lora", func(r chi.Router) {
-			r.Get("/", handlers.GetLoraModels)
-			r.Post("/{id}/enable", handlers.EnableLora)
-			r.Post("/{id}/disable", handlers.DisableLora)
+			r.Get("/", loraHandlers.ListModels)
+			r.Post("/{id}/enable", loraHandlers.EnableModel)
+			r.Post("/{id}/disable", loraHandlers.DisableModel)
+			r.Put("/{id}/strength", loraHandlers.UpdateStrength)
 		})
 
-		// Voice endpoints (placeholder for Phase 5)
+		// Voice endpoints
+		voiceHandlers := NewVoiceHandlers(voiceRegistry)
 		r.Route("/voice", func(r chi.Router) {
-			r.Get("/", handlers.GetVoices)
-			r.Post("/{id}/set-default", handlers.SetDefaultVoice)
+			r.Get("/", voiceHandlers.ListVoices)
+			r.Post("/reload", voiceHandlers.ReloadVoices)
+			r.Post("/{id}/enable", voiceHandlers.EnableVoice)
+			r.Post("/{id}/disable", voiceHandlers.DisableVoice)
+			r.Post("/{id}/set-default", voiceHandlers.SetDefaultVoice)
 		})
 
 		// ComfyUI Management endpoints
@@ -190,7 +324,7 @@ func NewRouter(cfg *config.Config, storyEngine interface{}, redis interface{}, c
 		})
 	})
 
-	return r
+	return r, &Services{LiveService: liveService, StoryHandlers: storyHandlers, Health: health}
 }
 
 // Live endpoints
@@ -207,24 +341,128 @@ func (h *Handlers) ConnectLive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Without a platform, work both out from a pasted live room link
+	if req.Platform == "" {
+		link := req.URL
+		if link == "" && strings.ContainsAny(req.RoomID, "./") {
+			link = req.RoomID
+		}
+		if link != "" {
+			platform, roomID, err := adapters.ResolveRoomURL(r.Context(), link)
+			if err != nil {
+				status := http.StatusBadRequest
+				if !errors.Is(err, adapters.ErrUnrecognizedRoomURL) {
+					status = http.StatusBadGateway // A short link couldn't be followed
+				}
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": err.Error(),
+				})
+				return
+			}
+			req.Platform, req.RoomID = platform, roomID
+		}
+	}
+
 	// Validate required fields
 	if req.Platform == "" || req.RoomID == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "platform and room_id are required",
+			"error": "platform and room_id, or a live room url, are required",
 		})
 		return
 	}
 
-	// TODO: Connect to live platform
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{"error": "Live connection not yet implemented"})
+	if h.liveService == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Live service not initialized"})
+		return
+	}
+
+	// Fall back to the configured cookie for the platform
+	cookie := req.Cookie
+	if cookie == "" {
+		switch req.Platform {
+		case "bilibili":
+			cookie = h.config.Live.Bilibili.Cookie
+		case "douyin":
+			cookie = h.config.Live.Douyin.Cookie
+		}
+	}
+
+	opts := &ConnectOptions{
+		Platform: req.Platform,
+		RoomID:   req.RoomID,
+		Cookie:   cookie,
+	}
+
+	// The connection outlives this request, so don't tie it to the request context
+	if err := h.liveService.Connect(context.Background(), opts, h.hub); err != nil {
+		status, code := connectErrorStatus(err)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ConnectResponse{
+			Success:   false,
+			Message:   err.Error(),
+			ErrorCode: code,
+			Platform:  req.Platform,
+			RoomID:    req.RoomID,
+		})
+		return
+	}
+
+	if req.StoryID != "" {
+		h.liveService.SetActiveStory(req.StoryID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ConnectResponse{
+		Success:   true,
+		Message:   "Connected",
+		Platform:  req.Platform,
+		RoomID:    req.RoomID,
+		Connected: true,
+	})
+}
+
+// connectErrorStatus maps a connect failure to an HTTP status and, for preflight
+// failures, an error code telling the user whether to refresh their cookie
+func connectErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, adapters.ErrCookieExpired):
+		return http.StatusUnauthorized, "cookie_expired"
+	case errors.Is(err, adapters.ErrRoomNotFound):
+		return http.StatusNotFound, "room_not_found"
+	case errors.Is(err, adapters.ErrRoomOffline):
+		return http.StatusConflict, "room_offline"
+	default:
+		return http.StatusBadGateway, ""
+	}
 }
 
 func (h *Handlers) DisconnectLive(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{"error": "Not implemented"})
+
+	if h.liveService == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Live service not initialized"})
+		return
+	}
+
+	if err := h.liveService.Disconnect(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ConnectResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ConnectResponse{
+		Success:   true,
+		Message:   "Disconnected",
+		Connected: false,
+	})
 }
 
 func (h *Handlers) GetLiveStatus(w http.ResponseWriter, r *http.Request) {
@@ -246,18 +484,55 @@ func (h *Handlers) GetLiveStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
-func (h *Handlers) GetDanmakuStream(w http.ResponseWriter, r *http.Request) {
+// LiveMetrics reports, per danmaku pipeline stage, how many messages were passed on,
+// sampled away under overload, or dropped on a full channel
+type LiveMetrics struct {
+	Stages map[string]backpressure.Stats `json:"stages"`
+}
+
+// GetLiveMetrics handles GET /api/v1/live/metrics
+func (h *Handlers) GetLiveMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	var gates []*backpressure.Gate
+	if h.liveService != nil {
+		gates = append(gates, h.liveService.IngestGate(), h.liveService.StoryGate())
+	}
+	if h.hub != nil {
+		gates = append(gates, h.hub.Gates()...)
+	}
+
+	metrics := LiveMetrics{Stages: make(map[string]backpressure.Stats, len(gates))}
+	for _, gate := range gates {
+		metrics.Stages[gate.Stage()] = gate.Stats()
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(metrics)
+}
+
+func (h *Handlers) GetDanmakuStream(w http.ResponseWriter, r *http.Request) {
 	if h.hub == nil {
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Hub not initialized"})
 		return
 	}
 
-	// Upgrade HTTP connection to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// Refuse pages from other sites before upgrading, so a visited page can't ride the
+	// viewer's browser onto the live stream socket
+	if !h.origins.checkWebSocketOrigin(r) {
+		logging.FromContext(r.Context(), nil).Warn("WebSocket origin rejected", "component", "http", "origin", r.Header.Get("Origin"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Origin not allowed"})
+		return
+	}
+
+	// Upgrade HTTP connection to WebSocket; on failure the upgrader has already replied
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		logging.FromContext(r.Context(), nil).Warn("WebSocket upgrade failed", "component", "http", "error", err)
 		return
 	}
 
@@ -268,14 +543,11 @@ func (h *Handlers) GetDanmakuStream(w http.ResponseWriter, r *http.Request) {
 	client := &Client{
 		ID:     clientID,
 		Conn:   conn,
-		Send:   make(chan []byte, 256),
+		Send:   make(chan []byte, clientSendBuffer),
 		Hub:    h.hub,
 		closed: false,
 	}
 
-	// Register client with hub
-	h.hub.register <- client
-
 	// Send welcome message
 	welcomeMsg := map[string]interface{}{
 		"type": "connected",
@@ -289,10 +561,14 @@ func (h *Handlers) GetDanmakuStream(w http.ResponseWriter, r *http.Request) {
 	default:
 	}
 
-	// Start client read pump
-	go client.readPump()
+	// Give late joiners recent context before live messages start
+	h.hub.ReplayRecent(r.Context(), client)
+
+	// Register client with hub
+	h.hub.register <- client
 
-	w.WriteHeader(http.StatusSwitchingProtocols)
+	// Start client read pump; the connection is hijacked, so nothing more is written to w
+	go client.readPump()
 }
 
 // Generate endpoints
@@ -308,38 +584,6 @@ func (h *Handlers) GenerateAudio(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"error": "Use GPT-SoVITS directly or story endpoints"})
 }
 
-// Lora endpoints
-func (h *Handlers) GetLoraModels(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{"error": "Use LoRA registry directly or story endpoints"})
-}
-
-func (h *Handlers) EnableLora(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{"error": "Not implemented"})
-}
-
-func (h *Handlers) DisableLora(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{"error": "Not implemented"})
-}
-
-// Voice endpoints
-func (h *Handlers) GetVoices(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{"error": "Not implemented"})
-}
-
-func (h *Handlers) SetDefaultVoice(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{"error": "Not implemented"})
-}
-
 // generateClientID generates a unique client ID
 func generateClientID() string {
 	b := make([]byte, 8)
@@ -353,7 +597,9 @@ func generateClientID() string {
 type ConnectRequest struct {
 	Platform string `json:"platform"`
 	RoomID   string `json:"room_id"`
+	URL      string `json:"url,omitempty"` // Live room link, used when platform is empty
 	Cookie   string `json:"cookie,omitempty"`
+	StoryID  string `json:"story_id,omitempty"` // Story that viewer votes drive
 }
 
 // LiveStatus represents live connection status
@@ -364,10 +610,14 @@ type LiveStatus struct {
 	ClientCount int    `json:"client_count"`
 }
 
+// comfyUIStatusLogLines is how much ComfyUI output the status endpoint surfaces on failure
+const comfyUIStatusLogLines = 50
+
 // ComfyUI Status Response
 type ComfyUIStatusResponse struct {
 	Status string `json:"status"`
 	URL    string `json:"url,omitempty"`
+	Log    []string `json:"log,omitempty"` // Recent ComfyUI output, included when it failed
 }
 
 // GetComfyUIStatus returns the current status of ComfyUI
@@ -388,6 +638,9 @@ func (h *Handlers) GetComfyUIStatus(w http.ResponseWriter, r *http.Request) {
 	if h.comfyuiManager.IsReady() {
 		response.URL = h.comfyuiManager.GetURL()
 	}
+	if status == string(infra.ComfyUIStatusError) {
+		response.Log = h.comfyuiManager.GetRecentLog(comfyUIStatusLogLines)
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
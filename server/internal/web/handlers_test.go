@@ -0,0 +1,99 @@
+package web
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Cyber-Jianghu/server/internal/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// lockedBuffer collects server error log output from several goroutines
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestDanmakuStreamUpgrade(t *testing.T) {
+	hub := NewDanmakuHub()
+	hub.Start()
+	handlers := NewHandlers(&config.Config{}, hub, nil, nil, nil)
+
+	// net/http logs writes to a hijacked connection through the server's error log
+	var serverLog lockedBuffer
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handlers.GetDanmakuStream))
+	server.Config.ErrorLog = log.New(&serverLog, "", 0)
+	server.Start()
+	defer server.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "" {
+		t.Errorf("upgrade response has Content-Type %q", got)
+	}
+	if got := readMessageType(t, conn); got != "connected" {
+		t.Fatalf("first message type = %q, want connected", got)
+	}
+
+	// Let the handler return and any stray header write reach the log
+	waitForClients(t, hub, 1)
+	time.Sleep(50 * time.Millisecond)
+	if logged := serverLog.String(); logged != "" {
+		t.Errorf("server logged %q during the upgrade", logged)
+	}
+}
+
+func TestDanmakuStreamRejectsPlainRequest(t *testing.T) {
+	hub := NewDanmakuHub()
+	hub.Start()
+	handlers := NewHandlers(&config.Config{}, hub, nil, nil, nil)
+	server := httptest.NewServer(http.HandlerFunc(handlers.GetDanmakuStream))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 from the upgrader", resp.StatusCode)
+	}
+	if hub.GetClientCount() != 0 {
+		t.Errorf("a failed upgrade registered a client")
+	}
+}
+
+func TestDanmakuStreamWithoutHub(t *testing.T) {
+	handlers := NewHandlers(&config.Config{}, nil, nil, nil, nil)
+	rec := httptest.NewRecorder()
+	handlers.GetDanmakuStream(rec, httptest.NewRequest(http.MethodGet, "/api/v1/live/danmaku", nil))
+
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("got %d with Content-Type %q, want a 503 JSON error", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
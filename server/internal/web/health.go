@@ -0,0 +1,127 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout bounds each dependency check so a hung dependency can't stall probes
+const healthCheckTimeout = 3 * time.Second
+
+// HealthCheckFunc reports whether a dependency is reachable
+type HealthCheckFunc func(ctx context.Context) error
+
+// DependencyStatus is the outcome of one dependency check
+type DependencyStatus struct {
+	Status    string `json:"status"` // "ok", "down" or "disabled"
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthResponse is returned by the readiness endpoint
+type HealthResponse struct {
+	Status       string                      `json:"status"` // "ok" or "unavailable"
+	Service      string                      `json:"service"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// HealthChecks holds the dependency checks run by the readiness endpoint
+type HealthChecks struct {
+	mu     sync.RWMutex
+	checks map[string]HealthCheckFunc
+}
+
+// NewHealthChecks creates an empty set of dependency checks
+func NewHealthChecks() *HealthChecks {
+	return &HealthChecks{checks: make(map[string]HealthCheckFunc)}
+}
+
+// Register adds or replaces the check for a dependency. A nil check marks the dependency
+// as disabled: it is listed but doesn't affect readiness, since the server runs without it.
+func (hc *HealthChecks) Register(name string, check HealthCheckFunc) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.checks[name] = check
+}
+
+// Run checks every dependency concurrently and reports whether all enabled ones are up
+func (hc *HealthChecks) Run(ctx context.Context) (map[string]DependencyStatus, bool) {
+	hc.mu.RLock()
+	names := make([]string, 0, len(hc.checks))
+	for name := range hc.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]HealthCheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = hc.checks[name]
+	}
+	hc.mu.RUnlock()
+
+	statuses := make([]DependencyStatus, len(names))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		if check == nil {
+			statuses[i] = DependencyStatus{Status: "disabled"}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, check HealthCheckFunc) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			statuses[i] = DependencyStatus{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				statuses[i].Status = "down"
+				statuses[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	result := make(map[string]DependencyStatus, len(names))
+	healthy := true
+	for i, name := range names {
+		result[name] = statuses[i]
+		if statuses[i].Status == "down" {
+			healthy = false
+		}
+	}
+	return result, healthy
+}
+
+// Liveness reports that the process is up without touching any dependency
+func (h *Handlers) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "ok",
+		"service": "cyber-jianghu",
+	})
+}
+
+// HealthCheck checks every registered dependency, returning 503 if any enabled one is down
+func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{Status: "ok", Service: "cyber-jianghu", Dependencies: map[string]DependencyStatus{}}
+	status := http.StatusOK
+	if h.health != nil {
+		deps, healthy := h.health.Run(r.Context())
+		resp.Dependencies = deps
+		if !healthy {
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
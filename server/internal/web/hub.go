@@ -1,16 +1,33 @@
 package web
 
 import (
+	"Cyber-Jianghu/server/internal/backpressure"
+	"Cyber-Jianghu/server/internal/engine"
 	"Cyber-Jianghu/server/internal/interfaces"
+	"Cyber-Jianghu/server/internal/logging"
+	"Cyber-Jianghu/server/internal/storage"
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// Client represents a WebSocket client connection
+const (
+	sceneImageTimeout = 5 * time.Minute
+
+	defaultHubBuffer = 1000
+	defaultSlowClientDrops = 50
+	slowCloseWait    = time.Second
+	clientSendBuffer = 256
+	// maxReplayCount leaves headroom in the send buffer for the welcome and live messages
+	maxReplayCount = clientSendBuffer - 56
+)
+
+// Client represents a WebSocket client connection. Only the hub closes Send, and only
+// after removing the client from its map; everything else closes Conn.
 type Client struct {
 	ID     string
 	Conn   *websocket.Conn
@@ -18,6 +35,11 @@ type Client struct {
 	Hub    *DanmakuHub
 	mu     sync.Mutex
 	closed bool
+	sendOnce sync.Once // Guards closing Send
+
+	// Owned by the hub's Run goroutine
+	drops   int  // Consecutive messages dropped on a full Send buffer
+	removed bool // Unregistered; a late register is ignored
 }
 
 // DanmakuHub manages WebSocket connections and broadcasts danmaku messages
@@ -28,19 +50,147 @@ type DanmakuHub struct {
 	broadcast  chan interfaces.Danmaku
 	danmakuOut chan []byte
 	mu         sync.RWMutex
+	startOnce  sync.Once
+
+	// Recent danmaku replayed to late joiners
+	replayStore *storage.RedisStore
+	replayCount int
+
+	// Renders scene images pushed to viewers after a story update; nil disables them
+	sceneImages SceneImageRenderer
+
+	// Count and shed messages into broadcast/danmakuOut and into client send buffers
+	broadcastGate *backpressure.Gate
+	clientGate    *backpressure.Gate
+	// Consecutive drops after which a client is disconnected; 0 never disconnects
+	slowClientDrops int
+
+	logger *slog.Logger
+}
+
+// SceneImageRenderer renders a story segment's visual spec and returns the image's URL
+type SceneImageRenderer func(ctx context.Context, storyID string, spec *engine.VisualSpec) (string, error)
+
+// storyMessage is the "story" websocket message: a generated segment and its story
+type storyMessage struct {
+	StoryID string `json:"story_id"`
+	*engine.StoryResponse
+}
+
+// sceneImageMessage is the "image" websocket message for a new scene's artwork
+type sceneImageMessage struct {
+	StoryID  string `json:"story_id"`
+	Scene    string `json:"scene"`
+	SceneKey string `json:"scene_key"`
+	Image    string `json:"image"` // URL of the cached image
 }
 
 // NewDanmakuHub creates a new danmaku hub
 func NewDanmakuHub() *DanmakuHub {
+	logger := slog.Default().With("component", "hub")
 	return &DanmakuHub{
-		clients:    make(map[string]*Client),
-		register:   make(chan *Client, 100),
-		unregister: make(chan *Client, 100),
-		broadcast:  make(chan interfaces.Danmaku, 1000),
-		danmakuOut: make(chan []byte, 1000),
+		clients:       make(map[string]*Client),
+		register:      make(chan *Client, 100),
+		unregister:    make(chan *Client, 100),
+		broadcast:     make(chan interfaces.Danmaku, defaultHubBuffer),
+		danmakuOut:    make(chan []byte, defaultHubBuffer),
+		broadcastGate: backpressure.NewGate("hub_broadcast", 1, logger),
+		clientGate:    backpressure.NewGate("client_send", 1, logger),
+		slowClientDrops: defaultSlowClientDrops,
+		logger:        logger,
 	}
 }
 
+// SetLogger sets the structured logger; call it before Start and SetBackpressure
+func (h *DanmakuHub) SetLogger(logger *slog.Logger) {
+	h.logger = logger.With("component", "hub")
+}
+
+// SetBackpressure sizes the broadcast channels (0 keeps the default) and sets how chat
+// danmaku are sampled when they back up; call it before Start
+func (h *DanmakuHub) SetBackpressure(capacity int, sampleEvery int) {
+	if capacity > 0 {
+		h.broadcast = make(chan interfaces.Danmaku, capacity)
+		h.danmakuOut = make(chan []byte, capacity)
+	}
+	h.broadcastGate = backpressure.NewGate("hub_broadcast", sampleEvery, h.logger)
+	// A slow client only loses its own messages, so client buffers are counted, not sampled
+	h.clientGate = backpressure.NewGate("client_send", 1, h.logger)
+}
+
+// SetSlowClientDrops sets how many messages in a row a client may miss on a full send
+// buffer before it is disconnected so its viewer reconnects fresh; 0 or less disables it.
+// Call it before Start.
+func (h *DanmakuHub) SetSlowClientDrops(drops int) {
+	if drops < 0 {
+		drops = 0
+	}
+	h.slowClientDrops = drops
+}
+
+// Gates returns the hub's broadcast and client send backpressure gates
+func (h *DanmakuHub) Gates() []*backpressure.Gate {
+	return []*backpressure.Gate{h.broadcastGate, h.clientGate}
+}
+
+// SetReplay configures how many recent danmaku from Redis are replayed to new clients
+func (h *DanmakuHub) SetReplay(redisStore *storage.RedisStore, count int) {
+	if count > maxReplayCount {
+		count = maxReplayCount
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.replayStore = redisStore
+	h.replayCount = count
+}
+
+// SetSceneImageRenderer enables pushing scene images to viewers when a story update moves
+// to a new scene
+func (h *DanmakuHub) SetSceneImageRenderer(renderer SceneImageRenderer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sceneImages = renderer
+}
+
+// ReplayRecent queues recent danmaku on a client's send channel, oldest first.
+// Call it before registering the client so replayed messages precede live ones.
+func (h *DanmakuHub) ReplayRecent(ctx context.Context, client *Client) {
+	h.mu.RLock()
+	redisStore, count := h.replayStore, h.replayCount
+	h.mu.RUnlock()
+
+	if redisStore == nil || count <= 0 {
+		return
+	}
+
+	recent, err := redisStore.GetRecentDanmaku(ctx, int64(count))
+	if err != nil {
+		h.logger.Warn("failed to load recent danmaku", "client_id", client.ID, "error", err)
+		return
+	}
+
+	// Redis returns newest first
+	for i := len(recent) - 1; i >= 0; i-- {
+		data, err := marshalDanmaku(recent[i], true)
+		if err != nil {
+			continue
+		}
+		select {
+		case client.Send <- data:
+		default:
+			return // Never block on a full buffer
+		}
+	}
+}
+
+// Start runs the hub's event loop in the background; repeated calls are no-ops
+func (h *DanmakuHub) Start() {
+	h.startOnce.Do(func() {
+		go h.Run()
+	})
+}
+
 // Run starts the hub's event loop
 func (h *DanmakuHub) Run() {
 	for {
@@ -53,6 +203,9 @@ func (h *DanmakuHub) Run() {
 
 		case danmaku := <-h.broadcast:
 			h.broadcastDanmaku(danmaku)
+
+		case data := <-h.danmakuOut:
+			h.broadcastRaw(data)
 		}
 	}
 }
@@ -62,66 +215,174 @@ func (h *DanmakuHub) registerClient(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	// The read pump can fail and unregister before the hub sees the register
+	if client.removed {
+		return
+	}
+
 	h.clients[client.ID] = client
-	log.Printf("[Hub] Client connected: %s (total: %d)", client.ID, len(h.clients))
+	h.logger.Info("client connected", "client_id", client.ID, "total", len(h.clients))
 
 	// Start the client's write pump
 	go client.writePump()
 }
 
-// unregisterClient removes a client from the hub
+// unregisterClient removes a client from the hub. Only the hub's Run goroutine sends on
+// or closes client.Send, and only while the client is in the map, so Send is closed once
+// however many times the client is unregistered.
 func (h *DanmakuHub) unregisterClient(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	client.removed = true
 	if _, ok := h.clients[client.ID]; ok {
 		delete(h.clients, client.ID)
-		close(client.Send)
-		log.Printf("[Hub] Client disconnected: %s (total: %d)", client.ID, len(h.clients))
+		client.closeSend()
+		h.logger.Info("client disconnected", "client_id", client.ID, "total", len(h.clients))
 	}
 }
 
 // broadcastDanmaku sends a danmaku message to all connected clients
 func (h *DanmakuHub) broadcastDanmaku(danmaku interfaces.Danmaku) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
 	// Serialize danmaku to JSON
-	data, err := json.Marshal(map[string]interface{}{
-		"type":    "danmaku",
-		"data":    danmaku,
-		"time":    time.Now().Unix(),
-		"sentAt":  danmaku.Timestamp,
-	})
+	data, err := marshalDanmaku(danmaku, false)
 	if err != nil {
-		log.Printf("[Hub] Failed to marshal danmaku: %v", err)
+		h.logger.Error("failed to marshal danmaku", "error", err)
 		return
 	}
 
-	// Send to all clients
+	sentCount := h.sendToClients(data)
+	h.logger.Debug("broadcast danmaku", "clients", sentCount, "user_id", danmaku.UserID)
+}
+
+// broadcastRaw sends a pre-encoded message to all connected clients
+func (h *DanmakuHub) broadcastRaw(data []byte) {
+	h.sendToClients(data)
+}
+
+// sendToClients queues data on every client's send buffer and returns how many took it.
+// Clients whose buffer was full for slowClientDrops messages in a row are disconnected.
+func (h *DanmakuHub) sendToClients(data []byte) int {
+	h.mu.RLock()
 	sentCount := 0
+	var slow []*Client
 	for _, client := range h.clients {
-		select {
-		case client.Send <- data:
+		if backpressure.Send(h.clientGate, client.Send, data, true) {
+			client.drops = 0
 			sentCount++
-		default:
-			// Client send buffer full, skip
-			log.Printf("[Hub] Client send buffer full: %s", client.ID)
+			continue
+		}
+		client.drops++
+		h.logger.Debug("client send buffer full", "client_id", client.ID, "consecutive_drops", client.drops)
+		if h.slowClientDrops > 0 && client.drops >= h.slowClientDrops {
+			slow = append(slow, client)
 		}
 	}
+	h.mu.RUnlock()
 
-	log.Printf("[Hub] Broadcast danmaku to %d clients", sentCount)
+	for _, client := range slow {
+		h.logger.Warn("disconnecting slow client", "client_id", client.ID, "consecutive_drops", client.drops)
+		h.unregisterClient(client)
+		go client.closeSlow()
+	}
+	return sentCount
 }
 
-// Broadcast sends a danmaku message to all connected clients (public method)
-func (h *DanmakuHub) Broadcast(danmaku interfaces.Danmaku) {
-	select {
-	case h.broadcast <- danmaku:
+// BroadcastRaw sends a pre-encoded JSON message to all connected clients
+func (h *DanmakuHub) BroadcastRaw(data []byte) {
+	// Story, vote and image messages are never sampled
+	if !backpressure.Send(h.broadcastGate, h.danmakuOut, data, true) {
+		h.logger.Warn("message channel full, dropping message")
+	}
+}
+
+// BroadcastMessage sends a typed message to all connected clients. An object payload's
+// fields sit beside "type" and "time"; any other payload is sent under "data".
+func (h *DanmakuHub) BroadcastMessage(msgType string, payload interface{}) {
+	data, err := marshalMessage(msgType, payload)
+	if err != nil {
+		h.logger.Error("failed to marshal message", "type", msgType, "error", err)
+		return
+	}
+	h.BroadcastRaw(data)
+}
+
+// BroadcastStoryUpdate sends a newly generated story segment to all connected clients as a
+// "story" message, followed by an "image" message once a new scene's artwork is ready
+func (h *DanmakuHub) BroadcastStoryUpdate(storyID string, response *engine.StoryResponse) {
+	h.BroadcastMessage("story", storyMessage{StoryID: storyID, StoryResponse: response})
+
+	h.mu.RLock()
+	renderer := h.sceneImages
+	h.mu.RUnlock()
+	if renderer != nil && response.VisualPrompt != nil {
+		go h.broadcastSceneImage(renderer, storyID, response)
+	}
+}
+
+// broadcastSceneImage renders a segment's scene image and sends it as an "image" message
+func (h *DanmakuHub) broadcastSceneImage(renderer SceneImageRenderer, storyID string, response *engine.StoryResponse) {
+	ctx, cancel := context.WithTimeout(logging.Detach(context.Background(), "scene-image"), sceneImageTimeout)
+	defer cancel()
+
+	url, err := renderer(ctx, storyID, response.VisualPrompt)
+	if err != nil {
+		h.logger.Warn("failed to render scene image", "story_id", storyID, "scene", response.NewScene, "error", err)
+		return
+	}
+	h.BroadcastMessage("image", sceneImageMessage{
+		StoryID:  storyID,
+		Scene:    response.NewScene,
+		SceneKey: response.VisualPrompt.SceneKey,
+		Image:    url,
+	})
+}
+
+// marshalMessage encodes a typed websocket message
+func marshalMessage(msgType string, payload interface{}) ([]byte, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &msg); err != nil || msg == nil {
+		msg = map[string]json.RawMessage{"data": raw}
+	}
+	msg["type"], _ = json.Marshal(msgType)
+	msg["time"], _ = json.Marshal(time.Now().Unix())
+	return json.Marshal(msg)
+}
+
+// marshalDanmaku serializes a danmaku websocket message
+func marshalDanmaku(danmaku interfaces.Danmaku, replay bool) ([]byte, error) {
+	msg := map[string]interface{}{
+		"type":   danmakuMessageType(danmaku),
+		"data":   danmaku,
+		"time":   time.Now().Unix(),
+		"sentAt": danmaku.Timestamp,
+	}
+	if replay {
+		msg["replay"] = true
+	}
+	return json.Marshal(msg)
+}
+
+// danmakuMessageType distinguishes gifts, superchats and room entries from regular chat for the frontend
+func danmakuMessageType(danmaku interfaces.Danmaku) string {
+	switch kind := danmaku.EventKind(); kind {
+	case interfaces.DanmakuChat:
+		return "danmaku"
 	default:
-		log.Printf("[Hub] Broadcast channel full, dropping danmaku")
+		return string(kind)
 	}
 }
 
+// Broadcast sends a danmaku message to all connected clients (public method)
+func (h *DanmakuHub) Broadcast(danmaku interfaces.Danmaku) {
+	backpressure.Send(h.broadcastGate, h.broadcast, danmaku, danmaku.IsPaid())
+}
+
 // GetClientCount returns the number of connected clients
 func (h *DanmakuHub) GetClientCount() int {
 	h.mu.RLock()
@@ -150,7 +411,7 @@ func (c *Client) writePump() {
 			}
 
 			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("[Client] Error writing to %s: %v", c.ID, err)
+				c.Hub.logger.Warn("failed to write to client", "client_id", c.ID, "error", err)
 				c.closed = true
 				c.mu.Unlock()
 				return
@@ -166,7 +427,7 @@ func (c *Client) writePump() {
 
 			// Send ping
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("[Client] Error sending ping to %s: %v", c.ID, err)
+				c.Hub.logger.Warn("failed to ping client", "client_id", c.ID, "error", err)
 				c.closed = true
 				c.mu.Unlock()
 				return
@@ -189,6 +450,21 @@ func (c *Client) Close() {
 	c.Conn.Close()
 }
 
+// closeSend closes the Send channel, which stops the write pump; repeated calls are no-ops
+func (c *Client) closeSend() {
+	c.sendOnce.Do(func() {
+		close(c.Send)
+	})
+}
+
+// closeSlow tells the viewer it fell behind and closes the connection, which also unblocks
+// a write pump stuck on it. WriteControl and Close are safe alongside the write pump.
+func (c *Client) closeSlow() {
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer")
+	_ = c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(slowCloseWait))
+	c.Conn.Close()
+}
+
 // readPump pumps messages from the WebSocket connection to the hub
 func (c *Client) readPump() {
 	defer func() {
@@ -207,7 +483,7 @@ func (c *Client) readPump() {
 		_, _, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("[Client] Unexpected close from %s: %v", c.ID, err)
+				c.Hub.logger.Warn("unexpected close from client", "client_id", c.ID, "error", err)
 			}
 			break
 		}
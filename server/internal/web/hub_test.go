@@ -0,0 +1,187 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Cyber-Jianghu/server/internal/config"
+	"Cyber-Jianghu/server/internal/interfaces"
+
+	"github.com/gorilla/websocket"
+)
+
+// startTestHub starts a hub behind the danmaku stream handler and returns its ws:// URL
+func startTestHub(t *testing.T) (*DanmakuHub, string) {
+	t.Helper()
+	hub := NewDanmakuHub()
+	hub.Start()
+	handlers := NewHandlers(&config.Config{}, hub, nil, nil, nil)
+	server := httptest.NewServer(http.HandlerFunc(handlers.GetDanmakuStream))
+	t.Cleanup(server.Close)
+	return hub, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// readMessageType reads the next websocket message and returns its "type" field
+func readMessageType(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return msg.Type
+}
+
+// waitForClients waits until the hub has n clients
+func waitForClients(t *testing.T, hub *DanmakuHub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.GetClientCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("hub has %d clients, want %d", hub.GetClientCount(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHubConcurrentRegisterAndBroadcast(t *testing.T) {
+	hub, url := startTestHub(t)
+
+	stop := make(chan struct{})
+	var broadcasters sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		broadcasters.Add(1)
+		go func() {
+			defer broadcasters.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				hub.Broadcast(interfaces.Danmaku{UserID: "u", Content: fmt.Sprintf("弹幕%d", n), Kind: interfaces.DanmakuChat})
+				hub.BroadcastMessage("vote", map[string]int{"round": n})
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+	}
+
+	// Viewers connect and leave while messages flow, so registers, unregisters and
+	// sends on their channels interleave
+	var viewers sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		viewers.Add(1)
+		go func() {
+			defer viewers.Done()
+			for j := 0; j < 10; j++ {
+				conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+				if err != nil {
+					t.Errorf("dial: %v", err)
+					return
+				}
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				// Under this load a viewer may be cut off as a slow consumer, which is fine
+				if _, _, err := conn.ReadMessage(); err != nil && !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+					t.Errorf("read welcome: %v", err)
+				}
+				conn.Close()
+			}
+		}()
+	}
+	viewers.Wait()
+	close(stop)
+	broadcasters.Wait()
+
+	waitForClients(t, hub, 0)
+}
+
+func TestHubUnregisterTwice(t *testing.T) {
+	hub, url := startTestHub(t)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	waitForClients(t, hub, 1)
+
+	hub.mu.RLock()
+	var client *Client
+	for _, c := range hub.clients {
+		client = c
+	}
+	hub.mu.RUnlock()
+
+	// A slow-client disconnect and the read pump can both unregister the same client
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hub.unregister <- client
+		}()
+	}
+	wg.Wait()
+	waitForClients(t, hub, 0)
+}
+
+func TestRouterStartsHub(t *testing.T) {
+	router, _ := NewRouter(&config.Config{}, nil, nil, nil, nil, nil, nil, nil)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// The welcome is written by the client's write pump, which only a running hub starts
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/live/danmaku", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if got := readMessageType(t, conn); got != "connected" {
+		t.Fatalf("first message type = %q, want connected", got)
+	}
+
+	resp, err := http.Get(server.URL + "/api/v1/live/status")
+	if err != nil {
+		t.Fatalf("get status: %v", err)
+	}
+	defer resp.Body.Close()
+	var status LiveStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if status.ClientCount != 1 {
+		t.Errorf("client count = %d, want 1", status.ClientCount)
+	}
+}
+
+func TestHubStartTwiceBroadcasts(t *testing.T) {
+	hub, url := startTestHub(t)
+	// startTestHub already started it; a second loop would race the first for messages
+	hub.Start()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if got := readMessageType(t, conn); got != "connected" {
+		t.Fatalf("first message type = %q, want connected", got)
+	}
+	waitForClients(t, hub, 1)
+
+	hub.Broadcast(interfaces.Danmaku{UserID: "42", Username: "侠客", Content: "投票2", Kind: interfaces.DanmakuChat})
+	if got := readMessageType(t, conn); got != "danmaku" {
+		t.Errorf("broadcast message type = %q, want danmaku", got)
+	}
+}
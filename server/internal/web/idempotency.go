@@ -0,0 +1,147 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"Cyber-Jianghu/server/internal/logging"
+	"Cyber-Jianghu/server/internal/storage"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// IdempotencyKeyHeader carries a client-chosen key that identifies retries of one request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader is set on responses replayed from an earlier request
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	idempotencyKeyPrefix = "idempotency:"
+	idempotencyPending   = "pending"
+	maxIdempotencyKeyLen = 255
+	idempotencyStoreWait = 2 * time.Second
+)
+
+// idempotentResponse is a completed response stored for replay
+type idempotentResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// idempotency replays the stored response when a request repeats an Idempotency-Key
+// header seen within ttl, so client retries don't redo expensive work. A retry that
+// arrives while the first request is still running gets 409. Server errors and rate
+// limit rejections are not stored, so they can be retried. Requests pass straight through without the header,
+// or when Redis is unavailable.
+func idempotency(store *storage.RedisStore, ttl time.Duration, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if store == nil || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			log := logging.FromContext(r.Context(), logger).With("component", "idempotency")
+			if len(key) > maxIdempotencyKeyLen {
+				writeIdempotencyError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+				return
+			}
+
+			// Keys are scoped to the endpoint so one key can't replay another route's response
+			redisKey := idempotencyKeyPrefix + r.Method + ":" + r.URL.Path + ":" + key
+			claimed, err := store.SetNX(r.Context(), redisKey, idempotencyPending, ttl)
+			if err != nil {
+				log.Warn("idempotency store unavailable, handling request normally", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !claimed {
+				replayIdempotent(w, r, store, redisKey, log)
+				return
+			}
+
+			var body bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&body)
+			next.ServeHTTP(ww, r)
+
+			// Finish bookkeeping even if the client has gone away
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), idempotencyStoreWait)
+			defer cancel()
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+				if err := store.Del(ctx, redisKey); err != nil {
+					log.Warn("failed to release idempotency key", "error", err)
+				}
+				return
+			}
+
+			data, err := json.Marshal(idempotentResponse{
+				Status:      status,
+				ContentType: ww.Header().Get("Content-Type"),
+				Body:        body.Bytes(),
+			})
+			if err == nil {
+				err = store.Set(ctx, redisKey, data, ttl)
+			}
+			if err != nil {
+				log.Warn("failed to store idempotent response", "error", err)
+				_ = store.Del(ctx, redisKey)
+			}
+		})
+	}
+}
+
+// replayIdempotent writes the stored response for a repeated key
+func replayIdempotent(w http.ResponseWriter, r *http.Request, store *storage.RedisStore, redisKey string, log *slog.Logger) {
+	value, err := store.Get(r.Context(), redisKey)
+	if errors.Is(err, redis.Nil) {
+		// Expired or released between the claim and now; ask the client to retry
+		writeIdempotencyError(w, http.StatusConflict, "Request with this Idempotency-Key is being retried, try again")
+		return
+	}
+	if err != nil {
+		log.Warn("failed to read idempotent response", "error", err)
+		writeIdempotencyError(w, http.StatusServiceUnavailable, "Idempotency store unavailable")
+		return
+	}
+	if value == idempotencyPending {
+		writeIdempotencyError(w, http.StatusConflict, "Request with this Idempotency-Key is still in progress")
+		return
+	}
+
+	var stored idempotentResponse
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		log.Warn("failed to decode idempotent response", "error", err)
+		writeIdempotencyError(w, http.StatusInternalServerError, "Stored response is unreadable")
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(IdempotentReplayHeader, "true")
+	w.WriteHeader(stored.Status)
+	_, _ = w.Write(stored.Body)
+}
+
+// writeIdempotencyError writes an error in the story endpoints' response shape
+func writeIdempotencyError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   message,
+	})
+}
@@ -0,0 +1,161 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"Cyber-Jianghu/server/internal/generators"
+	"Cyber-Jianghu/server/internal/logging"
+)
+
+const (
+	// preloadPriority queues speculative images behind every interactive request
+	preloadPriority = -10
+	// preloadTimeout bounds how long a preload waits in the queue and on the GPU
+	preloadTimeout   = 10 * time.Minute
+	maxPreloadImages = 20
+)
+
+// PreloadImagesRequest lists images to generate ahead of time. Each entry takes the same
+// fields as /image/generate, so a later request for it hits the cache.
+type PreloadImagesRequest struct {
+	Images []GenerateImageRequest `json:"images"`
+}
+
+// PreloadedImage identifies one image sent to the queue
+type PreloadedImage struct {
+	ID       string `json:"id"`
+	CacheKey string `json:"cache_key"`
+	Prompt   string `json:"prompt"`
+}
+
+// PreloadImagesResponse reports what happened to each requested image
+type PreloadImagesResponse struct {
+	Success bool             `json:"success"`
+	Queued  []PreloadedImage `json:"queued"`
+	Cached  int              `json:"cached"`  // Already cached or already being preloaded
+	Skipped int              `json:"skipped"` // Not queued because the queue was full
+	Error   string           `json:"error,omitempty"`
+}
+
+// PreloadImages queues low-priority generations for images the audience is likely to need
+// next, storing the results in the image cache. It returns without waiting for them.
+func (h *StoryHandlers) PreloadImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req PreloadImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PreloadImagesResponse{Error: "Invalid request body"})
+		return
+	}
+	if h.images == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(PreloadImagesResponse{Error: "ComfyUI client not initialized"})
+		return
+	}
+	if len(req.Images) == 0 || len(req.Images) > maxPreloadImages {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PreloadImagesResponse{
+			Error: fmt.Sprintf("between 1 and %d images are required", maxPreloadImages),
+		})
+		return
+	}
+
+	for i := range req.Images {
+		if req.Images[i].Prompt == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(PreloadImagesResponse{Error: fmt.Sprintf("images[%d]: prompt is required", i)})
+			return
+		}
+	}
+
+	// Results are cached after this request returns
+	ctx := logging.Detach(r.Context(), "preload")
+	resp := PreloadImagesResponse{Success: true, Queued: []PreloadedImage{}}
+	for i := range req.Images {
+		image := &req.Images[i]
+		opts, cacheKey := h.imageOptions(image)
+		if h.imageCache.Check(cacheKey) || !h.startPreload(cacheKey) {
+			resp.Cached++
+			continue
+		}
+
+		queued := PreloadedImage{
+			ID:       fmt.Sprintf("preload_%d_%d", time.Now().UnixNano(), i),
+			CacheKey: cacheKey,
+			Prompt:   image.Prompt,
+		}
+		resultCh := make(chan *generators.QueueResult, 1)
+		err := h.imageQueue.Enqueue(&generators.QueueRequest{
+			ID:        queued.ID,
+			Options:   opts,
+			ResultCh:  resultCh,
+			CreatedAt: time.Now(),
+			Priority:  preloadPriority,
+		})
+		if err != nil {
+			h.finishPreload(cacheKey)
+			if !errors.Is(err, generators.ErrQueueFull) {
+				storyLogger(ctx).Warn("failed to queue preload", "key", cacheKey, "error", err)
+			}
+			// Leave the rest of the queue to interactive requests
+			resp.Skipped = len(req.Images) - i
+			break
+		}
+
+		resp.Queued = append(resp.Queued, queued)
+		go h.storePreload(ctx, cacheKey, image.Prompt, opts, resultCh)
+	}
+
+	storyLogger(ctx).Info("images preloaded", "queued", len(resp.Queued), "cached", resp.Cached, "skipped", resp.Skipped)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// storePreload caches a preloaded image once the queue finishes it
+func (h *StoryHandlers) storePreload(ctx context.Context, cacheKey, prompt string, opts *generators.GenerateOptions, resultCh <-chan *generators.QueueResult) {
+	defer h.finishPreload(cacheKey)
+
+	var result *generators.QueueResult
+	select {
+	case result = <-resultCh:
+	case <-time.After(preloadTimeout):
+		storyLogger(ctx).Warn("preload timed out", "key", cacheKey)
+		return
+	}
+
+	if result.Error != nil {
+		if generators.ShouldCacheFailure(result.Error) {
+			h.imageCache.PutNegative(cacheKey, result.Error, generators.DefaultNegativeTTL)
+		}
+		storyLogger(ctx).Warn("preload failed", "key", cacheKey, "error", result.Error)
+		return
+	}
+	if err := h.imageCache.Put(ctx, cacheKey, result.ImageData, prompt, opts); err != nil {
+		storyLogger(ctx).Warn("failed to cache preloaded image", "key", cacheKey, "error", err)
+	}
+}
+
+// startPreload claims a cache key for preloading, reporting false if it is already claimed
+func (h *StoryHandlers) startPreload(cacheKey string) bool {
+	h.preloadMu.Lock()
+	defer h.preloadMu.Unlock()
+
+	if h.preloading[cacheKey] {
+		return false
+	}
+	h.preloading[cacheKey] = true
+	return true
+}
+
+// finishPreload releases a cache key claimed by startPreload
+func (h *StoryHandlers) finishPreload(cacheKey string) {
+	h.preloadMu.Lock()
+	defer h.preloadMu.Unlock()
+	delete(h.preloading, cacheKey)
+}
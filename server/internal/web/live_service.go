@@ -2,14 +2,22 @@ package web
 
 import (
 	"Cyber-Jianghu/server/internal/adapters"
+	"Cyber-Jianghu/server/internal/backpressure"
+	"Cyber-Jianghu/server/internal/engine"
 	"Cyber-Jianghu/server/internal/interfaces"
+	"Cyber-Jianghu/server/internal/models"
 	"Cyber-Jianghu/server/internal/storage"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
+	"time"
 )
 
+// storyQueueSize bounds the danmaku waiting for translation and the story pipeline
+const storyQueueSize = 256
+
 // ConnectOptions holds connection parameters for live platform
 type ConnectOptions struct {
 	Platform string `json:"platform"` // "bilibili" or "douyin"
@@ -26,16 +34,129 @@ type LiveService struct {
 	mu sync.RWMutex
 	danmakuParser *adapters.DanmakuParser
 	redisStore *storage.RedisStore
+	mysqlStore *storage.MySQLStore
+	storyEngine *engine.StoryEngine
+	dedupWindows map[string]time.Duration
+	douyinSigner adapters.DouyinSignatureFunc // Signs Douyin push URLs; nil makes Douyin connects fail
+	voteTally *VoteTally
+	actionBatcher *ActionBatcher
+	giftInfluence *GiftInfluence
+	lastHelp time.Time // When /help was last answered
+	ingestBuffer int // Adapter danmaku channel capacity; 0 uses the adapter default
+	ingestGate *backpressure.Gate // Shared by successive adapters so counts survive reconnects
+	storyGate *backpressure.Gate // Counts danmaku queued for translation and the story pipeline
+	logger *slog.Logger
+	baseLogger *slog.Logger // Unscoped logger passed on to adapters
 }
 
 // NewLiveService creates a new live service
 func NewLiveService(platform string) *LiveService {
+	logger := slog.Default().With("component", "live")
 	return &LiveService{
 		platform: platform,
 		danmakuParser: adapters.NewDanmakuParser(),
+		dedupWindows: make(map[string]time.Duration),
+		ingestGate: backpressure.NewGate("adapter_ingest", 1, logger),
+		storyGate: backpressure.NewGate("story_pipeline", 1, logger),
+		logger: logger,
+	}
+}
+
+// SetBackpressure sizes the adapter's danmaku channel (0 keeps the default) and sets how
+// chat danmaku are sampled when it backs up; call it after SetLogger
+func (s *LiveService) SetBackpressure(capacity int, sampleEvery int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ingestBuffer = capacity
+	s.ingestGate = backpressure.NewGate("adapter_ingest", sampleEvery, s.logger)
+	s.storyGate = backpressure.NewGate("story_pipeline", sampleEvery, s.logger)
+}
+
+// IngestGate returns the gate counting danmaku between the adapter and the service
+func (s *LiveService) IngestGate() *backpressure.Gate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ingestGate
+}
+
+// StoryGate returns the gate counting danmaku queued for the story pipeline
+func (s *LiveService) StoryGate() *backpressure.Gate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.storyGate
+}
+
+// SetLogger sets the structured logger, which is also handed to platform adapters
+func (s *LiveService) SetLogger(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger.With("component", "live")
+	s.baseLogger = logger
+}
+
+// SetVoteTally sets the tally that receives /vote commands
+func (s *LiveService) SetVoteTally(voteTally *VoteTally) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.voteTally = voteTally
+}
+
+// SetActionBatcher sets the batcher that receives action commands. Each command's
+// story action prefix (e.g. "攻击") also works as a keyword for it without the slash.
+func (s *LiveService) SetActionBatcher(actionBatcher *ActionBatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actionBatcher = actionBatcher
+
+	aliases := make(map[string]string)
+	for verb, prefix := range actionBatcher.Commands() {
+		aliases[prefix] = verb
+	}
+	s.danmakuParser.AddAliases(aliases)
+}
+
+// SetCommandAliases adds keywords (e.g. "冲") that viewers can type, with or without a
+// slash, in place of a canonical command verb (e.g. "attack")
+func (s *LiveService) SetCommandAliases(aliases map[string]string) {
+	s.danmakuParser.AddAliases(aliases)
+}
+
+// SetGiftInfluence sets the gift weighting applied to viewer votes and actions
+func (s *LiveService) SetGiftInfluence(giftInfluence *GiftInfluence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.giftInfluence = giftInfluence
+}
+
+// SetActiveStory sets the story that viewer votes and actions are applied to
+func (s *LiveService) SetActiveStory(storyID string) {
+	s.mu.RLock()
+	voteTally := s.voteTally
+	actionBatcher := s.actionBatcher
+	s.mu.RUnlock()
+
+	if voteTally != nil {
+		voteTally.SetStory(storyID)
+	}
+	if actionBatcher != nil {
+		actionBatcher.SetStory(storyID)
 	}
 }
 
+// SetDedupWindow sets the danmaku deduplication window for a platform
+func (s *LiveService) SetDedupWindow(platform string, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dedupWindows[platform] = window
+}
+
+// SetDouyinSigner sets the signer Douyin adapters use for the webcast push URL
+func (s *LiveService) SetDouyinSigner(signer adapters.DouyinSignatureFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.douyinSigner = signer
+}
+
 // SetRedisStore sets the Redis store for danmaku storage
 func (s *LiveService) SetRedisStore(redisStore *storage.RedisStore) {
 	s.mu.Lock()
@@ -43,10 +164,25 @@ func (s *LiveService) SetRedisStore(redisStore *storage.RedisStore) {
 	s.redisStore = redisStore
 }
 
+// SetMySQLStore sets the MySQL store for long-term danmaku archival
+func (s *LiveService) SetMySQLStore(mysqlStore *storage.MySQLStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mysqlStore = mysqlStore
+}
+
+// SetStoryEngine sets the story engine that receives audience input
+func (s *LiveService) SetStoryEngine(storyEngine *engine.StoryEngine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.storyEngine = storyEngine
+}
+
 // ConnectResponse holds connection response
 type ConnectResponse struct {
 	Success   bool   `json:"success"`
 	Message   string `json:"message"`
+	ErrorCode string `json:"error_code,omitempty"` // cookie_expired, room_offline or room_not_found
 	Platform  string `json:"platform"`
 	RoomID    string `json:"room_id"`
 	Connected bool   `json:"connected"`
@@ -64,10 +200,22 @@ func (s *LiveService) Connect(ctx context.Context, opts *ConnectOptions, hub *Da
 	// Create adapter based on platform
 	switch opts.Platform {
 	case "bilibili":
-		s.adapter = adapters.NewBilibiliAdapter()
+		bilibili := adapters.NewBilibiliAdapter()
+		bilibili.SetParser(s.danmakuParser)
+		bilibili.SetDedupWindow(s.dedupWindows[opts.Platform])
+		bilibili.SetBackpressure(s.ingestBuffer, s.ingestGate)
+		if s.baseLogger != nil {
+			bilibili.SetLogger(s.baseLogger)
+		}
+		s.adapter = bilibili
 	case "douyin":
-		// TODO: Implement Douyin adapter
-		return fmt.Errorf("douyin adapter not implemented yet")
+		douyin := adapters.NewDouyinAdapter()
+		douyin.SetDedupWindow(s.dedupWindows[opts.Platform])
+		douyin.SetBackpressure(s.ingestBuffer, s.ingestGate)
+		if s.douyinSigner != nil {
+			douyin.SetSignatureFunc(s.douyinSigner)
+		}
+		s.adapter = douyin
 	default:
 		return fmt.Errorf("unsupported platform: %s", opts.Platform)
 	}
@@ -78,6 +226,16 @@ func (s *LiveService) Connect(ctx context.Context, opts *ConnectOptions, hub *Da
 		Cookie: opts.Cookie,
 	}
 
+	if preflighter, ok := s.adapter.(interfaces.LivePreflighter); ok {
+		if err := preflighter.PreflightCheck(ctx, connectOpts); err != nil {
+			if isPreflightFailure(err) {
+				return fmt.Errorf("preflight check failed: %w", err)
+			}
+			// An unreachable check API shouldn't block a connection that may still work
+			s.logger.Warn("preflight check inconclusive, connecting anyway", "platform", opts.Platform, "room_id", opts.RoomID, "error", err)
+		}
+	}
+
 	if err := s.adapter.Connect(ctx, connectOpts); err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
@@ -85,15 +243,21 @@ func (s *LiveService) Connect(ctx context.Context, opts *ConnectOptions, hub *Da
 	s.connected = true
 	s.platform = opts.Platform
 	s.roomID = opts.RoomID
-	s.adapter.(*adapters.BilibiliAdapter).SetParser(s.danmakuParser)
 
 	// Subscribe to danmaku and forward to hub
 	go s.forwardDanmaku(ctx, hub)
 
-	log.Printf("[LiveService] Connected to %s room %s", opts.Platform, opts.RoomID)
+	s.logger.Info("connected", "platform", opts.Platform, "room_id", opts.RoomID)
 	return nil
 }
 
+// isPreflightFailure reports whether err is a definite answer from a preflight check
+func isPreflightFailure(err error) bool {
+	return errors.Is(err, adapters.ErrCookieExpired) ||
+		errors.Is(err, adapters.ErrRoomOffline) ||
+		errors.Is(err, adapters.ErrRoomNotFound)
+}
+
 // Disconnect disconnects from the live platform
 func (s *LiveService) Disconnect() error {
 	s.mu.Lock()
@@ -104,14 +268,17 @@ func (s *LiveService) Disconnect() error {
 	}
 
 	if err := s.adapter.Disconnect(); err != nil {
-		log.Printf("[LiveService] Error disconnecting: %v", err)
+		s.logger.Warn("error disconnecting", "platform", s.platform, "room_id", s.roomID, "error", err)
 	}
 
 	s.connected = false
 	s.platform = ""
 	s.roomID = ""
+	if s.giftInfluence != nil {
+		s.giftInfluence.Reset()
+	}
 
-	log.Printf("[LiveService] Disconnected")
+	s.logger.Info("disconnected")
 	return nil
 }
 
@@ -137,43 +304,134 @@ func (s *LiveService) GetStatus() *LiveStatus {
 
 // forwardDanmaku forwards danmaku from adapter to hub
 func (s *LiveService) forwardDanmaku(ctx context.Context, hub *DanmakuHub) {
+	s.mu.RLock()
+	logger := s.logger.With("platform", s.platform, "room_id", s.roomID)
+	storyGate := s.storyGate
+	s.mu.RUnlock()
+
 	danmakuChan, err := s.adapter.SubscribeDanmaku(ctx)
 	if err != nil {
-		log.Printf("[LiveService] Failed to subscribe danmaku: %v", err)
+		logger.Error("failed to subscribe danmaku", "error", err)
 		return
 	}
 
+	// One worker feeds the story pipeline so votes and actions keep their arrival
+	// order while slow translations stay off the read loop
+	storyQueue := make(chan interfaces.Danmaku, storyQueueSize)
+	defer close(storyQueue)
+	go s.runStoryPipeline(ctx, storyQueue, hub)
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case danmaku, ok := <-danmakuChan:
 			if !ok {
-				log.Printf("[LiveService] Danmaku channel closed")
+				logger.Info("danmaku channel closed")
 				return
 			}
 
-			// Parse danmaku for commands
-			parsedCmd := s.danmakuParser.Parse(danmaku)
-			if parsedCmd.Type != adapters.CommandNone {
-				log.Printf("[LiveService] Parsed command: %+v from %s", parsedCmd, danmaku.Username)
+			// Broadcast the original text to all WebSocket clients
+			hub.Broadcast(danmaku)
+
+			// Room entries are only shown; they carry no text for the story or the archive
+			if danmaku.EventKind() == interfaces.DanmakuEnter {
+				continue
 			}
 
-			// Broadcast to all WebSocket clients
-			hub.Broadcast(danmaku)
+			if !backpressure.Send(storyGate, storyQueue, danmaku, danmaku.IsPaid()) {
+				logger.Debug("story pipeline busy, skipping danmaku", "user_id", danmaku.UserID)
+			}
 
 			// Store to Redis (non-blocking)
 			s.mu.RLock()
 			redisStore := s.redisStore
+			mysqlStore := s.mysqlStore
+			platform, roomID := s.platform, s.roomID
 			s.mu.RUnlock()
 
 			if redisStore != nil {
 				go func(d interfaces.Danmaku) {
 					if err := redisStore.StoreDanmaku(context.Background(), d); err != nil {
-						log.Printf("[LiveService] Failed to store danmaku to Redis: %v", err)
+						logger.Warn("failed to store danmaku to Redis", "user_id", d.UserID, "error", err)
 					}
 				}(danmaku)
 			}
+
+			// Archive to MySQL (non-blocking)
+			if mysqlStore != nil {
+				go func(d interfaces.Danmaku) {
+					record := &models.Danmaku{
+						Platform:  platform,
+						RoomID:    roomID,
+						UserID:    d.UserID,
+						Username:  d.Username,
+						Content:   d.Content,
+						GiftValue: d.GiftValue,
+						Timestamp: time.Unix(d.Timestamp, 0),
+					}
+					if err := mysqlStore.SaveDanmaku(context.Background(), record); err != nil {
+						logger.Warn("failed to archive danmaku to MySQL", "user_id", d.UserID, "error", err)
+					}
+				}(danmaku)
+			}
+		}
+	}
+}
+
+// runStoryPipeline translates queued danmaku where needed and hands them to the story
+// pipeline in the order they were queued, until the queue is closed
+func (s *LiveService) runStoryPipeline(ctx context.Context, queue <-chan interfaces.Danmaku, hub *DanmakuHub) {
+	for danmaku := range queue {
+		s.mu.RLock()
+		storyEngine := s.storyEngine
+		s.mu.RUnlock()
+
+		if storyEngine != nil {
+			danmaku.Content = storyEngine.TranslateForStory(ctx, danmaku.Content)
+		}
+		s.handleStoryDanmaku(danmaku, hub)
+	}
+}
+
+// handleStoryDanmaku parses a danmaku destined for the story pipeline; /help is answered on hub
+func (s *LiveService) handleStoryDanmaku(danmaku interfaces.Danmaku, hub *DanmakuHub) {
+	s.mu.RLock()
+	voteTally := s.voteTally
+	actionBatcher := s.actionBatcher
+	giftInfluence := s.giftInfluence
+	logger := s.logger
+	s.mu.RUnlock()
+
+	if giftInfluence != nil && danmaku.GiftValue > 0 {
+		giftInfluence.AddGift(danmaku.UserID, danmaku.GiftValue)
+	}
+
+	parsedCmd := s.danmakuParser.Parse(danmaku)
+	if parsedCmd.Type != adapters.CommandNone {
+		logger.Debug("parsed command", "type", parsedCmd.Type, "user_id", danmaku.UserID, "username", danmaku.Username, "text", parsedCmd.RawText)
+	}
+
+	switch parsedCmd.Type {
+	case adapters.CommandVote:
+		if voteTally != nil {
+			weight := 1.0
+			if giftInfluence != nil {
+				weight = giftInfluence.Weight(danmaku.UserID)
+			}
+			voteTally.Vote(danmaku.UserID, parsedCmd.VoteID, weight)
+		}
+	case adapters.CommandAction:
+		if actionBatcher == nil {
+			break
+		}
+		// Big gifters skip the batching window
+		if giftInfluence != nil && giftInfluence.ExceedsThreshold(danmaku.UserID) {
+			actionBatcher.SubmitNow(parsedCmd.Action, parsedCmd.Args)
+		} else {
+			actionBatcher.Submit(parsedCmd.Action, parsedCmd.Args)
 		}
+	case adapters.CommandHelp:
+		s.answerHelp(hub)
 	}
 }
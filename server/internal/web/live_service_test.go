@@ -0,0 +1,151 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"Cyber-Jianghu/server/internal/config"
+	"Cyber-Jianghu/server/internal/engine"
+	"Cyber-Jianghu/server/internal/interfaces"
+	"Cyber-Jianghu/server/internal/rag"
+
+	"github.com/gorilla/websocket"
+)
+
+// slowTranslationClient translates every danmaku to translation after a delay and
+// answers story prompts with a segment offering two options
+type slowTranslationClient struct {
+	translation string
+	delay       time.Duration
+}
+
+func (c *slowTranslationClient) Chat(ctx context.Context, req *engine.ChatRequest) (*engine.ChatResponse, error) {
+	reply := ""
+	switch {
+	case strings.Contains(req.Messages[0].Content, "弹幕翻译"):
+		time.Sleep(c.delay)
+		reply = c.translation
+	case strings.Contains(req.Messages[len(req.Messages)-1].Content, "## 玩家的行为"):
+		reply = "【场景：悦来客栈】\n夜雨敲窗。\nA. 推门进客栈\nB. 转身离开"
+	default:
+		return nil, fmt.Errorf("unscripted prompt")
+	}
+	return &engine.ChatResponse{Choices: []engine.Choice{{Message: engine.ChatMessage{Role: "assistant", Content: reply}, FinishReason: "stop"}}}, nil
+}
+
+func (c *slowTranslationClient) Stats() engine.GLMStats {
+	return engine.GLMStats{}
+}
+
+// channelAdapter is a live adapter whose danmaku are sent on its channel by the test
+type channelAdapter struct {
+	danmaku chan interfaces.Danmaku
+}
+
+func (a *channelAdapter) Connect(context.Context, *interfaces.ConnectOptions) error { return nil }
+func (a *channelAdapter) SendChat(context.Context, string) error                    { return nil }
+func (a *channelAdapter) HealthCheck(context.Context) error                         { return nil }
+func (a *channelAdapter) Disconnect() error                                         { return nil }
+
+func (a *channelAdapter) SubscribeDanmaku(context.Context) (<-chan interfaces.Danmaku, error) {
+	return a.danmaku, nil
+}
+
+// readDanmakuContents reads websocket messages until n danmaku have arrived, skipping
+// other message types, and returns their contents in order
+func readDanmakuContents(t *testing.T, conn *websocket.Conn, n int) []string {
+	t.Helper()
+	var contents []string
+	for len(contents) < n {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read after %q: %v", contents, err)
+		}
+		var msg struct {
+			Type string             `json:"type"`
+			Data interfaces.Danmaku `json:"data"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+		if msg.Type == "danmaku" {
+			contents = append(contents, msg.Data.Content)
+		}
+	}
+	return contents
+}
+
+func TestForwardDanmakuKeepsOrderAcrossTranslation(t *testing.T) {
+	ctx := context.Background()
+	storyEngine := engine.NewStoryEngine("", rag.NewInMemoryVectorStore(64), t.TempDir(), "", config.GLM5Config{})
+	storyEngine.SetEmbedder(rag.NewHashEmbedder(64))
+	storyEngine.SetChatClient(&slowTranslationClient{translation: "投票1", delay: 100 * time.Millisecond})
+	storyEngine.EnableTranslation("")
+	if _, err := storyEngine.CreateStory(ctx, "live", nil); err != nil {
+		t.Fatalf("CreateStory: %v", err)
+	}
+
+	hub, url := startTestHub(t)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if got := readMessageType(t, conn); got != "connected" {
+		t.Fatalf("first message type = %q, want connected", got)
+	}
+	waitForClients(t, hub, 1)
+	voteTally := NewVoteTally(storyEngine, hub, time.Minute)
+
+	service := NewLiveService("bilibili")
+	service.SetStoryEngine(storyEngine)
+	service.SetVoteTally(voteTally)
+	service.SetActiveStory("live")
+	adapter := &channelAdapter{danmaku: make(chan interfaces.Danmaku, 2)}
+	service.adapter = adapter
+
+	forwardCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		service.forwardDanmaku(forwardCtx, hub)
+		close(done)
+	}()
+
+	// The same viewer votes twice; only the first vote counts, and it needs translating
+	adapter.danmaku <- interfaces.Danmaku{UserID: "42", Username: "traveler", Content: "I pick the first one"}
+	adapter.danmaku <- interfaces.Danmaku{UserID: "42", Username: "traveler", Content: "投票2"}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(voteTally.Tallies()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no vote reached the tally")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if tallies := voteTally.Tallies(); len(tallies) != 1 || tallies["A"] != 1 {
+		t.Fatalf("tallies = %v, want the translated first vote for A only", tallies)
+	}
+	if stats := service.StoryGate().Stats(); stats.Accepted != 2 {
+		t.Errorf("story gate accepted %d danmaku, want 2", stats.Accepted)
+	}
+
+	// Viewers see what was typed; only the story pipeline uses the translation
+	want := []string{"I pick the first one", "投票2"}
+	if got := readDanmakuContents(t, conn, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("broadcast danmaku = %q, want the untranslated %q", got, want)
+	}
+
+	close(adapter.danmaku)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwardDanmaku did not return after the adapter channel closed")
+	}
+}
@@ -0,0 +1,140 @@
+package web
+
+import (
+	"Cyber-Jianghu/server/internal/generators"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// LoRAHandlers exposes the LoRA registry over HTTP
+type LoRAHandlers struct {
+	registry *generators.LoRARegistry
+}
+
+// NewLoRAHandlers creates LoRA handlers; a nil registry makes every route return 503
+func NewLoRAHandlers(registry *generators.LoRARegistry) *LoRAHandlers {
+	return &LoRAHandlers{registry: registry}
+}
+
+// LoRAListResponse represents the response for listing LoRA models
+type LoRAListResponse struct {
+	Success bool                    `json:"success"`
+	Models  []*generators.LoRAModel `json:"models"`
+	Stats   *generators.LoRAStats   `json:"stats,omitempty"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// LoRAModelResponse represents the response for a single LoRA model
+type LoRAModelResponse struct {
+	Success bool                  `json:"success"`
+	Model   *generators.LoRAModel `json:"model,omitempty"`
+	Error   string                `json:"error,omitempty"`
+}
+
+// UpdateLoRAStrengthRequest represents a request to change a model's default strength
+type UpdateLoRAStrengthRequest struct {
+	Strength *float64 `json:"strength"`
+}
+
+// ListModels returns all registered LoRA models
+func (h *LoRAHandlers) ListModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.ready(w) {
+		return
+	}
+
+	stats := h.registry.GetStats()
+	stats.TotalSize = h.registry.GetTotalSize()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LoRAListResponse{
+		Success: true,
+		Models:  h.registry.ListModels(),
+		Stats:   stats,
+	})
+}
+
+// EnableModel enables a LoRA model
+func (h *LoRAHandlers) EnableModel(w http.ResponseWriter, r *http.Request) {
+	h.updateModel(w, r, h.registry.EnableModel)
+}
+
+// DisableModel disables a LoRA model
+func (h *LoRAHandlers) DisableModel(w http.ResponseWriter, r *http.Request) {
+	h.updateModel(w, r, h.registry.DisableModel)
+}
+
+// UpdateStrength sets a LoRA model's default strength
+func (h *LoRAHandlers) UpdateStrength(w http.ResponseWriter, r *http.Request) {
+	var req UpdateLoRAStrengthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Strength == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(LoRAModelResponse{
+			Success: false,
+			Error:   "strength is required",
+		})
+		return
+	}
+
+	h.updateModel(w, r, func(id string) error {
+		return h.registry.UpdateModelStrength(id, *req.Strength)
+	})
+}
+
+// updateModel applies a change to the model named in the URL and returns the updated model
+func (h *LoRAHandlers) updateModel(w http.ResponseWriter, r *http.Request, update func(id string) error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.ready(w) {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if !h.registry.ModelExists(id) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(LoRAModelResponse{
+			Success: false,
+			Error:   "model not found: " + id,
+		})
+		return
+	}
+
+	if err := update(id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoRAModelResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	model, err := h.registry.GetModel(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(LoRAModelResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LoRAModelResponse{
+		Success: true,
+		Model:   model,
+	})
+}
+
+// ready writes a 503 and returns false when no registry is configured
+func (h *LoRAHandlers) ready(w http.ResponseWriter) bool {
+	if h.registry != nil {
+		return true
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{"error": "LoRA registry not initialized"})
+	return false
+}
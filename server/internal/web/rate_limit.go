@@ -0,0 +1,202 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Cyber-Jianghu/server/internal/config"
+	"Cyber-Jianghu/server/internal/logging"
+	"Cyber-Jianghu/server/internal/storage"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const rateLimitKeyPrefix = "ratelimit:"
+
+// slidingWindowScript checks every key against its limit and records the action in all of
+// them only if none is full, so a request rejected by one limit doesn't use up another.
+// It returns 0 when allowed, otherwise the milliseconds until the fullest window frees a slot.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local retry = 0
+for i, key in ipairs(KEYS) do
+  redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+  if redis.call('ZCARD', key) >= tonumber(ARGV[i + 3]) then
+    local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+    local wait = math.max(tonumber(oldest[2]) + window - now, 1)
+    if wait > retry then retry = wait end
+  end
+end
+if retry > 0 then return retry end
+for _, key in ipairs(KEYS) do
+  redis.call('ZADD', key, now, ARGV[3])
+  redis.call('PEXPIRE', key, window)
+end
+return 0
+`)
+
+// rateLimitCheck is one sliding window an action must fit in
+type rateLimitCheck struct {
+	key   string
+	limit int
+}
+
+// ActionRateLimiter limits story actions per story and per user over a sliding window.
+// Windows live in Redis so every instance shares them; without Redis, or when it fails,
+// they are kept in memory and only limit this instance.
+type ActionRateLimiter struct {
+	window     time.Duration
+	perStory   int
+	perUser    int
+	multiplier float64
+
+	redisStore *storage.RedisStore
+	gifts      *GiftInfluence
+	seq        atomic.Uint64 // Makes window members unique within a millisecond
+
+	mu        sync.Mutex
+	local     map[string][]time.Time // In-memory windows, oldest first
+	lastSweep time.Time
+}
+
+// NewActionRateLimiter creates a limiter from config; it returns nil when both limits are 0
+func NewActionRateLimiter(cfg config.RateLimitConfig, redisStore *storage.RedisStore) *ActionRateLimiter {
+	if cfg.PerStory <= 0 && cfg.PerUser <= 0 {
+		return nil
+	}
+	multiplier := cfg.GifterMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	return &ActionRateLimiter{
+		window:     cfg.Window,
+		perStory:   cfg.PerStory,
+		perUser:    cfg.PerUser,
+		multiplier: multiplier,
+		redisStore: redisStore,
+		local:      make(map[string][]time.Time),
+	}
+}
+
+// SetGiftInfluence lets viewers over the gift threshold act more often
+func (l *ActionRateLimiter) SetGiftInfluence(gifts *GiftInfluence) {
+	l.gifts = gifts
+}
+
+// Allow records an action on storyID by userID (which may be empty) if it fits every
+// limit. Otherwise it reports how long until the action would be allowed.
+func (l *ActionRateLimiter) Allow(ctx context.Context, storyID, userID string) (bool, time.Duration) {
+	scale := 1.0
+	if userID != "" && l.gifts != nil && l.gifts.ExceedsThreshold(userID) {
+		scale = l.multiplier
+	}
+
+	var checks []rateLimitCheck
+	if l.perStory > 0 {
+		checks = append(checks, rateLimitCheck{key: "story:" + storyID, limit: scaleLimit(l.perStory, scale)})
+	}
+	if l.perUser > 0 && userID != "" {
+		checks = append(checks, rateLimitCheck{key: "user:" + storyID + ":" + userID, limit: scaleLimit(l.perUser, scale)})
+	}
+	if len(checks) == 0 {
+		return true, 0
+	}
+
+	if l.redisStore != nil {
+		retry, err := l.allowRedis(ctx, checks)
+		if err == nil {
+			return retry == 0, retry
+		}
+		logging.FromContext(ctx, nil).Warn("rate limit store unavailable, limiting in memory", "component", "ratelimit", "error", err)
+	}
+	retry := l.allowLocal(checks, time.Now())
+	return retry == 0, retry
+}
+
+// allowRedis runs the sliding window check in Redis
+func (l *ActionRateLimiter) allowRedis(ctx context.Context, checks []rateLimitCheck) (time.Duration, error) {
+	now := time.Now()
+	keys := make([]string, len(checks))
+	args := []interface{}{now.UnixMilli(), l.window.Milliseconds(), fmt.Sprintf("%d-%d", now.UnixNano(), l.seq.Add(1))}
+	for i, c := range checks {
+		keys[i] = rateLimitKeyPrefix + c.key
+		args = append(args, c.limit)
+	}
+
+	retryMs, err := slidingWindowScript.Run(ctx, l.redisStore.GetClient(), keys, args...).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+	return time.Duration(retryMs) * time.Millisecond, nil
+}
+
+// allowLocal applies the same sliding window as allowRedis to the in-memory windows
+func (l *ActionRateLimiter) allowLocal(checks []rateLimitCheck, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+	if now.Sub(l.lastSweep) > l.window {
+		for key, times := range l.local {
+			if len(trimWindow(times, cutoff)) == 0 {
+				delete(l.local, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	var retry time.Duration
+	for _, c := range checks {
+		times := trimWindow(l.local[c.key], cutoff)
+		l.local[c.key] = times
+		if len(times) >= c.limit {
+			if wait := times[0].Add(l.window).Sub(now); wait > retry {
+				retry = wait
+			}
+		}
+	}
+	if retry > 0 {
+		return retry
+	}
+
+	for _, c := range checks {
+		l.local[c.key] = append(l.local[c.key], now)
+	}
+	return 0
+}
+
+// trimWindow drops times at or before cutoff from the front of an ordered window
+func trimWindow(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// scaleLimit multiplies a limit, rounding down but never below the original
+func scaleLimit(limit int, scale float64) int {
+	return int(math.Max(float64(limit), math.Floor(float64(limit)*scale)))
+}
+
+// writeRateLimited answers 429 with a Retry-After rounded up to whole seconds
+func writeRateLimited(w http.ResponseWriter, retry time.Duration) {
+	seconds := int(math.Ceil(retry.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(CreateStoryResponse{
+		Success: false,
+		Error:   fmt.Sprintf("Too many actions for this story, retry in %ds", seconds),
+	})
+}
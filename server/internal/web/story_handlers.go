@@ -1,36 +1,61 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	"Cyber-Jianghu/server/internal/engine"
 	"Cyber-Jianghu/server/internal/generators"
+	"Cyber-Jianghu/server/internal/interfaces"
+	"Cyber-Jianghu/server/internal/logging"
+	"Cyber-Jianghu/server/internal/models"
 	"Cyber-Jianghu/server/internal/rag"
+	"Cyber-Jianghu/server/internal/storage"
+
+	"github.com/go-chi/chi/v5"
 )
 
 // StoryHandlers handles story-related requests
 type StoryHandlers struct {
 	storyEngine   *engine.StoryEngine
-	comfyClient   *generators.ComfyUIClient
+	images        generators.ImageGenerator // ComfyUI, or a stub in replay mode; nil disables images
 	imageCache    *generators.ImageCache
 	imageQueue    *generators.ImageQueue
+	preloading    map[string]bool // Cache keys of preloads still in the queue
+	preloadMu     sync.Mutex
+	rateLimiter   *ActionRateLimiter // Limits continue/select; nil disables it
+	timeline      *storage.RedisStore // Audience decision timeline; nil disables the endpoint
+}
+
+// storyLogger returns the default logger tagged with the request ID in ctx
+func storyLogger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, nil).With("component", "story")
 }
 
 // GenerateAudioRequest represents an audio generation request
 type GenerateAudioRequest struct {
-	Text    string `json:"text"`
-	VoiceID string `json:"voice_id,omitempty"`
+	Text     string `json:"text"`
+	VoiceID  string `json:"voice_id,omitempty"`
+	Language string `json:"language,omitempty"` // TTS language; empty is Chinese
 }
 
 // GenerateAudioResponse represents an audio generation response
 type GenerateAudioResponse struct {
 	Success     bool   `json:"success"`
 	AudioBase64 string `json:"audio_base64,omitempty"`
+	AudioKey    string `json:"audio_key,omitempty"` // Use with /audio/stream?key=
 	Error       string `json:"error,omitempty"`
 }
 
@@ -43,15 +68,27 @@ type GenerateImageRequest struct {
 	Steps         int     `json:"steps,omitempty"`
 	CFGScale      float64 `json:"cfg_scale,omitempty"`
 	Model         string  `json:"model,omitempty"`
+	StoryID       string  `json:"story_id,omitempty"` // Attaches the story protagonist's LoRA
+	SceneKey      string  `json:"scene_key,omitempty"` // From the visual spec; caches by scene instead of prompt
+	Inline        bool    `json:"inline,omitempty"`    // Also return the PNG as base64
 }
 
 // GenerateImageResponse represents an image generation response
 type GenerateImageResponse struct {
 	Success     bool   `json:"success"`
-	ImageBase64 string `json:"image_base64,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"` // Served from the image cache
+	ImageBase64 string `json:"image_base64,omitempty"` // Set when inline, or when the image could not be cached
 	Error       string `json:"error,omitempty"`
 }
 
+// imageURLPrefix is where cached images are served, followed by the cache key
+const imageURLPrefix = "/api/v1/image/"
+
+// imageURL returns the URL serving a cached image
+func imageURL(cacheKey string) string {
+	return imageURLPrefix + cacheKey
+}
+
 // GetVoicesResponse represents the response for listing voices
 type GetVoicesResponse struct {
 	Success bool                `json:"success"`
@@ -60,30 +97,58 @@ type GetVoicesResponse struct {
 	Error   string               `json:"error,omitempty"`
 }
 
-// SetDefaultVoiceRequest represents a request to set default voice
-type SetDefaultVoiceRequest struct {
-	VoiceID string `json:"voice_id"`
-}
-
 // NewStoryHandlers creates a new story handlers instance
-func NewStoryHandlers(storyEngine *engine.StoryEngine, comfyClient *generators.ComfyUIClient, imageCacheDir string) *StoryHandlers {
+func NewStoryHandlers(storyEngine *engine.StoryEngine, images generators.ImageGenerator, imageCacheDir string) *StoryHandlers {
 	imageCache := generators.NewImageCache(imageCacheDir, 200, 24*time.Hour)
 	imageQueue := generators.NewImageQueue(2) // 2 concurrent workers
+	if images != nil {
+		imageQueue.Start(context.Background(), images)
+	}
 
 	return &StoryHandlers{
 		storyEngine: storyEngine,
-		comfyClient: comfyClient,
+		images:      images,
 		imageCache:  imageCache,
 		imageQueue:  imageQueue,
+		preloading:  make(map[string]bool),
 	}
 }
 
+// SetRateLimiter sets the limiter applied to story actions; nil disables limiting
+func (h *StoryHandlers) SetRateLimiter(limiter *ActionRateLimiter) {
+	h.rateLimiter = limiter
+}
+
+// allowAction applies the rate limiter, writing a 429 and returning false when exceeded
+func (h *StoryHandlers) allowAction(w http.ResponseWriter, r *http.Request, storyID, userID string) bool {
+	if h.rateLimiter == nil {
+		return true
+	}
+	allowed, retry := h.rateLimiter.Allow(r.Context(), storyID, userID)
+	if !allowed {
+		storyLogger(r.Context()).Info("story action rate limited", "story_id", storyID, "user_id", userID, "retry_after", retry)
+		writeRateLimited(w, retry)
+	}
+	return allowed
+}
+
+// Shutdown drops queued image requests and waits for the generations already running
+func (h *StoryHandlers) Shutdown(ctx context.Context) error {
+	dropped, err := h.imageQueue.Shutdown(ctx)
+	storyLogger(ctx).Info("image queue stopped", "dropped", dropped, "drained", err == nil)
+	if err != nil {
+		return fmt.Errorf("image queue did not drain: %w", err)
+	}
+	return nil
+}
+
 // CreateStoryRequest represents a story creation request
 type CreateStoryRequest struct {
 	Genre       string `json:"genre"`
 	Tone        string `json:"tone"`
 	Style       string `json:"style"`
 	Protagonist string `json:"protagonist"`
+	Language    string `json:"language,omitempty"` // Story language, e.g. en; empty is Chinese
 }
 
 // CreateStoryResponse represents a story creation response
@@ -99,6 +164,7 @@ type CreateStoryResponse struct {
 type ContinueStoryRequest struct {
 	StoryID string `json:"story_id"`
 	Action  string `json:"action"`
+	UserID  string `json:"user_id,omitempty"` // Who acted, for per-user rate limits
 }
 
 // SelectOptionRequest represents an option selection request
@@ -106,6 +172,24 @@ type SelectOptionRequest struct {
 	StoryID    string `json:"story_id"`
 	OptionID   string `json:"option_id"`
 	ChoiceText string `json:"choice_text"`
+	UserID     string `json:"user_id,omitempty"`  // Who chose, for the decision history
+	Username   string `json:"username,omitempty"`
+}
+
+// EndStoryRequest represents a request to end a story
+type EndStoryRequest struct {
+	StoryID string `json:"story_id"`
+	Save    bool   `json:"save"`
+}
+
+// EndStoryResponse represents the final state of an ended story
+type EndStoryResponse struct {
+	Success bool   `json:"success"`
+	StoryID string `json:"story_id,omitempty"`
+	Summary string `json:"summary,omitempty"`
+	Scene   string `json:"scene,omitempty"`
+	Saved   bool   `json:"saved"`
+	Error   string `json:"error,omitempty"`
 }
 
 // CreateStory creates a new story
@@ -140,11 +224,16 @@ func (h *StoryHandlers) CreateStory(w http.ResponseWriter, r *http.Request) {
 		"tone":        req.Tone,
 		"style":       req.Style,
 		"protagonist": req.Protagonist,
+		"language":    req.Language,
 	}
 
 	_, err := h.storyEngine.CreateStory(r.Context(), storyID, settings)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, engine.ErrUnsupportedLanguage) {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(CreateStoryResponse{
 			Success: false,
 			Error:   err.Error(),
@@ -190,6 +279,10 @@ func (h *StoryHandlers) ContinueStory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.allowAction(w, r, req.StoryID, req.UserID) {
+		return
+	}
+
 	// Convert action to rag.Memory format
 	inputMemory := rag.Memory{
 		ID:        rag.BuildMemoryID(rag.MemoryTypePlayerAction, req.StoryID),
@@ -218,10 +311,11 @@ func (h *StoryHandlers) ContinueStory(w http.ResponseWriter, r *http.Request) {
 
 	// Generate audio for the story text (async to avoid blocking)
 	// Audio is cached by the engine, so subsequent requests will be fast
+	audioCtx := logging.Detach(r.Context(), "audio")
 	go func() {
-		_, err := h.storyEngine.GenerateAudio(r.Context(), response.Text, "")
+		_, err := h.storyEngine.GenerateAudio(audioCtx, response.AudioPrompt.Text, response.AudioPrompt.VoiceID, response.AudioPrompt.Language)
 		if err != nil {
-			log.Printf("Failed to generate audio: %v", err)
+			storyLogger(audioCtx).Warn("failed to generate audio", "story_id", req.StoryID, "error", err)
 		}
 	}()
 
@@ -233,6 +327,9 @@ func (h *StoryHandlers) ContinueStory(w http.ResponseWriter, r *http.Request) {
 			State:   currentState,
 			Content: response.Text,
 			Options: response.Options,
+			Visual:  response.VisualPrompt,
+			Audio:   response.AudioPrompt,
+			Usage:   response.Usage,
 		},
 	})
 }
@@ -266,8 +363,13 @@ func (h *StoryHandlers) SelectOption(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.allowAction(w, r, req.StoryID, req.UserID) {
+		return
+	}
+
 	// Apply the selected option
-	response, err := h.storyEngine.ApplyOption(r.Context(), req.StoryID, req.OptionID, req.ChoiceText)
+	source := engine.DecisionSource{UserID: req.UserID, Username: req.Username}
+	response, err := h.storyEngine.ApplyOptionFrom(r.Context(), req.StoryID, req.OptionID, req.ChoiceText, source)
 	if err != nil {
 		log.Printf("SelectOption: ApplyOption failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -291,6 +393,7 @@ func (h *StoryHandlers) SelectOption(w http.ResponseWriter, r *http.Request) {
 				State:   nil,
 				Content: response.Text,
 				Options: response.Options,
+				Usage:   response.Usage,
 			},
 		})
 		return
@@ -300,10 +403,11 @@ func (h *StoryHandlers) SelectOption(w http.ResponseWriter, r *http.Request) {
 
 	// Generate audio for the story text (async to avoid blocking)
 	// Audio is cached by the engine, so subsequent requests will be fast
+	audioCtx := logging.Detach(r.Context(), "audio")
 	go func() {
-		_, err := h.storyEngine.GenerateAudio(r.Context(), response.Text, "")
+		_, err := h.storyEngine.GenerateAudio(audioCtx, response.AudioPrompt.Text, response.AudioPrompt.VoiceID, response.AudioPrompt.Language)
 		if err != nil {
-			log.Printf("Failed to generate audio: %v", err)
+			storyLogger(audioCtx).Warn("failed to generate audio", "story_id", req.StoryID, "error", err)
 		}
 	}()
 
@@ -315,6 +419,114 @@ func (h *StoryHandlers) SelectOption(w http.ResponseWriter, r *http.Request) {
 			State:   currentState,
 			Content: response.Text,
 			Options: response.Options,
+			Visual:  response.VisualPrompt,
+			Audio:   response.AudioPrompt,
+			Usage:   response.Usage,
+		},
+	})
+}
+
+// EndStory ends a story and returns its final summary
+func (h *StoryHandlers) EndStory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req EndStoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(EndStoryResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+		return
+	}
+
+	if h.storyEngine == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(EndStoryResponse{
+			Success: false,
+			Error:   "Story engine not initialized",
+		})
+		return
+	}
+
+	if req.StoryID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(EndStoryResponse{
+			Success: false,
+			Error:   "story_id is required",
+		})
+		return
+	}
+
+	finalState, err := h.storyEngine.EndStory(r.Context(), req.StoryID, req.Save)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, engine.ErrStoryNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(EndStoryResponse{
+			Success: false,
+			StoryID: req.StoryID,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(EndStoryResponse{
+		Success: true,
+		StoryID: req.StoryID,
+		Summary: finalState.Summary,
+		Scene:   finalState.CurrentScene,
+		Saved:   req.Save,
+	})
+}
+
+// UndoTurn handles POST /api/v1/story/{story_id}/undo, rolling the story back to before
+// its last turn and returning the restored state
+func (h *StoryHandlers) UndoTurn(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	storyID := chi.URLParam(r, "story_id")
+
+	if h.storyEngine == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(CreateStoryResponse{
+			Success: false,
+			Error:   "Story engine not initialized",
+		})
+		return
+	}
+
+	state, err := h.storyEngine.Rollback(r.Context(), storyID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := err.Error()
+		switch {
+		case errors.Is(err, engine.ErrStoryNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, engine.ErrNothingToUndo):
+			// Nothing changed; the story is already at its earliest kept turn
+			status = http.StatusConflict
+			message = "Nothing to undo: no earlier turn is kept for this story"
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(CreateStoryResponse{
+			Success: false,
+			Error:   message,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CreateStoryResponse{
+		Success: true,
+		Story: &engine.Story{
+			ID:      storyID,
+			State:   state,
+			Content: state.PreviousText,
+			Options: state.Options,
 		},
 	})
 }
@@ -360,6 +572,232 @@ func (h *StoryHandlers) GetStoryStatus(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// DecisionHistoryResponse lists a story's applied decisions oldest first
+type DecisionHistoryResponse struct {
+	Success   bool                   `json:"success"`
+	StoryID   string                 `json:"story_id"`
+	Decisions []models.StoryDecision `json:"decisions"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// GetDecisionHistory returns who chose what in a story, for replay and timeline views
+func (h *StoryHandlers) GetDecisionHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	storyID := chi.URLParam(r, "story_id")
+
+	if h.storyEngine == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(DecisionHistoryResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   "Story engine not initialized",
+		})
+		return
+	}
+
+	decisions, err := h.storyEngine.GetDecisionHistory(r.Context(), storyID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(DecisionHistoryResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(DecisionHistoryResponse{
+		Success:   true,
+		StoryID:   storyID,
+		Decisions: decisions,
+	})
+}
+
+// NPCListResponse lists the NPCs tracked for a story
+type NPCListResponse struct {
+	Success bool                    `json:"success"`
+	StoryID string                  `json:"story_id"`
+	NPCs    []*interfaces.Character `json:"npcs"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// GetNPCs returns the characters the engine has picked up from a story's text
+func (h *StoryHandlers) GetNPCs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	storyID := chi.URLParam(r, "story_id")
+
+	if h.storyEngine == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(NPCListResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   "Story engine not initialized",
+		})
+		return
+	}
+
+	npcs, err := h.storyEngine.GetNPCs(storyID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, engine.ErrStoryNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(NPCListResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(NPCListResponse{
+		Success: true,
+		StoryID: storyID,
+		NPCs:    npcs,
+	})
+}
+
+// StoryHistoryResponse is a page of a story's narrative, oldest segment first
+type StoryHistoryResponse struct {
+	Success  bool                  `json:"success"`
+	StoryID  string                `json:"story_id"`
+	Total    int                   `json:"total"`  // Segments kept for the story
+	Offset   int                   `json:"offset"` // Index of the first returned segment
+	Segments []engine.StorySegment `json:"segments"`
+	Error    string                `json:"error,omitempty"`
+}
+
+// History page sizes for GET /story/{story_id}/history
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// GetStoryHistory handles GET /api/v1/story/{story_id}/history?offset=&limit=, returning
+// the narrative so far so a late-joining viewer can catch up
+func (h *StoryHandlers) GetStoryHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	storyID := chi.URLParam(r, "story_id")
+
+	if h.storyEngine == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(StoryHistoryResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   "Story engine not initialized",
+		})
+		return
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err == nil && offset < 0 {
+		err = fmt.Errorf("offset must not be negative")
+	}
+	limit := defaultHistoryLimit
+	if err == nil {
+		limit, err = queryInt(r, "limit", defaultHistoryLimit)
+	}
+	if err == nil && (limit < 1 || limit > maxHistoryLimit) {
+		err = fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(StoryHistoryResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	segments, total, err := h.storyEngine.GetStoryHistory(storyID, offset, limit)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, engine.ErrStoryNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(StoryHistoryResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(StoryHistoryResponse{
+		Success:  true,
+		StoryID:  storyID,
+		Total:    total,
+		Offset:   offset,
+		Segments: segments,
+	})
+}
+
+// ExportStory handles GET /api/v1/story/{story_id}/export?format=md|json, returning the
+// story so far as a downloadable document
+func (h *StoryHandlers) ExportStory(w http.ResponseWriter, r *http.Request) {
+	storyID := chi.URLParam(r, "story_id")
+
+	if h.storyEngine == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(CreateStoryResponse{
+			Success: false,
+			Error:   "Story engine not initialized",
+		})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = engine.ExportMarkdown
+	}
+
+	data, contentType, err := h.storyEngine.Export(r.Context(), storyID, format)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, engine.ErrStoryNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, engine.ErrUnsupportedExportFormat):
+			status = http.StatusBadRequest
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(CreateStoryResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", storyID+"."+format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// queryInt parses an integer query parameter, returning def when it is absent
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	return n, nil
+}
+
 // GenerateAudio generates audio for given text
 func (h *StoryHandlers) GenerateAudio(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -393,7 +831,7 @@ func (h *StoryHandlers) GenerateAudio(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate audio
-	audioData, err := h.storyEngine.GenerateAudio(r.Context(), req.Text, req.VoiceID)
+	audioData, err := h.storyEngine.GenerateAudio(r.Context(), req.Text, req.VoiceID, req.Language)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(GenerateAudioResponse{
@@ -410,41 +848,86 @@ func (h *StoryHandlers) GenerateAudio(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(GenerateAudioResponse{
 		Success:     true,
 		AudioBase64: audioBase64,
+		AudioKey:    h.storyEngine.AudioCacheKey(req.Text, req.VoiceID, req.Language),
 	})
 }
 
-// GenerateImage generates an image from prompt
-func (h *StoryHandlers) GenerateImage(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// StreamAudio serves raw audio bytes with range support.
+// Clips are looked up by ?key=, or by ?text=&voice_id=&language= and generated on a cache miss.
+func (h *StoryHandlers) StreamAudio(w http.ResponseWriter, r *http.Request) {
+	if h.storyEngine == nil {
+		http.Error(w, "Story engine not initialized", http.StatusServiceUnavailable)
+		return
+	}
 
-	var req GenerateImageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(GenerateImageResponse{
-			Success: false,
-			Error:   "Invalid request body",
-		})
+	key := r.URL.Query().Get("key")
+	text := r.URL.Query().Get("text")
+	voiceID := r.URL.Query().Get("voice_id")
+	language := r.URL.Query().Get("language")
+
+	if key == "" && text == "" {
+		http.Error(w, "key or text is required", http.StatusBadRequest)
 		return
 	}
+	if key == "" {
+		key = h.storyEngine.AudioCacheKey(text, voiceID, language)
+	}
 
-	if h.comfyClient == nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(GenerateImageResponse{
-			Success: false,
-			Error:   "ComfyUI client not initialized",
-		})
+	// Stream from the cached file on disk when available
+	if entry, err := h.storyEngine.GetCachedAudio(key); err == nil {
+		if served := serveAudioFile(w, r, entry); served {
+			return
+		}
+		storyLogger(r.Context()).Warn("cached audio unreadable, falling back", "key", key)
+	}
+
+	if text == "" {
+		http.Error(w, "audio not found", http.StatusNotFound)
 		return
 	}
 
-	if req.Prompt == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(GenerateImageResponse{
-			Success: false,
-			Error:   "Prompt is required",
-		})
+	audioData, err := h.storyEngine.GenerateAudio(r.Context(), text, voiceID, language)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", audioContentType(generators.GetAudioFormat(audioData)))
+	http.ServeContent(w, r, key+".wav", time.Now(), bytes.NewReader(audioData))
+}
+
+// serveAudioFile streams a cached clip from disk, reporting whether it was served
+func serveAudioFile(w http.ResponseWriter, r *http.Request, entry *generators.AudioCacheEntry) bool {
+	file, err := os.Open(entry.FilePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	w.Header().Set("Content-Type", audioContentType(entry.Format))
+	http.ServeContent(w, r, filepath.Base(entry.FilePath), info.ModTime(), file)
+	return true
+}
+
+// audioContentType maps an audio format to its MIME type
+func audioContentType(format string) string {
+	switch format {
+	case "mp3":
+		return "audio/mpeg"
+	case "ogg":
+		return "audio/ogg"
+	default:
+		return "audio/wav"
+	}
+}
+
+// imageOptions builds the generation options and cache key for an image request
+func (h *StoryHandlers) imageOptions(req *GenerateImageRequest) (*generators.GenerateOptions, string) {
 	// Build options
 	modelName := req.Model
 	if modelName == "" {
@@ -462,24 +945,61 @@ func (h *StoryHandlers) GenerateImage(w http.ResponseWriter, r *http.Request) {
 		Scheduler:     "normal",
 	}
 
-	// Check cache first
+	// Keep the protagonist consistent across scenes
+	if req.StoryID != "" && h.storyEngine != nil {
+		if lora, ok := h.storyEngine.CharacterLoRA(req.StoryID); ok {
+			opts.Lora = lora.Name
+			opts.LoraStrength = lora.Strength
+		}
+	}
+
+	// Scene images are reused whenever the story returns to the scene
 	cacheKey := generators.GenerateCacheKey(req.Prompt, opts)
-	imageData, err := h.imageCache.Get(r.Context(), cacheKey)
-	if err == nil {
-		// Cache hit
-		imageBase64 := base64.StdEncoding.EncodeToString(imageData)
-		w.WriteHeader(http.StatusOK)
+	if req.SceneKey != "" {
+		cacheKey = generators.GenerateCacheKey("scene:"+req.SceneKey, opts)
+	}
+	return opts, cacheKey
+}
+
+// GenerateImage generates an image from prompt
+func (h *StoryHandlers) GenerateImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req GenerateImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(GenerateImageResponse{
-			Success:     true,
-			ImageBase64: imageBase64,
+			Success: false,
+			Error:   "Invalid request body",
 		})
 		return
 	}
 
-	// Cache miss - generate new image
-	result, err := h.comfyClient.GenerateImage(r.Context(), opts)
+	if h.images == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(GenerateImageResponse{
+			Success: false,
+			Error:   "ComfyUI client not initialized",
+		})
+		return
+	}
+
+	if req.Prompt == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GenerateImageResponse{
+			Success: false,
+			Error:   "Prompt is required",
+		})
+		return
+	}
+
+	imageData, cacheKey, err := h.renderImage(r.Context(), &req)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, generators.ErrQueueFull) {
+			status = http.StatusServiceUnavailable
+		}
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(GenerateImageResponse{
 			Success: false,
 			Error:   err.Error(),
@@ -487,56 +1007,144 @@ func (h *StoryHandlers) GenerateImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store in cache (async)
-	go func() {
-		_ = h.imageCache.Put(context.Background(), cacheKey, result.ImageData, req.Prompt, opts)
-	}()
+	// Return result; the base64 form is only needed when asked for or when there is no URL
+	resp := GenerateImageResponse{Success: true}
+	if cacheKey != "" {
+		resp.ImageURL = imageURL(cacheKey)
+	}
+	if req.Inline || cacheKey == "" {
+		resp.ImageBase64 = base64.StdEncoding.EncodeToString(imageData)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ServeImage serves a cached image by its cache key. The key names the content, so it
+// doubles as the ETag and unchanged images revalidate without a body.
+func (h *StoryHandlers) ServeImage(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	etag := `"` + key + `"`
+	if !h.imageCache.Check(key) {
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
-	// Return result
-	imageBase64 := base64.StdEncoding.EncodeToString(result.ImageData)
+	imageData, err := h.imageCache.Get(r.Context(), key)
+	if err != nil {
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(imageData)))
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(GenerateImageResponse{
-		Success:     true,
-		ImageBase64: imageBase64,
-	})
+	_, _ = w.Write(imageData)
 }
 
-// GetVoices returns all available voices
-func (h *StoryHandlers) GetVoices(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// renderImage returns the image for req and the cache key serving it, generating it
+// through the queue on a miss so concurrent requests share the GPU workers. The key is
+// empty when a new image could not be cached.
+func (h *StoryHandlers) renderImage(ctx context.Context, req *GenerateImageRequest) ([]byte, string, error) {
+	// Check cache first
+	opts, cacheKey := h.imageOptions(req)
+	imageData, err := h.imageCache.Get(ctx, cacheKey)
+	if err == nil {
+		return imageData, cacheKey, nil
+	}
+	if errors.Is(err, generators.ErrCachedFailure) {
+		// The same request failed moments ago; don't tie up the GPU retrying it
+		return nil, "", err
+	}
+
+	result, err := h.imageQueue.EnqueueWithWait(ctx, &generators.QueueRequest{
+		ID:        fmt.Sprintf("img_%d", time.Now().UnixNano()),
+		Options:   opts,
+		CreatedAt: time.Now(),
+	})
+	if err == nil {
+		err = result.Error
+	}
+	if err != nil {
+		if generators.ShouldCacheFailure(err) {
+			h.imageCache.PutNegative(cacheKey, err, generators.DefaultNegativeTTL)
+		}
+		return nil, "", err
+	}
 
-	// Get voice registry from story engine
-	voices := h.storyEngine.GetAvailableVoices()
-	defaultVoice, err := h.storyEngine.GetDefaultVoice()
+	// Store before returning so the image URL resolves as soon as the client sees it
+	if err := h.imageCache.Put(ctx, cacheKey, result.ImageData, req.Prompt, opts); err != nil {
+		storyLogger(ctx).Warn("failed to cache image", "key", cacheKey, "error", err)
+		return result.ImageData, "", nil
+	}
+
+	return result.ImageData, cacheKey, nil
+}
+
+// RenderSceneImage renders the image for a story segment's visual spec, sharing the
+// cache and queue with /image/generate, and returns the URL serving it
+func (h *StoryHandlers) RenderSceneImage(ctx context.Context, storyID string, spec *engine.VisualSpec) (string, error) {
+	if h.images == nil {
+		return "", fmt.Errorf("ComfyUI client not initialized")
+	}
+	_, cacheKey, err := h.renderImage(ctx, &GenerateImageRequest{
+		Prompt:         spec.Prompt,
+		NegativePrompt: spec.Negative,
+		StoryID:        storyID,
+		SceneKey:       spec.SceneKey,
+	})
 	if err != nil {
-		// No default set, continue
+		return "", err
+	}
+	if cacheKey == "" {
+		return "", fmt.Errorf("scene image could not be cached")
 	}
+	return imageURL(cacheKey), nil
+}
 
+// ImageQueueStatusResponse represents the image generation queue status
+type ImageQueueStatusResponse struct {
+	QueueSize int `json:"queue_size"`
+	Workers   int `json:"workers"`
+}
+
+// GetImageQueueStatus returns how many image requests are waiting for a worker
+func (h *StoryHandlers) GetImageQueueStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(GetVoicesResponse{
-		Success: true,
-		Voices:  voices,
-		Default: defaultVoice,
+	json.NewEncoder(w).Encode(ImageQueueStatusResponse{
+		QueueSize: h.imageQueue.GetQueueSize(),
+		Workers:   h.imageQueue.GetWorkerCount(),
 	})
 }
 
-// SetDefaultVoice sets the default voice
-func (h *StoryHandlers) SetDefaultVoice(w http.ResponseWriter, r *http.Request) {
+// GetGLMStats returns GLM request concurrency and limits for tuning
+func (h *StoryHandlers) GetGLMStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.storyEngine.GLMStats())
+}
 
-	var req SetDefaultVoiceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(GetVoicesResponse{
-			Success: false,
-			Error:   "Invalid request body",
-		})
-		return
-	}
+// ReloadTemplatesResponse reports a prompt template reload
+type ReloadTemplatesResponse struct {
+	Success bool   `json:"success"`
+	Changed int    `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
 
-	if err := h.storyEngine.SetDefaultVoice(req.VoiceID); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(GetVoicesResponse{
+// ReloadTemplates re-reads the prompt template dir without waiting for the watcher
+func (h *StoryHandlers) ReloadTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	changed, err := h.storyEngine.ReloadTemplates()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ReloadTemplatesResponse{
 			Success: false,
 			Error:   err.Error(),
 		})
@@ -544,7 +1152,8 @@ func (h *StoryHandlers) SetDefaultVoice(w http.ResponseWriter, r *http.Request)
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(GetVoicesResponse{
+	json.NewEncoder(w).Encode(ReloadTemplatesResponse{
 		Success: true,
+		Changed: changed,
 	})
 }
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"Cyber-Jianghu/server/internal/engine"
+	"Cyber-Jianghu/server/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// timelineSummaryRunes is how much of the resulting narrative a timeline event keeps
+	timelineSummaryRunes = 120
+	timelineWriteTimeout = 2 * time.Second
+)
+
+// recordTimeline appends an audience decision and the segment it produced to the story's
+// timeline. Failures are logged; the timeline is a recap aid and never blocks the story.
+func recordTimeline(store *storage.RedisStore, logger *slog.Logger, storyEngine *engine.StoryEngine, storyID string, event storage.TimelineEvent, response *engine.StoryResponse) {
+	if store == nil {
+		return
+	}
+
+	event.Timestamp = time.Now().Unix()
+	if response != nil {
+		event.Summary = truncateSummary(response.Text, timelineSummaryRunes)
+	}
+	if state, err := storyEngine.GetStoryState(storyID); err == nil {
+		event.Turn = state.Turn
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timelineWriteTimeout)
+	defer cancel()
+	if err := store.AppendTimelineEvent(ctx, storyID, event); err != nil {
+		logger.Warn("failed to record timeline event", "story_id", storyID, "source", event.Source, "error", err)
+	}
+}
+
+// truncateSummary shortens s to at most n runes
+func truncateSummary(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+// TimelineResponse lists what the audience decided for a story, oldest first
+type TimelineResponse struct {
+	Success bool                    `json:"success"`
+	StoryID string                  `json:"story_id"`
+	Events  []storage.TimelineEvent `json:"events,omitempty"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// SetTimeline sets the store the story timeline is read from; nil disables the endpoint
+func (h *StoryHandlers) SetTimeline(store *storage.RedisStore) {
+	h.timeline = store
+}
+
+// GetTimeline handles GET /api/v1/story/{story_id}/timeline
+func (h *StoryHandlers) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	storyID := chi.URLParam(r, "story_id")
+
+	if h.timeline == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(TimelineResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   "Timeline requires Redis",
+		})
+		return
+	}
+
+	events, err := h.timeline.GetTimeline(r.Context(), storyID)
+	if err != nil {
+		storyLogger(r.Context()).Error("failed to read timeline", "story_id", storyID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TimelineResponse{
+			Success: false,
+			StoryID: storyID,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TimelineResponse{
+		Success: true,
+		StoryID: storyID,
+		Events:  events,
+	})
+}
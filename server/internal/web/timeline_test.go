@@ -0,0 +1,117 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"Cyber-Jianghu/server/internal/config"
+	"Cyber-Jianghu/server/internal/engine"
+	"Cyber-Jianghu/server/internal/rag"
+	"Cyber-Jianghu/server/internal/storage"
+)
+
+// startRejectingRedis starts a fake Redis that answers PING and rejects every other
+// command, and returns a store connected to it
+func startRejectingRedis(t *testing.T) *storage.RedisStore {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveRejectingRedis(conn)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	store, err := storage.NewRedisStore(config.RedisConfig{Host: addr.IP.String(), Port: addr.Port})
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// serveRejectingRedis reads RESP commands from conn until it closes
+func serveRejectingRedis(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		reply := "-ERR unavailable\r\n"
+		if len(args) > 0 && strings.EqualFold(args[0], "PING") {
+			reply = "+PONG\r\n"
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readRESPCommand reads one command sent as an array of bulk strings
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func TestRecordTimelineLogsFailedWrite(t *testing.T) {
+	store := startRejectingRedis(t)
+	storyEngine := engine.NewStoryEngine("", rag.NewInMemoryVectorStore(64), t.TempDir(), "", config.GLM5Config{})
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	recordTimeline(store, logger, storyEngine, "s1", storage.TimelineEvent{Source: "vote", OptionID: "A"}, nil)
+
+	want := `level=WARN msg="failed to record timeline event" story_id=s1 source=vote error=`
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("logs missing %q:\n%s", want, logs.String())
+	}
+}
+
+func TestRecordTimelineWithoutStore(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	recordTimeline(nil, logger, nil, "s1", storage.TimelineEvent{Source: "vote"}, nil)
+	if logs.Len() != 0 {
+		t.Errorf("a disabled timeline logged:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"Cyber-Jianghu/server/internal/generators"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// VoiceHandlers exposes the voice registry over HTTP
+type VoiceHandlers struct {
+	registry *generators.VoiceRegistry
+}
+
+// NewVoiceHandlers creates voice handlers; a nil registry makes every route return 503
+func NewVoiceHandlers(registry *generators.VoiceRegistry) *VoiceHandlers {
+	return &VoiceHandlers{registry: registry}
+}
+
+// VoiceResponse represents the response for a single voice
+type VoiceResponse struct {
+	Success bool                   `json:"success"`
+	Voice   *generators.VoiceModel `json:"voice,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// ListVoices returns all registered voices and the current default
+func (h *VoiceHandlers) ListVoices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.ready(w) {
+		return
+	}
+
+	defaultVoice, _ := h.registry.GetDefaultVoice()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(GetVoicesResponse{
+		Success: true,
+		Voices:  h.registry.ListVoices(),
+		Default: defaultVoice,
+	})
+}
+
+// VoiceReloadResponse represents the response for rescanning the voice directory
+type VoiceReloadResponse struct {
+	Success bool                   `json:"success"`
+	Stats   *generators.VoiceStats `json:"stats,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// ReloadVoices rescans the voice directory for reference clips
+func (h *VoiceHandlers) ReloadVoices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.ready(w) {
+		return
+	}
+
+	if _, err := h.registry.Reload(r.Context()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(VoiceReloadResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(VoiceReloadResponse{
+		Success: true,
+		Stats:   h.registry.GetStats(),
+	})
+}
+
+// EnableVoice enables a voice
+func (h *VoiceHandlers) EnableVoice(w http.ResponseWriter, r *http.Request) {
+	h.updateVoice(w, r, h.registry.EnableVoice)
+}
+
+// DisableVoice disables a voice
+func (h *VoiceHandlers) DisableVoice(w http.ResponseWriter, r *http.Request) {
+	h.updateVoice(w, r, h.registry.DisableVoice)
+}
+
+// SetDefaultVoice makes a voice the default narration voice
+func (h *VoiceHandlers) SetDefaultVoice(w http.ResponseWriter, r *http.Request) {
+	h.updateVoice(w, r, h.registry.SetDefault)
+}
+
+// updateVoice applies a change to the voice named in the URL and returns the updated voice
+func (h *VoiceHandlers) updateVoice(w http.ResponseWriter, r *http.Request, update func(id string) error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.ready(w) {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if _, err := h.registry.GetVoice(id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(VoiceResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := update(id); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(VoiceResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	voice, _ := h.registry.GetVoice(id)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(VoiceResponse{
+		Success: true,
+		Voice:   voice,
+	})
+}
+
+// ready writes a 503 and returns false when no registry is configured
+func (h *VoiceHandlers) ready(w http.ResponseWriter) bool {
+	if h.registry != nil {
+		return true
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Voice registry not initialized"})
+	return false
+}
@@ -0,0 +1,246 @@
+package web
+
+import (
+	"Cyber-Jianghu/server/internal/engine"
+	"Cyber-Jianghu/server/internal/storage"
+	"context"
+	"log"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultVoteWindow = 30 * time.Second
+
+// VoteTally counts danmaku votes for the active story's options and applies the winner
+// when the voting window closes
+type VoteTally struct {
+	storyEngine *engine.StoryEngine
+	hub         *DanmakuHub
+	window      time.Duration
+	timeline    *storage.RedisStore // Records each round's outcome; nil disables it
+	logger      *slog.Logger
+
+	mu      sync.Mutex
+	storyID string
+	votes   map[string]float64 // Option ID -> weighted count
+	voters  map[string]bool    // Users who voted this round
+	timer   *time.Timer
+}
+
+// NewVoteTally creates a vote tally; a non-positive window uses the 30 second default
+func NewVoteTally(storyEngine *engine.StoryEngine, hub *DanmakuHub, window time.Duration) *VoteTally {
+	if window <= 0 {
+		window = defaultVoteWindow
+	}
+	return &VoteTally{
+		storyEngine: storyEngine,
+		hub:         hub,
+		window:      window,
+		logger:      slog.Default().With("component", "votes"),
+		votes:       make(map[string]float64),
+		voters:      make(map[string]bool),
+	}
+}
+
+// SetTimeline sets the store each round's tallies and winner are recorded to
+func (t *VoteTally) SetTimeline(store *storage.RedisStore) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timeline = store
+}
+
+// SetLogger sets the structured logger
+func (t *VoteTally) SetLogger(logger *slog.Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logger = logger.With("component", "votes")
+}
+
+// SetStory sets the story that votes apply to and discards the current round
+func (t *VoteTally) SetStory(storyID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.storyID = storyID
+	t.resetLocked()
+}
+
+// Vote records a vote for an option, given by option ID or 1-based position.
+// Votes without a user ID, for options that don't exist and repeat votes from the same
+// user are ignored. The weight scales the vote, e.g. for gifters; non-positive weights
+// count as one.
+func (t *VoteTally) Vote(userID string, voteID string, weight float64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Anonymous votes can't be deduplicated, so one viewer could sway the round
+	if userID == "" || t.storyID == "" || t.storyEngine == nil {
+		return false
+	}
+
+	state, err := t.storyEngine.GetStoryState(t.storyID)
+	if err != nil {
+		return false
+	}
+
+	option := resolveVoteOption(state.Options, voteID)
+	if option == nil {
+		return false
+	}
+
+	if t.voters[userID] {
+		return false
+	}
+	t.voters[userID] = true
+
+	if weight <= 0 {
+		weight = 1
+	}
+	t.votes[option.ID] += weight
+
+	// The first vote opens the window
+	if t.timer == nil {
+		storyID := t.storyID
+		t.timer = time.AfterFunc(t.window, func() {
+			t.closeRound(storyID)
+		})
+	}
+
+	t.broadcastLocked("vote_tally", nil)
+	return true
+}
+
+// Tallies returns a copy of the current weighted vote counts
+func (t *VoteTally) Tallies() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tallies := make(map[string]float64, len(t.votes))
+	for id, count := range t.votes {
+		tallies[id] = count
+	}
+	return tallies
+}
+
+// closeRound picks the winning option and applies it to the story
+func (t *VoteTally) closeRound(storyID string) {
+	t.mu.Lock()
+	if t.storyID != storyID || len(t.votes) == 0 {
+		t.mu.Unlock()
+		return
+	}
+
+	winnerID := pickWinner(t.votes)
+	state, err := t.storyEngine.GetStoryState(storyID)
+	if err != nil {
+		t.resetLocked()
+		t.mu.Unlock()
+		log.Printf("[VoteTally] Story %s no longer active: %v", storyID, err)
+		return
+	}
+	option := resolveVoteOption(state.Options, winnerID)
+
+	t.broadcastLocked("vote_result", map[string]interface{}{"winner": winnerID})
+	votes, voters, timeline, logger := t.votes, len(t.voters), t.timeline, t.logger
+	t.resetLocked()
+	t.mu.Unlock()
+
+	if option == nil {
+		return
+	}
+
+	log.Printf("[VoteTally] Option %s won for story %s", option.ID, storyID)
+	source := engine.DecisionSource{Action: "/vote"}
+	response, err := t.storyEngine.ApplyOptionFrom(context.Background(), storyID, option.ID, option.Text, source)
+	if err != nil {
+		log.Printf("[VoteTally] Failed to apply option %s: %v", option.ID, err)
+		return
+	}
+
+	if t.hub != nil {
+		t.hub.BroadcastStoryUpdate(storyID, response)
+	}
+
+	recordTimeline(timeline, logger, t.storyEngine, storyID, storage.TimelineEvent{
+		Source:   "vote",
+		OptionID: option.ID,
+		Choice:   option.Text,
+		Votes:    votes,
+		Voters:   voters,
+	}, response)
+}
+
+// resetLocked clears the current round; callers must hold t.mu
+func (t *VoteTally) resetLocked() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.votes = make(map[string]float64)
+	t.voters = make(map[string]bool)
+}
+
+// broadcastLocked sends the current tallies to websocket clients; callers must hold t.mu
+func (t *VoteTally) broadcastLocked(msgType string, extra map[string]interface{}) {
+	if t.hub == nil {
+		return
+	}
+
+	msg := map[string]interface{}{
+		"story_id": t.storyID,
+		"votes":    t.votes,
+	}
+	for k, v := range extra {
+		msg[k] = v
+	}
+	t.hub.BroadcastMessage(msgType, msg)
+}
+
+// resolveVoteOption finds an option by ID, falling back to its 1-based position
+func resolveVoteOption(options []engine.StoryOption, voteID string) *engine.StoryOption {
+	for i := range options {
+		if options[i].ID == voteID {
+			return &options[i]
+		}
+	}
+
+	if n, err := strconv.Atoi(voteID); err == nil && n >= 1 && n <= len(options) {
+		return &options[n-1]
+	}
+	return nil
+}
+
+// pickWinner returns the option with the most votes; ties go to the lowest option ID
+func pickWinner(votes map[string]float64) string {
+	ids := make([]string, 0, len(votes))
+	for id := range votes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return lessOptionID(ids[i], ids[j])
+	})
+
+	winner := ""
+	best := -1.0
+	for _, id := range ids {
+		if votes[id] > best {
+			winner = id
+			best = votes[id]
+		}
+	}
+	return winner
+}
+
+// lessOptionID orders option IDs numerically when both are integers, so "2" comes before
+// "10", and as strings otherwise
+func lessOptionID(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil && x != y {
+		return x < y
+	}
+	return a < b
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Cyber-Jianghu/server/internal/config"
+	"Cyber-Jianghu/server/internal/engine"
+	"Cyber-Jianghu/server/internal/rag"
+)
+
+func TestPickWinner(t *testing.T) {
+	tests := []struct {
+		name  string
+		votes map[string]float64
+		want  string
+	}{
+		{"most votes", map[string]float64{"A": 1, "B": 2.5, "C": 2}, "B"},
+		{"letter tie", map[string]float64{"B": 2, "A": 2}, "A"},
+		{"numeric tie", map[string]float64{"10": 3, "2": 3}, "2"},
+		{"numeric tie past nine", map[string]float64{"11": 1, "10": 1, "9": 1}, "9"},
+		{"numeric most votes", map[string]float64{"2": 1, "10": 4}, "10"},
+		{"mixed tie", map[string]float64{"B": 1, "2": 1}, "2"},
+	}
+	for _, tt := range tests {
+		if got := pickWinner(tt.votes); got != tt.want {
+			t.Errorf("%s: pickWinner(%v) = %q, want %q", tt.name, tt.votes, got, tt.want)
+		}
+	}
+}
+
+func TestVoteCountsEachUserOnce(t *testing.T) {
+	storyEngine := engine.NewStoryEngine("", rag.NewInMemoryVectorStore(64), t.TempDir(), "", config.GLM5Config{})
+	storyEngine.SetEmbedder(rag.NewHashEmbedder(64))
+	storyEngine.SetChatClient(&slowTranslationClient{})
+	if _, err := storyEngine.CreateStory(context.Background(), "vote", nil); err != nil {
+		t.Fatalf("CreateStory: %v", err)
+	}
+
+	tally := NewVoteTally(storyEngine, nil, time.Minute)
+	if tally.Vote("42", "A", 1) {
+		t.Error("a vote with no active story was counted")
+	}
+	tally.SetStory("vote")
+	// Discard the round so its timer never fires
+	defer tally.SetStory("")
+
+	votes := []struct {
+		user, option string
+		weight       float64
+		want         bool
+	}{
+		{"", "A", 1, false},   // Anonymous
+		{"42", "1", 0, true},  // By position; a zero weight counts as one
+		{"42", "B", 1, false}, // Repeat voter
+		{"7", "B", 2, true},
+		{"8", "C", 1, false}, // No such option
+	}
+	for _, v := range votes {
+		if got := tally.Vote(v.user, v.option, v.weight); got != v.want {
+			t.Errorf("Vote(%q, %q) = %v, want %v", v.user, v.option, got, v.want)
+		}
+	}
+
+	tallies := tally.Tallies()
+	if len(tallies) != 2 || tallies["A"] != 1 || tallies["B"] != 2 {
+		t.Errorf("tallies = %v, want A:1 B:2", tallies)
+	}
+}